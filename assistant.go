@@ -11,6 +11,7 @@ import (
 	"os"
 	"os/signal"   
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"   
 	"syscall"   
@@ -35,6 +36,7 @@ type AssistantAPI interface {
 	GetAPIKey() string
 	GetLastUserQuery() string
 	GetConfig() *Config
+	GetJournal() *Journal
 	SetModel(model string)
 	SetProvider(provider, model, apiKey string)
 	ProcessQuery(query string, autoMode bool)
@@ -62,9 +64,20 @@ type Assistant struct {
 	requestCtx       ctx.Context
 	requestCancel    ctx.CancelFunc
     ragData        []RAGDocument
+    ragIndex       *RAGIndex
+    ragVectors     []*VectorStore
+    embedCancel    ctx.CancelFunc // отменяет фоновое построение векторного индекса
+    ragCollections []string
+    ragTables      []*RAGTable
+    ragRefreshMu   sync.Mutex
+    ragWatcher     *RAGWatcher
     ragEnabled     bool
     ragMutex       sync.RWMutex
 	autoCopyEnabled bool
+	journal          *Journal
+	workspace        *Workspace
+	dryRun           *DryRun
+	autosaver        *Autosaver
 }
 
 // Добавляем структуру для RAG-документов:
@@ -73,6 +86,11 @@ type RAGDocument struct {
     Content     string
     Size        int
     LoadedAt    time.Time
+    Format      string   // расширение исходного файла: pdf, docx, html, md...
+    Language    string   // язык программирования для исходного кода
+    Warnings    []string // что не удалось извлечь из файла
+    Collection  string   // коллекция, из которой загружен документ
+    Hash        string   // sha256 исходного файла: по нему :data refresh находит изменения
 }
 
 // Добавляем методы для работы с RAG-данными:
@@ -84,16 +102,28 @@ func (a *Assistant) GetRAGData() []RAGDocument {
 
 func (a *Assistant) SetRAGData(docs []RAGDocument) {
     a.ragMutex.Lock()
-    defer a.ragMutex.Unlock()
     a.ragData = docs
+    a.ragTables = buildRAGTables(docs)
+    a.ragIndex = BuildRAGIndex(docs, tableDocIDs(a.ragTables))
+    a.ragVectors = nil
     a.ragEnabled = len(docs) > 0
+    a.ragMutex.Unlock()
+    
+    a.startEmbedding()
 }
 
 func (a *Assistant) ClearRAGData() {
     a.ragMutex.Lock()
     defer a.ragMutex.Unlock()
     a.ragData = []RAGDocument{}
+    a.ragIndex = nil
+    a.ragTables = nil
+    a.ragVectors = nil
     a.ragEnabled = false
+    if a.embedCancel != nil {
+        a.embedCancel()
+        a.embedCancel = nil
+    }
 }
 
 func (a *Assistant) IsRAGEnabled() bool {
@@ -102,39 +132,51 @@ func (a *Assistant) IsRAGEnabled() bool {
     return a.ragEnabled
 }
 
-func (a *Assistant) GetRAGContext() string {
+// GetRAGChunkCount возвращает число проиндексированных фрагментов
+func (a *Assistant) GetRAGChunkCount() int {
+    a.ragMutex.RLock()
+    defer a.ragMutex.RUnlock()
+    return a.ragIndex.ChunkCount()
+}
+
+// GetRAGContext собирает RAG-контекст из фрагментов, наиболее подходящих к запросу.
+// Возвращает также отобранные фрагменты для проверки ссылок в ответе
+func (a *Assistant) GetRAGContext(query string) (string, []RAGSource) {
+    queryVector := a.embedQuery(query)
+    
     a.ragMutex.RLock()
     defer a.ragMutex.RUnlock()
     
     if !a.ragEnabled || len(a.ragData) == 0 {
-        return ""
+        return "", nil
+    }
+    
+    // Таблицы описываются схемой и примерами строк: в индекс фрагментов они не входят
+    hits := a.ragIndex.Retrieve(query, queryVector, RAGTopK, RAGContextLimit)
+    if len(hits) == 0 && len(a.ragTables) == 0 {
+        return "", nil
     }
     
     var context strings.Builder
     context.WriteString("\n=== ИНФОРМАЦИЯ ИЗ ФАЙЛОВ ДАННЫХ (RAG) ===\n")
-    context.WriteString("Используй ТОЛЬКО эту информацию для ответа на вопросы:\n\n")
+    context.WriteString("Используй ТОЛЬКО эту информацию для ответа на вопросы.\n")
+    context.WriteString(fmt.Sprintf("Ниже %d фрагментов из %d документов, отобранных по запросу. ", 
+        len(hits), len(a.ragData)))
+    context.WriteString("Фрагмент помечен как [документ:фрагмент]:\n\n")
     
-    totalSize := 0
-    for i, doc := range a.ragData {
-        // Ограничиваем размер каждого документа для контекста
-        maxDocSize := 5000
-        content := doc.Content
-        if len(content) > maxDocSize {
-            content = content[:maxDocSize] + "... [обрезано]"
+    for _, hit := range hits {
+        chunk := hit.Chunk
+        name := filepath.Base(chunk.FilePath)
+        if isURLPath(chunk.FilePath) {
+            name = chunk.FilePath // у страниц сайта источник — адрес
         }
-        
-        context.WriteString(fmt.Sprintf("--- Документ %d: %s (%d символов) ---\n", 
-            i+1, filepath.Base(doc.FilePath), doc.Size))
-        context.WriteString(content)
-        context.WriteString("\n\n")
-        
-        totalSize += len(content)
-        
-        // Ограничиваем общий размер RAG-контекста
-        if totalSize > 15000 {
-            context.WriteString("...[остальные документы не помещаются в контекст]...\n")
-            break
+        if lang := a.ragData[chunk.DocID-1].Language; lang != "" {
+            name += " (" + lang + ")"
         }
+        context.WriteString(fmt.Sprintf("--- %s %s, строки %d-%d ---\n", 
+            chunk.Ref(), name, chunk.StartLine, chunk.EndLine))
+        context.WriteString(strings.TrimRight(chunk.Text, "\n"))
+        context.WriteString("\n\n")
     }
     
     context.WriteString("ИНСТРУКЦИИ:\n")
@@ -142,8 +184,13 @@ func (a *Assistant) GetRAGContext() string {
     context.WriteString("2. Не добавляй информацию из своих знаний\n")
     context.WriteString("3. Если данных недостаточно - честно скажи об этом\n")
     context.WriteString("4. Соотноси запрос пользователя с данными из файлов\n")
+    context.WriteString("5. После каждого утверждения указывай источник в формате [документ:фрагмент], например [1:2]\n")
+    context.WriteString("6. Ссылайся только на фрагменты, приведенные выше\n")
+    if len(a.ragTables) > 0 {
+        context.WriteString(describeTables(a.ragTables))
+    }
     
-    return context.String()
+    return context.String(), ragSourcesFromHits(hits)
 }
 
 // SetModel временно изменяет модель для текущей сессии
@@ -213,6 +260,10 @@ func (a *Assistant) GetLastUserQuery() string {
 	return a.lastUserQuery
 }
 
+func (a *Assistant) GetJournal() *Journal {
+	return a.journal
+}
+
 func (a *Assistant) GetConfig() *Config {
 	if a.commandHandler != nil {
 		return a.commandHandler.config
@@ -247,11 +298,20 @@ func NewAssistant(provider, model, apiKey string, webSearchEnabled bool) *Assist
 	}
 
 	stats := NewStatistics()
-	fileParser := NewFileParser()
+	workspace := NewWorkspace(config)
+	fileParser := NewFileParser(workspace)
 
 	// Создаем раннер с конфигом
 	codeRunner := NewCodeRunner(config)
 
+	// Один сборщик плана dry-run на все компоненты, которые пишут файлы и запускают команды
+	dryRun := NewDryRun(config)
+	codeRunner.dryRun = dryRun
+	installer := NewInstaller(terminalReader, config)
+	installer.dryRun = dryRun
+	diffProcessor := NewDiffProcessor(fileParser, terminalReader, config)
+	diffProcessor.dryRun = dryRun
+
 	// Синхронизируем context_limit при старте
 	contextManager := NewContextManager()
 	if limit := config.GetInt("context_limit", 10); limit > 0 {
@@ -268,18 +328,26 @@ func NewAssistant(provider, model, apiKey string, webSearchEnabled bool) *Assist
 		fileParser:       fileParser,
 		codeRunner:       codeRunner,
 		codeParser:       NewCodeParser(),
-		installer:        NewInstaller(terminalReader, config),
+		installer:        installer,
 		terminalReader:   terminalReader,
-        diffProcessor:    NewDiffProcessor(fileParser, terminalReader, config),
+        diffProcessor:    diffProcessor,
 		lastUserQuery:    "",
 		ragData:        []RAGDocument{},
 		ragEnabled:     false,
         // autoCopyEnabled: config.GetBool("auto_copy_responses", false),
 		autoCopyEnabled: false,
+		journal:          NewJournal(),
+		workspace:        workspace,
+		dryRun:           dryRun,
 	}
 	
 	// Теперь создаем CommandHandler с Assistant как AssistantAPI
 	assistant.commandHandler = NewCommandHandler(assistant, config, stats, terminalReader)
+	sessionCrypto.Configure(config, terminalReader)
+	assistant.restoreRAGCollections()
+	if config.GetBool("rag_watch") {
+		assistant.StartRAGWatch(ragWatchInterval(config))
+	}
 
 	// После создания commandHandler устанавливаем правильное значение
 	assistant.autoCopyEnabled = assistant.getConfigBoolSafe("auto_copy_responses", false)
@@ -395,7 +463,7 @@ func (a *Assistant) RunInteractive() {
 	fmt.Println("Для завершения сессии введите 'quit', 'exit' или 'bye'")
 	fmt.Println("Используйте: \n\t@имя_файла для ссылки, \n\t@all для всех файлов, \n\t@http://... для веб-страни, \n\t$int для открытия в браузере, \n\t$diff применить частичные изменения к файлам, \n\t$cod работа с кодом программ, \n\t:help посмотреть возможности программы")
 	fmt.Println("Нажмите Ctrl+C для отмены текущего запроса или Ctrl+D для завершения сессии")
-	fmt.Println("\n")
+	fmt.Print("\n\n")
 
     // Добавляем информацию об авто-копировании
     if a.autoCopyEnabled {
@@ -405,21 +473,18 @@ func (a *Assistant) RunInteractive() {
     }
     
     fmt.Println("Нажмите Ctrl+C для отмены текущего запроса или Ctrl+D для завершения сессии")
-    fmt.Println("\n")
+    fmt.Print("\n\n")
 	
 	// Настраиваем автодополнение
-	commands := []string{
-		":clean", ":pop", ":ctx", ":limit", ":summarize",
-		":save", ":load", ":ls", ":rm", ":export", ":sh",
-		":clip", ":clip+", ":cd", ":pwd", ":open", ":dir",
-		":debug", ":stats", ":retry", ":models", ":model", ":providers", ":provider",
-		":set", ":get", ":reset", ":quit", ":help", ":history", ":skip", ":data",
-		":copi",
-	}
-	a.terminalReader.SetCompleter(commands)
+	a.terminalReader.SetCompleter(completionCommands)
 
 	defer a.terminalReader.Close()
 
+	// Автосохранение и восстановление после аварийного завершения
+	a.startAutosave(true)
+	defer a.stopAutosave()
+	defer a.codeRunner.StopServers()
+
 	// Настраиваем перехват сигналов Ctrl+C
     sigChan := make(chan os.Signal, 1)
     signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
@@ -562,12 +627,15 @@ func (a *Assistant) ProcessQuery(query string, autoMode bool) {
     context := a.buildContext(refs, hasRefs)
 
    // ДОБАВЛЯЕМ RAG-КОНТЕКСТ если включен
+    var ragSources []RAGSource
     if a.IsRAGEnabled() {
-        ragContext := a.GetRAGContext()
+        var ragContext string
+        ragContext, ragSources = a.GetRAGContext(query)
         if ragContext != "" {
             context += ragContext
             if a.isDebugMode() {
-                fmt.Printf("🔍 RAG-режим активен (%d документов)\n", len(a.ragData))
+                fmt.Printf("🔍 RAG-режим активен (%d документов, %d фрагментов)\n", 
+                    len(a.GetRAGData()), a.GetRAGChunkCount())
             }
         }
     }
@@ -618,20 +686,43 @@ func (a *Assistant) ProcessQuery(query string, autoMode bool) {
         return
     }
     
+    // Модель запросила вычисление по таблицам: выполняем локально и просим окончательный ответ
+    response, err = a.answerTableQueries(a.requestCtx, prompt, response, func(c ctx.Context, p string) (string, error) {
+        return a.sendWithStats(c, p, a.provider, a.model, a.apiKey, "llm")
+    }, true)
+    if err != nil {
+        if errors.Is(err, ctx.Canceled) {
+            fmt.Println("🤖 Запрос отменен пользователем")
+            return
+        }
+        fmt.Printf("❌ Ошибка LLM: %v\n", err)
+        return
+    }
+    
 	// Обрабатываем ответ
     a.handleResponseWithCommandType(response, autoMode, isTextRequest, isCodeCmd)
 	// a.handleResponse(response, autoMode, isTextRequest)
 	
+	// Источники RAG: проверяем ссылки [документ:фрагмент] в ответе
+	if len(ragSources) > 0 {
+		fmt.Print(FormatSourcesFooter(CheckCitations(response, ragSources)))
+	}
+	
 	// Обновляем контекст беседы
 	a.context.AddExchange(query, response)
+	a.maybeAutoSummarize(a.requestCtx)
+	a.autosave()
 }
 
 // handleResponseWithCommandType обрабатывает ответ с учетом типа команды
 func (a *Assistant) handleResponseWithCommandType(response string, autoMode bool, isTextRequest bool, isCodeCommand bool) {
-    fmt.Println("\n🤖 Ассистент:\n")
+    fmt.Print("\n🤖 Ассистент:\n\n")
 
     // 🆕 Проверяем, это кодогенерация или обычный ответ
     files := a.codeParser.ParseCodeBlocks(response)
+    if len(files) == 0 && isCodeCommand {
+        files = a.codeParser.ParseGeneratedCode(response)
+    }
     
     if len(files) > 0 {
         // Это кодогенерация - работаем как раньше
@@ -680,6 +771,8 @@ func (a *Assistant) handleDiffRequest(query string, autoMode bool) {
 	
 	a.handleDiffResponse(response, autoMode)
 	a.context.AddExchange(query, response)
+	a.maybeAutoSummarize(a.requestCtx)
+	a.autosave()
 }
 
 func (a *Assistant) buildDiffContext(files []string) string {
@@ -781,6 +874,23 @@ func (a *Assistant) handleDiffResponse(response string, autoMode bool) {
         }
     }
     
+    // Незакоммиченные изменения и рабочая ветка git (git_auto_commit, git_branch)
+    paths := make([]string, 0, len(fileGroups))
+    for filePath := range fileGroups {
+        paths = append(paths, filePath)
+    }
+    sort.Strings(paths)
+    
+    // Dry-run: без подтверждения и записи — только план
+    if a.dryRun.Enabled() {
+        a.planDiffApplication(blocks, compileInfoMap, paths)
+        return
+    }
+    
+    if !a.gitBeforeApply(paths, autoMode) {
+        return
+    }
+    
     // Запрашиваем подтверждение только если не в autoMode
     if !autoMode {
         // Первоначальный запрос - без переноса строки в начале
@@ -841,6 +951,20 @@ func (a *Assistant) handleDiffResponse(response string, autoMode bool) {
     default:
     }
 
+    if !a.gitUseWorkBranch() {
+        return
+    }
+
+    // Записываем операцию в журнал для :undo
+    op := a.journal.Begin("DIFF", nil)
+    for _, filePath := range paths {
+        op.TrackFile(filePath)
+        op.Label += " " + filePath
+    }
+    defer op.Commit()
+    // Коммит после проверки и исправлений кода
+    defer a.gitAutoCommit(a.requestCtx, paths)
+
     // ПРИМЕНЯЕМ патчи с новой логикой частичного применения
     fmt.Println("\n🔧 Применение патчей...")
     if err := a.diffProcessor.ApplyDiffBlocks(blocks, autoMode); err != nil {
@@ -1037,27 +1161,81 @@ func (a *Assistant) copyToClipboardSafely(text string) {
 // processCodeGeneration обрабатывает генерацию кода с анализом проекта
 func (a *Assistant) processCodeGeneration(files []CodeFile, autoMode bool, isTextRequest bool) {
 	fmt.Println("🔧 Анализ сгенерированного кода...")
-	fmt.Printf("📋 Найдено %d файлов для создания/обновления\n\n", len(files))
+	fmt.Printf("📋 Найдено %d файлов для создания/обновления\n", len(files))
+	// Имена из Markdown-блоков угаданы по косвенным признакам — показываем, откуда
+	for _, f := range files {
+		if f.Format != "" && f.Format != "marker" {
+			fmt.Printf("   📄 %s — имя из %s (уверенность %.0f%%)\n", f.Path, codeFileFormatName(f.Format), f.Confidence*100)
+		}
+	}
+	fmt.Println()
+
+	// Пути из ответа модели: вне рабочего пространства ничего не пишем
+	files = a.workspace.FilterCodeFiles(files)
+	if len(files) == 0 {
+		fmt.Println("🚫 Нет файлов внутри рабочего пространства, ничего не записано")
+		return
+	}
+
+	// Dry-run: файлы не пишутся, установки и запуск только описываются в плане
+	if a.dryRun.Enabled() {
+		a.planCodeGeneration(files, isTextRequest)
+		return
+	}
+
+	// Незакоммиченные изменения и рабочая ветка git (git_auto_commit, git_branch)
+	targets := make([]string, 0, len(files))
+	for _, f := range files {
+		targets = append(targets, f.Path)
+	}
+	if !a.gitBeforeApply(targets, autoMode) {
+		return
+	}
+
+	// Просмотр диффа и подтверждение каждого файла перед записью
+	if !autoMode && a.GetConfig() != nil && a.GetConfig().GetBool("review_changes") {
+		files = ReviewCodeFiles(files, a.terminalReader)
+		if countWrites(files) == 0 {
+			if len(files) == 0 {
+				fmt.Println("🚫 Изменения отклонены, файлы не записаны")
+				return
+			}
+			fmt.Println("⏭️  Изменений для записи нет, проект запускается из сохраненных файлов")
+		}
+	}
+
+	if countWrites(files) > 0 && !a.gitUseWorkBranch() {
+		return
+	}
+
+	// Записываем операцию в журнал для :undo (включая последующие исправления кода)
+	paths := make([]string, 0, len(files))
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+	op := a.journal.Begin("Код: "+strings.Join(paths, ", "), nil)
+	defer op.Commit()
 
 	// Первый проход: записываем все файлы
 	fmt.Println("📥 Запись файлов...")
+	var written []string
 	for _, f := range files {
-		
-		fullPath := f.Path //filepath.Join(".", f.Path)
-		dir := filepath.Dir(fullPath)
-
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			fmt.Printf("❌ Ошибка создания директории %s: %v\n", dir, err)
+		// Снимок берется и для файлов без изменений: их может исправить цикл запуска
+		op.TrackFile(f.Path)
+		if f.SkipWrite {
 			continue
 		}
 
-		if err := os.WriteFile(fullPath, []byte(f.Content), 0644); err != nil {
-			fmt.Printf("❌ Ошибка записи файла %s: %v\n", f.Path, err)
+		if err := a.workspace.WriteFile(f.Path, []byte(f.Content)); err != nil {
+			fmt.Printf("❌ %v\n", err)
 			continue
 		}
 
+		written = append(written, f.Path)
 		fmt.Printf("✅ Файл записан: %s\n", f.Path)
 	}
+	// Коммит после установки зависимостей и запуска (с исправлениями кода)
+	defer a.gitAutoCommit(a.requestCtx, written)
 
 	// Второй проход: обрабатываем информацию о компиляции
 	var compileFiles []CodeFile
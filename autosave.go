@@ -0,0 +1,343 @@
+// autosave.go
+// Автосохранение текущей сессии и восстановление после аварийного завершения.
+// Каждый запуск пишет свой файл в ~/.cogitor/autosave; при штатном выходе файл помечается закрытым.
+// PID в имени файла отличает аварийно завершенные сессии от сессий еще работающих экземпляров
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultAutosaveInterval = 60 // секунд между периодическими сохранениями
+	DefaultAutosaveKeep     = 10 // сколько файлов автосохранения хранить
+)
+
+// autosaveData — содержимое файла автосохранения
+type autosaveData struct {
+	SessionData
+	PID    int  `json:"pid"`
+	Closed bool `json:"closed"` // true — сессия завершилась штатно или уже восстановлена
+}
+
+// Autosaver периодически и после каждого обмена сохраняет контекст в файл текущего запуска
+type Autosaver struct {
+	assistant *Assistant
+	path      string
+	encrypt   bool
+	last      string // состояние контекста на момент последнего сохранения
+	stop      chan struct{}
+	mu        sync.Mutex
+}
+
+// getAutosaveDir возвращает директорию файлов автосохранения
+func getAutosaveDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".cogitor", "autosave")
+}
+
+// NewAutosaver создает автосохранение для нового запуска
+func NewAutosaver(a *Assistant) *Autosaver {
+	name := fmt.Sprintf("autosave_%s_%d.json", time.Now().Format("20060102_150405"), os.Getpid())
+	return &Autosaver{
+		assistant: a,
+		path:      filepath.Join(getAutosaveDir(), name),
+		stop:      make(chan struct{}),
+	}
+}
+
+// Start запускает периодическое сохранение
+func (as *Autosaver) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := as.Save(); err != nil && as.assistant.isDebugMode() {
+					fmt.Printf("🔧 Автосохранение не удалось: %v\n", err)
+				}
+			case <-as.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Save записывает контекст, если он изменился с прошлого сохранения
+func (as *Autosaver) Save() error {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	state := as.state()
+	if state == as.last {
+		return nil
+	}
+	if err := as.write(false); err != nil {
+		return err
+	}
+	as.last = state
+	return nil
+}
+
+// state описывает то, что попадает в файл: контекст, название, теги и RAG-документы
+func (as *Autosaver) state() string {
+	a := as.assistant
+	state := a.context.ToJSON()
+	if ch := a.commandHandler; ch != nil {
+		state += "\x00" + ch.session.GetTitle() + "\x00" + strings.Join(ch.session.GetTags(), ",")
+	}
+	if a.IsRAGEnabled() {
+		state += "\x00" + strings.Join(a.ActiveRAGCollections(), ",")
+		for _, doc := range a.GetRAGData() {
+			state += "\x00" + doc.FilePath
+		}
+	}
+	return state
+}
+
+// Close останавливает автосохранение и помечает сессию как штатно завершенную.
+// Пустые сессии не оставляют файла
+func (as *Autosaver) Close() {
+	close(as.stop)
+
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	cm := as.assistant.context
+	if cm.GetExchangeCount() == 0 && cm.GetSummary() == "" {
+		os.Remove(as.path)
+		return
+	}
+	if err := as.write(true); err != nil {
+		fmt.Printf("⚠️  Не удалось завершить автосохранение: %v\n", err)
+		return
+	}
+	markAutosaveClosed(as.path)
+}
+
+// markAutosaveClosed переименовывает файл, чтобы закрытые сессии распознавались без чтения
+// (зашифрованные автосохранения иначе пришлось бы расшифровывать при каждом запуске)
+func markAutosaveClosed(path string) {
+	if strings.HasSuffix(path, "_closed.json") {
+		return
+	}
+	os.Rename(path, strings.TrimSuffix(path, ".json")+"_closed.json")
+}
+
+// write атомарно записывает файл автосохранения (через временный файл)
+func (as *Autosaver) write(closed bool) error {
+	cm := as.assistant.context
+	exchanges := cm.GetAllExchanges()
+	if len(exchanges) == 0 && cm.GetSummary() == "" && !closed {
+		return nil
+	}
+
+	// Те же метаданные, что и при :save: название, теги, рабочая директория, RAG-документы
+	data := autosaveData{
+		SessionData: as.assistant.commandHandler.currentSessionData(),
+		PID:         os.Getpid(),
+		Closed:      closed,
+	}
+
+	return writeSecureJSON(as.path, data, as.encrypt)
+}
+
+// autosave сохраняет контекст после обмена, если автосохранение включено
+func (a *Assistant) autosave() {
+	if a.autosaver == nil {
+		return
+	}
+	if err := a.autosaver.Save(); err != nil && a.isDebugMode() {
+		fmt.Printf("🔧 Автосохранение не удалось: %v\n", err)
+	}
+}
+
+// startAutosave удаляет старые файлы, предлагает восстановить аварийно завершенную сессию
+// и запускает автосохранение текущей. Без терминала (веб-интерфейс) восстановление не
+// предлагается: незакрытый файл дождется следующего запуска в терминале
+func (a *Assistant) startAutosave(interactive bool) {
+	config := a.GetConfig()
+	if !config.GetBool("autosave") {
+		return
+	}
+
+	pruneAutosaves(config.GetInt("autosave_keep", DefaultAutosaveKeep))
+	if interactive {
+		a.offerRecovery()
+	} else if hasUnclosedAutosave() {
+		fmt.Println("♻️  Есть незавершенная сессия: восстановить её можно при запуске в терминале")
+	}
+
+	// Пароль запрашиваем сейчас: фоновое сохранение не должно спрашивать его посреди ввода
+	encrypt := config.GetBool("encrypt_sessions")
+	if encrypt {
+		if err := sessionCrypto.Unlock(); err != nil {
+			fmt.Printf("⚠️  Автосохранение отключено: шифрование недоступно (%v)\n", err)
+			return
+		}
+	}
+
+	interval := config.GetInt("autosave_interval", DefaultAutosaveInterval)
+	if interval <= 0 {
+		interval = DefaultAutosaveInterval
+	}
+	a.autosaver = NewAutosaver(a)
+	a.autosaver.encrypt = encrypt
+	a.autosaver.Start(time.Duration(interval) * time.Second)
+}
+
+// stopAutosave штатно завершает автосохранение
+func (a *Assistant) stopAutosave() {
+	if a.autosaver != nil {
+		a.autosaver.Close()
+		a.autosaver = nil
+	}
+}
+
+// offerRecovery ищет последнюю незакрытую сессию и предлагает её восстановить
+func (a *Assistant) offerRecovery() {
+	path, data := findUnclosedAutosave()
+	if data == nil {
+		return
+	}
+
+	when := data.Timestamp
+	if t, err := time.Parse(time.RFC3339, data.Timestamp); err == nil {
+		when = t.Format("02.01.2006 15:04")
+	}
+	fmt.Printf("♻️  Найдена незавершенная сессия от %s (обменов: %d, %s/%s)\n",
+		when, len(data.Exchanges), data.Provider, data.Model)
+
+	response, err := a.terminalReader.ReadLineWithPrompt("Восстановить предыдущую сессию? (y/n): ")
+	if err == nil && strings.ToLower(strings.TrimSpace(response)) == "y" {
+		a.context.LoadFromHistory(data.Exchanges)
+		a.context.SetSummary(data.Summary)
+		a.context.SetPins(data.Pins)
+		a.context.SetSummaryBackup(data.SummaryBackup)
+		fmt.Printf("✅ Сессия восстановлена (обменов: %d)\n", a.context.GetExchangeCount())
+		a.commandHandler.session.SetTitle(data.Title)
+		a.commandHandler.session.SetTags(data.Tags)
+		a.commandHandler.restoreSessionEnvironment(&data.SessionData)
+	} else {
+		fmt.Println("⏭️  Восстановление пропущено (файл сохранен в " + getAutosaveDir() + ")")
+	}
+
+	// Больше не предлагаем эту сессию
+	markAutosaveClosed(path)
+}
+
+// findUnclosedAutosave возвращает самую новую незакрытую непустую сессию
+func findUnclosedAutosave() (string, *autosaveData) {
+	for _, path := range listAutosaves() {
+		if strings.HasSuffix(path, "_closed.json") || autosaveLive(autosavePID(path)) {
+			continue
+		}
+		if isEncryptedFile(path) {
+			fmt.Println("🔒 Найдено зашифрованное автосохранение")
+		}
+		var data autosaveData
+		if err := readSecureJSON(path, &data, true); err != nil {
+			fmt.Printf("⚠️  Не удалось прочитать автосохранение %s: %v\n", filepath.Base(path), err)
+			continue
+		}
+		if data.Closed || autosaveLive(data.PID) {
+			continue
+		}
+		if len(data.Exchanges) == 0 && data.Summary == "" {
+			continue
+		}
+		return path, &data
+	}
+	return "", nil
+}
+
+// hasUnclosedAutosave сообщает, есть ли незакрытые файлы завершившихся запусков (без чтения)
+func hasUnclosedAutosave() bool {
+	for _, path := range listAutosaves() {
+		if !strings.HasSuffix(path, "_closed.json") && !autosaveLive(autosavePID(path)) {
+			return true
+		}
+	}
+	return false
+}
+
+// autosavePID извлекает PID запуска из имени файла autosave_<время>_<pid>.json (0 — не удалось)
+func autosavePID(path string) int {
+	name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".json"), "_closed")
+	i := strings.LastIndex(name, "_")
+	if i < 0 {
+		return 0
+	}
+	pid, err := strconv.Atoi(name[i+1:])
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+// autosaveLive проверяет, что файл автосохранения принадлежит этому или другому работающему
+// экземпляру: такую сессию восстанавливать и удалять нельзя
+func autosaveLive(pid int) bool {
+	return pid == os.Getpid() || processAlive(pid)
+}
+
+// listAutosaves возвращает файлы автосохранения, новые первыми
+func listAutosaves() []string {
+	dir := getAutosaveDir()
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	type entry struct {
+		path    string
+		modTime time.Time
+	}
+	var entries []entry
+	for _, f := range files {
+		if f.IsDir() || !strings.HasPrefix(f.Name(), "autosave_") || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, entry{filepath.Join(dir, f.Name()), info.ModTime()})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].modTime.After(entries[j].modTime)
+	})
+
+	paths := make([]string, len(entries))
+	for i, e := range entries {
+		paths[i] = e.path
+	}
+	return paths
+}
+
+// pruneAutosaves оставляет только keep последних файлов автосохранения.
+// Файлы работающих экземпляров не удаляются и в счет не идут
+func pruneAutosaves(keep int) {
+	if keep < 1 {
+		keep = 1
+	}
+	kept := 0
+	for _, path := range listAutosaves() {
+		if !strings.HasSuffix(path, "_closed.json") && autosaveLive(autosavePID(path)) {
+			continue
+		}
+		kept++
+		if kept > keep {
+			os.Remove(path)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// citations.go
+// Ссылки на источники в RAG-ответах: модель цитирует фрагменты как [документ:фрагмент],
+// после ответа ссылки проверяются по отобранным фрагментам и выводится список источников
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// citationRe находит [doc:chunk]; символ перед скобкой исключает срезы вида a[1:2]
+var citationRe = regexp.MustCompile(`(^|[^\w\]\)])\[(\d+):(\d+)\]`)
+
+// RAGSource — фрагмент, переданный модели в контексте
+type RAGSource struct {
+	Ref       string `json:"ref"`
+	DocID     int    `json:"doc"`
+	ChunkID   int    `json:"chunk"`
+	FilePath  string `json:"file"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Cited     bool   `json:"cited"`
+}
+
+// CitationReport — результат проверки ссылок в ответе
+type CitationReport struct {
+	Sources []RAGSource `json:"sources"` // процитированные фрагменты, а если ссылок нет — все отобранные
+	Invalid []string    `json:"invalid"` // ссылки на фрагменты, которых не было в контексте
+	Cited   bool        `json:"cited"`   // в ответе есть хотя бы одна верная ссылка
+}
+
+// ragSourcesFromHits описывает отобранные фрагменты для проверки ссылок
+func ragSourcesFromHits(hits []RAGHit) []RAGSource {
+	sources := make([]RAGSource, 0, len(hits))
+	for _, hit := range hits {
+		c := hit.Chunk
+		sources = append(sources, RAGSource{
+			Ref:       c.Ref(),
+			DocID:     c.DocID,
+			ChunkID:   c.ChunkID,
+			FilePath:  c.FilePath,
+			StartLine: c.StartLine,
+			EndLine:   c.EndLine,
+		})
+	}
+	return sources
+}
+
+// stripCodeBlocks убирает блоки ``` из текста: в коде [1:2] — это срез, а не ссылка
+func stripCodeBlocks(text string) string {
+	var b strings.Builder
+	inCode := false
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCode = !inCode
+			continue
+		}
+		if !inCode {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// CheckCitations сопоставляет ссылки в ответе с фрагментами, переданными в контексте
+func CheckCitations(response string, retrieved []RAGSource) CitationReport {
+	var report CitationReport
+	byRef := make(map[string]int, len(retrieved))
+	for i, s := range retrieved {
+		byRef[s.Ref] = i
+	}
+
+	cited := make(map[int]bool)
+	seenInvalid := make(map[string]bool)
+	for _, m := range citationRe.FindAllStringSubmatch(stripCodeBlocks(response), -1) {
+		doc, _ := strconv.Atoi(m[2])
+		chunk, _ := strconv.Atoi(m[3])
+		ref := fmt.Sprintf("[%d:%d]", doc, chunk)
+		if i, ok := byRef[ref]; ok {
+			cited[i] = true
+		} else if !seenInvalid[ref] {
+			seenInvalid[ref] = true
+			report.Invalid = append(report.Invalid, ref)
+		}
+	}
+
+	for i, s := range retrieved {
+		if cited[i] {
+			s.Cited = true
+			report.Sources = append(report.Sources, s)
+		}
+	}
+	report.Cited = len(report.Sources) > 0
+	if !report.Cited {
+		report.Sources = append(report.Sources, retrieved...)
+	}
+	return report
+}
+
+// FormatSourcesFooter формирует блок «Источники» для вывода в терминале
+func FormatSourcesFooter(report CitationReport) string {
+	if len(report.Sources) == 0 && len(report.Invalid) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	if report.Cited {
+		b.WriteString("📚 Источники:\n")
+	} else {
+		b.WriteString("📚 Источники (ответ без ссылок, в контексте были фрагменты):\n")
+	}
+	for _, s := range report.Sources {
+		b.WriteString(fmt.Sprintf("   %s %s, строки %d-%d\n", s.Ref, s.FilePath, s.StartLine, s.EndLine))
+	}
+	if len(report.Invalid) > 0 {
+		b.WriteString(fmt.Sprintf("⚠️  Ссылки на несуществующие фрагменты: %s\n", strings.Join(report.Invalid, ", ")))
+	}
+	return b.String()
+}
@@ -1,11 +1,16 @@
 // codeparser.go
-// Парсинг ответов LLM и извлечение блоков кода в формате "--- File: path ---"
+// Парсинг ответов LLM и извлечение блоков кода в формате "--- File: path ---".
+// Если модель ответила Markdown-блоками ```, имя файла берется из строки блока,
+// заголовка перед ним или комментария в первой строке — с оценкой уверенности
 
 package main
 
 import (
+	"path/filepath"
 	"regexp"
 	"strings"
+
+	"github.com/alecthomas/chroma/lexers"
 )
 
 // CompileInfo содержит информацию о компиляции для файла
@@ -26,9 +31,12 @@ func NewCodeParser() *CodeParser {
 
 // CodeFile представляет файл с кодом и опциональной информацией о компиляции
 type CodeFile struct {
-	Path    string
-	Content string
-	Compile *CompileInfo // может быть nil, если нет спец. флагов
+	Path       string
+	Content    string
+	Compile    *CompileInfo // может быть nil, если нет спец. флагов
+	Format     string       // откуда взято имя файла: marker, info, heading, comment
+	Confidence float64      // уверенность в имени файла: 1 для "--- File:", меньше для блоков ```
+	SkipWrite  bool         // совпадает с файлом на диске: не записывается, но входит в проект
 }
 
 // ParseCodeBlocks парсит ответ LLM и извлекает файлы с кодом и информацию о компиляции
@@ -50,8 +58,10 @@ func (cp *CodeParser) ParseCodeBlocks(response string) []CodeFile {
 			// Пропускаем пустые файлы
 			if path != "" && content != "" {
 				codeFile := CodeFile{
-					Path:    path,
-					Content: content,
+					Path:       path,
+					Content:    content,
+					Format:     "marker",
+					Confidence: 1,
 				}
 
 				// Проверяем, есть ли после этого файла информация о компиляции
@@ -82,6 +92,17 @@ func (cp *CodeParser) ParseCodeBlocks(response string) []CodeFile {
 	return files
 }
 
+// ParseGeneratedCode разбирает ответ на явную команду генерации кода ($cod) или
+// на запрос исправления: если модель проигнорировала формат "--- File:", берутся
+// Markdown-блоки с именами файлов. Для обычных вопросов используется ParseCodeBlocks —
+// пример кода в ответе не должен записываться на диск
+func (cp *CodeParser) ParseGeneratedCode(response string) []CodeFile {
+	if files := cp.ParseCodeBlocks(response); len(files) > 0 {
+		return files
+	}
+	return cp.parseFencedBlocks(response)
+}
+
 func (cp *CodeParser) cleanCodeFromMarkers(content string) string {
     lines := strings.Split(content, "\n")
     var cleaned []string
@@ -157,4 +178,284 @@ func (cp *CodeParser) parseCompileInfo(text string) *CompileInfo {
 func (cp *CodeParser) IsCodeResponse(response string) bool {
 	return strings.Contains(response, "--- File:") || 
 		   strings.Contains(response, "--- Diff:")
-}
\ No newline at end of file
+}
+
+// ========== Markdown-блоки ``` с именами файлов ==========
+
+const (
+	fenceMinConfidence   = 0.5 // блоки с меньшей уверенностью не считаются файлами
+	fenceLanguagePenalty = 0.3 // язык блока не совпадает с расширением файла
+)
+
+var (
+	fenceOpenRe    = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})\\s*(.*)$")
+	fenceAttrRe    = regexp.MustCompile(`(?i)\b(title|filename|file|name|path)\s*=\s*(?:"([^"]*)"|'([^']*)'|(\S+))`)
+	fenceCommentRe = regexp.MustCompile(`(?i)^\s*(?://|#|--|;|%|/\*|<!--)\s*(?:(file|filename|path|файл)\s*:\s*)?(\S+?)\s*(?:\*/|-->)?\s*$`)
+	fenceHeadingRe = regexp.MustCompile(`(?i)^(?:(?:file|filename|path|файл)\s*:\s*)?(\S+)$`)
+	fenceInlineRe  = regexp.MustCompile("`([^`\\s]+)`")
+	fileExtRe      = regexp.MustCompile(`\.[A-Za-z0-9_+-]*[A-Za-z][A-Za-z0-9_+-]*$`)
+)
+
+// knownFileNames — файлы без расширения, которые тоже считаются именами файлов
+var knownFileNames = []string{"Makefile", "Dockerfile", "Containerfile", "Jenkinsfile", "Procfile", "Gemfile", "Rakefile", "Vagrantfile", "CMakeLists.txt"}
+
+// knownFileExtensions — расширения, для которых у подсветки нет лексера
+var knownFileExtensions = []string{".txt", ".env", ".cfg", ".conf", ".lock", ".sum", ".mod", ".csv", ".tsv", ".log", ".gitignore", ".dockerignore"}
+
+// fencedBlock — блок ``` в ответе
+type fencedBlock struct {
+	info    string
+	content string
+	heading string // непустая строка перед блоком
+	start   int    // номер строки с открывающей оградой
+	end     int    // номер строки после закрывающей ограды
+}
+
+// splitFencedBlocks находит блоки ``` и ~~~ (закрывающая ограда не короче открывающей)
+func splitFencedBlocks(lines []string) []fencedBlock {
+	var blocks []fencedBlock
+	for i := 0; i < len(lines); i++ {
+		m := fenceOpenRe.FindStringSubmatch(lines[i])
+		if m == nil || (m[2][0] == '`' && strings.Contains(m[3], "`")) {
+			continue
+		}
+		fence := m[2]
+		block := fencedBlock{info: strings.TrimSpace(m[3]), start: i}
+		for j := i - 1; j >= 0 && j >= i-2; j-- {
+			if t := strings.TrimSpace(lines[j]); t != "" {
+				block.heading = t
+				break
+			}
+		}
+
+		end := len(lines)
+		for j := i + 1; j < len(lines); j++ {
+			t := strings.TrimSpace(lines[j])
+			if strings.HasPrefix(t, fence) && strings.Trim(t, string(fence[0])) == "" {
+				end = j
+				break
+			}
+		}
+		if end > i+1 {
+			block.content = strings.Join(lines[i+1:end], "\n")
+		}
+		block.end = end + 1
+		blocks = append(blocks, block)
+		i = end
+	}
+	return blocks
+}
+
+// parseFencedBlocks извлекает файлы из блоков ```, у которых удалось определить имя.
+// Блоки без имени файла (примеры, вывод команд) пропускаются
+func (cp *CodeParser) parseFencedBlocks(response string) []CodeFile {
+	lines := strings.Split(strings.ReplaceAll(response, "\r\n", "\n"), "\n")
+	blocks := splitFencedBlocks(lines)
+
+	var files []CodeFile
+	index := make(map[string]int)
+	for n, block := range blocks {
+		file, ok := cp.fencedFile(block)
+		if !ok {
+			continue
+		}
+
+		// Блоки "--- Compile:" / "--- Install:" между этим и следующим блоком
+		next := len(lines)
+		if n+1 < len(blocks) {
+			next = blocks[n+1].start
+		}
+		if block.end < next {
+			file.Compile = cp.parseCompileInfo(strings.Join(lines[block.end:next], "\n"))
+		}
+
+		// Повторный блок с тем же файлом — исправленная версия
+		if i, seen := index[file.Path]; seen {
+			files[i] = file
+			continue
+		}
+		index[file.Path] = len(files)
+		files = append(files, file)
+	}
+	return files
+}
+
+// fencedFile определяет имя файла для блока и уверенность в нем
+func (cp *CodeParser) fencedFile(block fencedBlock) (CodeFile, bool) {
+	language, path, confidence, format := parseFenceInfo(block.info)
+	content := block.content
+
+	if p, c, rest, ok := fenceFirstLinePath(content); ok {
+		if p == path {
+			confidence += 0.05 // имя подтверждено дважды
+		} else if c > confidence {
+			path, confidence, format = p, c, "comment"
+		}
+		content = rest
+	}
+	if p, c, ok := fenceHeadingPath(block.heading); ok {
+		if p == path {
+			confidence += 0.05
+		} else if c > confidence {
+			path, confidence, format = p, c, "heading"
+		}
+	}
+	if path == "" {
+		return CodeFile{}, false
+	}
+
+	if language != "" && !fenceLanguageMatches(language, path) {
+		confidence -= fenceLanguagePenalty
+	}
+	if confidence > 1 {
+		confidence = 1
+	}
+	content = strings.TrimSpace(cp.cleanCodeFromMarkers(content))
+	if confidence < fenceMinConfidence || content == "" {
+		return CodeFile{}, false
+	}
+	return CodeFile{Path: path, Content: content, Format: format, Confidence: confidence}, true
+}
+
+// parseFenceInfo разбирает строку после ```: язык, title="main.go", go:main.go или просто путь
+func parseFenceInfo(info string) (language, path string, confidence float64, format string) {
+	if info == "" {
+		return "", "", 0, ""
+	}
+	if m := fenceAttrRe.FindStringSubmatch(info); m != nil {
+		if p := strings.TrimSpace(m[2] + m[3] + m[4]); looksLikeFilePath(p) {
+			path, confidence, format = p, 0.95, "info"
+		}
+		info = strings.TrimSpace(strings.Replace(info, m[0], "", 1))
+	}
+
+	fields := strings.Fields(strings.Trim(info, "{}"))
+	if len(fields) == 0 {
+		return "", path, confidence, format
+	}
+	language = strings.TrimPrefix(fields[0], ".")
+	if path != "" {
+		return language, path, confidence, format
+	}
+
+	// ```go:main.go
+	if i := strings.Index(language, ":"); i > 0 && looksLikeFilePath(language[i+1:]) {
+		return language[:i], language[i+1:], 0.9, "info"
+	}
+	// ```main.go или ```go main.go
+	for i, f := range fields {
+		if i > 1 {
+			break
+		}
+		if looksLikeFilePath(f) && knownFileType(f) {
+			if i == 0 {
+				language = ""
+			}
+			return language, f, 0.85, "info"
+		}
+	}
+	return language, "", 0, ""
+}
+
+// codeFileFormatName описывает источник имени файла для вывода
+func codeFileFormatName(format string) string {
+	switch format {
+	case "info":
+		return "строки ```"
+	case "heading":
+		return "заголовка перед блоком"
+	case "comment":
+		return "комментария в первой строке"
+	}
+	return "маркера --- File:"
+}
+
+// fenceFirstLinePath ищет имя файла в комментарии первой строки: "// file: main.go" или "# main.py".
+// Возвращает содержимое без этой строки
+func fenceFirstLinePath(content string) (string, float64, string, bool) {
+	lines := strings.SplitN(content, "\n", 3)
+	for i, line := range lines {
+		if i == 0 && strings.HasPrefix(line, "#!") && len(lines) > 1 {
+			continue // после shebang
+		}
+		if i > 1 {
+			break
+		}
+		m := fenceCommentRe.FindStringSubmatch(line)
+		if m == nil || !looksLikeFilePath(m[2]) {
+			return "", 0, content, false
+		}
+		confidence := 0.85
+		if m[1] == "" {
+			if !knownFileType(m[2]) {
+				return "", 0, content, false
+			}
+			confidence = 0.6
+		}
+		rest := append(append([]string{}, lines[:i]...), lines[i+1:]...)
+		return m[2], confidence, strings.Join(rest, "\n"), true
+	}
+	return "", 0, content, false
+}
+
+// fenceHeadingPath ищет имя файла в строке перед блоком: **main.go**, ### main.go, `main.go`:
+func fenceHeadingPath(heading string) (string, float64, bool) {
+	if heading == "" {
+		return "", 0, false
+	}
+	t := strings.TrimSpace(strings.TrimLeft(heading, "#>-* "))
+	t = strings.TrimSpace(strings.TrimRight(t, ":"))
+	t = strings.Trim(t, "*_`")
+	t = strings.TrimSpace(strings.TrimRight(t, ":"))
+	t = strings.Trim(t, "*_` ")
+	if m := fenceHeadingRe.FindStringSubmatch(t); m != nil {
+		if p := strings.Trim(m[1], "*_`"); looksLikeFilePath(p) && knownFileType(p) {
+			return p, 0.7, true
+		}
+	}
+
+	// Фраза, заканчивающаяся двоеточием, с одним путем в `кавычках`: "Создайте файл `main.go`:"
+	if strings.HasSuffix(heading, ":") {
+		m := fenceInlineRe.FindAllStringSubmatch(heading, -1)
+		if len(m) == 1 && looksLikeFilePath(m[0][1]) && knownFileType(m[0][1]) {
+			return m[0][1], 0.55, true
+		}
+	}
+	return "", 0, false
+}
+
+// looksLikeFilePath проверяет, похожа ли строка на относительный или абсолютный путь к файлу
+func looksLikeFilePath(s string) bool {
+	if s == "" || len(s) > 200 || strings.Contains(s, "://") || strings.HasPrefix(s, "-") {
+		return false
+	}
+	if strings.ContainsAny(s, " \t()[]{}<>|*?\"',;=$&!") {
+		return false
+	}
+	base := filepath.Base(s)
+	return containsString(knownFileNames, base) || fileExtRe.MatchString(base)
+}
+
+// knownFileType — расширение или имя файла знакомо (отсекает fmt.Println и т.п.)
+func knownFileType(path string) bool {
+	base := filepath.Base(path)
+	if containsString(knownFileNames, base) {
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(base))
+	if containsString(knownFileExtensions, ext) || (strings.HasPrefix(base, ".") && containsString(knownFileExtensions, base)) {
+		return true
+	}
+	return lexers.Match(base) != nil
+}
+
+// fenceLanguageMatches сравнивает язык блока с языком по расширению файла.
+// Неизвестный язык или расширение считаются совпадением
+func fenceLanguageMatches(language, path string) bool {
+	byName := lexers.Get(language)
+	byPath := lexers.Match(filepath.Base(path))
+	if byName == nil || byPath == nil {
+		return true
+	}
+	return byName.Config().Name == byPath.Config().Name
+}
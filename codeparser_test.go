@@ -0,0 +1,131 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitFencedBlocks(t *testing.T) {
+	type block struct {
+		info, content string
+	}
+	tests := []struct {
+		name  string
+		input string
+		want  []block
+	}{
+		{
+			name:  "простой блок",
+			input: "текст\n```go\npackage main\n```\nпосле",
+			want:  []block{{"go", "package main"}},
+		},
+		{
+			name:  "два блока подряд",
+			input: "```go\na\n```\n```py\nb\n```",
+			want:  []block{{"go", "a"}, {"py", "b"}},
+		},
+		{
+			name:  "вложенный блок внутри длинной ограды",
+			input: "````markdown\n# README\n```sh\nmake\n```\n````",
+			want:  []block{{"markdown", "# README\n```sh\nmake\n```"}},
+		},
+		{
+			name:  "тильды не закрываются обратными кавычками",
+			input: "~~~md\n```\nкод\n```\n~~~",
+			want:  []block{{"md", "```\nкод\n```"}},
+		},
+		{
+			name:  "закрывающая ограда длиннее открывающей",
+			input: "```go\nx := 1\n`````",
+			want:  []block{{"go", "x := 1"}},
+		},
+		{
+			name:  "незакрытый блок идет до конца ответа",
+			input: "```go\npackage main\n\nfunc main() {}",
+			want:  []block{{"go", "package main\n\nfunc main() {}"}},
+		},
+		{
+			name:  "пустой блок",
+			input: "```\n```",
+			want:  []block{{"", ""}},
+		},
+		{
+			name:  "обратные кавычки в info — это не ограда",
+			input: "```inline``` текст\n```go\nb\n```",
+			want:  []block{{"go", "b"}},
+		},
+		{
+			name:  "отступ больше трех пробелов — не ограда",
+			input: "    ```go\n    code\n    ```",
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []block
+			for _, b := range splitFencedBlocks(strings.Split(tt.input, "\n")) {
+				got = append(got, block{b.info, b.content})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("получено %q, ожидалось %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFencedBlocks(t *testing.T) {
+	cp := NewCodeParser()
+	tests := []struct {
+		name     string
+		response string
+		want     map[string]string
+	}{
+		{
+			name:     "имя в info",
+			response: "```go title=\"main.go\"\npackage main\n```",
+			want:     map[string]string{"main.go": "package main"},
+		},
+		{
+			name:     "язык:путь",
+			response: "```python:app/run.py\nprint(1)\n```",
+			want:     map[string]string{"app/run.py": "print(1)"},
+		},
+		{
+			name:     "имя в заголовке перед блоком",
+			response: "Файл `util.go`:\n```go\npackage util\n```",
+			want:     map[string]string{"util.go": "package util"},
+		},
+		{
+			name:     "вложенный README сохраняет внутренний блок",
+			response: "````markdown README.md\n# Сборка\n```sh\nmake\n```\n````",
+			want:     map[string]string{"README.md": "# Сборка\n```sh\nmake\n```"},
+		},
+		{
+			name:     "незакрытый блок с именем",
+			response: "```go main.go\npackage main",
+			want:     map[string]string{"main.go": "package main"},
+		},
+		{
+			name:     "повторный блок заменяет предыдущий",
+			response: "```go main.go\nv1\n```\nИсправление:\n```go main.go\nv2\n```",
+			want:     map[string]string{"main.go": "v2"},
+		},
+		{
+			name:     "блок без имени пропускается",
+			response: "```sh\nls -la\n```",
+			want:     map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(map[string]string)
+			for _, f := range cp.parseFencedBlocks(tt.response) {
+				got[f.Path] = f.Content
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("получено %q, ожидалось %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -10,13 +10,23 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 	"context"
 )
 
 // CodeRunner управляет компиляцией и запуском кода
 type CodeRunner struct {
-	maxRetries int
+	maxRetries  int
+	config      *Config
+	workspace   *Workspace
+	dryRun      *DryRun
+	sandboxOnce *SandboxOptions // параметры песочницы на один запуск (:sandbox once)
+	noTerminal  bool            // код запускается из веб-интерфейса: терминал не подключается
+
+	serversMu    sync.Mutex
+	servers      []*BackgroundServer // серверы, запущенные в фоне (:servers)
+	nextServerID int
 }
 
 // NewCodeRunner создает новый раннер кода
@@ -27,6 +37,8 @@ func NewCodeRunner(config *Config) *CodeRunner {
 	}
 	return &CodeRunner{
 		maxRetries: maxRetries,
+		config:     config,
+		workspace:  NewWorkspace(config),
 	}
 }
 
@@ -38,19 +50,20 @@ type LanguageInfo struct {
 	NeedsCompile bool
 }
 
-// buildCompileCommand строит команду компиляции с учетом CompileInfo
-func (cr *CodeRunner) buildCompileCommand(file string, langInfo *LanguageInfo, compileInfo *CompileInfo) (*exec.Cmd, string, error) {
+// buildCompileCommand строит команду компиляции с учетом CompileInfo. steps — подготовительные
+// шаги сборки (kotlinc, nasm), которые выполняются до cmd. Все команды запускаются в
+// директории файла (cmd.Dir): рабочая директория процесса не меняется
+func (cr *CodeRunner) buildCompileCommand(file string, langInfo *LanguageInfo, compileInfo *CompileInfo) (steps []*exec.Cmd, cmd *exec.Cmd, outputFile string, err error) {
 	dir := filepath.Dir(file)
 	filename := filepath.Base(file)
 	nameWithoutExt := strings.TrimSuffix(filename, filepath.Ext(filename))
-
-	// Меняем директорию на директорию файла
-	originalDir, _ := os.Getwd()
-	os.Chdir(dir)
-	defer os.Chdir(originalDir)
-
-	var cmd *exec.Cmd
-	var outputFile string
+	defer func() {
+		for _, c := range append(steps, cmd) {
+			if c != nil {
+				c.Dir = dir
+			}
+		}
+	}()
 
 	// Если задана полная команда - используем её
 	if compileInfo != nil && compileInfo.Command != "" {
@@ -62,7 +75,7 @@ func (cr *CodeRunner) buildCompileCommand(file string, langInfo *LanguageInfo, c
 			if len(parts) > 2 && parts[1] == "-o" {
 				outputFile = parts[2]
 			}
-			return cmd, outputFile, nil
+			return nil, cmd, outputFile, nil
 		}
 	}
 
@@ -90,18 +103,13 @@ func (cr *CodeRunner) buildCompileCommand(file string, langInfo *LanguageInfo, c
 			cmd = exec.Command(parts[0], parts[1:]...)
 		case ".kt":
 			if _, err := exec.LookPath("java"); err != nil {
-				return nil, "", fmt.Errorf("java не найден в PATH. Установите JDK для запуска Kotlin")
+				return nil, nil, "", fmt.Errorf("java не найден в PATH. Установите JDK для запуска Kotlin")
 			}
 			jarFile := nameWithoutExt + ".jar"
 			compileCmd := langInfo.Compiler + flags + " -include-runtime -d " + jarFile + " " + filename
 			parts := strings.Fields(compileCmd)
-			compileCmdObj := exec.Command(parts[0], parts[1:]...)
-			if output, err := compileCmdObj.CombinedOutput(); err != nil {
-				return nil, "", fmt.Errorf("%s", string(output))
-			}
-			outputFile = jarFile
 			// Для Kotlin команда запуска отличается от компиляции
-			return exec.Command("java", "-jar", jarFile), outputFile, nil
+			return []*exec.Cmd{exec.Command(parts[0], parts[1:]...)}, exec.Command("java", "-jar", jarFile), jarFile, nil
 		case ".swift":
 			outputFile = nameWithoutExt
 			compileCmd := langInfo.Compiler + flags + " -o " + outputFile + " " + filename
@@ -109,32 +117,13 @@ func (cr *CodeRunner) buildCompileCommand(file string, langInfo *LanguageInfo, c
 			cmd = exec.Command(parts[0], parts[1:]...)
 		case ".asm":
 			objectFile := nameWithoutExt + ".o"
-			executableFile := nameWithoutExt
+			outputFile = nameWithoutExt
 			
-			// Первый этап: компиляция в объектный файл
+			// Первый этап: компиляция в объектный файл, второй — линковка
 			compileCmd := "nasm" + flags + " -f elf64 " + filename + " -o " + objectFile
 			parts := strings.Fields(compileCmd)
-			compileCmdObj := exec.Command(parts[0], parts[1:]...)
-			if output, err := compileCmdObj.CombinedOutput(); err != nil {
-				os.Remove(objectFile)
-				return nil, "", fmt.Errorf("%s", string(output))
-			}
-			
-			// Второй этап: линковка
-			linkCmd := "ld -o " + executableFile + " " + objectFile
-			parts = strings.Fields(linkCmd)
-			linkCmdObj := exec.Command(parts[0], parts[1:]...)
-			if output, err := linkCmdObj.CombinedOutput(); err != nil {
-				os.Remove(objectFile)
-				os.Remove(executableFile)
-				return nil, "", fmt.Errorf("%s", string(output))
-			}
-			
-			os.Remove(objectFile)
-			os.Chmod(executableFile, 0755)
-			outputFile = executableFile
-			// Команда уже выполнена
-			return nil, outputFile, nil
+			steps = append(steps, exec.Command(parts[0], parts[1:]...))
+			cmd = exec.Command("ld", "-o", outputFile, objectFile)
 		case ".s":
 			outputFile = nameWithoutExt
 			compileCmd := langInfo.Compiler + flags + " -o " + outputFile + " " + filename
@@ -143,12 +132,12 @@ func (cr *CodeRunner) buildCompileCommand(file string, langInfo *LanguageInfo, c
 		}
 
 		if cmd != nil {
-			return cmd, outputFile, nil
+			return steps, cmd, outputFile, nil
 		}
 
 		// Запуск
 		if outputFile != "" {
-			return exec.Command("./" + outputFile), outputFile, nil
+			return nil, exec.Command("./" + outputFile), outputFile, nil
 		}
 	} else {
 		// Интерпретатор или прямой запуск
@@ -175,16 +164,16 @@ func (cr *CodeRunner) buildCompileCommand(file string, langInfo *LanguageInfo, c
 			// Открываем HTML файл в браузере
 			absPath, err := filepath.Abs(file)
 			if err != nil {
-				return nil, "", fmt.Errorf("не удалось получить абсолютный путь: %v", err)
+				return nil, nil, "", fmt.Errorf("не удалось получить абсолютный путь: %v", err)
 			}
 			fileURL := "file://" + absPath
 			if runtime.GOOS == "windows" {
 				fileURL = "file:///" + strings.ReplaceAll(absPath, "\\", "/")
 			}
 			if err := OpenURLInBrowser(fileURL); err != nil {
-				return nil, "", fmt.Errorf("не удалось открыть HTML в браузере: %v", err)
+				return nil, nil, "", fmt.Errorf("не удалось открыть HTML в браузере: %v", err)
 			}
-			return nil, "", nil // Специальный случай
+			return nil, nil, "", nil // Специальный случай
 		default:
 			runCmd := langInfo.Runner + flags + " " + filename
 			parts := strings.Fields(runCmd)
@@ -192,7 +181,79 @@ func (cr *CodeRunner) buildCompileCommand(file string, langInfo *LanguageInfo, c
 		}
 	}
 
-	return cmd, outputFile, nil
+	return nil, cmd, outputFile, nil
+}
+
+// plannedCommands описывает команды компиляции и запуска файла, не выполняя их (dry-run).
+// Команды повторяют buildCompileCommand и выполняются в директории файла
+func (cr *CodeRunner) plannedCommands(file string, langInfo *LanguageInfo, compileInfo *CompileInfo) []PlanCommand {
+	dir := filepath.Dir(file)
+	if dir == "." {
+		dir = ""
+	}
+	filename := filepath.Base(file)
+	name := strings.TrimSuffix(filename, filepath.Ext(filename))
+	command := func(kind, cmd string) PlanCommand {
+		return PlanCommand{Kind: kind, Command: cmd, Dir: dir, Source: "project"}
+	}
+
+	if compileInfo != nil && compileInfo.Command != "" {
+		parts := strings.Fields(compileInfo.Command)
+		if len(parts) > 2 && parts[1] == "-o" {
+			return []PlanCommand{command("compile", compileInfo.Command), command("run", "./"+parts[2])}
+		}
+		return []PlanCommand{command("run", compileInfo.Command)}
+	}
+	flags := ""
+	if compileInfo != nil && compileInfo.Flags != "" {
+		flags = " " + compileInfo.Flags
+	}
+
+	switch langInfo.Extension {
+	case ".c", ".cpp", ".cc", ".f90", ".f95", ".swift", ".s":
+		return []PlanCommand{
+			command("compile", langInfo.Compiler+flags+" -o "+name+" "+filename),
+			command("run", "./"+name),
+		}
+	case ".kt":
+		jar := name + ".jar"
+		return []PlanCommand{
+			command("compile", langInfo.Compiler+flags+" -include-runtime -d "+jar+" "+filename),
+			command("run", "java -jar "+jar),
+		}
+	case ".asm":
+		return []PlanCommand{
+			command("compile", "nasm"+flags+" -f elf64 "+filename+" -o "+name+".o"),
+			command("compile", "ld -o "+name+" "+name+".o"),
+			command("run", "./"+name),
+		}
+	case ".go":
+		return []PlanCommand{command("run", "go run"+flags+" "+filename)}
+	case ".py":
+		// Флаги Python — переменные окружения KEY=VALUE
+		return []PlanCommand{command("run", strings.TrimSpace(flags+" python3 "+filename))}
+	case ".rb":
+		return []PlanCommand{command("run", "ruby "+filename)}
+	case ".lisp", ".cl":
+		return []PlanCommand{command("run", "sbcl --script "+filename)}
+	case ".html":
+		open := "xdg-open"
+		switch runtime.GOOS {
+		case "darwin":
+			open = "open"
+		case "windows":
+			open = "start \"\""
+		}
+		return []PlanCommand{command("run", open+" "+filename)}
+	}
+	return []PlanCommand{command("run", langInfo.Runner+flags+" "+filename)}
+}
+
+// planFile добавляет в план команды проверки файла
+func (cr *CodeRunner) planFile(file string, langInfo *LanguageInfo, compileInfo *CompileInfo) {
+	for _, c := range cr.plannedCommands(file, langInfo, compileInfo) {
+		cr.dryRun.AddCommand(c)
+	}
 }
 
 // getLanguageInfo возвращает информацию о языке по расширению файла
@@ -231,6 +292,16 @@ func (cr *CodeRunner) RunWithRetry(ctx context.Context, file string, originalCod
 	if langInfo == nil {
 		return fmt.Errorf("неподдерживаемый язык программирования: %s", file)
 	}
+	defer cr.clearSandboxOnce()
+
+	// Dry-run: только описываем установку, компиляцию и запуск
+	if cr.dryRun.Enabled() {
+		if compileInfo != nil && compileInfo.InstallCommand != "" {
+			cr.dryRun.AddCommand(PlanCommand{Kind: "install", Command: compileInfo.InstallCommand, Source: "llm"})
+		}
+		cr.planFile(file, langInfo, compileInfo)
+		return nil
+	}
 
 	// Выполняем команду установки зависимостей, если она предоставлена
 	if compileInfo != nil && compileInfo.InstallCommand != "" {
@@ -254,7 +325,7 @@ func (cr *CodeRunner) RunWithRetry(ctx context.Context, file string, originalCod
 
 	// Для HTML файлов не нужны повторные попытки, сразу открываем в браузере
 	if langInfo.Extension == ".html" {
-		_, err := cr.runCode(file, langInfo, compileInfo)
+		_, err := cr.runCode(ctx, file, langInfo, compileInfo)
 		return err
 	}
 
@@ -267,7 +338,7 @@ func (cr *CodeRunner) RunWithRetry(ctx context.Context, file string, originalCod
 		}
 		fmt.Printf("  Попытка %d/%d...\n", attempt, cr.maxRetries)
 
-		output, err := cr.runCode(file, langInfo, compileInfo)
+		output, err := cr.runCode(ctx, file, langInfo, compileInfo)
 
 		if err == nil {
 			fmt.Printf("✅ Выполнение успешно!\n")
@@ -277,6 +348,11 @@ func (cr *CodeRunner) RunWithRetry(ctx context.Context, file string, originalCod
 			return nil
 		}
 
+		if ctx.Err() != nil {
+			fmt.Println("Запрос отменён пользователем")
+			return fmt.Errorf("запрос отменён")
+		}
+
 		// Ошибка - показываем пользователю
 		fmt.Printf("❌ Ошибка: %v\n", err)
 		if output != "" {
@@ -342,7 +418,7 @@ filename, err, output, originalCode, filename)
 
 			// Парсим ответ
 			parser := NewCodeParser()
-			files := parser.ParseCodeBlocks(fixedCode)
+			files := parser.ParseGeneratedCode(fixedCode)
 
 			if len(files) == 0 {
 				return fmt.Errorf("LLM не предоставил исправленный код")
@@ -351,7 +427,7 @@ filename, err, output, originalCode, filename)
 			fixedFile := files[0]
 			fullPath := file //filepath.Join(".", file)
 			if len(files) > 0 {
-                if err := os.WriteFile(fullPath, []byte(fixedFile.Content), 0644); err != nil {
+                if err := cr.workspace.WriteFile(fullPath, []byte(fixedFile.Content)); err != nil {
                     return fmt.Errorf("не удалось записать исправленный код: %v", err)
                 }
                 fmt.Println("✅ Исправленный код записан, повторяю компиляцию...")
@@ -370,7 +446,8 @@ filename, err, output, originalCode, filename)
 	return fmt.Errorf("не удалось запустить код после %d попыток", cr.maxRetries)
 }
 
-// executeInstallCommand выполняет команду установки зависимостей и выводит результаты в канвас
+// executeInstallCommand выполняет команду установки зависимостей и выводит результаты в канвас.
+// Установка ограничена по времени (installTimeoutFactor × run_timeout) и лимитами песочницы
 func (cr *CodeRunner) executeInstallCommand(ctx context.Context, command string) error {
 	// Проверяем отмену контекста
 	select {
@@ -386,68 +463,139 @@ func (cr *CodeRunner) executeInstallCommand(ctx context.Context, command string)
 	}
 
 	// Первый аргумент - это команда (pip, apt-get, npm и т.д.)
-	cmd := exec.Command(parts[0], parts[1:]...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-
-	// Запускаем команду
-	err := cmd.Run()
+	cmd, box, err := cr.installCommand(exec.Command(parts[0], parts[1:]...))
 	if err != nil {
-		return fmt.Errorf("команда '%s' завершилась с ошибкой: %w", command, err)
+		return fmt.Errorf("команда '%s' не запущена: %v", command, err)
+	}
+
+	// Запускаем команду: вывод виден сразу, в памяти — не больше run_output_kb
+	if _, err := cr.runCommand(ctx, cmd, installTimeoutFactor*cr.runTimeout(), os.Stdout); err != nil {
+		return fmt.Errorf("команда '%s' завершилась с ошибкой: %w%s", command, err, sandboxNote(box, err))
 	}
 
 	return nil
 }
 
 // runCode выполняет компиляцию и запуск кода
-func (cr *CodeRunner) runCode(file string, langInfo *LanguageInfo, compileInfo *CompileInfo) (string, error) {
+func (cr *CodeRunner) runCode(ctx context.Context, file string, langInfo *LanguageInfo, compileInfo *CompileInfo) (string, error) {
 	dir := filepath.Dir(file)
 	filename := filepath.Base(file)
 
-	// Меняем директорию на директорию файла
-	originalDir, _ := os.Getwd()
-	os.Chdir(dir)
-	defer os.Chdir(originalDir)
-	// Сборка команды с учетом CompileInfo
-	cmd, outputFile, err := cr.buildCompileCommand(filename, langInfo, compileInfo)
+	// Сервер не завершается сам: он запускается в фоне с проверкой порта
+	var server *serverSpec
+	interactive := false // программа читает stdin — подключаем терминал пользователя
+	if source, err := os.ReadFile(file); err == nil && langInfo.Extension != ".html" {
+		server = detectServer(string(source))
+		interactive = server == nil && cr.interactiveRun(string(source))
+	}
+
+	// Код собирается и запускается в копии директории внутри песочницы; HTML только
+	// открывается в браузере
+	var box *Sandbox
+	keepBox := false // каталог работающего сервера удаляется при его остановке
+	if opts := cr.sandboxOptions(); opts.Backend != "off" && langInfo.Extension != ".html" {
+		if server != nil && !opts.Network {
+			opts.Network = true // иначе порт сервера недоступен для проверки и браузера
+			fmt.Println("🌐 Код похож на сервер: сеть песочницы включена для этого запуска")
+		}
+		if server != nil {
+			// процессорное время работающего сервера растет без конца — RLIMIT_CPU убил бы
+			// его через sandbox_cpu_sec; остальные лимиты действуют
+			opts.CPUSec = 0
+		}
+		var err error
+		box, err = NewSandbox(opts, dir, filename)
+		if err != nil {
+			return "", err
+		}
+		defer func() {
+			if !keepBox {
+				box.Close()
+			}
+		}()
+		fmt.Println(box.Describe())
+		dir = box.Dir
+	}
+
+	// Файлы, записанные программой, переносятся в проект после успешного запуска — уже
+	// из исходной рабочей директории, от которой считается рабочее пространство
+	saveOutputs := false
+	defer func() {
+		if saveOutputs && box != nil {
+			cr.saveOutputs(box)
+		}
+	}()
+
+	// Сборка команды с учетом CompileInfo; команды выполняются в dir через cmd.Dir
+	steps, cmd, outputFile, err := cr.buildCompileCommand(filepath.Join(dir, filename), langInfo, compileInfo)
 	if err != nil {
 		return "", err
 	}
 	
 	// Для HTML возвращаем специальный результат
 	if langInfo.Extension == ".html" && cmd == nil {
-        absPath, _ := filepath.Abs(filename)
+        absPath, _ := filepath.Abs(filepath.Join(dir, filename))
 		return fmt.Sprintf("HTML файл открыт в браузере: %s", "file://"+absPath), nil
 	}
 
 	// Выполняем команду
-	var output []byte
+	var output string
 	var runErr error
 	
+	// Подготовительные шаги сборки — с теми же таймаутом, выводом и песочницей, что и запуск
+	if langInfo.Extension == ".asm" {
+		defer os.Remove(filepath.Join(dir, strings.TrimSuffix(filename, filepath.Ext(filename))+".o"))
+	}
+	for _, step := range steps {
+		if output, err = cr.execute(ctx, step, box); err != nil {
+			return output, fmt.Errorf("ошибка компиляции: %v%s", err, sandboxNote(box, err))
+		}
+	}
+	
 	if cmd != nil {
-		output, err = cmd.CombinedOutput()
+		// Без отдельного исполняемого файла эта команда и есть запуск программы
+		if server != nil && (outputFile == "" || langInfo.Extension == ".kt") {
+			keepBox = true
+			return cr.startBackgroundServer(ctx, file, cmd, box, server)
+		}
+		runsProgram := outputFile == "" || langInfo.Extension == ".kt"
+		if interactive && runsProgram {
+			output, err = cr.runInteractive(ctx, cmd, box)
+		} else {
+			output, err = cr.execute(ctx, cmd, box)
+		}
 		if err != nil {
-			return string(output), fmt.Errorf("ошибка выполнения: %v", err)
+			return output, fmt.Errorf("ошибка выполнения: %v%s", err, sandboxNote(box, err))
 		}
+		saveOutputs = runsProgram
 	}
 
 	// Если был создан outputFile, это компилируемый язык, нужно запустить
 	if outputFile != "" && langInfo.Extension != ".kt" {
 		// Выдаём права на выполнение, если нужно
 		if langInfo.NeedsCompile && langInfo.Extension != ".html" {
-			os.Chmod(outputFile, 0755)
+			os.Chmod(filepath.Join(dir, outputFile), 0755)
 		}
 		
 		// Запускаем скомпилированный файл
 		runCmd := exec.Command("./" + outputFile)
-		output, runErr = runCmd.CombinedOutput()
+		runCmd.Dir = dir
+		if server != nil {
+			keepBox = true
+			return cr.startBackgroundServer(ctx, file, runCmd, box, server)
+		}
+		if interactive {
+			output, runErr = cr.runInteractive(ctx, runCmd, box)
+		} else {
+			output, runErr = cr.execute(ctx, runCmd, box)
+		}
 		if runErr != nil {
-			return string(output), fmt.Errorf("ошибка запуска: %v", runErr)
+			return output, fmt.Errorf("ошибка запуска: %v%s", runErr, sandboxNote(box, runErr))
 		}
+		saveOutputs = true
 	}
 
-	return string(output), nil
+	return output, nil
 }
 
 // RunDiffWithRetry запускает компиляцию/выполнение файла с автоисправлением ошибок в режиме DIFF.
@@ -457,11 +605,16 @@ func (cr *CodeRunner) RunDiffWithRetry(ctx context.Context, file string, provide
 	if langInfo == nil {
 		return fmt.Errorf("неподдерживаемый язык: %s", file)
 	}
+	defer cr.clearSandboxOnce()
 
 	// Пропускаем файлы, которые не нуждаются в компиляции
 	if langInfo.Extension == ".html" || langInfo.Extension == ".txt" {
 		return nil
 	}
+	if cr.dryRun.Enabled() {
+		cr.planFile(file, langInfo, compileInfo)
+		return nil
+	}
 
 	fullPath := file
 	
@@ -479,7 +632,7 @@ func (cr *CodeRunner) RunDiffWithRetry(ctx context.Context, file string, provide
 		
 		fmt.Printf("  Попытка запуска %d/%d...\n", attempt, cr.maxRetries)
 
-		output, err := cr.runCode(fullPath, langInfo, compileInfo)
+		output, err := cr.runCode(ctx, fullPath, langInfo, compileInfo)
 		if err == nil {
 			fmt.Printf("  ✅ Выполнение успешно!\n")
 			if output != "" {
@@ -488,6 +641,11 @@ func (cr *CodeRunner) RunDiffWithRetry(ctx context.Context, file string, provide
 			return nil
 		}
 
+		if ctx.Err() != nil {
+			fmt.Println("  🤖 Проверка отменена пользователем")
+			return fmt.Errorf("проверка отменена")
+		}
+
 		// Запоминаем последнюю ошибку
 		lastError = fmt.Errorf("%v", err)
 		
@@ -554,13 +712,13 @@ Modified:
 		if len(fixBlocks) == 0 {
 			// Fallback: если LLM вернул целый файл
 			parser := NewCodeParser()
-			files := parser.ParseCodeBlocks(fixedResponse)
+			files := parser.ParseGeneratedCode(fixedResponse)
 			if len(files) == 0 {
 				fmt.Printf("  ❌ LLM не предоставил исправлений\n")
 				continue
 			}
 			// Перезаписываем файл целиком
-			if writeErr := os.WriteFile(fullPath, []byte(files[0].Content), 0644); writeErr != nil {
+			if writeErr := cr.workspace.WriteFile(fullPath, []byte(files[0].Content)); writeErr != nil {
 				fmt.Printf("  ❌ Ошибка записи: %v\n", writeErr)
 				continue
 			}
@@ -614,8 +772,9 @@ func (cr *CodeRunner) RunProject(ctx context.Context, config *ProjectConfig, pro
         // Добавить это условие для одиночных файлов:
         if config.HasPyMain == "" && len(config.Files) == 1 {
             fullPath := filepath.Join(".", config.EntryPoint)
+            // В dry-run файл еще не записан: содержимое не нужно
             content, err := os.ReadFile(fullPath)
-            if err != nil {
+            if err != nil && !cr.dryRun.Enabled() {
                 return fmt.Errorf("не удалось прочитать %s: %v", config.EntryPoint, err)
             }
             return cr.RunWithRetry(ctx, fullPath, string(content), provider, model, apiKey, nil)
@@ -635,7 +794,7 @@ func (cr *CodeRunner) RunProject(ctx context.Context, config *ProjectConfig, pro
 
 	fullPath := filepath.Join(".", config.EntryPoint)
 	content, err := os.ReadFile(fullPath)
-	if err != nil {
+	if err != nil && !cr.dryRun.Enabled() {
 		return fmt.Errorf("не удалось прочитать %s: %v", config.EntryPoint, err)
 	}
 
@@ -650,6 +809,11 @@ func (cr *CodeRunner) runCompiledProject(ctx context.Context, config *ProjectCon
     if config.CompileCommand == "" {
         return fmt.Errorf("не найдена команда компиляции")
     }
+    if cr.dryRun.Enabled() {
+        cr.dryRun.AddCommand(PlanCommand{Kind: "compile", Command: config.CompileCommand, Source: "project"})
+        cr.dryRun.AddCommand(PlanCommand{Kind: "run", Command: strings.TrimSpace(config.RunCommand + " " + strings.Join(config.Args, " ")), Source: "project"})
+        return nil
+    }
 
     // Добавить циклы попыток:
     for attempt := 1; attempt <= cr.maxRetries; attempt++ {
@@ -698,6 +862,10 @@ func (cr *CodeRunner) runCompiledProject(ctx context.Context, config *ProjectCon
 
 // runGoProject запускает Go модуль
 func (cr *CodeRunner) runGoProject(ctx context.Context, config *ProjectConfig, provider, model, apiKey string) error {
+	if cr.dryRun.Enabled() {
+		cr.dryRun.AddCommand(PlanCommand{Kind: "run", Command: strings.TrimSpace("go run . " + strings.Join(config.Args, " ")), Source: "project"})
+		return nil
+	}
 	fmt.Println("  Запуск как Go модуль: go run .")
 	cmd := exec.Command("go", "run", ".")
 	if len(config.Args) > 0 {
@@ -730,6 +898,12 @@ func (cr *CodeRunner) runPythonProject(ctx context.Context, config *ProjectConfi
         return fmt.Errorf("не найдена точка входа Python")
     }
 
+    if cr.dryRun.Enabled() {
+        run := strings.Join(append(cmd.Args, config.Args...), " ")
+        cr.dryRun.AddCommand(PlanCommand{Kind: "run", Command: run, Source: "project"})
+        return nil
+    }
+
     if len(config.Args) > 0 {
         cmd.Args = append(cmd.Args, config.Args...)
         // if len(config.Args) > 0 && cr.config.GetBool("debug_mode") {
@@ -750,6 +924,13 @@ func (cr *CodeRunner) runPythonProject(ctx context.Context, config *ProjectConfi
 
 // runMakefileProject запускает через make
 func (cr *CodeRunner) runMakefileProject(ctx context.Context, config *ProjectConfig, provider, model, apiKey string) error {
+	if cr.dryRun.Enabled() {
+		cr.dryRun.AddCommand(PlanCommand{Kind: "compile", Command: "make", Source: "project"})
+		if config.RunCommand != "" {
+			cr.dryRun.AddCommand(PlanCommand{Kind: "run", Command: config.RunCommand, Source: "project"})
+		}
+		return nil
+	}
 	fmt.Println("  Использование Makefile: make")
 	cmd := exec.Command("make")
 	cmd.Stdout = os.Stdout
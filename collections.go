@@ -0,0 +1,368 @@
+// collections.go
+// Именованные RAG-коллекции: документы хранятся в ~/.cogitor/rag/<коллекция>/collection.json,
+// активными могут быть несколько коллекций сразу; список активных переживает перезапуск
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ragCollectionFile = "collection.json"
+	ragActiveFile     = "active.json"
+)
+
+var collectionNameRe = regexp.MustCompile(`^[\p{L}\p{N}_-][\p{L}\p{N}_.-]{0,63}$`)
+
+// RAGCollection — именованный набор документов
+type RAGCollection struct {
+	Name      string          `json:"name"`
+	Created   string          `json:"created"`
+	Updated   string          `json:"updated"`
+	Documents []RAGDocument   `json:"documents"`
+	Sources   []RAGLoadSource `json:"sources,omitempty"` // откуда загружались документы (для :data refresh)
+}
+
+// RAGLoadSource — путь, загруженный в коллекцию, с параметрами обхода
+type RAGLoadSource struct {
+	Path      string   `json:"path"`
+	Recursive bool     `json:"recursive,omitempty"`
+	Include   []string `json:"include,omitempty"`
+	Exclude   []string `json:"exclude,omitempty"`
+}
+
+// RAGCollectionInfo — краткие сведения о коллекции для списков
+type RAGCollectionInfo struct {
+	Name      string `json:"name"`
+	Documents int    `json:"documents"`
+	Size      int    `json:"size"`
+	Updated   string `json:"updated"`
+	Active    bool   `json:"active"`
+}
+
+// ValidateCollectionName проверяет имя коллекции (оно же имя директории)
+func ValidateCollectionName(name string) error {
+	if !collectionNameRe.MatchString(name) {
+		return fmt.Errorf("недопустимое имя коллекции '%s': буквы, цифры, '_', '-', '.', до 64 символов", name)
+	}
+	return nil
+}
+
+func getRAGRootDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".cogitor", "rag")
+}
+
+// RAGCollectionExists проверяет, сохранена ли коллекция
+func RAGCollectionExists(name string) bool {
+	_, err := os.Stat(filepath.Join(getRAGDir(name), ragCollectionFile))
+	return err == nil
+}
+
+// NewRAGCollection создает пустую коллекцию (без записи на диск)
+func NewRAGCollection(name string) *RAGCollection {
+	now := time.Now().Format(time.RFC3339)
+	return &RAGCollection{Name: name, Created: now, Updated: now}
+}
+
+// LoadRAGCollection читает коллекцию с диска
+func LoadRAGCollection(name string) (*RAGCollection, error) {
+	if err := ValidateCollectionName(name); err != nil {
+		return nil, err
+	}
+	var c RAGCollection
+	if err := readSecureJSON(filepath.Join(getRAGDir(name), ragCollectionFile), &c, false); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("коллекция '%s' не найдена", name)
+		}
+		return nil, fmt.Errorf("ошибка чтения коллекции '%s': %v", name, err)
+	}
+	c.Name = name
+	return &c, nil
+}
+
+// Save записывает коллекцию
+func (c *RAGCollection) Save() error {
+	c.Updated = time.Now().Format(time.RFC3339)
+	return writeSecureJSON(filepath.Join(getRAGDir(c.Name), ragCollectionFile), c, encryptRAGCaches())
+}
+
+// Upsert добавляет документы; документ с тем же путем заменяется
+func (c *RAGCollection) Upsert(docs []RAGDocument) (added, replaced int) {
+	index := make(map[string]int, len(c.Documents))
+	for i, doc := range c.Documents {
+		index[doc.FilePath] = i
+	}
+	for _, doc := range docs {
+		doc.Collection = c.Name
+		if i, ok := index[doc.FilePath]; ok {
+			c.Documents[i] = doc
+			replaced++
+			continue
+		}
+		index[doc.FilePath] = len(c.Documents)
+		c.Documents = append(c.Documents, doc)
+		added++
+	}
+	return added, replaced
+}
+
+// AddSource запоминает загруженный путь; повторная загрузка того же пути заменяет параметры
+func (c *RAGCollection) AddSource(src RAGLoadSource) {
+	for i, existing := range c.Sources {
+		if existing.Path == src.Path {
+			c.Sources[i] = src
+			return
+		}
+	}
+	c.Sources = append(c.Sources, src)
+}
+
+// Remove удаляет документ по номеру (с 1), полному пути или имени файла
+func (c *RAGCollection) Remove(ref string) (RAGDocument, error) {
+	found := -1
+	if n, err := strconv.Atoi(ref); err == nil {
+		if n < 1 || n > len(c.Documents) {
+			return RAGDocument{}, fmt.Errorf("нет документа с номером %d (всего %d)", n, len(c.Documents))
+		}
+		found = n - 1
+	} else {
+		var matches []int
+		for i, doc := range c.Documents {
+			if doc.FilePath == ref {
+				matches = []int{i}
+				break
+			}
+			if filepath.Base(doc.FilePath) == ref {
+				matches = append(matches, i)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			return RAGDocument{}, fmt.Errorf("документ '%s' не найден в коллекции '%s'", ref, c.Name)
+		case 1:
+			found = matches[0]
+		default:
+			return RAGDocument{}, fmt.Errorf("имени '%s' соответствует %d документов, укажите путь или номер", ref, len(matches))
+		}
+	}
+
+	doc := c.Documents[found]
+	c.Documents = append(c.Documents[:found], c.Documents[found+1:]...)
+	return doc, nil
+}
+
+// Info возвращает краткие сведения о коллекции
+func (c *RAGCollection) Info() RAGCollectionInfo {
+	info := RAGCollectionInfo{Name: c.Name, Documents: len(c.Documents), Updated: c.Updated}
+	for _, doc := range c.Documents {
+		info.Size += doc.Size
+	}
+	return info
+}
+
+// ListRAGCollections возвращает сохраненные коллекции по имени
+func ListRAGCollections(active []string) ([]RAGCollectionInfo, error) {
+	entries, err := os.ReadDir(getRAGRootDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var list []RAGCollectionInfo
+	for _, e := range entries {
+		if !e.IsDir() || !RAGCollectionExists(e.Name()) {
+			continue
+		}
+		c, err := LoadRAGCollection(e.Name())
+		if err != nil {
+			continue
+		}
+		info := c.Info()
+		info.Active = containsString(active, c.Name)
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// DeleteRAGCollection удаляет коллекцию вместе с её векторным индексом
+func DeleteRAGCollection(name string) error {
+	if err := ValidateCollectionName(name); err != nil {
+		return err
+	}
+	if !RAGCollectionExists(name) {
+		return fmt.Errorf("коллекция '%s' не найдена", name)
+	}
+	return os.RemoveAll(getRAGDir(name))
+}
+
+// loadActiveCollections читает список активных коллекций
+func loadActiveCollections() []string {
+	data, err := os.ReadFile(filepath.Join(getRAGRootDir(), ragActiveFile))
+	if err != nil {
+		return nil
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return nil
+	}
+	return names
+}
+
+func saveActiveCollections(names []string) error {
+	if names == nil {
+		names = []string{}
+	}
+	return writeSecureJSON(filepath.Join(getRAGRootDir(), ragActiveFile), names, false)
+}
+
+// ActiveRAGCollections возвращает имена активных коллекций
+func (a *Assistant) ActiveRAGCollections() []string {
+	a.ragMutex.RLock()
+	defer a.ragMutex.RUnlock()
+	return append([]string(nil), a.ragCollections...)
+}
+
+// CurrentRAGCollection — коллекция, в которую добавляются документы: первая активная
+func (a *Assistant) CurrentRAGCollection() string {
+	a.ragMutex.RLock()
+	defer a.ragMutex.RUnlock()
+	if len(a.ragCollections) > 0 {
+		return a.ragCollections[0]
+	}
+	return DefaultRAGCollection
+}
+
+// UseRAGCollections делает активными указанные коллекции и загружает их документы.
+// Пустой список выключает RAG (коллекции остаются на диске)
+func (a *Assistant) UseRAGCollections(names []string) error {
+	var docs []RAGDocument
+	var active []string
+	for _, name := range names {
+		if containsString(active, name) {
+			continue
+		}
+		c, err := LoadRAGCollection(name)
+		if err != nil {
+			return err
+		}
+		for _, doc := range c.Documents {
+			doc.Collection = name
+			docs = append(docs, doc)
+		}
+		active = append(active, name)
+	}
+
+	if err := saveActiveCollections(active); err != nil {
+		return fmt.Errorf("не удалось сохранить список активных коллекций: %v", err)
+	}
+
+	a.ragMutex.Lock()
+	a.ragCollections = active
+	a.ragMutex.Unlock()
+
+	if len(docs) == 0 {
+		a.ClearRAGData()
+		return nil
+	}
+	a.SetRAGData(docs)
+	return nil
+}
+
+// AddRAGDocuments добавляет документы в коллекцию (по умолчанию — текущую) и делает её активной.
+// source — путь, из которого загружены документы (nil для загрузки через веб); replace заменяет
+// все документы и источники коллекции
+func (a *Assistant) AddRAGDocuments(collection string, docs []RAGDocument, source *RAGLoadSource, replace bool) (added, replaced int, err error) {
+	if collection == "" {
+		collection = a.CurrentRAGCollection()
+	}
+	if err := ValidateCollectionName(collection); err != nil {
+		return 0, 0, err
+	}
+
+	c, err := LoadRAGCollection(collection)
+	if err != nil {
+		if RAGCollectionExists(collection) {
+			return 0, 0, err
+		}
+		c = NewRAGCollection(collection)
+	}
+	if replace {
+		c.Documents = nil
+		c.Sources = nil
+	}
+	if source != nil {
+		c.AddSource(*source)
+	}
+	added, replaced = c.Upsert(docs)
+	if err := c.Save(); err != nil {
+		return 0, 0, fmt.Errorf("не удалось сохранить коллекцию '%s': %v", collection, err)
+	}
+
+	active := a.ActiveRAGCollections()
+	if !containsString(active, collection) {
+		active = append(active, collection)
+	}
+	return added, replaced, a.UseRAGCollections(active)
+}
+
+// RemoveRAGDocument удаляет документ из текущей коллекции
+func (a *Assistant) RemoveRAGDocument(ref string) (RAGDocument, string, error) {
+	collection := a.CurrentRAGCollection()
+	// Явная коллекция: коллекция/документ
+	if i := strings.Index(ref, ":"); i > 0 && RAGCollectionExists(ref[:i]) {
+		collection, ref = ref[:i], ref[i+1:]
+	}
+
+	c, err := LoadRAGCollection(collection)
+	if err != nil {
+		return RAGDocument{}, collection, err
+	}
+	doc, err := c.Remove(ref)
+	if err != nil {
+		return RAGDocument{}, collection, err
+	}
+	if err := c.Save(); err != nil {
+		return RAGDocument{}, collection, err
+	}
+	if active := a.ActiveRAGCollections(); containsString(active, collection) {
+		if err := a.UseRAGCollections(active); err != nil {
+			return doc, collection, err
+		}
+	}
+	return doc, collection, nil
+}
+
+// restoreRAGCollections активирует коллекции, активные при прошлом запуске
+func (a *Assistant) restoreRAGCollections() {
+	names := loadActiveCollections()
+	if len(names) == 0 {
+		return
+	}
+	var available []string
+	for _, name := range names {
+		if RAGCollectionExists(name) {
+			available = append(available, name)
+		}
+	}
+	if err := a.UseRAGCollections(available); err != nil {
+		fmt.Printf("⚠️  RAG-коллекции не восстановлены: %v\n", err)
+		return
+	}
+	if len(available) > 0 {
+		fmt.Printf("📚 RAG: активны коллекции %s (%d документов)\n",
+			strings.Join(available, ", "), len(a.GetRAGData()))
+	}
+}
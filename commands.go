@@ -25,33 +25,84 @@ type CommandHandler struct {
 	// lastQuery   string
 	lastContext string
 	terminalReader *TerminalReader
+	session     *SessionMeta
+}
+
+// completionCommands — команды для автодополнения (одни для запуска и после :open)
+var completionCommands = []string{
+	":clean", ":pop", ":ctx", ":limit", ":summarize", ":undo", ":redo", ":git", ":apply", ":sandbox", ":servers", ":search", ":title", ":tag", ":pin", ":unpin",
+	":save", ":load", ":ls", ":rm", ":export", ":import", ":migrate", ":sh", ":data", ":copy",
+	":clip", ":clip+", ":cd", ":pwd", ":open", ":dir",
+	":debug", ":stats", ":retry", ":models", ":model", ":providers", ":provider",
+	":set", ":get", ":reset", ":quit", ":help", ":history", ":skip",
 }
 
 // В начале файла после импортов добавить
 var commandHelp = map[string]string{
     ":data": `Загрузить файлы данных для RAG-режима
+Документы хранятся в именованных коллекциях (~/.cogitor/rag/<имя>) и переживают перезапуск.
 Использование: 
-  :data <путь_к_файлу>        — Загрузить один файл
-  :data <путь_к_директории>   — Загрузить все текстовые файлы из директории
-  :data                       — Выключить RAG-режим и очистить данные
+  :data <путь_к_файлу>        — Добавить файл в текущую коллекцию (файл с тем же путем заменяется)
+  :data <путь_к_директории>   — Добавить все поддерживаемые файлы из директории
+      --recursive, -r         — Включая поддиректории
+      --replace               — Заменить документы текущей коллекции загруженными
+      --include '<glob>'      — Только совпавшие файлы (можно несколько раз)
+      --exclude '<glob>'      — Исключить файлы и директории ('drafts/**')
+  :data add <путь> [флаги]    — То же, что :data <путь>
+  :data rm <документ>         — Удалить документ (номер, путь, имя файла или коллекция:документ)
+  :data refresh [имя...]      — Обновить измененные, новые и удаленные файлы (по хешам содержимого)
+  :data watch [on|off]        — Следить за файлами активных коллекций и обновлять их автоматически
+  :data crawl <url> [флаги]   — Обойти сайт в коллекцию (по умолчанию — по имени хоста)
+      --depth N               — Глубина переходов по ссылкам (2)
+      --any-host              — Переходить и на другие хосты (по умолчанию — только тот же хост)
+      --max-pages N           — Не больше N страниц (200)
+      --delay мс              — Пауза между запросами к хосту (1000, не меньше 250; Crawl-delay из robots.txt главнее)
+      --collection <имя>      — Коллекция для страниц
+      --restart               — Начать заново вместо продолжения прерванного обхода
+  :data new <имя>             — Создать коллекцию и сделать её текущей
+  :data use <имя>...          — Активировать коллекции (первая — текущая, в нее идет :data add)
+  :data ls                    — Список коллекций
+  :data delete <имя>          — Удалить коллекцию с диска
+  :data                       — Выключить RAG-режим (коллекции остаются на диске)
   :data status                — Показать статус загруженных данных
 
-Поддерживаемые форматы: .txt, .json, .csv, .md, .xml, .yaml, .yml
+Поддерживаемые форматы: .txt, .json, .csv, .md, .xml, .yaml, .yml,
+  .pdf, .docx, .html/.htm и исходный код (.go, .py, .js, .ts, .java, .c, .cpp, .rs...)
+Предупреждения извлечения (сканы PDF, изображения, кодировки) — в :data status
+Учитываются .gitignore и .cogitorignore; лимит размера файла — :set rag_max_file_kb
 Примеры:
   :data ./data.txt
   :data /path/to/dataset/
-  :data ../data/`,
+  :data ./docs --recursive --include '*.md' --exclude 'drafts/**'
+  :data new api-docs
+  :data add ./openapi.yaml
+  :data use api-docs handbook
+  :data rm 3
+  :data crawl https://go.dev/doc/ --depth 2 --max-pages 200`,
 	":clean":     "Очистить всю историю контекста\nИспользование: :clean",
+	":search":    "Полнотекстовый поиск по сохраненным сессиям и текущему контексту\nИспользование: :search <текст>\nНайденный обмен можно загрузить: :load <сессия> <номер обмена>",
+	":title":     "Показать или задать заголовок сессии\nИспользование:\n  :title          — показать заголовок\n  :title <текст>  — задать заголовок\n  :title auto     — сгенерировать заголовок с помощью LLM\nБез явного заголовка при :save используется первый вопрос",
+	":tag":       "Управление тегами сессии\nИспользование:\n  :tag              — показать теги\n  :tag <тег>...     — добавить теги\n  :tag -<тег>...    — удалить теги\nФильтр по тегу: :ls <тег>",
+	":pin":       "Закрепить заметку: она всегда передается в контексте и сохраняется с сессией\nИспользование:\n  :pin            — показать заметки\n  :pin <текст>    — закрепить заметку",
+	":unpin":     "Удалить закрепленную заметку\nИспользование: :unpin <номер|all>",
+	":undo":      "Отменить последнюю операцию (:clean, :pop, :summarize, :load, применение DIFF, запись сгенерированных файлов)\nИспользование: :undo [list]\nСнимки файлов хранятся в .cogitor/snapshots",
+	":redo":      "Повторить последнюю отмененную операцию\nИспользование: :redo",
+	":apply":     "Применить план, составленный в режиме dry-run\nИспользование: :apply [план] [--no-run] [--force]\n  план      — файл или имя в .cogitor/plans (по умолчанию последний)\n  --no-run  — только записать файлы, без установок и команд\n  --force   — перезаписать файлы, измененные после создания плана\nРежим dry-run: cogitor --dry-run или :set dry_run on",
+	":sandbox":   "Песочница для запуска сгенерированного кода: отдельный временный каталог, лимиты ресурсов, изоляция\nИспользование:\n  :sandbox                — настройки и доступный бэкенд\n  :sandbox once <парам.>  — параметры только для следующего запуска\n  :sandbox reset          — отменить разовые параметры\nПараметры: off, net, nonet, cpu=N, mem=N, file=N, procs=N, backend=auto|bwrap|namespaces|limits\nПример: :sandbox once net cpu=120\nНастройки: sandbox, sandbox_network, sandbox_cpu_sec, sandbox_memory_mb, sandbox_file_mb, sandbox_procs",
+	":servers":   "Серверы из сгенерированного кода, запущенные в фоне после проверки порта\nИспользование:\n  :servers              — список серверов\n  :servers stop [n|all] — остановить сервер n или все\n  :servers log <n>      — вывод сервера\nСервер распознается по коду (ListenAndServe, app.run, serve_forever, listen и т.п.); готовность ждется до run_timeout секунд",
+	":git":       "Работа с git-репозиторием текущей директории\nИспользование:\n  :git                    — ветка, автокоммит и незакоммиченные файлы\n  :git log [n]            — последние n коммитов (по умолчанию 10)\n  :git diff [--staged] [путь] — незакоммиченные изменения\n  :git revert [коммит]    — создать коммит, отменяющий указанный (по умолчанию последний)\nНастройки: git_auto_commit (коммит после $cod/$diff), git_branch (рабочая ветка)\nВ запросах: @git:diff, @git:staged, @git:log",
     ":copy": "Включить/выключить автоматическое копирование ответов в буфер обмена\nИспользование: :copy [on|off|status]\nПримеры:\n  :copy on   - включить авто-копирование\n  :copy off  - выключить\n  :copy      - показать статус",
 	":pop":       "Удалить последние n обменов из контекста (по умолчанию 1)\nИспользование: :pop [n]",
 	":ctx":       "Показать статистику контекста (количество обменов и токенов)\nИспользование: :ctx",
 	":limit":     "Установить максимальное количество обменов в контексте\nИспользование: :limit <число>",
-	":summarize": "Сжать контекст до 1-2 предложений с помощью LLM\nИспользование: :summarize",
-	":save":      "Сохранить текущую сессию в файл\nИспользование: :save [имя]",
-	":load":      "Загрузить сессию из файла\nИспользование: :load <имя>",
-	":ls":        "Показать список сохраненных сессий\nИспользование: :ls",
+	":summarize": "Сжать старые обмены в накопительную сводку с помощью LLM (последние обмены остаются дословно)\nИспользование: :summarize [n|undo]\n  n     — сколько последних обменов оставить (по умолчанию summary_keep_recent)\n  undo  — отменить последнюю суммаризацию\nАвтоматически выполняется при превышении context_token_budget (auto_summarize)",
+	":save":      "Сохранить текущую сессию в файл\nИспользование: :save [имя] [--encrypt|--no-encrypt]\nС --encrypt сессия шифруется AES-GCM (пароль или encryption_key_file); по умолчанию — настройка encrypt_sessions\nВместе с обменами сохраняются заголовок, теги, рабочая директория, RAG-документы и закрепленные заметки",
+	":load":      "Загрузить сессию из файла\nИспользование: :load <имя> [номер обмена]\nС номером обмена загружается история до него включительно\nВосстанавливает рабочую директорию и RAG-документы сессии",
+	":ls":        "Показать список сохраненных сессий с заголовками и тегами\nИспользование: :ls [тег]",
 	":rm":        "Удалить сохраненную сессию\nИспользование: :rm <имя>",
-	":export":    "Экспортировать диалог в файл (форматы: md/txt/json)\nИспользование: :export [fmt]",
+	":import":    "Импортировать диалоги из файла в сохраненные сессии\nИспользование: :import <файл> [имя]\nФорматы:\n  conversations.json     — экспорт ChatGPT (OpenAI)\n  [{role, content}]      — JSON-массив сообщений\n  *.md                   — Markdown-экспорт cogitor (:export md)\nПеред сохранением показывается сводка найденных обменов",
+	":migrate":   "Зашифровать или расшифровать все сохраненные сессии и исправить права доступа (0600)\nИспользование: :migrate <encrypt|decrypt|perms>\nКлюч: пароль (запрашивается, либо COGITOR_PASSPHRASE) или encryption_key_file",
+	":export":    "Экспортировать диалог (форматы: md/txt/json/html/code)\nИспользование: :export [fmt] [путь]\n  md    — Markdown с fenced-блоками кода\n  html  — автономная HTML-страница с подсветкой синтаксиса\n  json  — JSON с метаданными сессии\n  code  — записать все блоки '--- File:' в дерево директорий (путь — директория)",
 	":clip":      "Показать содержимое буфера обмена\nИспользование: :clip",
 	":clip+":     "Добавить буфер обмена в следующий запрос\nИспользование: :clip+",
     ":skip":      "Включить/выключить пропуск автоматической установки зависимостей\nИспользование: :skip [on|off]\nКогда включено, программа показывает команды для ручной установки и ожидает нажатия Enter",
@@ -83,6 +134,7 @@ func NewCommandHandler(assistant AssistantAPI, config *Config, stats *Statistics
 		config:    config,
 		stats:     stats,
 		terminalReader: terminalReader,
+		session:   NewSessionMeta(),
 	}
 }
 
@@ -130,8 +182,11 @@ func (ch *CommandHandler) Handle(query string) bool {
 
 	switch command {
 	case ":clean":
+		op := ch.assistant.GetJournal().Begin(":clean", ch.assistant.GetContext())
 		ch.assistant.GetContext().Clear()
-		fmt.Println("✅ Контекст очищен")
+		op.Commit()
+		ch.session.Reset()
+		fmt.Println("✅ Контекст очищен (отмена: :undo)")
 	case ":pop":
         n := 1
         if len(args) > 0 {
@@ -145,10 +200,12 @@ func (ch *CommandHandler) Handle(query string) bool {
             }
         }
         
+        op := ch.assistant.GetJournal().Begin(fmt.Sprintf(":pop %d", n), ch.assistant.GetContext())
         if err := ch.assistant.GetContext().Pop(n); err != nil {
             fmt.Printf("❌ Ошибка: %v\n", err)
             return true
         }
+        op.Commit()
         fmt.Printf("✅ Удалено %d последних обменов\n", n)	
 
 	case ":ctx":
@@ -160,7 +217,10 @@ func (ch *CommandHandler) Handle(query string) bool {
         
         fmt.Printf("📊 Статистика контекста:\n")
         fmt.Printf("   Обменов: %d / %d (%.0f%%)\n", count, limit, usagePercent)
-        fmt.Printf("   Оценка токенов: ~%d\n", tokens)
+        fmt.Printf("   Оценка токенов: ~%d / %d\n", tokens, ch.config.GetInt("context_token_budget", DefaultContextTokenBudget))
+        if summary := ch.assistant.GetContext().GetSummary(); summary != "" {
+            fmt.Printf("   Сводка старых обменов: %d символов\n", len(summary))
+        }
         
         if count >= limit {
             fmt.Printf("⚠️  ВНИМАНИЕ: Достигнут лимит контекста!\n")
@@ -199,8 +259,7 @@ func (ch *CommandHandler) Handle(query string) bool {
         }
     
 	case ":summarize":
-		autoMode := ch.config.GetBool("auto_execute")
-		ch.handleSummarize(autoMode)
+		ch.handleSummarize(args)
     case ":sh":
         ch.handleSh(args)
 	case ":dir":
@@ -210,9 +269,13 @@ func (ch *CommandHandler) Handle(query string) bool {
 	case ":load":
 		ch.handleLoad(args)
 	case ":ls":
-		ch.handleListSessions()
+		ch.handleListSessions(args)
 	case ":rm":
 		ch.handleRemove(args)
+	case ":import":
+		ch.handleImport(args)
+	case ":migrate":
+		ch.handleMigrate(args)
 	case ":export":
 		ch.handleExport(args)
     case ":skip":
@@ -252,6 +315,11 @@ func (ch *CommandHandler) Handle(query string) bool {
 		fmt.Println("✅ Настройки сброшены")
 	case ":quit", ":q":
 		fmt.Println("\n🤖 Ассистент: До свидания!")
+		// os.Exit не выполняет defer, поэтому закрываем автосохранение явно
+		if a, ok := ch.assistant.(*Assistant); ok {
+			a.stopAutosave()
+			a.codeRunner.StopServers()
+		}
 		os.Exit(0)
 	case ":help", ":h":
 		ch.showHelp(args)
@@ -259,6 +327,28 @@ func (ch *CommandHandler) Handle(query string) bool {
         ch.handleCopyCommand(args)
     case ":data":
         ch.handleData(args)
+	case ":search":
+		ch.handleSearch(args)
+	case ":title":
+		ch.handleTitle(args)
+	case ":tag":
+		ch.handleTag(args)
+	case ":pin":
+		ch.handlePin(args)
+	case ":unpin":
+		ch.handleUnpin(args)
+	case ":undo":
+		ch.handleUndo(args)
+	case ":redo":
+		ch.handleRedo()
+	case ":git":
+		ch.handleGit(args)
+	case ":apply":
+		ch.handleApply(args)
+	case ":sandbox":
+		ch.handleSandbox(args)
+	case ":servers":
+		ch.handleServers(args)
 	default:
 		fmt.Printf("❌ Неизвестная команда: %s\nНаберите :help для списка команд\n", command)
 	}
@@ -315,20 +405,79 @@ func (ch *CommandHandler) handleData(args []string) {
         // return
     // }
 // 
+    assistant := ch.assistant.(*Assistant)
     if len(args) == 0 {
         // Выключить RAG-режим
-        ch.assistant.(*Assistant).ClearRAGData()
-        fmt.Println("✅ RAG-режим выключен, данные очищены")
+        if err := assistant.UseRAGCollections(nil); err != nil {
+            fmt.Printf("⚠️  %v\n", err)
+        }
+        fmt.Println("✅ RAG-режим выключен (коллекции сохранены, включить: :data use <имя>)")
         return
     }
     
-    // Проверка статуса
-    if args[0] == "status" || args[0] == "stat" {
+    switch args[0] {
+    case "status", "stat":
         ch.showRAGStatus()
         return
+    case "ls", "list":
+        ch.listRAGCollections()
+        return
+    case "use":
+        ch.useRAGCollections(args[1:])
+        return
+    case "new":
+        if len(args) != 2 {
+            fmt.Println("Использование: :data new <имя>")
+            return
+        }
+        ch.newRAGCollection(args[1])
+        return
+    case "delete":
+        if len(args) != 2 {
+            fmt.Println("Использование: :data delete <имя>")
+            return
+        }
+        ch.deleteRAGCollection(args[1])
+        return
+    case "rm":
+        if len(args) != 2 {
+            fmt.Println("Использование: :data rm <номер|путь|имя файла|коллекция:документ>")
+            return
+        }
+        doc, collection, err := assistant.RemoveRAGDocument(strings.Trim(args[1], "'\""))
+        if err != nil {
+            fmt.Printf("❌ %v\n", err)
+            return
+        }
+        fmt.Printf("✅ Документ %s удален из коллекции '%s'\n", doc.FilePath, collection)
+        return
+    case "add":
+        ch.loadRAGData(args[1:])
+        return
+    case "refresh":
+        ch.refreshRAGData(args[1:])
+        return
+    case "watch":
+        ch.watchRAGData(args[1:])
+        return
+    case "crawl":
+        ch.crawlRAGData(args[1:])
+        return
     }
     
-    path := args[0]
+    ch.loadRAGData(args)
+}
+
+// loadRAGData добавляет файлы в текущую коллекцию (документы с тем же путем заменяются);
+// с --replace заменяет все её документы
+func (ch *CommandHandler) loadRAGData(args []string) {
+    path, opts, err := parseRAGDataArgs(args)
+    if err != nil {
+        fmt.Printf("❌ %v\n", err)
+        fmt.Println("Использование: :data [add] <путь> [--recursive] [--include '<glob>'] [--exclude '<glob>'] [--replace]")
+        return
+    }
+    opts.MaxFileSize = ragMaxFileSize(ch.config)
     resolvedPath := ch.resolveDirectoryPath(path)
     
     // Проверяем существование
@@ -341,8 +490,12 @@ func (ch *CommandHandler) handleData(args []string) {
     var docs []RAGDocument
     if info.IsDir() {
         // Загружаем все файлы из директории
-        docs = ch.loadFilesFromDirectory(resolvedPath)
+        docs = ch.loadFilesFromDirectory(resolvedPath, opts)
     } else {
+        if limit := ragFileSizeLimit(resolvedPath, opts.MaxFileSize); limit > 0 && info.Size() > limit {
+            fmt.Printf("❌ Файл больше лимита %d КБ (:set rag_max_file_kb <КБ>)\n", limit/1024)
+            return
+        }
         // Загружаем один файл
         doc, err := ch.loadSingleFile(resolvedPath)
         if err != nil {
@@ -357,22 +510,257 @@ func (ch *CommandHandler) handleData(args []string) {
         return
     }
     
-    // Устанавливаем данные в Assistant
-    ch.assistant.(*Assistant).SetRAGData(docs)
+    // Сохраняем документы в коллекцию и обновляем индекс
+    assistant := ch.assistant.(*Assistant)
+    collection := assistant.CurrentRAGCollection()
+    source := &RAGLoadSource{
+        Path:      resolvedPath,
+        Recursive: opts.Recursive,
+        Include:   opts.Include,
+        Exclude:   opts.Exclude,
+    }
+    added, replaced, err := assistant.AddRAGDocuments(collection, docs, source, opts.Replace)
+    if err != nil {
+        fmt.Printf("❌ %v\n", err)
+        return
+    }
     
     // Показываем статистику
     totalSize := 0
+    warnings := 0
     for _, doc := range docs {
         totalSize += doc.Size
+        warnings += len(doc.Warnings)
     }
     
-    fmt.Printf("✅ RAG-режим активирован\n")
-    fmt.Printf("📊 Загружено документов: %d\n", len(docs))
+    fmt.Printf("✅ RAG-режим активирован, коллекция '%s'\n", collection)
+    fmt.Printf("📊 Загружено документов: %d (новых %d, обновлено %d)\n", len(docs), added, replaced)
     fmt.Printf("📊 Общий размер: %d символов\n", totalSize)
-    fmt.Printf("📊 Использование: данные будут использоваться для всех последующих запросов\n")
+    fmt.Printf("📊 Активные коллекции: %s, документов всего %d\n", 
+        strings.Join(assistant.ActiveRAGCollections(), ", "), len(assistant.GetRAGData()))
+    fmt.Printf("📊 Фрагментов в индексе: %d\n", assistant.GetRAGChunkCount())
+    fmt.Printf("📊 Использование: в каждый запрос попадут наиболее подходящие фрагменты\n")
+    if warnings > 0 {
+        fmt.Printf("⚠️  Предупреждений при извлечении текста: %d (подробности: :data status)\n", warnings)
+    }
     fmt.Printf("💡 Для отключения введите: :data\n")
 }
 
+// refreshRAGData заново загружает только измененные, новые и удаленные файлы коллекций
+func (ch *CommandHandler) refreshRAGData(names []string) {
+    assistant := ch.assistant.(*Assistant)
+    reports, err := assistant.RefreshRAGCollections(names)
+    for _, r := range reports {
+        if r.HasChanges() {
+            fmt.Printf("🔄 Коллекция %s\n", r)
+        } else {
+            fmt.Printf("✅ Коллекция '%s' актуальна (%d документов)\n", r.Collection, r.Unchanged)
+        }
+        for _, p := range r.Added {
+            fmt.Printf("   + %s\n", p)
+        }
+        for _, p := range r.Changed {
+            fmt.Printf("   ~ %s\n", p)
+        }
+        for _, p := range r.Removed {
+            fmt.Printf("   - %s\n", p)
+        }
+        for _, s := range r.Skipped {
+            fmt.Printf("⚠️  Пропущен %s: %s\n", s.Path, s.Reason)
+        }
+    }
+    if err != nil {
+        fmt.Printf("❌ %v\n", err)
+    }
+}
+
+// watchRAGData включает или выключает слежение за файлами активных коллекций
+func (ch *CommandHandler) watchRAGData(args []string) {
+    assistant := ch.assistant.(*Assistant)
+    if len(args) == 0 {
+        if assistant.IsRAGWatching() {
+            fmt.Printf("🔄 Слежение за RAG-файлами включено (каждые %d с)\n", 
+                ch.config.GetInt("rag_watch_interval", DefaultRAGWatchInterval))
+        } else {
+            fmt.Println("🔄 Слежение за RAG-файлами выключено (:data watch on)")
+        }
+        return
+    }
+    
+    switch args[0] {
+    case "on":
+        assistant.StartRAGWatch(ragWatchInterval(ch.config))
+        fmt.Printf("✅ Слежение за RAG-файлами включено (каждые %d с)\n", 
+            ch.config.GetInt("rag_watch_interval", DefaultRAGWatchInterval))
+    case "off":
+        assistant.StopRAGWatch()
+        fmt.Println("✅ Слежение за RAG-файлами выключено")
+    default:
+        fmt.Println("Использование: :data watch [on|off]")
+        return
+    }
+    ch.config.Set("rag_watch", args[0])
+    ch.config.Save()
+}
+
+// crawlRAGData обходит сайт и сохраняет страницы в RAG-коллекцию
+func (ch *CommandHandler) crawlRAGData(args []string) {
+    startURL, opts, err := parseCrawlArgs(args)
+    if err != nil {
+        fmt.Printf("❌ %v\n", err)
+        fmt.Println("Использование: :data crawl <url> [--depth N] [--any-host] [--max-pages N] [--delay мс] [--collection имя] [--restart]")
+        return
+    }
+    
+    assistant := ch.assistant.(*Assistant)
+    c, done := assistant.cancelableCommand()
+    defer done()
+    
+    fmt.Printf("🕸️  Обход %s (глубина %d, до %d страниц, пауза %v; Ctrl+C — прервать)\n", 
+        startURL, opts.Depth, opts.MaxPages, opts.Delay)
+    progress := func(state *CrawlState, current string) {
+        if len([]rune(current)) > 60 {
+            current = string([]rune(current)[:57]) + "..."
+        }
+        fmt.Printf("\r\033[K🕸️  %d/%d, в очереди %d: %s", state.Pages, state.MaxPages, len(state.Queue), current)
+    }
+    collection, state, resumed, err := assistant.CrawlToCollection(c, startURL, opts, progress)
+    fmt.Print("\r\033[K")
+    if resumed {
+        fmt.Printf("⏯️  Продолжен прерванный обход (параметры первого запуска, заново: --restart)\n")
+    }
+    if state != nil {
+        for i, f := range state.Failed {
+            if i == 10 {
+                fmt.Printf("⚠️  ... и еще %d ошибок\n", len(state.Failed)-10)
+                break
+            }
+            fmt.Printf("⚠️  %s: %s\n", f.Path, f.Reason)
+        }
+        fmt.Printf("📊 Страниц загружено: %d, ошибок: %d, в очереди: %d\n", 
+            state.Pages, len(state.Failed), len(state.Queue))
+        if !state.Done {
+            fmt.Printf("⏸️  Обход прерван. Продолжить: :data crawl %s --collection %s\n", state.StartURL, collection)
+        }
+    }
+    if err != nil {
+        fmt.Printf("❌ %v\n", err)
+        return
+    }
+    fmt.Printf("✅ Коллекция '%s' активна: %d документов, %d фрагментов\n", 
+        collection, len(assistant.GetRAGData()), assistant.GetRAGChunkCount())
+    fmt.Printf("💡 Ответы будут ссылаться на адреса страниц\n")
+}
+
+// listRAGCollections выводит сохраненные коллекции
+func (ch *CommandHandler) listRAGCollections() {
+    assistant := ch.assistant.(*Assistant)
+    list, err := ListRAGCollections(assistant.ActiveRAGCollections())
+    if err != nil {
+        fmt.Printf("❌ Ошибка чтения коллекций: %v\n", err)
+        return
+    }
+    if len(list) == 0 {
+        fmt.Println("📚 Коллекций нет. Создать: :data new <имя> или :data <путь>")
+        return
+    }
+    current := assistant.CurrentRAGCollection()
+    fmt.Println("📚 RAG-коллекции:")
+    for _, info := range list {
+        mark := "  "
+        if info.Active {
+            mark = "✅"
+        }
+        suffix := ""
+        if info.Active && info.Name == current {
+            suffix = " (текущая)"
+        }
+        updated := info.Updated
+        if t, err := time.Parse(time.RFC3339, info.Updated); err == nil {
+            updated = t.Format("02.01.2006 15:04")
+        }
+        fmt.Printf("   %s %s%s — %d документов, %d символов, изменена %s\n", 
+            mark, info.Name, suffix, info.Documents, info.Size, updated)
+    }
+}
+
+// useRAGCollections активирует коллекции; без аргументов показывает активные
+func (ch *CommandHandler) useRAGCollections(names []string) {
+    assistant := ch.assistant.(*Assistant)
+    if len(names) == 0 {
+        active := assistant.ActiveRAGCollections()
+        if len(active) == 0 {
+            fmt.Println("📚 Активных коллекций нет. Использование: :data use <имя>...")
+            return
+        }
+        fmt.Printf("📚 Активные коллекции: %s\n", strings.Join(active, ", "))
+        return
+    }
+    if err := assistant.UseRAGCollections(names); err != nil {
+        fmt.Printf("❌ %v\n", err)
+        return
+    }
+    fmt.Printf("✅ Активные коллекции: %s (%d документов, %d фрагментов)\n", 
+        strings.Join(assistant.ActiveRAGCollections(), ", "), 
+        len(assistant.GetRAGData()), assistant.GetRAGChunkCount())
+}
+
+// newRAGCollection создает пустую коллекцию и делает её текущей
+func (ch *CommandHandler) newRAGCollection(name string) {
+    if err := ValidateCollectionName(name); err != nil {
+        fmt.Printf("❌ %v\n", err)
+        return
+    }
+    if RAGCollectionExists(name) {
+        fmt.Printf("❌ Коллекция '%s' уже существует (активировать: :data use %s)\n", name, name)
+        return
+    }
+    if err := NewRAGCollection(name).Save(); err != nil {
+        fmt.Printf("❌ Не удалось создать коллекцию: %v\n", err)
+        return
+    }
+    
+    // Новая коллекция становится текущей, остальные активные сохраняются
+    assistant := ch.assistant.(*Assistant)
+    active := []string{name}
+    for _, n := range assistant.ActiveRAGCollections() {
+        if n != name {
+            active = append(active, n)
+        }
+    }
+    if err := assistant.UseRAGCollections(active); err != nil {
+        fmt.Printf("❌ %v\n", err)
+        return
+    }
+    fmt.Printf("✅ Коллекция '%s' создана и стала текущей\n", name)
+    fmt.Printf("💡 Добавить документы: :data add <путь>\n")
+}
+
+// deleteRAGCollection удаляет коллекцию с диска
+func (ch *CommandHandler) deleteRAGCollection(name string) {
+    assistant := ch.assistant.(*Assistant)
+    response, err := ch.terminalReader.ReadLineWithPrompt(
+        fmt.Sprintf("⚠️  Удалить коллекцию '%s' вместе с векторным индексом? (y/n): ", name))
+    if err != nil || strings.ToLower(strings.TrimSpace(response)) != "y" {
+        fmt.Println("❌ Удаление отменено")
+        return
+    }
+    if err := DeleteRAGCollection(name); err != nil {
+        fmt.Printf("❌ %v\n", err)
+        return
+    }
+    var active []string
+    for _, n := range assistant.ActiveRAGCollections() {
+        if n != name {
+            active = append(active, n)
+        }
+    }
+    if err := assistant.UseRAGCollections(active); err != nil {
+        fmt.Printf("⚠️  %v\n", err)
+    }
+    fmt.Printf("✅ Коллекция '%s' удалена\n", name)
+}
+
 // handleDataWeb обрабатывает команду :data в веб-режиме
 func (ch *CommandHandler) handleDataWeb(args []string) {
     // Перенаправляем на JavaScript функцию
@@ -382,72 +770,35 @@ func (ch *CommandHandler) handleDataWeb(args []string) {
 
 // Вспомогательные функции для загрузки файлов:
 func (ch *CommandHandler) loadSingleFile(filePath string) (RAGDocument, error) {
-    content, err := os.ReadFile(filePath)
-    if err != nil {
-        return RAGDocument{}, err
-    }
-    
     // Проверяем поддерживаемый формат
     if !isSupportedRAGFile(filePath) {
         return RAGDocument{}, fmt.Errorf("неподдерживаемый формат файла")
     }
     
-    return RAGDocument{
-        FilePath: filePath,
-        Content:  string(content),
-        Size:     len(content),
-        LoadedAt: time.Now(),
-    }, nil
+    content, err := os.ReadFile(filePath)
+    if err != nil {
+        return RAGDocument{}, err
+    }
+    
+    return ExtractRAGDocument(filePath, content, ragMaxFileSize(ch.config))
 }
 
-func (ch *CommandHandler) loadFilesFromDirectory(dirPath string) []RAGDocument {
-    var docs []RAGDocument
-    
-    files, err := os.ReadDir(dirPath)
+func (ch *CommandHandler) loadFilesFromDirectory(dirPath string, opts RAGLoadOptions) []RAGDocument {
+    files, skipped, err := CollectRAGFiles(dirPath, opts)
     if err != nil {
         fmt.Printf("❌ Ошибка чтения директории: %v\n", err)
-        return docs
+        return nil
+    }
+    if len(files) == 0 && !opts.Recursive {
+        fmt.Println("💡 Для загрузки поддиректорий добавьте --recursive")
     }
     
-    supportedExtensions := []string{".txt", ".json", ".csv", ".md", ".xml", ".yaml", ".yml"}
+    docs, failed := LoadRAGFiles(files, opts.MaxFileSize, true)
+    skipped = append(skipped, failed...)
     
-    for _, file := range files {
-        if file.IsDir() {
-            continue
-        }
-        
-        filePath := filepath.Join(dirPath, file.Name())
-        
-        // Проверяем расширение
-        ext := strings.ToLower(filepath.Ext(file.Name()))
-        supported := false
-        for _, supportedExt := range supportedExtensions {
-            if ext == supportedExt {
-                supported = true
-                break
-            }
-        }
-        
-        if !supported {
-            continue
-        }
-        
-        // Проверяем размер файла (ограничение 1MB)
-        info, err := file.Info()
-        if err != nil || info.Size() > 1024*1024 {
-            fmt.Printf("⚠️  Файл %s слишком большой или недоступен, пропускаем\n", file.Name())
-            continue
-        }
-        
-        doc, err := ch.loadSingleFile(filePath)
-        if err != nil {
-            fmt.Printf("⚠️  Ошибка загрузки файла %s: %v\n", file.Name(), err)
-            continue
-        }
-        
-        docs = append(docs, doc)
+    for _, s := range skipped {
+        fmt.Printf("⚠️  Пропущен %s: %s\n", s.Path, s.Reason)
     }
-    
     return docs
 }
 
@@ -475,31 +826,55 @@ func (ch *CommandHandler) showRAGStatus() {
             totalSize += doc.Size
         }
         
+        fmt.Printf("📚 Активные коллекции: %s (текущая: %s)\n", 
+            strings.Join(assistant.ActiveRAGCollections(), ", "), assistant.CurrentRAGCollection())
         fmt.Printf("📊 Загружено документов: %d\n", len(docs))
         fmt.Printf("📊 Общий размер данных: %d символов\n", totalSize)
-        fmt.Printf("📊 Список файлов:\n")
+        fmt.Printf("📊 Фрагментов в индексе BM25: %d (по %d символов, в контекст до %d)\n", 
+            assistant.GetRAGChunkCount(), RAGChunkSize, RAGTopK)
+        if stores := assistant.GetRAGVectorStores(); len(stores) > 0 {
+            fmt.Printf("🧮 Модель эмбеддингов: %s/%s, поиск гибридный\n", stores[0].Provider, stores[0].Model)
+            for _, store := range stores {
+                count, size := store.Size()
+                fmt.Printf("🧮 Векторный индекс '%s': %d векторов (размерность %d), %.1f КБ, %s\n", 
+                    store.Collection, count, store.Dim, float64(size)/1024, store.Path())
+            }
+        } else if ch.config.GetBool("rag_embeddings") {
+            fmt.Printf("🧮 Векторный индекс недоступен, поиск только по BM25\n")
+        } else {
+            fmt.Printf("🧮 Векторный поиск выключен (:set rag_embeddings on)\n")
+        }
+        for _, t := range assistant.GetRAGTables() {
+            fmt.Printf("🧾 Таблица %s: %d строк, колонки: %s\n", 
+                t.Name, len(t.Rows), strings.Join(t.Columns, ", "))
+        }
+        // Номера документов — внутри коллекции, как в :data rm
+        n := 0
         for i, doc := range docs {
-            fmt.Printf("   %d. %s (%d символов, загружен %s)\n", 
-                i+1, doc.FilePath, doc.Size, 
+            if i == 0 || doc.Collection != docs[i-1].Collection {
+                fmt.Printf("📊 Документы коллекции '%s':\n", doc.Collection)
+                if crawl := crawlStateSummary(doc.Collection); crawl != "" {
+                    fmt.Printf("   🕸️  Обход %s\n", crawl)
+                }
+                n = 0
+            }
+            n++
+            kind := doc.Format
+            if doc.Language != "" {
+                kind = "код: " + doc.Language
+            }
+            fmt.Printf("   %d. %s [%s] (%d символов, загружен %s)\n", 
+                n, doc.FilePath, kind, doc.Size, 
                 doc.LoadedAt.Format("02.01.2006 15:04"))
+            for _, w := range doc.Warnings {
+                fmt.Printf("      ⚠️  %s\n", w)
+            }
         }
     } else {
         fmt.Printf("📊 Данные не загружены\n")
     }
 }
 
-func isSupportedRAGFile(filePath string) bool {
-    ext := strings.ToLower(filepath.Ext(filePath))
-    supported := []string{".txt", ".json", ".csv", ".md", ".xml", ".yaml", ".yml"}
-    
-    for _, supportedExt := range supported {
-        if ext == supportedExt {
-            return true
-        }
-    }
-    return false
-}
-
 func (ch *CommandHandler) handleSkipInstall(args []string) {
 	if len(args) == 0 {
 		skipMode, ok := ch.config.Get("skip_install")
@@ -791,51 +1166,230 @@ func (ch *CommandHandler) clearHistory() {
 
 // ========== Методы контекста ==========
 
-func (ch *CommandHandler) handleSummarize(autoMode bool) {
-    if ch.assistant.GetContext().GetExchangeCount() == 0 {
+func (ch *CommandHandler) handleSummarize(args []string) {
+    cm := ch.assistant.GetContext()
+
+    if len(args) > 0 && args[0] == "undo" {
+        op := ch.assistant.GetJournal().Begin(":summarize undo", cm)
+        if err := cm.RestoreSummaryBackup(); err != nil {
+            fmt.Printf("❌ Ошибка: %v\n", err)
+            return
+        }
+        op.Commit()
+        fmt.Printf("✅ Суммаризация отменена (обменов: %d)\n", cm.GetExchangeCount())
+        return
+    }
+
+    if cm.GetExchangeCount() == 0 && cm.EvictedCount() == 0 {
         fmt.Println("⚠️ Контекст пуст, нечего суммаризировать")
         return
     }
 
-    if !autoMode {
-        fmt.Sprintf("Сжаты обмены с LLM. Оригинал будет потерян.")
-        // count := ch.assistant.GetContext().GetExchangeCount()
-        // response, err := ch.terminalReader.ReadLineWithPrompt(
-            // fmt.Sprintf("Сжать %d обменов? Оригинал будет потерян. (y/n): ", count))
-        // if err != nil || strings.ToLower(strings.TrimSpace(response)) != "y" {
-            // fmt.Println("❌ Суммаризация отменена")
-            // return
-        // }
+    keep := ch.config.GetInt("summary_keep_recent", DefaultSummaryKeepRecent)
+    if len(args) > 0 {
+        if _, err := fmt.Sscanf(args[0], "%d", &keep); err != nil || keep < 0 {
+            fmt.Printf("❌ Недопустимое число: %s\n", args[0])
+            return
+        }
     }
 
-    // Сохраняем оригинал для возможной отмены
-    original := ch.assistant.GetContext().GetAllExchanges()
-    backup := strings.Join(original, "|EXCHANGE_BREAK|")
-    ch.config.Set("summarize_backup", backup)
-    ch.config.Save()
+    op := ch.assistant.GetJournal().Begin(":summarize", cm)
+    summary, count, err := SummarizeContext(ctx.Background(), cm, keep,
+        ch.assistant.GetProvider(), ch.assistant.GetModel(), ch.assistant.GetAPIKey())
+    if err != nil {
+        fmt.Printf("❌ Ошибка: %v\n", err)
+        return
+    }
+    if count == 0 {
+        fmt.Printf("⚠️ Нечего сжимать: в контексте не больше %d обменов\n", keep)
+        return
+    }
+    op.Commit()
 
-    // Выполняем суммаризацию
-    context := ch.assistant.GetContext().GetContext()
-    prompt := fmt.Sprintf(`Сожми диалог до 2-4 предложений:
-    
-    %s
-    
-    ВЕРНИ ТОЛЬКО сводку.`, context)
-	response, err := SendMessageToLLM(ctx.Background(), prompt, ch.assistant.GetProvider(), ch.assistant.GetModel(), ch.assistant.GetAPIKey())
+    fmt.Printf("📋 Сводка (сжато обменов: %d, дословно оставлено: %d):\n%s\n", count, cm.GetExchangeCount(), summary)
+    fmt.Printf("💡 Для отмены используйте :summarize undo\n")
+}
+
+
+func (ch *CommandHandler) handleSearch(args []string) {
+    query := strings.TrimSpace(strings.Join(args, " "))
+    if query == "" {
+        fmt.Println("❌ Укажите текст для поиска: :search <текст>")
+        return
+    }
+
+    results, err := SearchSessions(query, ch.assistant.GetContext().GetAllExchanges())
+    if err != nil {
+        fmt.Printf("❌ Ошибка поиска: %v\n", err)
+        return
+    }
+    if len(results) == 0 {
+        fmt.Printf("🔍 По запросу '%s' ничего не найдено\n", query)
+        return
+    }
+
+    fmt.Printf("🔍 Найдено: %d\n", len(results))
+    for _, r := range results {
+        fmt.Printf("\n  📁 %s  #%d\n", r.Session, r.Exchange)
+        fmt.Printf("     %s\n", HighlightSnippet(r))
+    }
+    if results[0].Session != CurrentSessionName {
+        fmt.Printf("\n💡 Загрузить историю до найденного обмена: :load %s %d\n", results[0].Session, results[0].Exchange)
+    }
+}
+
+func (ch *CommandHandler) handleTitle(args []string) {
+    if len(args) == 0 {
+        title := ch.session.GetTitle()
+        if title == "" {
+            title = autoTitle(ch.assistant.GetContext().GetAllExchanges())
+            if title == "" {
+                fmt.Println("📝 Заголовок не задан")
+                return
+            }
+            fmt.Printf("📝 Заголовок (авто): %s\n", title)
+            return
+        }
+        fmt.Printf("📝 Заголовок: %s\n", title)
+        return
+    }
+
+    if len(args) == 1 && args[0] == "auto" {
+        fmt.Println("⏳ Генерация заголовка...")
+        title, err := GenerateSessionTitle(ctx.Background(), ch.assistant.GetContext().GetAllExchanges(),
+            ch.assistant.GetProvider(), ch.assistant.GetModel(), ch.assistant.GetAPIKey())
+        if err != nil {
+            fmt.Printf("❌ Ошибка: %v\n", err)
+            return
+        }
+        ch.session.SetTitle(title)
+        fmt.Printf("✅ Заголовок: %s\n", title)
+        return
+    }
+
+    ch.session.SetTitle(strings.Join(args, " "))
+    fmt.Printf("✅ Заголовок: %s\n", ch.session.GetTitle())
+}
+
+func (ch *CommandHandler) handleTag(args []string) {
+    for _, arg := range args {
+        if strings.HasPrefix(arg, "-") {
+            if ch.session.RemoveTag(strings.TrimPrefix(arg, "-")) {
+                fmt.Printf("✅ Тег удален: #%s\n", normalizeTag(strings.TrimPrefix(arg, "-")))
+            } else {
+                fmt.Printf("⚠️  Тега нет: %s\n", strings.TrimPrefix(arg, "-"))
+            }
+            continue
+        }
+        if ch.session.AddTag(arg) {
+            fmt.Printf("✅ Тег добавлен: #%s\n", normalizeTag(arg))
+        }
+    }
+
+    tags := ch.session.GetTags()
+    if len(tags) == 0 {
+        fmt.Println("🏷️  Теги не заданы")
+        return
+    }
+    fmt.Printf("🏷️  Теги: #%s\n", strings.Join(tags, " #"))
+    if len(args) > 0 {
+        fmt.Println("💡 Теги сохраняются при :save")
+    }
+}
+
+func (ch *CommandHandler) handlePin(args []string) {
+    cm := ch.assistant.GetContext()
+    if len(args) > 0 {
+        cm.AddPin(strings.Join(args, " "))
+        fmt.Println("📌 Заметка закреплена")
+    }
+
+    pins := cm.GetPins()
+    if len(pins) == 0 {
+        fmt.Println("📌 Закрепленных заметок нет")
+        return
+    }
+    fmt.Printf("📌 Закрепленные заметки (%d):\n", len(pins))
+    for i, pin := range pins {
+        fmt.Printf("  %d. %s\n", i+1, pin)
+    }
+}
+
+func (ch *CommandHandler) handleUnpin(args []string) {
+    if len(args) == 0 {
+        fmt.Println("❌ Укажите номер заметки: :unpin <номер|all>")
+        return
+    }
+    cm := ch.assistant.GetContext()
+    if args[0] == "all" {
+        cm.SetPins(nil)
+        fmt.Println("✅ Все закрепленные заметки удалены")
+        return
+    }
+    n, err := strconv.Atoi(args[0])
     if err != nil {
+        fmt.Println("❌ Номер должен быть числом")
+        return
+    }
+    if err := cm.RemovePin(n); err != nil {
         fmt.Printf("❌ Ошибка: %v\n", err)
         return
     }
+    fmt.Printf("✅ Заметка #%d удалена\n", n)
+}
+
+func (ch *CommandHandler) handleUndo(args []string) {
+    journal := ch.assistant.GetJournal()
 
-    // Проверяем длину ответа
-    if len(response) > 2000 {
-        response = response[:2000] + "...(обрезано)"
+    if len(args) > 0 && args[0] == "list" {
+        undo, redo := journal.Entries()
+        if len(undo) == 0 && len(redo) == 0 {
+            fmt.Println("📋 Журнал операций пуст")
+            return
+        }
+        fmt.Printf("📋 Журнал операций (отмена: %d, повтор: %d):\n", len(undo), len(redo))
+        for i := len(undo) - 1; i >= 0; i-- {
+            fmt.Printf("  ↶ %s  %s", undo[i].Time.Format("15:04:05"), undo[i].Label)
+            if files := undo[i].Files(); len(files) > 0 {
+                fmt.Printf(" (файлов: %d)", len(files))
+            }
+            fmt.Println()
+        }
+        for i := len(redo) - 1; i >= 0; i-- {
+            fmt.Printf("  ↷ %s  %s\n", redo[i].Time.Format("15:04:05"), redo[i].Label)
+        }
+        return
     }
 
-    ch.assistant.GetContext().Clear()
-    ch.assistant.GetContext().AddExchange("Сводка диалога", response)
-    fmt.Printf("📋 Сводка: %s\n", response)
-    // fmt.Printf("💡 Для отмены используйте :pop\n")
+    entry, err := journal.Undo()
+    if entry == nil {
+        fmt.Printf("⚠️  %v\n", err)
+        return
+    }
+    if err != nil {
+        fmt.Printf("⚠️  %v\n", err)
+    }
+    ch.printJournalEntry("↶ Отменено", entry)
+}
+
+func (ch *CommandHandler) handleRedo() {
+    entry, err := ch.assistant.GetJournal().Redo()
+    if entry == nil {
+        fmt.Printf("⚠️  %v\n", err)
+        return
+    }
+    if err != nil {
+        fmt.Printf("⚠️  %v\n", err)
+    }
+    ch.printJournalEntry("↷ Повторено", entry)
+}
+
+func (ch *CommandHandler) printJournalEntry(action string, entry *JournalEntry) {
+    fmt.Printf("✅ %s: %s\n", action, entry.Label)
+    for _, f := range entry.Files() {
+        fmt.Printf("   📄 %s\n", f)
+    }
+    fmt.Printf("📊 Обменов в контексте: %d\n", ch.assistant.GetContext().GetExchangeCount())
 }
 
 
@@ -847,32 +1401,32 @@ func getSessionsDir() string {
 }
 
 func (ch *CommandHandler) handleSave(args []string) {
+    // Флаги шифрования: --encrypt / --no-encrypt (по умолчанию — encrypt_sessions)
+    encrypt := ch.config.GetBool("encrypt_sessions")
+    var rest []string
+    for _, arg := range args {
+        switch arg {
+        case "--encrypt":
+            encrypt = true
+        case "--no-encrypt":
+            encrypt = false
+        default:
+            rest = append(rest, arg)
+        }
+    }
+    args = rest
+
 	name := "session"
-    if len(args) > 0 {                       // ← защита от пустого слайса
+    if len(args) > 0 && args[0] != "" {
         name = args[0]
     }
-
-    dir := getSessionsDir()                  // ← теперь dir виден везде
-    if err := os.MkdirAll(dir, 0755); err != nil {
-        fmt.Printf("❌ Ошибка создания директории: %v\n", err)
+    path, err := sessionPath(name)
+    if err != nil {
+        fmt.Printf("❌ %v\n", err)
         return
     }
 
-	if len(args) > 0 && args[0] != "" {
-        // Проверка на недопустимые символы
-        if strings.ContainsAny(args[0], "/\\:*?\"<>|") {
-            fmt.Printf("❌ Недопустимые символы в имени сессии (используйте буквы, цифры, -, _)\n")
-            return
-        }
-        // Ограничение длины
-        if len(args[0]) > 50 {
-            fmt.Printf("❌ Имя сессии слишком длинное (макс. 50 символов)\n")
-            return
-        }
-    }
-    
     // Проверка существования файла
-    path := filepath.Join(dir, name+".json")
     if _, err := os.Stat(path); err == nil {
         response, err := ch.terminalReader.ReadLineWithPrompt(
             fmt.Sprintf("Сессия '%s' уже существует. Перезаписать? (y/n): ", name))
@@ -881,32 +1435,80 @@ func (ch *CommandHandler) handleSave(args []string) {
             return
         }
     }
-    data := SessionData{
-        Version:   SessionFormatVersion,
-        Timestamp: time.Now().Format(time.RFC3339),
-        Provider:  ch.assistant.GetProvider(),
-        Model:     ch.assistant.GetModel(),
-        Exchanges: ch.assistant.GetContext().GetAllExchanges(),
-    }
-	jsonData, err := json.MarshalIndent(data, "", "  ")
+    data, err := ch.saveSession(path, encrypt)
     if err != nil {
-        fmt.Printf("❌ Ошибка сериализации: %v\n", err)
-        return
-    }
-    // Атомарная запись через временный файл (заменить os.WriteFile)
-    tempPath := path + ".tmp"
-    if err = os.WriteFile(tempPath, jsonData, 0644); err != nil {
         fmt.Printf("❌ Ошибка сохранения: %v\n", err)
-        os.Remove(tempPath) // cleanup
         return
     }
-    // Атомарное перемещение
-    if err := os.Rename(tempPath, path); err != nil {
-        fmt.Printf("❌ Ошибка завершения сохранения: %v\n", err)
-        return
+
+	if encrypt {
+		fmt.Printf("✅ Сессия сохранена (🔒 зашифрована): %s\n", path)
+	} else {
+		fmt.Printf("✅ Сессия сохранена: %s\n", path)
+	}
+	if data.Title != "" {
+		fmt.Printf("📝 Заголовок: %s\n", data.Title)
+	}
+}
+
+// sessionPath проверяет имя сессии и возвращает путь к ее файлу
+func sessionPath(name string) (string, error) {
+	if strings.ContainsAny(name, "/\\:*?\"<>|") {
+		return "", fmt.Errorf("недопустимые символы в имени сессии (используйте буквы, цифры, -, _)")
+	}
+	if len(name) > 50 {
+		return "", fmt.Errorf("имя сессии слишком длинное (макс. 50 символов)")
+	}
+	dir := getSessionsDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("ошибка создания директории: %v", err)
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// saveSession записывает текущую сессию без вопросов пользователю (кроме пароля
+// шифрования, если он еще не известен — веб-интерфейс проверяет это заранее)
+func (ch *CommandHandler) saveSession(path string, encrypt bool) (SessionData, error) {
+	if ch.session.GetTitle() == "" {
+		ch.session.SetTitle(autoTitle(ch.assistant.GetContext().GetAllExchanges()))
+	}
+	data := ch.currentSessionData()
+	// Атомарная запись через временный файл, права 0600
+	return data, writeSecureJSON(path, data, encrypt)
+}
+
+// currentSessionData собирает текущую сессию со всеми метаданными (для :save и :export)
+func (ch *CommandHandler) currentSessionData() SessionData {
+    cwd, _ := os.Getwd()
+    var ragFiles, ragCollections []string
+    if a, ok := ch.assistant.(*Assistant); ok && a.IsRAGEnabled() {
+        ragCollections = a.ActiveRAGCollections()
+        for _, doc := range a.GetRAGData() {
+            ragFiles = append(ragFiles, doc.FilePath)
+        }
     }
 
-	fmt.Printf("✅ Сессия сохранена: %s\n", path)
+    exchanges := ch.assistant.GetContext().GetAllExchanges()
+    title := ch.session.GetTitle()
+    if title == "" {
+        title = autoTitle(exchanges)
+    }
+
+    return SessionData{
+        Version:   SessionFormatVersion,
+        Timestamp: time.Now().Format(time.RFC3339),
+        Provider:  ch.assistant.GetProvider(),
+        Model:     ch.assistant.GetModel(),
+        Exchanges: exchanges,
+        Summary:   ch.assistant.GetContext().GetSummary(),
+        Title:     title,
+        Tags:      ch.session.GetTags(),
+        Cwd:       cwd,
+        RAGFiles:  ragFiles,
+        RAGCollections: ragCollections,
+        Pins:      ch.assistant.GetContext().GetPins(),
+        SummaryBackup: ch.assistant.GetContext().SummaryBackup(),
+    }
 }
 
 func (ch *CommandHandler) handleLoad(args []string) {
@@ -932,25 +1534,40 @@ func (ch *CommandHandler) handleLoad(args []string) {
 		}
 	}
 
-	fileData, err := os.ReadFile(path)
-	if err != nil {
+	// Необязательный номер обмена: загружаем историю до него включительно (см. :search)
+	uptoExchange := 0
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			fmt.Println("❌ Номер обмена должен быть положительным числом: :load <имя> [номер]")
+			return
+		}
+		uptoExchange = n
+	}
+
+	// Зашифрованные сессии расшифровываются прозрачно (при необходимости запрашивается пароль)
+	var data SessionData
+	if err := readSecureJSON(path, &data, true); err != nil {
 		fmt.Printf("❌ Ошибка загрузки: %v\n", err)
 		return
 	}
-
-	var data struct {
-		Version   string   `json:"version"`   // добавлено поле версии
-		Timestamp string   `json:"timestamp"`
-		Provider  string   `json:"provider"`
-		Model     string   `json:"model"`
-		Exchanges []string `json:"exchanges"`
+	if err := ch.applySession(args[0], &data, uptoExchange, ":load "+strings.Join(args, " ")); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
 	}
 
-	if err := json.Unmarshal(fileData, &data); err != nil {
-		fmt.Printf("❌ Ошибка парсинга JSON: %v\n", err)
-		return
+	fmt.Printf("✅ Сессия загружена: %s (обменов: %d)\n", path, len(data.Exchanges))
+	if data.Title != "" {
+		fmt.Printf("📝 %s", data.Title)
+		if len(data.Tags) > 0 {
+			fmt.Printf("  #%s", strings.Join(data.Tags, " #"))
+		}
+		fmt.Println()
 	}
+}
 
+// applySession заменяет текущий контекст сессией (до обмена upto, если он задан)
+func (ch *CommandHandler) applySession(name string, data *SessionData, upto int, operation string) error {
 	// Проверка версии формата сессии
 	if data.Version != "" && data.Version != SessionFormatVersion {
 		fmt.Printf("⚠️  Предупреждение: Сессия в формате v%s, текущая v%s. Могут быть проблемы совместимости.\n",
@@ -959,25 +1576,115 @@ func (ch *CommandHandler) handleLoad(args []string) {
 
 	// Валидация структуры после Unmarshal
 	if data.Provider == "" || data.Model == "" {
-		fmt.Printf("⚠️  Предупреждение: Сессия '%s' имеет неполные метаданные\n", args[0])
+		fmt.Printf("⚠️  Предупреждение: Сессия '%s' имеет неполные метаданные\n", name)
 	}
-	if len(data.Exchanges) == 0 {
-		fmt.Printf("⚠️  Предупреждение: Сессия '%s' пуста\n", args[0])
+	if len(data.Exchanges) == 0 && data.Summary == "" {
+		fmt.Printf("⚠️  Предупреждение: Сессия '%s' пуста\n", name)
+	}
+
+	if upto > 0 {
+		if upto > len(data.Exchanges) {
+			return fmt.Errorf("в сессии '%s' только %d обменов", name, len(data.Exchanges))
+		}
+		data.Exchanges = data.Exchanges[:upto]
+		fmt.Printf("📍 Загрузка до обмена #%d\n", upto)
 	}
 
 	// Восстанавливаем контекст
+	op := ch.assistant.GetJournal().Begin(operation, ch.assistant.GetContext())
 	ch.assistant.GetContext().LoadFromHistory(data.Exchanges)
+	ch.assistant.GetContext().SetSummary(data.Summary)
+	ch.assistant.GetContext().SetPins(data.Pins)
+	if upto == 0 {
+		// При частичной загрузке сохраненное состояние не соответствует контексту
+		ch.assistant.GetContext().SetSummaryBackup(data.SummaryBackup)
+	}
+	op.Commit()
+
+	ch.session.SetTitle(data.Title)
+	ch.session.SetTags(data.Tags)
+	ch.restoreSessionEnvironment(data)
 
 	// Информируем о возможных различиях в провайдере/модели
 	if data.Provider != ch.assistant.GetProvider() || data.Model != ch.assistant.GetModel() {
 		fmt.Printf("⚠️  Внимание: Сессия сохранена с %s/%s\n", data.Provider, data.Model)
 		fmt.Printf("   Текущая конфигурация: %s/%s\n", ch.assistant.GetProvider(), ch.assistant.GetModel())
 	}
+	return nil
+}
 
-	fmt.Printf("✅ Сессия загружена: %s (обменов: %d)\n", path, len(data.Exchanges))
+// restoreSessionEnvironment восстанавливает рабочую директорию и RAG-документы сохраненной сессии
+func (ch *CommandHandler) restoreSessionEnvironment(data *SessionData) {
+	if data.Cwd != "" {
+		if wd, _ := os.Getwd(); wd != data.Cwd {
+			if err := os.Chdir(data.Cwd); err != nil {
+				fmt.Printf("⚠️  Не удалось перейти в директорию сессии %s: %v\n", data.Cwd, err)
+			} else {
+				fmt.Printf("📂 Текущая директория: %s\n", data.Cwd)
+			}
+		}
+	}
+
+	a, ok := ch.assistant.(*Assistant)
+	if !ok {
+		return
+	}
+	// Сессии с коллекциями активируют их; в старых сессиях — только список файлов
+	if len(data.RAGCollections) > 0 {
+		var available []string
+		for _, name := range data.RAGCollections {
+			if RAGCollectionExists(name) {
+				available = append(available, name)
+			} else {
+				fmt.Printf("⚠️  RAG-коллекция недоступна: %s\n", name)
+			}
+		}
+		if err := a.UseRAGCollections(available); err != nil {
+			fmt.Printf("⚠️  RAG-коллекции не восстановлены: %v\n", err)
+			return
+		}
+		if len(available) > 0 {
+			fmt.Printf("📚 RAG-режим восстановлен: коллекции %s (%d документов)\n",
+				strings.Join(available, ", "), len(a.GetRAGData()))
+		} else {
+			fmt.Println("⚠️  Ни одна RAG-коллекция сессии не найдена, RAG-режим выключен")
+		}
+		return
+	}
+	if len(data.RAGFiles) == 0 {
+		if a.IsRAGEnabled() {
+			a.UseRAGCollections(nil)
+			fmt.Println("📚 RAG-режим выключен (в сессии не было документов)")
+		}
+		return
+	}
+
+	var docs []RAGDocument
+	for _, filePath := range data.RAGFiles {
+		doc, err := ch.loadSingleFile(filePath)
+		if err != nil {
+			fmt.Printf("⚠️  RAG-документ недоступен: %s (%v)\n", filePath, err)
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	if len(docs) == 0 {
+		a.UseRAGCollections(nil)
+		fmt.Println("⚠️  Ни один RAG-документ сессии не найден, RAG-режим выключен")
+		return
+	}
+	// Документы старой сессии загружаются без коллекции и не сохраняются на диск
+	a.UseRAGCollections(nil)
+	a.SetRAGData(docs)
+	fmt.Printf("📚 RAG-режим восстановлен: %d из %d документов\n", len(docs), len(data.RAGFiles))
 }
 
-func (ch *CommandHandler) handleListSessions() {
+func (ch *CommandHandler) handleListSessions(args []string) {
+	filterTag := ""
+	if len(args) > 0 {
+		filterTag = normalizeTag(args[0])
+	}
+
 	dir := getSessionsDir()
 	files, err := os.ReadDir(dir)
 
@@ -994,6 +1701,8 @@ func (ch *CommandHandler) handleListSessions() {
     type sessionInfo struct {
         name string
         modTime time.Time
+        title string
+        tags []string
     }
     var sessions []sessionInfo
     
@@ -1003,14 +1712,33 @@ func (ch *CommandHandler) handleListSessions() {
             if err != nil {
                 continue // Пропускаем файлы с ошибками
             }
-            sessions = append(sessions, sessionInfo{
+            si := sessionInfo{
                 name: strings.TrimSuffix(f.Name(), ".json"),
                 modTime: info.ModTime(),
-            })
+            }
+            if data, err := readSessionFile(filepath.Join(dir, f.Name())); err == nil {
+                si.title = data.Title
+                if si.title == "" {
+                    si.title = autoTitle(data.Exchanges)
+                }
+                si.tags = data.Tags
+                if filterTag != "" && !sessionHasTag(data, filterTag) {
+                    continue
+                }
+            } else if filterTag != "" {
+                continue
+            } else if isEncryptedFile(filepath.Join(dir, f.Name())) {
+                si.title = "🔒 (зашифрована)"
+            }
+            sessions = append(sessions, si)
         }
     }
     
     if len(sessions) == 0 {
+        if filterTag != "" {
+            fmt.Printf("📁 Сессии с тегом #%s не найдены\n", filterTag)
+            return
+        }
         fmt.Println("📁 Сохраненные сессии отсутствуют")
         return
     }
@@ -1021,9 +1749,17 @@ func (ch *CommandHandler) handleListSessions() {
     })
     
     // Красивый вывод
-    fmt.Printf("📁 Сохраненные сессии (%d):\n", len(sessions))
+    if filterTag != "" {
+        fmt.Printf("📁 Сохраненные сессии с тегом #%s (%d):\n", filterTag, len(sessions))
+    } else {
+        fmt.Printf("📁 Сохраненные сессии (%d):\n", len(sessions))
+    }
     for _, s := range sessions {
-        fmt.Printf("  %-20s %s\n", s.name, s.modTime.Format("2006-01-02 15:04"))
+        fmt.Printf("  %-20s %s  %s", s.name, s.modTime.Format("2006-01-02 15:04"), s.title)
+        if len(s.tags) > 0 {
+            fmt.Printf("  #%s", strings.Join(s.tags, " #"))
+        }
+        fmt.Println()
     }
 
 	if err != nil {
@@ -1058,7 +1794,7 @@ func (ch *CommandHandler) handleRemove(args []string) {
     
     // Перемещение в "корзину" вместо немедленного удаления
     trashDir := filepath.Join(getSessionsDir(), ".trash")
-    os.MkdirAll(trashDir, 0755)
+    os.MkdirAll(trashDir, 0700)
     
     // Создаем уникальное имя для файла в корзине
     timestamp := time.Now().Format("20060102_150405")
@@ -1074,7 +1810,7 @@ func (ch *CommandHandler) handleRemove(args []string) {
     
     metadataJSON, _ := json.MarshalIndent(metadata, "", "  ")
     metadataPath := trashPath + ".meta"
-    os.WriteFile(metadataPath, metadataJSON, 0644)
+    os.WriteFile(metadataPath, metadataJSON, 0600)
     
     if err := os.Rename(path, trashPath); err != nil {
         fmt.Printf("❌ Ошибка удаления: %v\n", err)
@@ -1087,49 +1823,190 @@ func (ch *CommandHandler) handleRemove(args []string) {
 func (ch *CommandHandler) handleExport(args []string) {
     format := "md"
     if len(args) > 0 {
-        format = args[0]
+        format = strings.ToLower(args[0])
+    }
+    path := ""
+    if len(args) > 1 {
+        path = args[1]
     }
 
-    filename := fmt.Sprintf("export_%s.%s", time.Now().Format("20060102_150405"), format)
-    file, err := os.Create(filename)
+    valid := false
+    for _, f := range ExportFormats {
+        if f == format {
+            valid = true
+        }
+    }
+    if !valid {
+        fmt.Printf("❌ Неизвестный формат: %s (доступно: %s)\n", format, strings.Join(ExportFormats, ", "))
+        return
+    }
+
+    data := ch.currentSessionData()
+    if len(data.Exchanges) == 0 && data.Summary == "" {
+        fmt.Println("⚠️  Контекст пуст, экспортировать нечего")
+        return
+    }
+
+    result, files, err := WriteExport(format, &data, path, NewWorkspace(ch.config))
     if err != nil {
-        fmt.Printf("❌ Ошибка создания файла: %v\n", err)
+        fmt.Printf("❌ Ошибка экспорта: %v\n", err)
+        return
+    }
+
+    if format == "code" {
+        fmt.Printf("✅ Извлечено файлов: %d → %s\n", len(files), result)
+        for _, f := range files {
+            fmt.Printf("   📄 %s\n", f)
+        }
+        return
+    }
+    fmt.Printf("✅ Диалог экспортирован: %s\n", result)
+}
+
+func (ch *CommandHandler) handleImport(args []string) {
+    if len(args) == 0 {
+        fmt.Println("❌ Укажите файл: :import <файл> [имя]")
+        return
+    }
+    if len(args) > 1 && (strings.ContainsAny(args[1], "/\\:*?\"<>|") || len(args[1]) > 50) {
+        fmt.Println("❌ Недопустимое имя сессии (используйте буквы, цифры, -, _; до 50 символов)")
+        return
+    }
+
+    result, err := ImportConversations(args[0])
+    if err != nil {
+        fmt.Printf("❌ Ошибка импорта: %v\n", err)
+        return
+    }
+
+    // Предпросмотр
+    total := 0
+    fmt.Printf("📥 Формат: %s, диалогов: %d\n", result.Format, len(result.Conversations))
+    for i, conv := range result.Conversations {
+        total += len(conv.Exchanges)
+        if i < 20 {
+            title := conv.Title
+            if title == "" {
+                title = autoTitle(conv.Exchanges)
+            }
+            fmt.Printf("  %2d. %-50s обменов: %d", i+1, truncateTitle(title), len(conv.Exchanges))
+            if conv.Skipped > 0 {
+                fmt.Printf(" (пропущено сообщений: %d)", conv.Skipped)
+            }
+            fmt.Println()
+        }
+    }
+    if len(result.Conversations) > 20 {
+        fmt.Printf("  ... и еще %d\n", len(result.Conversations)-20)
+    }
+    fmt.Printf("📊 Всего обменов: %d\n", total)
+
+    response, err := ch.terminalReader.ReadLineWithPrompt(
+        fmt.Sprintf("Сохранить в %s? (y/n): ", getSessionsDir()))
+    if err != nil || strings.ToLower(strings.TrimSpace(response)) != "y" {
+        fmt.Println("❌ Импорт отменен")
         return
     }
-    defer file.Close()
 
-    content := ch.assistant.GetContext().GetAllExchanges()
-    var writeErr error
-
-    switch format {
-    case "md":
-        _, writeErr = file.WriteString("# Экспорт сессии\n\n")
-        for _, ex := range content {
-            _, _ = file.WriteString("---\n")
-            _, _ = file.WriteString(ex + "\n\n")
-        }
-    case "txt":
-        for _, ex := range content {
-            _, _ = file.WriteString(ex + "\n\n")
-        }
-    case "json":
-        _, _ = file.WriteString(`{ "exchanges": [`)
-        for i, ex := range content {
-            if i > 0 {
-                _, _ = file.WriteString(",")
+    var saved []string
+    for i, conv := range result.Conversations {
+        name := importSessionName(conv.Title, i)
+        if len(args) > 1 {
+            name = args[1]
+            if len(result.Conversations) > 1 {
+                name = fmt.Sprintf("%s_%d", args[1], i+1)
             }
-            _, _ = file.WriteString(fmt.Sprintf("%q", ex))
         }
-        _, _ = file.WriteString("]}")
+        sessionName, err := SaveImportedConversation(conv, name, ch.assistant.GetProvider(), ch.assistant.GetModel(),
+            ch.config.GetBool("encrypt_sessions"))
+        if err != nil {
+            fmt.Printf("❌ Ошибка сохранения '%s': %v\n", name, err)
+            continue
+        }
+        saved = append(saved, sessionName)
+    }
+
+    fmt.Printf("✅ Импортировано сессий: %d\n", len(saved))
+    for _, name := range saved {
+        fmt.Printf("   📁 %s\n", name)
+    }
+    if len(saved) > 0 {
+        fmt.Printf("💡 Продолжить диалог: :load %s\n", saved[0])
     }
+}
 
-    if writeErr != nil {
-        fmt.Printf("❌ Ошибка записи файла: %v\n", writeErr)
-        _ = os.Remove(filename) // удаляем повреждённый файл
+func (ch *CommandHandler) handleMigrate(args []string) {
+    if len(args) == 0 || (args[0] != "encrypt" && args[0] != "decrypt" && args[0] != "perms") {
+        fmt.Println("❌ Использование: :migrate <encrypt|decrypt|perms>")
         return
     }
+    mode := args[0]
 
-    fmt.Printf("✅ Диалог экспортирован: %s\n", filename)
+    dirs := []string{getSessionsDir(), filepath.Join(getSessionsDir(), ".trash"), getAutosaveDir()}
+    for _, dir := range dirs {
+        if _, err := os.Stat(dir); err == nil {
+            os.Chmod(dir, 0700)
+        }
+    }
+
+    files, err := os.ReadDir(getSessionsDir())
+    if err != nil {
+        if os.IsNotExist(err) {
+            fmt.Println("📁 Сохраненные сессии отсутствуют")
+            return
+        }
+        fmt.Printf("❌ Ошибка чтения директории: %v\n", err)
+        return
+    }
+
+    converted, skipped, failed := 0, 0, 0
+    for _, f := range files {
+        if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+            continue
+        }
+        path := filepath.Join(getSessionsDir(), f.Name())
+        os.Chmod(path, 0600)
+
+        encrypted := isEncryptedFile(path)
+        if mode == "perms" || (mode == "encrypt" && encrypted) || (mode == "decrypt" && !encrypted) {
+            skipped++
+            continue
+        }
+
+        var data SessionData
+        if err := readSecureJSON(path, &data, true); err != nil {
+            fmt.Printf("❌ %s: %v\n", f.Name(), err)
+            failed++
+            continue
+        }
+        if err := writeSecureJSON(path, data, mode == "encrypt"); err != nil {
+            fmt.Printf("❌ %s: %v\n", f.Name(), err)
+            failed++
+            continue
+        }
+        converted++
+    }
+
+    // Автосохранения и корзина тоже могут содержать код
+    for _, dir := range dirs[1:] {
+        if entries, err := os.ReadDir(dir); err == nil {
+            for _, e := range entries {
+                if !e.IsDir() {
+                    os.Chmod(filepath.Join(dir, e.Name()), 0600)
+                }
+            }
+        }
+    }
+
+    switch mode {
+    case "encrypt":
+        fmt.Printf("🔒 Зашифровано сессий: %d (уже зашифровано: %d, ошибок: %d)\n", converted, skipped, failed)
+        fmt.Println("💡 Чтобы новые сессии тоже шифровались: :set encrypt_sessions on")
+    case "decrypt":
+        fmt.Printf("🔓 Расшифровано сессий: %d (не были зашифрованы: %d, ошибок: %d)\n", converted, skipped, failed)
+    default:
+        fmt.Printf("✅ Права доступа исправлены (0600) для %d сессий\n", skipped)
+    }
 }
 
 // ========== Методы I/O ==========
@@ -1257,14 +2134,7 @@ func (ch *CommandHandler) handleOpen(args []string) {
 	for _, h := range history {
 		ch.terminalReader.line.AppendHistory(h)
 	}
-	commands := []string{
-		":clean", ":pop", ":ctx", ":limit", ":summarize", //":undo",
-		":save", ":load", ":ls", ":rm", ":export", ":sh",
-		":clip", ":clip+", ":cd", ":pwd", ":open", ":dir",
-		":debug", ":stats", ":retry", ":models", ":model", ":providers", ":provider",
-		":set", ":get", ":reset", ":quit", ":help", ":history", ":skip",
-	}
-	ch.terminalReader.SetCompleter(commands)
+	ch.terminalReader.SetCompleter(completionCommands)
 	
 	fmt.Printf("✅ Редактор закрыт\n")
 }
@@ -1424,6 +2294,95 @@ func (ch *CommandHandler) handleSet(args []string) {
 		fmt.Printf("⚡ Auto-execute: %v (будет применено к новым запросам)\n", ch.config.GetBool("auto_execute"))
 	case "max_retries":
 		fmt.Printf("🔄 Max retries: %v (будет применено к новым запросам)\n", ch.config.GetInt("max_retries", 10))
+	case "context_token_budget", "summary_keep_recent", "auto_summarize":
+		fmt.Printf("🗜️  Автосуммаризация: %v, бюджет ~%d токенов, дословно %d обменов\n",
+			ch.config.GetBool("auto_summarize"),
+			ch.config.GetInt("context_token_budget", DefaultContextTokenBudget),
+			ch.config.GetInt("summary_keep_recent", DefaultSummaryKeepRecent))
+	case "encrypt_sessions", "encryption_key_file":
+		if ch.config.GetBool("encrypt_sessions") {
+			fmt.Println("🔒 Новые сессии и автосохранения будут шифроваться (существующие: :migrate encrypt)")
+		} else {
+			fmt.Println("🔓 Шифрование новых сессий выключено (:save --encrypt для отдельной сессии)")
+		}
+		if sessionCrypto.HasKeyFile() {
+			fmt.Println("🔒 RAG-коллекции, эмбеддинги и состояние обхода шифруются файлом ключа (при следующей записи)")
+		} else {
+			fmt.Println("   RAG-коллекции и их кеши в ~/.cogitor/rag шифруются только с encryption_key_file")
+		}
+	case "rag_watch", "rag_watch_interval":
+		if a, ok := ch.assistant.(*Assistant); ok {
+			if ch.config.GetBool("rag_watch") {
+				a.StartRAGWatch(ragWatchInterval(ch.config))
+			} else {
+				a.StopRAGWatch()
+			}
+		}
+		fmt.Printf("🔄 Слежение за RAG-файлами: %v, интервал %d с\n",
+			ch.config.GetBool("rag_watch"), ch.config.GetInt("rag_watch_interval", DefaultRAGWatchInterval))
+	case "workspace_allow":
+		if a, ok := ch.assistant.(*Assistant); ok {
+			roots, _ := a.workspace.Roots()
+			fmt.Printf("📂 Рабочее пространство: %s\n", strings.Join(roots, ", "))
+		}
+	case "dry_run":
+		if a, ok := ch.assistant.(*Assistant); ok {
+			a.dryRun.SetForced(false) // :set отменяет --dry-run из командной строки
+		}
+		if ch.config.GetBool("dry_run") {
+			fmt.Println("📝 Dry-run включен: $cod и $diff только составляют план в .cogitor/plans (:apply — применить)")
+		} else {
+			fmt.Println("✅ Dry-run выключен")
+		}
+	case "run_timeout", "run_output_kb":
+		fmt.Printf("⏱️  Запуск кода: таймаут %d с, вывод до %d КБ\n",
+			ch.config.GetInt("run_timeout", DefaultRunTimeout), ch.config.GetInt("run_output_kb", DefaultRunOutputKB))
+	case "run_interactive":
+		switch runInteractiveSetting(ch.config) {
+		case "on":
+			fmt.Println("⌨️  Программы всегда запускаются с подключенным терминалом (без таймаута)")
+		case "off":
+			fmt.Println("⌨️  Интерактивный запуск выключен: stdin программ пуст")
+		default:
+			fmt.Println("⌨️  Терминал подключается к программам, которые читают stdin")
+		}
+	case "sandbox", "sandbox_network", "sandbox_cpu_sec", "sandbox_memory_mb", "sandbox_file_mb", "sandbox_procs":
+		opts := sandboxOptionsFromConfig(ch.config)
+		if opts.Backend == "off" {
+			fmt.Println("🔓 Песочница выключена: сгенерированный код запускается без ограничений")
+		} else {
+			fmt.Printf("🔒 Песочница: %s — %s\n", opts.Backend, opts.describeLimits())
+			if _, note, err := selectSandboxBackend(opts); err != nil {
+				fmt.Printf("⚠️  %v\n", err)
+			} else if note != "" {
+				fmt.Printf("⚠️  %s\n", note)
+			}
+		}
+	case "git_auto_commit", "git_branch":
+		branch := gitBranchSetting(ch.config)
+		if branch == "" {
+			branch = "текущая"
+		}
+		fmt.Printf("📦 Git: автокоммит %v, ветка для изменений: %s\n", ch.config.GetBool("git_auto_commit"), branch)
+		if !IsGitRepo() {
+			fmt.Println("⚠️  Текущая директория не является git-репозиторием")
+		}
+	case "review_changes":
+		fmt.Printf("🔍 Просмотр изменений перед записью файлов: %v\n", ch.config.GetBool("review_changes"))
+	case "rag_max_file_kb":
+		fmt.Printf("📚 Лимит размера RAG-файла: %d КБ\n", ch.config.GetInt("rag_max_file_kb", DefaultRAGMaxFileKB))
+	case "rag_embeddings", "embedding_provider", "embedding_model":
+		if a, ok := ch.assistant.(*Assistant); ok {
+			provider, model, _ := a.embeddingSettings()
+			fmt.Printf("🧮 Векторный поиск RAG: %v (%s/%s)\n", ch.config.GetBool("rag_embeddings"), provider, model)
+			// Пересобираем векторный индекс для уже загруженных данных
+			a.startEmbedding()
+		}
+	case "autosave", "autosave_interval", "autosave_keep":
+		fmt.Printf("💾 Автосохранение: %v, интервал %d с, хранить %d файлов (применится при следующем запуске)\n",
+			ch.config.GetBool("autosave"),
+			ch.config.GetInt("autosave_interval", DefaultAutosaveInterval),
+			ch.config.GetInt("autosave_keep", DefaultAutosaveKeep))
 	}
 
 	// Сохраняем конфигурацию на диск
@@ -1450,6 +2409,31 @@ func (ch *CommandHandler) handleGet(args []string) {
 			{"max_retries", "Количество попыток запуска кода при ошибках"},
 			{"web_search", "Включение поиска в интернете"},
             {"skip_install", "Режим пропуска автоматической установки зависимостей"},
+			{"autosave", "Автосохранение сессии и восстановление после сбоя"},
+			{"autosave_interval", "Интервал автосохранения, секунд"},
+			{"autosave_keep", "Сколько файлов автосохранения хранить"},
+			{"encrypt_sessions", "Шифровать сессии и автосохранения (AES-GCM)"},
+			{"encryption_key_file", "Файл 32-байтового ключа вместо пароля"},
+			{"rag_embeddings", "Гибридный RAG-поиск: BM25 + эмбеддинги"},
+			{"embedding_provider", "Провайдер эмбеддингов (пусто — авто)"},
+			{"embedding_model", "Модель эмбеддингов"},
+			{"rag_max_file_kb", "Максимальный размер RAG-файла, КБ"},
+			{"rag_watch", "Следить за файлами RAG-коллекций и обновлять их"},
+			{"rag_watch_interval", "Интервал проверки RAG-файлов, секунд"},
+			{"review_changes", "Показывать дифф и подтверждать запись сгенерированных файлов"},
+			{"workspace_allow", "Дополнительные корни для чтения и записи файлов (через запятую)"},
+			{"git_auto_commit", "Коммитить примененные файлы с сообщением от LLM"},
+			{"git_branch", "Git-ветка для изменений (пусто — текущая)"},
+			{"dry_run", "Только план действий $cod/$diff в JSON, без записи и запуска"},
+			{"sandbox", "Песочница запуска кода: auto, bwrap, namespaces, limits, off"},
+			{"sandbox_network", "Разрешить сеть в песочнице"},
+			{"sandbox_cpu_sec", "Лимит процессорного времени, секунд"},
+			{"sandbox_memory_mb", "Лимит адресного пространства, МБ"},
+			{"sandbox_file_mb", "Максимальный размер записываемого файла, МБ"},
+			{"sandbox_procs", "Максимальное число процессов и потоков"},
+			{"run_timeout", "Таймаут компиляции, запуска или старта сервера, секунд"},
+			{"run_output_kb", "Сколько вывода программы хранить, КБ (середина обрезается)"},
+			{"run_interactive", "Подключать терминал к программе: auto (если читает stdin), on, off"},
 		}
 		
 		for _, s := range settings {
@@ -1464,7 +2448,7 @@ func (ch *CommandHandler) handleGet(args []string) {
 		fmt.Printf("%s = %v\n", key, val)
 	} else {
 		fmt.Printf("❌ Настройка не найдена: %s\n", key)
-		fmt.Println("Доступные настройки: debug_mode, context_limit, auto_execute, max_retries, web_search, skip_install")
+		fmt.Println("Доступные настройки: debug_mode, context_limit, auto_execute, max_retries, web_search, skip_install, auto_summarize, context_token_budget, summary_keep_recent, autosave, autosave_interval, autosave_keep, encrypt_sessions, encryption_key_file, rag_embeddings, embedding_provider, embedding_model, rag_max_file_kb, rag_watch, rag_watch_interval, review_changes, workspace_allow, git_auto_commit, git_branch, dry_run, sandbox, sandbox_network, sandbox_cpu_sec, sandbox_memory_mb, sandbox_file_mb, sandbox_procs, run_timeout, run_output_kb, run_interactive")
 	}
 }
 
@@ -1559,10 +2543,22 @@ func (ch *CommandHandler) showHelp(args []string) {
 	fmt.Println("  :pop [n]            — Удалить последние n обменов")
 	fmt.Println("  :ctx                — Показать статистику контекста")
 	fmt.Println("  :limit <число>      — Установить лимит контекста")
-	fmt.Println("  :summarize          — Сжать контекст до сводки")
+	fmt.Println("  :summarize [n|undo] — Сжать старые обмены в сводку / отменить")
+	fmt.Println("  :search <текст>     — Поиск по всем сессиям и текущему контексту")
+	fmt.Println("  :title [текст|auto] — Заголовок сессии")
+	fmt.Println("  :tag [тег|-тег]     — Теги сессии")
+	fmt.Println("  :pin [текст]        — Закрепить заметку / показать заметки")
+	fmt.Println("  :unpin <n|all>      — Удалить закрепленную заметку")
+	fmt.Println("  :undo [list]        — Отменить последнюю операцию (контекст и файлы)")
+	fmt.Println("  :redo               — Повторить отмененную операцию")
 	fmt.Println()
     fmt.Println("Данные (RAG):")
     fmt.Println("  :data [путь]       — Загрузить файлы данных для RAG-режима")
+    fmt.Println("  :data add|rm       — Добавить/удалить документы текущей коллекции")
+    fmt.Println("  :data new|use|ls   — Создать, активировать, показать коллекции")
+    fmt.Println("  :data refresh      — Обновить изменившиеся файлы коллекций")
+    fmt.Println("  :data watch on|off — Автоматически обновлять коллекции при изменениях")
+    fmt.Println("  :data crawl <url>  — Обойти сайт в RAG-коллекцию")
 	fmt.Println()
     fmt.Println("Буфер обмена:")
     fmt.Println("  :clip               — Показать буфер обмена")
@@ -1571,10 +2567,12 @@ func (ch *CommandHandler) showHelp(args []string) {
     fmt.Println()
 	fmt.Println("Сессии:")
 	fmt.Println("  :save [имя]         — Сохранить сессию")
-	fmt.Println("  :load <имя>         — Загрузить сессию")
-	fmt.Println("  :ls                 — Список сессий")
+	fmt.Println("  :load <имя> [n]     — Загрузить сессию (до обмена n)")
+	fmt.Println("  :ls [тег]           — Список сессий (с фильтром по тегу)")
 	fmt.Println("  :rm <имя>           — Удалить сессию")
-	fmt.Println("  :export [fmt]       — Экспортировать диалог")
+	fmt.Println("  :export [fmt] [путь] — Экспорт (md/txt/json/html/code)")
+	fmt.Println("  :import <файл> [имя] — Импорт диалогов (ChatGPT, [{role, content}], md)")
+	fmt.Println("  :migrate <encrypt|decrypt|perms> — Шифрование существующих сессий")
 	fmt.Println("  :history            — История последних команд")
 	fmt.Println()
 	fmt.Println("I/O:")
@@ -1583,6 +2581,10 @@ func (ch *CommandHandler) showHelp(args []string) {
 	fmt.Println("  :pwd                — Текущая директория")
 	fmt.Println("  :dir                — Посмотреть содержимое директории")
 	fmt.Println("  :open <file>        — Открыть файл в редакторе")
+	fmt.Println("  :git [log|diff|revert] — Статус, история, изменения, отмена коммита")
+	fmt.Println("  :apply [план]       — Применить план dry-run (--no-run, --force)")
+	fmt.Println("  :sandbox [once ...] — Песочница запуска кода; параметры на один запуск")
+	fmt.Println("  :servers [stop|log] — Серверы, запущенные в фоне из сгенерированного кода")
 	fmt.Println()
 	fmt.Println("Отладка:")
     fmt.Println("  :skip  [on|off]     — Вкл/выкл пропуск установки")
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 type Config struct {
@@ -22,6 +23,21 @@ type SessionData struct {
     Provider  string   `json:"provider"`
     Model     string   `json:"model"`
     Exchanges []string `json:"exchanges"`
+    Summary   string   `json:"summary,omitempty"`
+    Title     string   `json:"title,omitempty"`
+    Tags      []string `json:"tags,omitempty"`
+    Cwd       string   `json:"cwd,omitempty"`       // рабочая директория на момент сохранения
+    RAGFiles  []string `json:"rag_files,omitempty"` // активные RAG-документы
+    RAGCollections []string `json:"rag_collections,omitempty"` // активные RAG-коллекции
+    Pins      []string `json:"pins,omitempty"`      // закрепленные заметки
+    SummaryBackup *SummaryBackup `json:"summary_backup,omitempty"` // контекст до последней суммаризации (для :summarize undo)
+}
+
+// SummaryBackup — сохраняемое состояние контекста до суммаризации
+type SummaryBackup struct {
+    Exchanges []string `json:"exchanges"`
+    Summary   string   `json:"summary,omitempty"`
+    Evicted   []string `json:"evicted,omitempty"`
 }
 
 func NewConfig() *Config {
@@ -33,6 +49,34 @@ func NewConfig() *Config {
 			"context_limit": 10,
 			"auto_execute":  false,
 			"skip_install":  false,
+			"auto_summarize":       true,
+			"context_token_budget": DefaultContextTokenBudget,
+			"summary_keep_recent":  DefaultSummaryKeepRecent,
+			"autosave":             true,
+			"autosave_interval":    DefaultAutosaveInterval,
+			"autosave_keep":        DefaultAutosaveKeep,
+			"encrypt_sessions":     false,
+			"encryption_key_file":  "",
+			"rag_embeddings":       false,
+			"embedding_provider":   "",
+			"embedding_model":      DefaultEmbeddingModel,
+			"rag_max_file_kb":      DefaultRAGMaxFileKB,
+			"rag_watch":            false,
+			"rag_watch_interval":   DefaultRAGWatchInterval,
+			"review_changes":       true,
+			"workspace_allow":      "",
+			"git_auto_commit":      false,
+			"git_branch":           "",
+			"dry_run":              false,
+			"sandbox":              DefaultSandboxBackend,
+			"sandbox_network":      false,
+			"sandbox_cpu_sec":      DefaultSandboxCPUSec,
+			"sandbox_memory_mb":    DefaultSandboxMemoryMB,
+			"sandbox_file_mb":      DefaultSandboxFileMB,
+			"sandbox_procs":        DefaultSandboxProcs,
+			"run_timeout":          DefaultRunTimeout,
+			"run_output_kb":        DefaultRunOutputKB,
+			"run_interactive":      DefaultRunInteractive,
 		},
 	}
 }
@@ -44,7 +88,7 @@ func (c *Config) Save() error {
 		return err
 	}
 	configDir := filepath.Join(home, ".cogitor")
-	if err := os.MkdirAll(configDir, 0755); err != nil {
+	if err := os.MkdirAll(configDir, 0700); err != nil {
 		return err
 	}
 	path := filepath.Join(configDir, "config.json")
@@ -52,7 +96,7 @@ func (c *Config) Save() error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, data, 0644)
+	return os.WriteFile(path, data, 0600)
 }
 
 // Load загружает конфигурацию из файла
@@ -88,7 +132,87 @@ func (c *Config) Set(key, value string) error {
 			return fmt.Errorf("context_limit слишком большой (макс. 100)")
 		}
 		c.settings[key] = v
-	case "web_search", "debug_mode", "auto_execute", "skip_install":
+	case "context_token_budget", "summary_keep_recent":
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("недопустимое значение '%s': ожидается число", value)
+		}
+		if v < 0 || (key == "context_token_budget" && v == 0) {
+			return fmt.Errorf("значение для %s должно быть положительным числом", key)
+		}
+		c.settings[key] = v
+	case "autosave_interval", "autosave_keep", "rag_max_file_kb", "rag_watch_interval",
+		"sandbox_cpu_sec", "sandbox_memory_mb", "sandbox_file_mb", "sandbox_procs", "run_timeout", "run_output_kb":
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("недопустимое значение '%s': ожидается число", value)
+		}
+		if v <= 0 {
+			return fmt.Errorf("значение для %s должно быть положительным числом", key)
+		}
+		c.settings[key] = v
+	case "encryption_key_file":
+		// "off" или "none" — отключить файл ключа и использовать пароль
+		if value == "off" || value == "none" {
+			value = ""
+		}
+		if value != "" {
+			if _, err := readKeyFile(expandHome(value)); err != nil {
+				return err
+			}
+		}
+		c.settings[key] = value
+	case "embedding_provider":
+		// "auto" — текущий провайдер, если он поддерживает эмбеддинги, иначе ollama
+		if value == "auto" {
+			value = ""
+		}
+		if value != "" {
+			if _, _, err := embeddingEndpoint(value); err != nil {
+				return err
+			}
+		}
+		c.settings[key] = value
+	case "workspace_allow":
+		// Дополнительные корни через запятую; "off" или "none" — только текущая директория
+		if value == "off" || value == "none" {
+			value = ""
+		}
+		for _, root := range strings.Split(value, ",") {
+			if root = strings.TrimSpace(root); root == "" {
+				continue
+			}
+			info, err := os.Stat(expandHome(root))
+			if err != nil || !info.IsDir() {
+				return fmt.Errorf("разрешенный корень '%s' не является директорией", root)
+			}
+		}
+		c.settings[key] = value
+	case "git_branch":
+		// "off" или "none" — работать в текущей ветке
+		if value == "off" || value == "none" {
+			value = ""
+		}
+		if strings.HasPrefix(value, "-") || strings.ContainsAny(value, " \t~^:?*[\\") || strings.Contains(value, "..") {
+			return fmt.Errorf("недопустимое имя ветки: %s", value)
+		}
+		c.settings[key] = value
+	case "sandbox":
+		if !containsString(sandboxBackends, value) {
+			return fmt.Errorf("недопустимое значение '%s': ожидается %s", value, strings.Join(sandboxBackends, ", "))
+		}
+		c.settings[key] = value
+	case "run_interactive":
+		if !containsString(runInteractiveModes, value) {
+			return fmt.Errorf("недопустимое значение '%s': ожидается %s", value, strings.Join(runInteractiveModes, ", "))
+		}
+		c.settings[key] = value
+	case "embedding_model":
+		if strings.TrimSpace(value) == "" {
+			return fmt.Errorf("имя модели эмбеддингов не может быть пустым")
+		}
+		c.settings[key] = value
+	case "web_search", "debug_mode", "auto_execute", "skip_install", "auto_summarize", "autosave", "encrypt_sessions", "rag_embeddings", "rag_watch", "review_changes", "git_auto_commit", "dry_run", "sandbox_network":
 		// Унифицированная обработка булевых значений
 		boolValue := value == "true" || value == "on" || value == "1" || value == "yes"
 		c.settings[key] = boolValue
@@ -151,5 +275,33 @@ func (c *Config) Reset() {
 		"context_limit": 10,
 		"auto_execute":  false,
 		"skip_install":  false,
+		"auto_summarize":       true,
+		"context_token_budget": DefaultContextTokenBudget,
+		"summary_keep_recent":  DefaultSummaryKeepRecent,
+		"autosave":             true,
+		"autosave_interval":    DefaultAutosaveInterval,
+		"autosave_keep":        DefaultAutosaveKeep,
+		"encrypt_sessions":     false,
+		"encryption_key_file":  "",
+		"rag_embeddings":       false,
+		"embedding_provider":   "",
+		"embedding_model":      DefaultEmbeddingModel,
+		"rag_max_file_kb":      DefaultRAGMaxFileKB,
+		"rag_watch":            false,
+		"rag_watch_interval":   DefaultRAGWatchInterval,
+		"review_changes":       true,
+		"workspace_allow":      "",
+		"git_auto_commit":      false,
+		"git_branch":           "",
+		"dry_run":              false,
+		"sandbox":              DefaultSandboxBackend,
+		"sandbox_network":      false,
+		"sandbox_cpu_sec":      DefaultSandboxCPUSec,
+		"sandbox_memory_mb":    DefaultSandboxMemoryMB,
+		"sandbox_file_mb":      DefaultSandboxFileMB,
+		"sandbox_procs":        DefaultSandboxProcs,
+		"run_timeout":          DefaultRunTimeout,
+		"run_output_kb":        DefaultRunOutputKB,
+		"run_interactive":      DefaultRunInteractive,
 	}
 }
\ No newline at end of file
@@ -19,9 +19,22 @@ type ContextManager struct {
 	conversation []string
 	maxLength    int
 	totalSize    int
+	summary      string           // накопительная сводка старых обменов
+	evicted      []string         // вытесненные лимитами обмены, еще не вошедшие в сводку
+	pins         []string         // закрепленные заметки, не вытесняются и не очищаются :clean
+	backup       *contextSnapshot // состояние до последней суммаризации (для :summarize undo)
 	mu           sync.RWMutex
 }
 
+// contextSnapshot хранит копию состояния контекста
+type contextSnapshot struct {
+	conversation []string
+	summary      string
+	pins         []string
+	evicted      []string
+	backup       *contextSnapshot
+}
+
 // NewContextManager создает новый менеджер контекста
 func NewContextManager() *ContextManager {
 	return &ContextManager{
@@ -46,15 +59,49 @@ func (cm *ContextManager) AddExchange(question, answer string) {
 	
 	// Ограничиваем по количеству
 	if len(cm.conversation) > cm.maxLength {
-		removed := cm.conversation[0]
-		cm.conversation = cm.conversation[1:]
-		cm.totalSize -= len(removed)
+		cm.evictOldest()
 	}
 	
 	// Ограничиваем по общему размеру (более агрессивно)
 	cm.enforceTotalSizeLimit()
 }
 
+// evictOldest убирает старейший обмен из окна контекста. Он не теряется, а ждет
+// суммаризации в evicted (не больше MaxTotalSize, сверх — старейшие отбрасываются)
+func (cm *ContextManager) evictOldest() {
+	removed := cm.conversation[0]
+	cm.conversation = cm.conversation[1:]
+	cm.totalSize -= len(removed)
+
+	cm.evicted = append(cm.evicted, removed)
+	size := 0
+	for _, e := range cm.evicted {
+		size += len(e)
+	}
+	for size > MaxTotalSize && len(cm.evicted) > 1 {
+		size -= len(cm.evicted[0])
+		cm.evicted = cm.evicted[1:]
+	}
+}
+
+// EvictedCount — сколько вытесненных обменов ждут суммаризации
+func (cm *ContextManager) EvictedCount() int {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return len(cm.evicted)
+}
+
+// EvictedTokens приблизительно оценивает токены вытесненных обменов (как GetEstimatedTokens)
+func (cm *ContextManager) EvictedTokens() int {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	size := 0
+	for _, e := range cm.evicted {
+		size += len(e)
+	}
+	return size / 3
+}
+
 // truncateExchange обрезает слишком длинные exchange
 func (cm *ContextManager) truncateExchange(exchange string) string {
 	if len(exchange) <= MaxExchangeSize {
@@ -68,9 +115,7 @@ func (cm *ContextManager) truncateExchange(exchange string) string {
 func (cm *ContextManager) enforceTotalSizeLimit() {
 	// Удаляем из начала пока общий размер не станет меньше лимита
 	for cm.totalSize > MaxTotalSize && len(cm.conversation) > 1 {
-		removed := cm.conversation[0]
-		cm.conversation = cm.conversation[1:]
-		cm.totalSize -= len(removed)
+		cm.evictOldest()
 	}
 }
 
@@ -79,11 +124,25 @@ func (cm *ContextManager) GetContext() string {
 	cm.mu.RLock()
 	defer cm.mu.RUnlock()
 
-	if len(cm.conversation) == 0 {
+	if len(cm.conversation) == 0 && cm.summary == "" && len(cm.pins) == 0 {
 		return ""
 	}
-	
-	return "Предыдущие обмены:\n" + strings.Join(cm.conversation, "\n\n") + "\n\n"
+
+	var b strings.Builder
+	if len(cm.pins) > 0 {
+		b.WriteString("Закрепленные заметки:\n")
+		for _, pin := range cm.pins {
+			b.WriteString("- " + pin + "\n")
+		}
+		b.WriteString("\n")
+	}
+	if cm.summary != "" {
+		b.WriteString("Сводка предыдущего диалога:\n" + cm.summary + "\n\n")
+	}
+	if len(cm.conversation) > 0 {
+		b.WriteString("Предыдущие обмены:\n" + strings.Join(cm.conversation, "\n\n") + "\n\n")
+	}
+	return b.String()
 }
 
 // Clear очищает контекст
@@ -93,6 +152,9 @@ func (cm *ContextManager) Clear() {
 
 	cm.conversation = make([]string, 0)
 	cm.totalSize = 0
+	cm.summary = ""
+	cm.evicted = nil
+	cm.backup = nil
 	cm.maxLength = DefaultMaxLength
 }
 
@@ -134,7 +196,7 @@ func (cm *ContextManager) GetEstimatedTokens() int {
 
 	// Теперь это точная оценка на основе отслеживаемого размера
 	// Учитываем, что 1 токен ≈ 3-4 символа (с запасом)
-	return cm.totalSize / 3
+	return (cm.totalSize + len(cm.summary)) / 3
 }
 
 // SetMaxLength изменяет размер окна контекста
@@ -149,9 +211,7 @@ func (cm *ContextManager) SetMaxLength(maxLength int) error {
 	
 	// Ограничиваем по количеству
 	for len(cm.conversation) > cm.maxLength {
-		removed := cm.conversation[0]
-		cm.conversation = cm.conversation[1:]
-		cm.totalSize -= len(removed)
+		cm.evictOldest()
 	}
 	
 	// Также проверяем общий размер
@@ -195,10 +255,324 @@ func (cm *ContextManager) LoadFromHistory(exchanges []string) {
 func (cm *ContextManager) ToJSON() string {
 	data, err := json.Marshal(map[string]interface{}{
 		"exchanges": cm.conversation,
+		"summary":   cm.summary,
+		"pins":      cm.pins,
 		"maxLength": cm.maxLength,
 	})
 	if err != nil {
 		return `{"exchanges": [], "error": "serialization_failed"}`
 	}
 	return string(data)
-}
\ No newline at end of file
+}
+
+// GetSummary возвращает накопительную сводку старых обменов
+func (cm *ContextManager) GetSummary() string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.summary
+}
+
+// SetSummary устанавливает накопительную сводку (для :load)
+func (cm *ContextManager) SetSummary(summary string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.summary = summary
+}
+
+// SplitForSummary возвращает обмены, которые нужно сжать: вытесненные лимитами и все,
+// кроме keepRecent последних
+func (cm *ContextManager) SplitForSummary(keepRecent int) (old []string, summary string) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if keepRecent < 0 {
+		keepRecent = 0
+	}
+	old = append([]string(nil), cm.evicted...)
+	if cut := len(cm.conversation) - keepRecent; cut > 0 {
+		old = append(old, cm.conversation[:cut]...)
+	}
+	return old, cm.summary
+}
+
+// ApplySummary заменяет сводкой ровно те обмены, что в нее вошли (summarized из
+// SplitForSummary), даже если пока модель писала сводку, контекст пополнился и часть из
+// них вытеснена. previous — сводка, поверх которой строилась новая: если ее успели
+// изменить, сводка не применяется. Предыдущее состояние сохраняется для :summarize undo.
+func (cm *ContextManager) ApplySummary(summary, previous string, summarized []string) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if cm.summary != previous {
+		return fmt.Errorf("сводка изменилась во время суммаризации, повторите")
+	}
+
+	cm.backup = &contextSnapshot{
+		conversation: append([]string(nil), cm.conversation...),
+		summary:      cm.summary,
+		evicted:      append([]string(nil), cm.evicted...),
+	}
+
+	// Убираем по одному вхождению каждого сжатого обмена, начиная со старейших
+	pending := make(map[string]int, len(summarized))
+	for _, e := range summarized {
+		pending[e]++
+	}
+	take := func(list []string) []string {
+		var kept []string
+		for _, e := range list {
+			if pending[e] > 0 {
+				pending[e]--
+				continue
+			}
+			kept = append(kept, e)
+		}
+		return kept
+	}
+	cm.evicted = take(cm.evicted)
+	cm.conversation = take(cm.conversation)
+	if cm.conversation == nil {
+		cm.conversation = make([]string, 0)
+	}
+
+	cm.totalSize = 0
+	for _, exchange := range cm.conversation {
+		cm.totalSize += len(exchange)
+	}
+	cm.summary = summary
+	return nil
+}
+
+// HasSummaryBackup сообщает, можно ли отменить последнюю суммаризацию
+func (cm *ContextManager) HasSummaryBackup() bool {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.backup != nil
+}
+
+// RestoreSummaryBackup восстанавливает контекст, каким он был до последней суммаризации
+func (cm *ContextManager) RestoreSummaryBackup() error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if cm.backup == nil {
+		return fmt.Errorf("нет сохраненного состояния для отмены")
+	}
+
+	// Копии: снимок остается в журнале и может быть восстановлен повторно через :redo
+	cm.conversation = append(make([]string, 0, len(cm.backup.conversation)), cm.backup.conversation...)
+	cm.summary = cm.backup.summary
+	cm.evicted = append([]string(nil), cm.backup.evicted...)
+	cm.backup = nil
+
+	cm.totalSize = 0
+	for _, exchange := range cm.conversation {
+		cm.totalSize += len(exchange)
+	}
+	return nil
+}
+
+// SummaryBackup возвращает состояние до последней суммаризации для сохранения в сессии
+func (cm *ContextManager) SummaryBackup() *SummaryBackup {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	if cm.backup == nil {
+		return nil
+	}
+	return &SummaryBackup{
+		Exchanges: append([]string(nil), cm.backup.conversation...),
+		Summary:   cm.backup.summary,
+		Evicted:   append([]string(nil), cm.backup.evicted...),
+	}
+}
+
+// SetSummaryBackup восстанавливает состояние для :summarize undo из сохраненной сессии
+func (cm *ContextManager) SetSummaryBackup(b *SummaryBackup) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if b == nil {
+		cm.backup = nil
+		return
+	}
+	cm.backup = &contextSnapshot{
+		conversation: append([]string(nil), b.Exchanges...),
+		summary:      b.Summary,
+		evicted:      append([]string(nil), b.Evicted...),
+	}
+}
+
+// Snapshot возвращает копию текущего состояния контекста (для журнала :undo/:redo)
+func (cm *ContextManager) Snapshot() contextSnapshot {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return contextSnapshot{
+		conversation: append([]string(nil), cm.conversation...),
+		summary:      cm.summary,
+		pins:         append([]string(nil), cm.pins...),
+		evicted:      append([]string(nil), cm.evicted...),
+		backup:       cm.backup,
+	}
+}
+
+// ApplyDelta переводит изменения одной операции из состояния from в состояние to, не
+// трогая того, что изменилось после нее: обмены и заметки, добавленные операцией, удаляются,
+// удаленные ею — возвращаются на свои места. Сводка и состояние для :summarize undo меняются,
+// только если их с тех пор не трогали
+func (cm *ContextManager) ApplyDelta(from, to contextSnapshot) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cm.conversation = applyListDelta(cm.conversation, from.conversation, to.conversation)
+	cm.pins = applyListDelta(cm.pins, from.pins, to.pins)
+	cm.evicted = applyListDelta(cm.evicted, from.evicted, to.evicted)
+	if cm.summary == from.summary {
+		cm.summary = to.summary
+	}
+	if cm.backup == from.backup {
+		cm.backup = to.backup
+	}
+	cm.totalSize = 0
+	for _, exchange := range cm.conversation {
+		cm.totalSize += len(exchange)
+	}
+}
+
+// applyListDelta удаляет из current элементы, которых нет в to по сравнению с from, и
+// вставляет недостающие — после ближайшего предшествующего им в to элемента. Одинаковые
+// элементы различаются по номеру вхождения: удаляется и служит опорой именно тот, что
+// затронула операция, а не первый попавшийся
+func applyListDelta(current, from, to []string) []string {
+	keptFrom, keptTo := alignLists(from, to)
+
+	drop := make(map[string]map[int]bool)
+	seen := make(map[string]int)
+	for i, s := range from {
+		n := seen[s]
+		seen[s]++
+		if keptFrom[i] {
+			continue
+		}
+		if drop[s] == nil {
+			drop[s] = make(map[int]bool)
+		}
+		drop[s][n] = true
+	}
+	result := make([]string, 0, len(current)+len(to))
+	seen = make(map[string]int)
+	for _, s := range current {
+		n := seen[s]
+		seen[s]++
+		if drop[s][n] {
+			continue
+		}
+		result = append(result, s)
+	}
+
+	for i, s := range to {
+		if keptTo[i] {
+			continue
+		}
+		pos := 0
+		for k := i - 1; k >= 0; k-- {
+			if m := occurrenceIndex(result, to[k], occurrenceNumber(to, k)); m >= 0 {
+				pos = m + 1
+				break
+			}
+		}
+		result = append(result[:pos], append([]string{s}, result[pos:]...)...)
+	}
+	return result
+}
+
+// alignLists сопоставляет списки по наибольшей общей подпоследовательности и отмечает
+// элементы, оставшиеся на месте (не удаленные из a и не добавленные в b)
+func alignLists(a, b []string) (keptA, keptB []bool) {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	keptA, keptB = make([]bool, len(a)), make([]bool, len(b))
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			keptA[i], keptB[j] = true, true
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return keptA, keptB
+}
+
+// occurrenceNumber — номер вхождения list[i] среди одинаковых элементов (с 0)
+func occurrenceNumber(list []string, i int) int {
+	n := 0
+	for _, s := range list[:i] {
+		if s == list[i] {
+			n++
+		}
+	}
+	return n
+}
+
+// occurrenceIndex ищет n-е вхождение s; если столько вхождений нет — последнее (-1, если нет совсем)
+func occurrenceIndex(list []string, s string, n int) int {
+	last := -1
+	for i, v := range list {
+		if v != s {
+			continue
+		}
+		if n == 0 {
+			return i
+		}
+		n--
+		last = i
+	}
+	return last
+}
+
+// GetPins возвращает закрепленные заметки
+func (cm *ContextManager) GetPins() []string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return append([]string(nil), cm.pins...)
+}
+
+// SetPins заменяет закрепленные заметки (для :load)
+func (cm *ContextManager) SetPins(pins []string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.pins = append([]string(nil), pins...)
+}
+
+// AddPin закрепляет заметку, которая всегда передается в контексте
+func (cm *ContextManager) AddPin(text string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.pins = append(cm.pins, text)
+}
+
+// RemovePin удаляет закрепленную заметку по номеру (начиная с 1)
+func (cm *ContextManager) RemovePin(n int) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if n < 1 || n > len(cm.pins) {
+		return fmt.Errorf("закрепленной заметки #%d нет (всего: %d)", n, len(cm.pins))
+	}
+	cm.pins = append(cm.pins[:n-1:n-1], cm.pins[n:]...)
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyListDelta(t *testing.T) {
+	tests := []struct {
+		name              string
+		current, from, to []string
+		want              []string
+	}{
+		{
+			name:    "добавление",
+			current: []string{"a"}, from: []string{"a"}, to: []string{"a", "b"},
+			want: []string{"a", "b"},
+		},
+		{
+			name:    "возврат на место перед более поздними",
+			current: []string{"a", "c"}, from: []string{"a"}, to: []string{"a", "b"},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name:    "удаление не трогает более поздние",
+			current: []string{"a", "b", "c"}, from: []string{"a", "b"}, to: []string{"a"},
+			want: []string{"a", "c"},
+		},
+		{
+			name:    "восстановление после очистки",
+			current: []string{"c"}, from: nil, to: []string{"a", "b"},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name:    "удаляется последний из одинаковых",
+			current: []string{"a", "b", "a", "c"}, from: []string{"a", "b", "a"}, to: []string{"a", "b"},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name:    "удаляется первый из одинаковых",
+			current: []string{"a", "b", "a", "c"}, from: []string{"a", "b", "a"}, to: []string{"b", "a"},
+			want: []string{"b", "a", "c"},
+		},
+		{
+			name:    "возврат дубликата на его место",
+			current: []string{"a", "b", "c"}, from: []string{"a", "b"}, to: []string{"a", "b", "a"},
+			want: []string{"a", "b", "a", "c"},
+		},
+		{
+			name:    "опора — нужное вхождение дубликата",
+			current: []string{"a", "b", "a", "c", "a"}, from: []string{"a", "b", "a"}, to: []string{"a", "b", "a", "x"},
+			want: []string{"a", "b", "a", "x", "c", "a"},
+		},
+		{
+			name:    "одинаковые элементы",
+			current: []string{"a", "a", "a"}, from: []string{"a", "a"}, to: []string{"a"},
+			want: []string{"a", "a"},
+		},
+		{
+			name:    "без изменений",
+			current: []string{"a", "b"}, from: []string{"x"}, to: []string{"x"},
+			want: []string{"a", "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := applyListDelta(tt.current, tt.from, tt.to)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("получено %q, ожидалось %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyDeltaSummary(t *testing.T) {
+	cm := NewContextManager()
+	cm.SetMaxLength(2)
+	for _, q := range []string{"1", "2", "3"} {
+		cm.AddExchange(q, "ok")
+	}
+	if cm.EvictedCount() != 1 {
+		t.Fatalf("вытеснено %d, ожидалось 1", cm.EvictedCount())
+	}
+
+	before := cm.Snapshot()
+	old, previous := cm.SplitForSummary(1)
+	if err := cm.ApplySummary("сводка", previous, old); err != nil {
+		t.Fatal(err)
+	}
+	after := cm.Snapshot()
+	cm.AddExchange("4", "ok")
+
+	// Отмена суммаризации возвращает сжатые обмены и вытесненный, не трогая нового
+	cm.ApplyDelta(after, before)
+	if got := cm.GetAllExchanges(); len(got) != 3 || got[2] != "Вопрос: 4\nОтвет: ok" {
+		t.Errorf("обмены после отмены: %q", got)
+	}
+	if cm.EvictedCount() != 1 || cm.GetSummary() != "" || cm.HasSummaryBackup() {
+		t.Errorf("после отмены: вытеснено %d, сводка %q, backup %v",
+			cm.EvictedCount(), cm.GetSummary(), cm.HasSummaryBackup())
+	}
+
+	cm.ApplyDelta(before, after)
+	if cm.EvictedCount() != 0 || cm.GetSummary() != "сводка" || !cm.HasSummaryBackup() {
+		t.Errorf("после повтора: вытеснено %d, сводка %q, backup %v",
+			cm.EvictedCount(), cm.GetSummary(), cm.HasSummaryBackup())
+	}
+}
@@ -0,0 +1,682 @@
+// crawler.go
+// Обход сайтов в RAG-коллекцию: страницы загружаются вежливо (пауза между запросами,
+// robots.txt), текст извлекается тем же extractText, а адреса страниц служат ссылками
+// на источники. Состояние обхода сохраняется, прерванный обход продолжается с места остановки
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	DefaultCrawlDepth    = 2
+	DefaultCrawlMaxPages = 200
+	DefaultCrawlDelay    = time.Second
+	MinCrawlDelay        = 250 * time.Millisecond // пауза меньше не принимается: обход не должен нагружать сайт
+
+	crawlUserAgent   = "Mozilla/5.0 (compatible; Cogitor-Crawler/1.0)"
+	crawlRobotsAgent = "cogitor"
+	crawlMaxPageSize = 5 << 20
+	crawlSaveEvery   = 10 // сохранять прогресс каждые N страниц
+	crawlStateFile   = "crawl.json"
+)
+
+// crawlSkipExtensions — ссылки на файлы, которые не являются страницами
+var crawlSkipExtensions = []string{
+	".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp", ".ico", ".bmp",
+	".css", ".js", ".mjs", ".map", ".woff", ".woff2", ".ttf", ".eot",
+	".zip", ".gz", ".tgz", ".tar", ".rar", ".7z", ".exe", ".dmg", ".deb", ".rpm",
+	".mp3", ".mp4", ".avi", ".mov", ".webm", ".wav", ".pdf", ".doc", ".docx",
+}
+
+// CrawlOptions — параметры обхода
+type CrawlOptions struct {
+	Depth      int
+	SameHost   bool // по умолчанию true; --any-host разрешает переходы на другие хосты
+	MaxPages   int
+	Delay      time.Duration
+	Collection string
+	Restart    bool // начать заново, даже если есть незавершенный обход
+}
+
+type crawlItem struct {
+	URL   string `json:"url"`
+	Depth int    `json:"depth"`
+}
+
+// CrawlState — сохраняемое состояние обхода
+type CrawlState struct {
+	StartURL string       `json:"start_url"`
+	Depth    int          `json:"depth"`
+	SameHost bool         `json:"same_host"`
+	MaxPages int          `json:"max_pages"`
+	DelayMs  int64        `json:"delay_ms"`
+	Queue    []crawlItem  `json:"queue"`
+	Seen     []string     `json:"seen"` // адреса, поставленные в очередь или загруженные
+	Pages    int          `json:"pages"`
+	Failed   []RAGSkipped `json:"failed,omitempty"`
+	Done     bool         `json:"done"`
+	Started  string       `json:"started"`
+	Updated  string       `json:"updated"`
+}
+
+// robotsRules — правила robots.txt для нашего агента
+type robotsRules struct {
+	allow    []string
+	disallow []string
+	delay    time.Duration
+}
+
+// Crawler загружает страницы с соблюдением robots.txt и паузы между запросами к хосту
+type Crawler struct {
+	client    *http.Client
+	delay     time.Duration
+	host      string // если задан — только этот хост, в том числе после перенаправлений
+	robots    map[string]*robotsRules
+	lastFetch map[string]time.Time
+}
+
+// parseCrawlArgs разбирает аргументы :data crawl
+func parseCrawlArgs(args []string) (string, CrawlOptions, error) {
+	opts := CrawlOptions{Depth: DefaultCrawlDepth, SameHost: true, MaxPages: DefaultCrawlMaxPages, Delay: DefaultCrawlDelay}
+	var target string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch arg {
+		case "--same-host":
+			opts.SameHost = true
+		case "--any-host":
+			opts.SameHost = false
+		case "--restart":
+			opts.Restart = true
+		case "--depth", "--max-pages", "--delay", "--collection":
+			if i+1 >= len(args) {
+				return "", opts, fmt.Errorf("%s требует значение", arg)
+			}
+			i++
+			value := strings.Trim(args[i], "'\"")
+			if arg == "--collection" {
+				opts.Collection = value
+				continue
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return "", opts, fmt.Errorf("%s: ожидается неотрицательное число, получено '%s'", arg, value)
+			}
+			switch arg {
+			case "--depth":
+				opts.Depth = n
+			case "--max-pages":
+				if n == 0 {
+					return "", opts, fmt.Errorf("--max-pages должно быть больше 0")
+				}
+				opts.MaxPages = n
+			case "--delay":
+				opts.Delay = time.Duration(n) * time.Millisecond
+				if opts.Delay < MinCrawlDelay {
+					return "", opts, fmt.Errorf("--delay: не меньше %d мс", MinCrawlDelay.Milliseconds())
+				}
+			}
+		default:
+			if strings.HasPrefix(arg, "--") {
+				return "", opts, fmt.Errorf("неизвестный флаг: %s", arg)
+			}
+			if target != "" {
+				return "", opts, fmt.Errorf("указано несколько адресов: %s и %s", target, arg)
+			}
+			target = strings.Trim(arg, "'\"")
+		}
+	}
+	if target == "" {
+		return "", opts, fmt.Errorf("не указан адрес сайта")
+	}
+	return target, opts, nil
+}
+
+// normalizeCrawlURL приводит ссылку к абсолютному адресу без фрагмента
+func normalizeCrawlURL(base *url.URL, href string) (string, bool) {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return "", false
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", false
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", false
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if (u.Scheme == "http" && u.Port() == "80") || (u.Scheme == "https" && u.Port() == "443") {
+		u.Host = u.Hostname()
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String(), true
+}
+
+// crawlCollectionName выводит имя коллекции из адреса сайта
+func crawlCollectionName(u *url.URL) string {
+	name := strings.TrimPrefix(u.Hostname(), "www.")
+	if ValidateCollectionName(name) != nil {
+		return "web"
+	}
+	return name
+}
+
+// extractLinks собирает ссылки <a href> страницы
+func extractLinks(base *url.URL, data []byte) []string {
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	// <base href> меняет основу относительных ссылок
+	var links []string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.Data == "a" || n.Data == "base") {
+			for _, attr := range n.Attr {
+				if attr.Key != "href" {
+					continue
+				}
+				if n.Data == "base" {
+					if u, err := url.Parse(attr.Val); err == nil {
+						base = base.ResolveReference(u)
+					}
+				} else if link, ok := normalizeCrawlURL(base, attr.Val); ok {
+					links = append(links, link)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return uniqueStrings(links)
+}
+
+// parseRobots выбирает из robots.txt группу для agent (или '*')
+func parseRobots(data, agent string) *robotsRules {
+	type group struct {
+		agents []string
+		rules  robotsRules
+	}
+	var groups []*group
+	var current *group
+	lastWasAgent := false
+
+	for _, line := range strings.Split(data, "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if current == nil || !lastWasAgent {
+				current = &group{}
+				groups = append(groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			lastWasAgent = true
+			continue
+		case "allow":
+			if current != nil && value != "" {
+				current.rules.allow = append(current.rules.allow, value)
+			}
+		case "disallow":
+			if current != nil && value != "" {
+				current.rules.disallow = append(current.rules.disallow, value)
+			}
+		case "crawl-delay":
+			if current != nil {
+				if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+					current.rules.delay = time.Duration(secs * float64(time.Second))
+				}
+			}
+		}
+		lastWasAgent = false
+	}
+
+	var wildcard *robotsRules
+	for _, g := range groups {
+		for _, a := range g.agents {
+			if a != "*" && strings.Contains(agent, a) {
+				return &g.rules
+			}
+			if a == "*" && wildcard == nil {
+				wildcard = &g.rules
+			}
+		}
+	}
+	if wildcard != nil {
+		return wildcard
+	}
+	return &robotsRules{}
+}
+
+// robotsMatch сравнивает путь с шаблоном robots.txt ('*' — любые символы, '$' — конец)
+func robotsMatch(pattern, p string) bool {
+	if !strings.ContainsAny(pattern, "*$") {
+		return strings.HasPrefix(p, pattern)
+	}
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+	re, err := regexp.Compile(expr)
+	return err == nil && re.MatchString(p)
+}
+
+// allowed применяет самое длинное совпавшее правило; при равенстве побеждает Allow
+func (r *robotsRules) allowed(p string) bool {
+	best, result := -1, true
+	for _, pattern := range r.disallow {
+		if len(pattern) > best && robotsMatch(pattern, p) {
+			best, result = len(pattern), false
+		}
+	}
+	for _, pattern := range r.allow {
+		if len(pattern) >= best && robotsMatch(pattern, p) {
+			best, result = len(pattern), true
+		}
+	}
+	return result
+}
+
+// NewCrawler создает обходчик с паузой delay (не меньше MinCrawlDelay) между запросами к
+// одному хосту. Непустой host ограничивает обход этим хостом (по умолчанию, без --any-host)
+func NewCrawler(delay time.Duration, host string) *Crawler {
+	if delay < MinCrawlDelay {
+		delay = MinCrawlDelay // состояние обхода, сохраненное до появления нижней границы
+	}
+	cr := &Crawler{
+		delay:     delay,
+		host:      host,
+		robots:    make(map[string]*robotsRules),
+		lastFetch: make(map[string]time.Time),
+	}
+	cr.client = &http.Client{
+		Timeout:       30 * time.Second,
+		Transport:     &http.Transport{Proxy: http.ProxyFromEnvironment},
+		CheckRedirect: cr.checkRedirect,
+	}
+	return cr
+}
+
+// checkRedirect применяет к каждому перенаправлению те же правила, что и к исходному
+// адресу: хост (без --any-host), robots.txt и паузу между запросами
+func (cr *Crawler) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return fmt.Errorf("слишком много перенаправлений")
+	}
+	// Перенаправления самого robots.txt проверять по robots.txt нельзя
+	if via[0].URL.Path == "/robots.txt" {
+		return nil
+	}
+	if cr.host != "" && req.URL.Host != cr.host {
+		return fmt.Errorf("перенаправление на другой хост: %s", req.URL.Host)
+	}
+	rules := cr.robotsFor(req.Context(), req.URL)
+	if !rules.allowed(req.URL.EscapedPath()) {
+		return fmt.Errorf("перенаправление на %s запрещено robots.txt", req.URL)
+	}
+	delay := cr.delay
+	if rules.delay > delay {
+		delay = rules.delay
+	}
+	return cr.wait(req.Context(), req.URL.Host, delay)
+}
+
+// robotsFor загружает и кеширует robots.txt хоста; недоступный robots.txt ничего не запрещает
+func (cr *Crawler) robotsFor(c context.Context, u *url.URL) *robotsRules {
+	key := u.Scheme + "://" + u.Host
+	if rules, ok := cr.robots[key]; ok {
+		return rules
+	}
+	rules := &robotsRules{}
+	body, _, _, status, err := cr.get(c, key+"/robots.txt", 512<<10)
+	if err == nil && status == http.StatusOK {
+		rules = parseRobots(string(body), crawlRobotsAgent)
+	}
+	cr.robots[key] = rules
+	return rules
+}
+
+// wait выдерживает паузу между запросами к хосту
+func (cr *Crawler) wait(c context.Context, host string, delay time.Duration) error {
+	if last, ok := cr.lastFetch[host]; ok {
+		if pause := delay - time.Since(last); pause > 0 {
+			select {
+			case <-c.Done():
+				return c.Err()
+			case <-time.After(pause):
+			}
+		}
+	}
+	cr.lastFetch[host] = time.Now()
+	return nil
+}
+
+// get выполняет GET-запрос и возвращает тело (не больше limit байт), тип содержимого,
+// итоговый адрес после перенаправлений и статус
+func (cr *Crawler) get(c context.Context, pageURL string, limit int64) ([]byte, string, *url.URL, int, error) {
+	req, err := http.NewRequestWithContext(c, "GET", pageURL, nil)
+	if err != nil {
+		return nil, "", nil, 0, err
+	}
+	req.Header.Set("User-Agent", crawlUserAgent)
+	req.Header.Set("Accept", "text/html,text/plain;q=0.9,*/*;q=0.1")
+
+	resp, err := cr.client.Do(req)
+	if err != nil {
+		return nil, "", nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, "", nil, resp.StatusCode, err
+	}
+	if int64(len(body)) > limit {
+		return nil, "", nil, resp.StatusCode, fmt.Errorf("страница больше %d КБ", limit>>10)
+	}
+	return body, resp.Header.Get("Content-Type"), resp.Request.URL, resp.StatusCode, nil
+}
+
+// Fetch загружает страницу с учетом robots.txt и паузы
+func (cr *Crawler) Fetch(c context.Context, pageURL string) ([]byte, string, *url.URL, error) {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	rules := cr.robotsFor(c, u)
+	if !rules.allowed(u.EscapedPath()) {
+		return nil, "", nil, fmt.Errorf("запрещено robots.txt")
+	}
+	delay := cr.delay
+	if rules.delay > delay {
+		delay = rules.delay
+	}
+	if err := cr.wait(c, u.Host, delay); err != nil {
+		return nil, "", nil, err
+	}
+
+	body, contentType, final, status, err := cr.get(c, pageURL, crawlMaxPageSize)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if status != http.StatusOK {
+		return nil, "", nil, fmt.Errorf("HTTP статус: %d", status)
+	}
+	return body, contentType, final, nil
+}
+
+// crawlPageDocument извлекает текст страницы; ok=false — содержимое не текстовое
+func crawlPageDocument(pageURL, contentType string, body []byte) (RAGDocument, bool, error) {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	var text string
+	var warnings []string
+	var err error
+	format := "html"
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml" || mediaType == "":
+		text, warnings, err = extractHTMLText(body, pageURL, 0)
+	case strings.HasPrefix(mediaType, "text/"):
+		format = strings.TrimPrefix(mediaType, "text/")
+		text, warnings, err = extractPlainText(body, pageURL, 0)
+	default:
+		return RAGDocument{}, false, nil
+	}
+	if err != nil {
+		return RAGDocument{}, true, err
+	}
+	return RAGDocument{
+		FilePath: pageURL,
+		Content:  text,
+		Size:     len(text),
+		LoadedAt: time.Now(),
+		Format:   format,
+		Warnings: warnings,
+		Hash:     fileHash(body),
+	}, true, nil
+}
+
+// isCrawlablePage отсеивает ссылки на изображения, архивы и прочие файлы
+func isCrawlablePage(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	return !containsString(crawlSkipExtensions, strings.ToLower(path.Ext(u.Path)))
+}
+
+func crawlStatePath(collection string) string {
+	return filepath.Join(getRAGDir(collection), crawlStateFile)
+}
+
+// loadCrawlState читает сохраненное состояние обхода коллекции
+func loadCrawlState(collection string) *CrawlState {
+	var state CrawlState
+	if err := readSecureJSON(crawlStatePath(collection), &state, false); err != nil {
+		return nil
+	}
+	return &state
+}
+
+func (s *CrawlState) save(collection string) error {
+	s.Updated = time.Now().Format(time.RFC3339)
+	return writeSecureJSON(crawlStatePath(collection), s, encryptRAGCaches())
+}
+
+// CrawlToCollection обходит сайт и сохраняет страницы в коллекцию. Прогресс пишется
+// на диск каждые crawlSaveEvery страниц, так что прерванный обход можно продолжить
+func (a *Assistant) CrawlToCollection(c context.Context, startURL string, opts CrawlOptions,
+	progress func(state *CrawlState, current string)) (string, *CrawlState, bool, error) {
+
+	start, ok := normalizeCrawlURL(nil, startURL)
+	if !ok {
+		return "", nil, false, fmt.Errorf("нужен адрес http(s)://...: %s", startURL)
+	}
+	startParsed, _ := url.Parse(start)
+
+	collection := opts.Collection
+	if collection == "" {
+		collection = crawlCollectionName(startParsed)
+	}
+	if err := ValidateCollectionName(collection); err != nil {
+		return "", nil, false, err
+	}
+
+	coll, err := LoadRAGCollection(collection)
+	if err != nil {
+		if RAGCollectionExists(collection) {
+			return collection, nil, false, err
+		}
+		coll = NewRAGCollection(collection)
+	}
+
+	state := loadCrawlState(collection)
+	resumed := state != nil && !state.Done && !opts.Restart && state.StartURL == start
+	if !resumed {
+		state = &CrawlState{
+			StartURL: start,
+			Depth:    opts.Depth,
+			SameHost: opts.SameHost,
+			MaxPages: opts.MaxPages,
+			DelayMs:  opts.Delay.Milliseconds(),
+			Queue:    []crawlItem{{URL: start}},
+			Seen:     []string{start},
+			Started:  time.Now().Format(time.RFC3339),
+		}
+	}
+	seen := make(map[string]bool, len(state.Seen))
+	for _, s := range state.Seen {
+		seen[s] = true
+	}
+
+	onlyHost := ""
+	if state.SameHost {
+		onlyHost = startParsed.Host
+	}
+	crawler := NewCrawler(time.Duration(state.DelayMs)*time.Millisecond, onlyHost)
+	var pending []RAGDocument
+	flush := func() error {
+		if len(pending) > 0 {
+			coll.Upsert(pending)
+			pending = nil
+			if err := coll.Save(); err != nil {
+				return fmt.Errorf("не удалось сохранить коллекцию '%s': %v", collection, err)
+			}
+		}
+		return state.save(collection)
+	}
+
+	for len(state.Queue) > 0 && state.Pages < state.MaxPages {
+		if c.Err() != nil {
+			break
+		}
+		item := state.Queue[0]
+		if progress != nil {
+			progress(state, item.URL)
+		}
+
+		body, contentType, final, err := crawler.Fetch(c, item.URL)
+		if c.Err() != nil {
+			break // страница останется в очереди до продолжения обхода
+		}
+		state.Queue = state.Queue[1:]
+		if err != nil {
+			state.Failed = append(state.Failed, RAGSkipped{item.URL, err.Error()})
+			continue
+		}
+
+		pageURL := item.URL
+		if final != nil {
+			if normalized, ok := normalizeCrawlURL(nil, final.String()); ok && normalized != item.URL {
+				// Перенаправление на уже загруженную страницу
+				if seen[normalized] {
+					continue
+				}
+				seen[normalized] = true
+				state.Seen = append(state.Seen, normalized)
+				pageURL = normalized
+			}
+		}
+
+		doc, isText, err := crawlPageDocument(pageURL, contentType, body)
+		if err != nil {
+			state.Failed = append(state.Failed, RAGSkipped{pageURL, err.Error()})
+			continue
+		}
+		if !isText {
+			continue
+		}
+		pending = append(pending, doc)
+		state.Pages++
+
+		if item.Depth < state.Depth && doc.Format == "html" {
+			base, _ := url.Parse(pageURL)
+			for _, link := range extractLinks(base, body) {
+				if seen[link] || !isCrawlablePage(link) {
+					continue
+				}
+				if state.SameHost {
+					if u, err := url.Parse(link); err != nil || u.Host != startParsed.Host {
+						continue
+					}
+				}
+				seen[link] = true
+				state.Seen = append(state.Seen, link)
+				state.Queue = append(state.Queue, crawlItem{URL: link, Depth: item.Depth + 1})
+			}
+		}
+
+		if state.Pages%crawlSaveEvery == 0 {
+			if err := flush(); err != nil {
+				return collection, state, resumed, err
+			}
+		}
+	}
+
+	state.Done = c.Err() == nil
+	if err := flush(); err != nil {
+		return collection, state, resumed, err
+	}
+	if state.Pages == 0 && len(coll.Documents) == 0 {
+		return collection, state, resumed, fmt.Errorf("не загружено ни одной страницы")
+	}
+
+	active := a.ActiveRAGCollections()
+	if !containsString(active, collection) {
+		active = append(active, collection)
+	}
+	return collection, state, resumed, a.UseRAGCollections(active)
+}
+
+// cancelableCommand создает контекст команды, который отменяется по Ctrl+C
+func (a *Assistant) cancelableCommand() (context.Context, func()) {
+	a.requestMu.Lock()
+	defer a.requestMu.Unlock()
+	if a.requestCancel != nil {
+		a.requestCancel()
+	}
+	c, cancel := context.WithCancel(context.Background())
+	a.requestCtx, a.requestCancel = c, cancel
+	return c, func() {
+		a.requestMu.Lock()
+		if a.requestCancel != nil {
+			a.requestCancel()
+			a.requestCancel = nil
+		}
+		a.requestMu.Unlock()
+	}
+}
+
+// crawlStateSummary описывает сохраненный обход коллекции для :data status
+func crawlStateSummary(collection string) string {
+	state := loadCrawlState(collection)
+	if state == nil {
+		return ""
+	}
+	status := "завершен"
+	if !state.Done {
+		status = fmt.Sprintf("прерван, в очереди %d (продолжить: :data crawl %s --collection %s)",
+			len(state.Queue), state.StartURL, collection)
+	}
+	return fmt.Sprintf("%s: %d страниц, %s", state.StartURL, state.Pages, status)
+}
+
+// isURLPath сообщает, загружен ли документ из интернета
+func isURLPath(p string) bool {
+	return strings.HasPrefix(p, "http://") || strings.HasPrefix(p, "https://")
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRobotsAllowed(t *testing.T) {
+	tests := []struct {
+		name   string
+		robots string
+		path   string
+		want   bool
+	}{
+		{"пустой robots.txt", "", "/any", true},
+		{"Disallow по префиксу", "User-agent: *\nDisallow: /private", "/private/page", false},
+		{"путь вне правила", "User-agent: *\nDisallow: /private", "/public", true},
+		{"пустой Disallow ничего не запрещает", "User-agent: *\nDisallow:", "/page", true},
+		{"длинный Allow побеждает короткий Disallow", "User-agent: *\nDisallow: /docs\nAllow: /docs/public", "/docs/public/a", true},
+		{"длинный Disallow побеждает короткий Allow", "User-agent: *\nAllow: /docs\nDisallow: /docs/secret", "/docs/secret/a", false},
+		{"при равной длине побеждает Allow", "User-agent: *\nDisallow: /page\nAllow: /page", "/page", true},
+		{"порядок правил не важен", "User-agent: *\nAllow: /docs/public\nDisallow: /docs", "/docs/public", true},
+		{"шаблон со звездочкой", "User-agent: *\nDisallow: /*.pdf", "/files/report.pdf", false},
+		{"якорь конца строки", "User-agent: *\nDisallow: /*.pdf$", "/files/report.pdf?x=1", true},
+		{"корень запрещает всё", "User-agent: *\nDisallow: /", "/a/b", false},
+		{"группа агента важнее '*'", "User-agent: *\nDisallow: /\n\nUser-agent: Cogitor\nDisallow: /tmp", "/page", true},
+		{"правила чужого агента не применяются", "User-agent: googlebot\nDisallow: /", "/page", true},
+		{"несколько агентов в одной группе", "User-agent: googlebot\nUser-agent: cogitor\nDisallow: /x", "/x", false},
+		{"комментарии игнорируются", "User-agent: * # все\nDisallow: /a # закрыто", "/a", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := parseRobots(tt.robots, crawlRobotsAgent)
+			if got := rules.allowed(tt.path); got != tt.want {
+				t.Errorf("allowed(%q) = %v, ожидалось %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRobotsCrawlDelay(t *testing.T) {
+	tests := []struct {
+		robots string
+		want   time.Duration
+	}{
+		{"User-agent: *\nCrawl-delay: 2", 2 * time.Second},
+		{"User-agent: *\nCrawl-delay: 0.5", 500 * time.Millisecond},
+		{"User-agent: *\nCrawl-delay: abc", 0},
+		{"User-agent: other\nCrawl-delay: 5", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRobots(tt.robots, crawlRobotsAgent).delay; got != tt.want {
+			t.Errorf("%q: delay = %v, ожидалось %v", tt.robots, got, tt.want)
+		}
+	}
+}
+
+func TestParseCrawlArgs(t *testing.T) {
+	tests := []struct {
+		args     []string
+		sameHost bool
+		delay    time.Duration
+		err      string
+	}{
+		{args: []string{"https://example.com"}, sameHost: true, delay: DefaultCrawlDelay},
+		{args: []string{"https://example.com", "--same-host"}, sameHost: true, delay: DefaultCrawlDelay},
+		{args: []string{"https://example.com", "--any-host"}, sameHost: false, delay: DefaultCrawlDelay},
+		{args: []string{"https://example.com", "--delay", "250"}, sameHost: true, delay: 250 * time.Millisecond},
+		{args: []string{"https://example.com", "--delay", "0"}, err: "--delay: не меньше 250 мс"},
+		{args: []string{"https://example.com", "--delay", "100"}, err: "--delay: не меньше 250 мс"},
+		{args: []string{"--depth", "1"}, err: "не указан адрес сайта"},
+	}
+	for _, tt := range tests {
+		_, opts, err := parseCrawlArgs(tt.args)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%v: ошибка %v, ожидалось %q", tt.args, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", tt.args, err)
+			continue
+		}
+		if opts.SameHost != tt.sameHost || opts.Delay != tt.delay {
+			t.Errorf("%v: SameHost=%v Delay=%v", tt.args, opts.SameHost, opts.Delay)
+		}
+	}
+
+	// Состояние обхода без нижней границы паузы (delay_ms: 0) получает минимальную паузу
+	if cr := NewCrawler(0, ""); cr.delay != MinCrawlDelay {
+		t.Errorf("NewCrawler(0): пауза %v, ожидалось %v", cr.delay, MinCrawlDelay)
+	}
+}
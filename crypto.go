@@ -0,0 +1,428 @@
+// crypto.go
+// Шифрование сессий и автосохранений на диске: AES-256-GCM с ключом из пароля (Argon2id)
+// или из файла ключа. Зашифрованный файл — JSON-конверт, который распознается при чтении.
+// С файлом ключа шифруются и RAG-коллекции с кешами: их пишут фоновые задачи без пароля
+
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	encryptedFormat   = "cogitor-encrypted"
+	encryptionVersion = 1
+	kdfArgon2id       = "argon2id"
+	kdfKeyFile        = "keyfile"
+
+	// Параметры Argon2id (рекомендации RFC 9106 для интерактивного использования)
+	argonTime    = 3
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+	argonKeyLen  = 32
+
+	passphraseEnv = "COGITOR_PASSPHRASE"
+)
+
+// ErrNoKey — ключ недоступен без взаимодействия с пользователем
+var ErrNoKey = errors.New("ключ шифрования недоступен")
+
+// ErrBadKey — ключ не подошел к файлу
+var ErrBadKey = errors.New("неверный пароль или ключ, либо файл поврежден")
+
+// encryptedEnvelope — формат зашифрованного файла
+type encryptedEnvelope struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Salt    string `json:"salt,omitempty"`
+	Nonce   string `json:"nonce"`
+	Data    string `json:"data"`
+}
+
+// SessionCrypto хранит источник ключа: файл ключа из конфигурации или пароль,
+// который запрашивается один раз за запуск
+type SessionCrypto struct {
+	config     *Config
+	reader     *TerminalReader
+	passphrase string
+	keys       map[string][]byte // ключи, выведенные из пароля, по соли (Argon2id дорогой)
+	salt       string            // соль для новых файлов: ключ выводится один раз за запуск
+	mu         sync.Mutex
+}
+
+var sessionCrypto = &SessionCrypto{}
+
+// Configure задает конфигурацию (encryption_key_file) и терминал для запроса пароля
+func (sc *SessionCrypto) Configure(config *Config, reader *TerminalReader) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.config = config
+	sc.reader = reader
+}
+
+// keyFilePath возвращает путь к файлу ключа из конфигурации
+func (sc *SessionCrypto) keyFilePath() string {
+	if sc.config == nil {
+		return ""
+	}
+	if v, ok := sc.config.Get("encryption_key_file"); ok {
+		if path, ok := v.(string); ok {
+			return expandHome(path)
+		}
+	}
+	return ""
+}
+
+// getPassphrase возвращает пароль: из кеша, переменной окружения или терминала
+func (sc *SessionCrypto) getPassphrase(interactive, confirm bool) (string, error) {
+	if sc.passphrase != "" {
+		return sc.passphrase, nil
+	}
+	if env := os.Getenv(passphraseEnv); env != "" {
+		sc.passphrase = env
+		return env, nil
+	}
+	if !interactive || sc.reader == nil {
+		return "", ErrNoKey
+	}
+
+	passphrase, err := sc.reader.ReadPassword("🔑 Пароль для сессий: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("пароль не может быть пустым")
+	}
+	if confirm {
+		again, err := sc.reader.ReadPassword("🔑 Повторите пароль: ")
+		if err != nil {
+			return "", err
+		}
+		if again != passphrase {
+			return "", fmt.Errorf("пароли не совпадают")
+		}
+	}
+	sc.passphrase = passphrase
+	return passphrase, nil
+}
+
+// Ready сообщает, можно ли шифровать без запроса пароля
+func (sc *SessionCrypto) Ready() bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if keyFile := sc.keyFilePath(); keyFile != "" {
+		_, err := readKeyFile(keyFile)
+		return err == nil
+	}
+	_, err := sc.getPassphrase(false, false)
+	return err == nil
+}
+
+// SetPassphrase задает пароль без терминала (веб-интерфейс передает его в запросе)
+func (sc *SessionCrypto) SetPassphrase(passphrase string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if passphrase != sc.passphrase {
+		sc.passphrase = passphrase
+		sc.forgetKeys()
+	}
+}
+
+// forgetKeys сбрасывает выведенные из пароля ключи (пароль сменился или не подошел)
+func (sc *SessionCrypto) forgetKeys() {
+	sc.keys = nil
+	sc.salt = ""
+}
+
+// HasKeyFile сообщает, задан ли читаемый encryption_key_file: тогда шифровать можно
+// в любой момент, без пароля
+func (sc *SessionCrypto) HasKeyFile() bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	keyFile := sc.keyFilePath()
+	if keyFile == "" {
+		return false
+	}
+	_, err := readKeyFile(keyFile)
+	return err == nil
+}
+
+// encryptRAGCaches — шифровать ли коллекции, эмбеддинги и состояние обхода
+func encryptRAGCaches() bool {
+	return sessionCrypto.HasKeyFile()
+}
+
+// passphraseKey возвращает ключ для новых файлов: соль выбирается один раз за запуск,
+// и Argon2id не выполняется при каждом автосохранении. Уникальность шифротекстов
+// обеспечивает случайный nonce
+func (sc *SessionCrypto) passphraseKey(passphrase string) (string, []byte, error) {
+	if key, ok := sc.keys[sc.salt]; ok && sc.salt != "" {
+		return sc.salt, key, nil
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(salt)
+	if sc.keys == nil {
+		sc.keys = make(map[string][]byte)
+	}
+	sc.keys[encoded] = argon2.IDKey([]byte(passphrase), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+	sc.salt = encoded
+	return encoded, sc.keys[encoded], nil
+}
+
+// Unlock заранее запрашивает пароль (например, перед фоновым автосохранением)
+func (sc *SessionCrypto) Unlock() error {
+	if sc.Ready() {
+		return nil
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	_, err := sc.getPassphrase(true, true)
+	return err
+}
+
+// readKeyFile читает 32-байтовый ключ: сырые байты, hex или base64
+func readKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("файл ключа: %v", err)
+	}
+	if len(data) == argonKeyLen {
+		return data, nil
+	}
+	text := strings.TrimSpace(string(data))
+	if key, err := hex.DecodeString(text); err == nil && len(key) == argonKeyLen {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == argonKeyLen {
+		return key, nil
+	}
+	return nil, fmt.Errorf("файл ключа %s должен содержать 32 байта (сырые, hex или base64)", path)
+}
+
+// Encrypt шифрует данные. При заданном encryption_key_file используется он, иначе пароль
+func (sc *SessionCrypto) Encrypt(plain []byte) ([]byte, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	env := encryptedEnvelope{Format: encryptedFormat, Version: encryptionVersion}
+	var key []byte
+
+	if keyFile := sc.keyFilePath(); keyFile != "" {
+		k, err := readKeyFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		key = k
+		env.KDF = kdfKeyFile
+	} else {
+		passphrase, err := sc.getPassphrase(true, true)
+		if err != nil {
+			return nil, err
+		}
+		salt, k, err := sc.passphraseKey(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		key = k
+		env.KDF = kdfArgon2id
+		env.Salt = salt
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	env.Nonce = base64.StdEncoding.EncodeToString(nonce)
+	env.Data = base64.StdEncoding.EncodeToString(gcm.Seal(nil, nonce, plain, envelopeAAD(env)))
+
+	return json.MarshalIndent(env, "", "  ")
+}
+
+// Decrypt расшифровывает конверт. Если interactive == false, пароль не запрашивается
+func (sc *SessionCrypto) Decrypt(data []byte, interactive bool) ([]byte, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	var env encryptedEnvelope
+	if err := json.Unmarshal(data, &env); err != nil || env.Format != encryptedFormat {
+		return nil, fmt.Errorf("файл не зашифрован cogitor")
+	}
+	if env.Version != encryptionVersion {
+		return nil, fmt.Errorf("неподдерживаемая версия шифрования: %d", env.Version)
+	}
+
+	var key []byte
+	switch env.KDF {
+	case kdfKeyFile:
+		keyFile := sc.keyFilePath()
+		if keyFile == "" {
+			return nil, fmt.Errorf("файл зашифрован ключом из файла: задайте encryption_key_file")
+		}
+		k, err := readKeyFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		key = k
+	case kdfArgon2id:
+		passphrase, err := sc.getPassphrase(interactive, false)
+		if err != nil {
+			return nil, err
+		}
+		salt, err := base64.StdEncoding.DecodeString(env.Salt)
+		if err != nil {
+			return nil, fmt.Errorf("поврежденный конверт: %v", err)
+		}
+		if cached, ok := sc.keys[env.Salt]; ok {
+			key = cached
+		} else {
+			key = argon2.IDKey([]byte(passphrase), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+		}
+	default:
+		return nil, fmt.Errorf("неизвестный способ получения ключа: %s", env.KDF)
+	}
+
+	nonce, err1 := base64.StdEncoding.DecodeString(env.Nonce)
+	ciphertext, err2 := base64.StdEncoding.DecodeString(env.Data)
+	if err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("поврежденный конверт")
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("поврежденный конверт: неверный nonce")
+	}
+	plain, err := gcm.Open(nil, nonce, ciphertext, envelopeAAD(env))
+	if err != nil {
+		if env.KDF == kdfArgon2id {
+			sc.passphrase = "" // даем ввести пароль заново
+			sc.forgetKeys()
+		}
+		return nil, ErrBadKey
+	}
+	if env.KDF == kdfArgon2id {
+		if sc.keys == nil {
+			sc.keys = make(map[string][]byte)
+		}
+		sc.keys[env.Salt] = key
+	}
+	return plain, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// envelopeAAD привязывает шифротекст к параметрам конверта
+func envelopeAAD(env encryptedEnvelope) []byte {
+	return []byte(fmt.Sprintf("%s:%d:%s:%s", env.Format, env.Version, env.KDF, env.Salt))
+}
+
+// IsEncrypted проверяет, является ли содержимое зашифрованным конвертом
+func IsEncrypted(data []byte) bool {
+	var probe struct {
+		Format string `json:"format"`
+	}
+	return json.Unmarshal(data, &probe) == nil && probe.Format == encryptedFormat
+}
+
+// writeSecureJSON атомарно записывает JSON с правами 0600, при необходимости зашифровав его
+func writeSecureJSON(path string, v interface{}, encrypt bool) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации: %v", err)
+	}
+	return writeSecureData(path, data, encrypt)
+}
+
+// writeSecureData атомарно записывает готовые данные с правами 0600, при необходимости
+// зашифровав их
+func writeSecureData(path string, data []byte, encrypt bool) error {
+	var err error
+	if encrypt {
+		if data, err = sessionCrypto.Encrypt(data); err != nil {
+			return fmt.Errorf("ошибка шифрования: %v", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	// Уникальное имя временного файла: одновременные записи (например, отмененное и новое
+	// вычисление эмбеддингов) не портят файлы друг друга. CreateTemp создает его с правами 0600
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// readSecureJSON читает JSON, прозрачно расшифровывая зашифрованные файлы
+func readSecureJSON(path string, v interface{}, interactive bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if IsEncrypted(data) {
+		if data, err = sessionCrypto.Decrypt(data, interactive); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(data, v)
+}
+
+// isEncryptedFile проверяет файл без расшифровки
+func isEncryptedFile(path string) bool {
+	data, err := os.ReadFile(path)
+	return err == nil && IsEncrypted(data)
+}
+
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	return path
+}
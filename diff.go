@@ -4,7 +4,6 @@ package main
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 	"sort"
 	"strings"
 	"regexp"
@@ -15,6 +14,8 @@ type DiffProcessor struct {
 	fileParser     *FileParser
 	terminalReader *TerminalReader
 	config         *Config
+	workspace      *Workspace
+	dryRun         *DryRun
 }
 
 type DiffBlock struct {
@@ -27,7 +28,7 @@ type DiffBlock struct {
 }
 
 func NewDiffProcessor(fp *FileParser, tr *TerminalReader, cfg *Config) *DiffProcessor {
-	return &DiffProcessor{fileParser: fp, terminalReader: tr, config: cfg}
+	return &DiffProcessor{fileParser: fp, terminalReader: tr, config: cfg, workspace: NewWorkspace(cfg)}
 }
 
 // ---------------  парсинг блоков из ответа LLM  ---------------
@@ -132,7 +133,7 @@ func (dp *DiffProcessor) ApplyDiffBlocks(blocks []DiffBlock, autoMode bool) erro
 
 // applySingleFilePatchesOptimized - новая оптимизированная версия
 func (dp *DiffProcessor) applySingleFilePatchesOptimized(filePath string, blocks []DiffBlock, autoMode bool) error {
-	fullPath, err := dp.resolveSafePath(filePath)
+	fullPath, err := dp.workspace.Resolve(filePath)
 	if err != nil {
 		return fmt.Errorf("валидация пути файла '%s' провалилась: %v", filePath, err)
 	}
@@ -145,7 +146,8 @@ func (dp *DiffProcessor) applySingleFilePatchesOptimized(filePath string, blocks
 	origLines := strings.Split(string(content), "\n")
 	
 	// Создаем бэкап перед изменениями
-	if !autoMode && dp.config != nil && !dp.config.GetBool("skip_backup") {
+	dryRun := dp.dryRun.Enabled()
+	if !autoMode && !dryRun && dp.config != nil && !dp.config.GetBool("skip_backup") {
 		backupPath := fullPath + ".backup"
 		if err := os.WriteFile(backupPath, content, 0644); err != nil {
 			return fmt.Errorf("не удалось создать бэкап %s: %v", backupPath, err)
@@ -223,7 +225,9 @@ func (dp *DiffProcessor) applySingleFilePatchesOptimized(filePath string, blocks
 		}
 		
 		// Спрашиваем подтверждение, если есть проблемные патчи
-		if !autoMode {
+		if dryRun {
+			dp.dryRun.Warn(fmt.Sprintf("%s: %d из %d патчей не совпадают с файлом", filePath, len(invalidPatches), len(blocks)))
+		} else if !autoMode {
 			response, err := dp.terminalReader.ReadLineWithPrompt(
 				fmt.Sprintf("Применить только %d корректных патчей из %d? (y/n): ", 
 					len(validPatches), len(blocks)))
@@ -278,12 +282,16 @@ func (dp *DiffProcessor) applySingleFilePatchesOptimized(filePath string, blocks
 	
 	// Записываем результат, даже если не все патчи применились
 	result := strings.Join(resultLines, "\n")
-	if err := os.WriteFile(fullPath, []byte(result), 0644); err != nil {
+	verb := "применено"
+	if dryRun {
+		verb = "будет применено"
+		dp.dryRun.AddWrite(filePath, result, "diff")
+	} else if err := os.WriteFile(fullPath, []byte(result), 0644); err != nil {
 		return fmt.Errorf("ошибка записи: %v", err)
 	}
 	
 	// Формируем отчет о применении
-	fmt.Printf("  ✅ %s: применено %d/%d патчей", filePath, appliedCount, len(blocks))
+	fmt.Printf("  ✅ %s: %s %d/%d патчей", filePath, verb, appliedCount, len(blocks))
 	if len(invalidPatches) > 0 {
 		fmt.Printf(" (%d с предупреждениями)", len(invalidPatches))
 	}
@@ -424,85 +432,13 @@ func (dp *DiffProcessor) GetTargetFiles(q string) []string {
 	refs, _ := dp.fileParser.ExtractFileReferences(q)
 	var files []string
 	for _, r := range refs {
-		if !r.IsAll && !r.IsURL {
+		if !r.IsAll && !r.IsURL && r.Git == "" {
 			files = append(files, r.Path)
 		}
 	}
 	return files
 }
 
-// resolveSafePath проверяет, что путь не содержит попыток выйти за пределы рабочей директории
-func (dp *DiffProcessor) resolveSafePath(relativePath string) (string, error) {
-    // Очищаем путь от лишних элементов
-    cleanPath := filepath.Clean(relativePath)
-    
-    // === ИСПРАВЛЕНИЕ 1: Раскрытие домашней директории ===
-    if strings.HasPrefix(cleanPath, "~/") {
-        home, err := os.UserHomeDir()
-        if err != nil {
-            return "", fmt.Errorf("не удалось получить домашнюю директорию: %v", err)
-        }
-        cleanPath = filepath.Join(home, cleanPath[2:])
-    }
-    
-    // === ИСПРАВЛЕНИЕ 2: Разрешение абсолютных путей внутри рабочей директории ===
-    workingDir, err := os.Getwd()
-    if err != nil {
-        return "", fmt.Errorf("не удалось получить текущую директорию: %v", err)
-    }
-    
-    var fullPath string
-    if filepath.IsAbs(cleanPath) {
-        // Для абсолютных путей проверяем, что они внутри рабочей директории
-        relPath, err := filepath.Rel(workingDir, cleanPath)
-        if err != nil {
-            return "", fmt.Errorf("не удалось проверить относительный путь: %v", err)
-        }
-        
-        if strings.HasPrefix(relPath, "..") {
-            return "", fmt.Errorf("путь выходит за пределы рабочей директории: %s", cleanPath)
-        }
-        
-        fullPath = cleanPath
-    } else {
-        // Относительный путь - соединяем с рабочей директорией
-        fullPath = filepath.Join(workingDir, cleanPath)
-    }
-    
-    // Проверяем, что резолвленный путь остается внутри рабочей директории
-    resolvedPath, err := filepath.EvalSymlinks(fullPath)
-    if err != nil {
-        // Файл еще не существует - разрешаем создание, но только внутри рабочей директории
-        if os.IsNotExist(err) {
-            // Проверяем, что родительская директория разрешена
-            parentDir := filepath.Dir(fullPath)
-            relParent, err := filepath.Rel(workingDir, parentDir)
-            if err != nil {
-                return "", fmt.Errorf("не удалось проверить родительскую директорию: %v", err)
-            }
-            
-            if strings.HasPrefix(relParent, "..") {
-                return "", fmt.Errorf("родительская директория выходит за пределы рабочей директории: %s", parentDir)
-            }
-            
-            return fullPath, nil
-        }
-        return "", err
-    }
-    
-    // Проверяем, что резолвленный путь остается внутри рабочей директории
-    relResolved, err := filepath.Rel(workingDir, resolvedPath)
-    if err != nil {
-        return "", fmt.Errorf("не удалось проверить резолвленный путь: %v", err)
-    }
-    
-    if strings.HasPrefix(relResolved, "..") {
-        return "", fmt.Errorf("путь выходит за пределы рабочей директории: %s", resolvedPath)
-    }
-    
-    return fullPath, nil
-}
-
 // SafeApplyDiffBlocks применяет патчи с максимальной отказоустойчивостью
 // Возвращает статистику примененных/непримененных патчей
 func (dp *DiffProcessor) SafeApplyDiffBlocks(blocks []DiffBlock, autoMode bool) (applied int, total int, errors []string) {
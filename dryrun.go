@@ -0,0 +1,525 @@
+// dryrun.go
+// Режим dry-run (--dry-run, :set dry_run on): генерация кода, DIFF-патчи, установка
+// зависимостей и запуск только описывают свои действия. Описание собирается в JSON-план
+// в .cogitor/plans рабочей директории; :apply <план> выполняет его позже
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const PlanVersion = 1
+
+// Plan — запланированные записи файлов, установки и команды
+type Plan struct {
+	Version  int           `json:"version"`
+	Created  time.Time     `json:"created"`
+	Dir      string        `json:"dir"`
+	Query    string        `json:"query,omitempty"`
+	Writes   []PlanWrite   `json:"writes"`
+	Installs []PlanCommand `json:"installs"`
+	Commands []PlanCommand `json:"commands"`
+	Warnings []string      `json:"warnings,omitempty"`
+}
+
+// PlanWrite — запись одного файла
+type PlanWrite struct {
+	Path    string `json:"path"`
+	Action  string `json:"action"` // create, update, patch
+	Source  string `json:"source"` // cod, diff
+	Content string `json:"content"`
+	// BaseHash — sha256 файла на момент планирования (пусто для нового файла): :apply
+	// не перезаписывает файлы, измененные после создания плана
+	BaseHash string `json:"base_sha256,omitempty"`
+	Added    int    `json:"added"`
+	Removed  int    `json:"removed"`
+	Diff     string `json:"diff,omitempty"`
+}
+
+// PlanCommand — команда установки, компиляции или запуска (выполняется через shell)
+type PlanCommand struct {
+	Kind    string `json:"kind"` // install, compile, run
+	Command string `json:"command"`
+	Dir     string `json:"dir,omitempty"`
+	Source  string `json:"source,omitempty"` // llm, analysis, project
+	Package string `json:"package,omitempty"`
+}
+
+// DryRun собирает план, пока режим включен. Один экземпляр разделяют ассистент,
+// DiffProcessor, Installer и CodeRunner
+type DryRun struct {
+	config *Config
+	forced bool // --dry-run в командной строке: действует до :set dry_run off
+	mu     sync.Mutex
+	plan   *Plan
+}
+
+// NewDryRun создает сборщик плана
+func NewDryRun(config *Config) *DryRun {
+	return &DryRun{config: config}
+}
+
+// Enabled сообщает, включен ли режим dry-run
+func (d *DryRun) Enabled() bool {
+	if d == nil {
+		return false
+	}
+	return d.forced || (d.config != nil && d.config.GetBool("dry_run"))
+}
+
+// SetForced включает режим на время сессии без сохранения в конфигурации
+func (d *DryRun) SetForced(on bool) {
+	d.mu.Lock()
+	d.forced = on
+	d.mu.Unlock()
+}
+
+// Begin начинает новый план
+func (d *DryRun) Begin(query string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.plan = newPlan(query)
+}
+
+func newPlan(query string) *Plan {
+	dir, _ := os.Getwd()
+	return &Plan{
+		Version:  PlanVersion,
+		Created:  time.Now(),
+		Dir:      dir,
+		Query:    query,
+		Writes:   []PlanWrite{},
+		Installs: []PlanCommand{},
+		Commands: []PlanCommand{},
+	}
+}
+
+// current возвращает текущий план, создавая его при необходимости; вызывается под mu
+func (d *DryRun) current() *Plan {
+	if d.plan == nil {
+		d.plan = newPlan("")
+	}
+	return d.plan
+}
+
+// AddWrite добавляет запись файла; повторная запись того же файла заменяет предыдущую
+func (d *DryRun) AddWrite(path, content, source string) {
+	w := PlanWrite{Path: path, Source: source, Content: content, Action: "create"}
+	old, err := os.ReadFile(path)
+	oldName := "/dev/null"
+	if err == nil {
+		w.Action = "update"
+		if source == "diff" {
+			w.Action = "patch"
+		}
+		w.BaseHash = fileHash(old)
+		oldName = "a/" + path
+	}
+	w.Diff, w.Added, w.Removed = UnifiedDiff(oldName, "b/"+path, string(old), content)
+
+	d.mu.Lock()
+	plan := d.current()
+	replaced := false
+	for i := range plan.Writes {
+		if plan.Writes[i].Path == path {
+			// База — исходное состояние файла до первой запланированной записи
+			w.BaseHash = plan.Writes[i].BaseHash
+			w.Action = plan.Writes[i].Action
+			plan.Writes[i] = w
+			replaced = true
+		}
+	}
+	if !replaced {
+		plan.Writes = append(plan.Writes, w)
+	}
+	d.mu.Unlock()
+
+	fmt.Printf("📝 [dry-run] %s: %s (+%d -%d)\n", planActionName(w.Action), path, w.Added, w.Removed)
+}
+
+// AddCommand добавляет команду установки, компиляции или запуска
+func (d *DryRun) AddCommand(c PlanCommand) {
+	d.mu.Lock()
+	plan := d.current()
+	if c.Kind == "install" {
+		for _, existing := range plan.Installs {
+			if existing.Command == c.Command {
+				d.mu.Unlock()
+				return
+			}
+		}
+		plan.Installs = append(plan.Installs, c)
+	} else {
+		plan.Commands = append(plan.Commands, c)
+	}
+	d.mu.Unlock()
+
+	icon := "🚀"
+	switch c.Kind {
+	case "install":
+		icon = "📦"
+	case "compile":
+		icon = "🔧"
+	}
+	fmt.Printf("%s [dry-run] %s: %s\n", icon, planKindName(c.Kind), c.Command)
+}
+
+// Warn добавляет в план предупреждение
+func (d *DryRun) Warn(msg string) {
+	d.mu.Lock()
+	plan := d.current()
+	plan.Warnings = append(plan.Warnings, msg)
+	d.mu.Unlock()
+	fmt.Printf("⚠️  [dry-run] %s\n", msg)
+}
+
+// Finish сохраняет план и печатает путь к нему
+func (d *DryRun) Finish() {
+	d.mu.Lock()
+	plan := d.plan
+	d.plan = nil
+	d.mu.Unlock()
+	if plan == nil {
+		return
+	}
+
+	path, err := plan.Save()
+	if err != nil {
+		fmt.Printf("❌ Не удалось сохранить план: %v\n", err)
+		return
+	}
+	fmt.Printf("\n📋 План (dry-run): %s\n", plan.Summary())
+	fmt.Printf("💾 %s\n", path)
+	fmt.Println("   Применить: :apply " + filepath.Base(path))
+}
+
+func planActionName(action string) string {
+	switch action {
+	case "create":
+		return "создать"
+	case "patch":
+		return "применить патч"
+	}
+	return "перезаписать"
+}
+
+func planKindName(kind string) string {
+	switch kind {
+	case "install":
+		return "установка"
+	case "compile":
+		return "компиляция"
+	}
+	return "запуск"
+}
+
+// getPlansDir возвращает директорию планов для текущей рабочей директории
+func getPlansDir() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		wd = "."
+	}
+	return filepath.Join(wd, ".cogitor", "plans")
+}
+
+// Summary кратко описывает план
+func (p *Plan) Summary() string {
+	return fmt.Sprintf("файлов %d, установок %d, команд %d", len(p.Writes), len(p.Installs), len(p.Commands))
+}
+
+// Save записывает план в .cogitor/plans и возвращает путь
+func (p *Plan) Save() (string, error) {
+	dir := getPlansDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	ignoreCogitorDir(filepath.Dir(dir))
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "plan_"+p.Created.Format("20060102_150405")+".json")
+	for n := 2; ; n++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			break
+		}
+		path = filepath.Join(dir, fmt.Sprintf("plan_%s_%d.json", p.Created.Format("20060102_150405"), n))
+	}
+	return path, os.WriteFile(path, data, 0644)
+}
+
+// LoadPlan читает план; name — путь к файлу или имя в .cogitor/plans, пусто — последний план
+func LoadPlan(name string) (*Plan, string, error) {
+	path := expandHome(name)
+	if name == "" {
+		entries, _ := filepath.Glob(filepath.Join(getPlansDir(), "plan_*.json"))
+		if len(entries) == 0 {
+			return nil, "", fmt.Errorf("планов нет в %s (создайте: :set dry_run on)", getPlansDir())
+		}
+		sort.SliceStable(entries, func(i, j int) bool {
+			fi, _ := os.Stat(entries[i])
+			fj, _ := os.Stat(entries[j])
+			return fi != nil && fj != nil && fi.ModTime().Before(fj.ModTime())
+		})
+		path = entries[len(entries)-1]
+	} else if _, err := os.Stat(path); err != nil && !strings.ContainsRune(name, os.PathSeparator) {
+		path = filepath.Join(getPlansDir(), name)
+		if filepath.Ext(path) == "" {
+			path += ".json"
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, path, fmt.Errorf("не удалось прочитать план: %v", err)
+	}
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, path, fmt.Errorf("некорректный план %s: %v", path, err)
+	}
+	if plan.Version != PlanVersion {
+		return nil, path, fmt.Errorf("неподдерживаемая версия плана: %d", plan.Version)
+	}
+	return &plan, path, nil
+}
+
+// planShellCommand возвращает команду для выполнения строки через shell
+func planShellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
+
+// runPlanned выполняет установки и команды плана. Установки идут через установщик,
+// компиляция и запуск — в песочнице с теми же лимитами времени и вывода, что и при
+// обычном запуске; команды одной директории разделяют песочницу, чтобы запуск видел
+// результат компиляции
+func (cr *CodeRunner) runPlanned(ctx context.Context, installs, commands []PlanCommand) error {
+	for _, c := range installs {
+		fmt.Printf("\n▶️  %s: %s\n", planKindName(c.Kind), c.Command)
+		if err := cr.executeInstallCommand(ctx, c.Command); err != nil {
+			return err
+		}
+	}
+	if len(commands) == 0 {
+		return nil
+	}
+	defer cr.clearSandboxOnce()
+
+	opts := cr.sandboxOptions()
+	boxes := make(map[string]*Sandbox)
+	defer func() {
+		for _, box := range boxes {
+			box.Close()
+		}
+	}()
+	for _, c := range commands {
+		fmt.Printf("\n▶️  %s: %s\n", planKindName(c.Kind), c.Command)
+		cmd := planShellCommand(c.Command)
+		cmd.Dir = c.Dir
+		var box *Sandbox
+		if opts.Backend != "off" {
+			dir := c.Dir
+			if dir == "" {
+				dir = "."
+			}
+			if box = boxes[dir]; box == nil {
+				var err error
+				if box, err = NewSandbox(opts, dir, ""); err != nil {
+					return err
+				}
+				boxes[dir] = box
+				fmt.Println(box.Describe())
+			}
+		}
+		output, err := cr.execute(ctx, cmd, box)
+		fmt.Print(output)
+		if output != "" && !strings.HasSuffix(output, "\n") {
+			fmt.Println()
+		}
+		if err != nil {
+			return fmt.Errorf("команда '%s' завершилась с ошибкой: %v%s", c.Command, err, sandboxNote(box, err))
+		}
+	}
+	for _, box := range boxes {
+		cr.saveOutputs(box)
+	}
+	return nil
+}
+
+// ========== Планирование генерации кода и DIFF ==========
+
+// planCodeGeneration описывает запись сгенерированных файлов, установку зависимостей и запуск
+func (a *Assistant) planCodeGeneration(files []CodeFile, isTextRequest bool) {
+	a.dryRun.Begin(a.lastUserQuery)
+	defer a.dryRun.Finish()
+
+	for _, f := range files {
+		if NewFileChange(f).Unchanged() {
+			fmt.Printf("⏭️  %s: без изменений\n", f.Path)
+			continue
+		}
+		a.dryRun.AddWrite(f.Path, f.Content, "cod")
+	}
+
+	if err := a.installer.CheckAndInstallDependencies(files); err != nil {
+		a.dryRun.Warn(err.Error())
+	}
+	if !isTextRequest {
+		// Точка входа — по умолчанию, без вопросов: план должен быть воспроизводимым
+		projectConfig := NewProjectAnalyzer(files).Analyze()
+		if err := a.codeRunner.RunProject(a.requestCtx, projectConfig, a.provider, a.model, a.apiKey); err != nil {
+			a.dryRun.Warn(err.Error())
+		}
+	}
+}
+
+// planDiffApplication описывает применение DIFF-патчей и проверку измененных файлов
+func (a *Assistant) planDiffApplication(blocks []DiffBlock, compileInfoMap map[string]*CompileInfo, paths []string) {
+	a.dryRun.Begin(a.lastUserQuery)
+	defer a.dryRun.Finish()
+
+	if err := a.diffProcessor.ApplyDiffBlocks(blocks, true); err != nil {
+		a.dryRun.Warn(err.Error())
+	}
+	for _, filePath := range paths {
+		if err := a.codeRunner.RunDiffWithRetry(a.requestCtx, filePath, a.provider, a.model, a.apiKey, a.diffProcessor, compileInfoMap[filePath]); err != nil {
+			a.dryRun.Warn(err.Error())
+		}
+	}
+}
+
+// ========== Применение плана ==========
+
+// ApplyPlan записывает файлы плана и, если run, выполняет установки и команды.
+// Файлы, измененные после создания плана, пропускаются (force — перезаписать)
+func (a *Assistant) ApplyPlan(plan *Plan, run, force bool) error {
+	if wd, _ := os.Getwd(); plan.Dir != "" && wd != plan.Dir {
+		return fmt.Errorf("план создан в %s, текущая директория %s (:cd %s)", plan.Dir, wd, plan.Dir)
+	}
+
+	var writes []PlanWrite
+	skipped := 0
+	for _, w := range plan.Writes {
+		if _, err := a.workspace.Resolve(w.Path); err != nil {
+			fmt.Printf("⛔ %s пропущен: %v\n", w.Path, err)
+			skipped++
+			continue
+		}
+		current := ""
+		if data, err := os.ReadFile(w.Path); err == nil {
+			current = fileHash(data)
+		}
+		if current != w.BaseHash && !force {
+			fmt.Printf("⚠️  %s изменился после создания плана, пропущен (:apply ... --force — перезаписать)\n", w.Path)
+			skipped++
+			continue
+		}
+		writes = append(writes, w)
+	}
+
+	paths := make([]string, 0, len(writes))
+	for _, w := range writes {
+		paths = append(paths, w.Path)
+	}
+	if len(writes) > 0 && (!a.gitBeforeApply(paths, false) || !a.gitUseWorkBranch()) {
+		return fmt.Errorf("применение отменено")
+	}
+
+	var written []string
+	if len(writes) > 0 {
+		op := a.journal.Begin("План: "+strings.Join(paths, ", "), nil)
+		for _, w := range writes {
+			op.TrackFile(w.Path)
+			if err := a.workspace.WriteFile(w.Path, []byte(w.Content)); err != nil {
+				fmt.Printf("❌ %v\n", err)
+				continue
+			}
+			written = append(written, w.Path)
+			fmt.Printf("✅ Файл записан: %s\n", w.Path)
+		}
+		op.Commit()
+	}
+
+	if run && skipped > 0 {
+		fmt.Println("⏭️  Установки и команды не выполняются: записаны не все файлы плана")
+		run = false
+	}
+	if run {
+		if err := a.codeRunner.runPlanned(context.Background(), plan.Installs, plan.Commands); err != nil {
+			a.gitAutoCommit(context.Background(), written)
+			return err
+		}
+	}
+
+	a.gitAutoCommit(context.Background(), written)
+	fmt.Printf("\n📊 План применен: записано файлов %d из %d\n", len(written), len(plan.Writes))
+	return nil
+}
+
+// handleApply — команда :apply [план] [--no-run] [--force]
+func (ch *CommandHandler) handleApply(args []string) {
+	a, ok := ch.assistant.(*Assistant)
+	if !ok {
+		return
+	}
+	name := ""
+	run, force := true, false
+	for _, arg := range args {
+		switch arg {
+		case "--no-run":
+			run = false
+		case "--force":
+			force = true
+		default:
+			name = arg
+		}
+	}
+
+	plan, path, err := LoadPlan(name)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+
+	fmt.Printf("📋 План %s (%s): %s\n", filepath.Base(path), plan.Created.Format("02.01.2006 15:04"), plan.Summary())
+	if plan.Query != "" {
+		fmt.Printf("   Запрос: %s\n", plan.Query)
+	}
+	for _, w := range plan.Writes {
+		fmt.Printf("   📝 %s %s (+%d -%d)\n", planActionName(w.Action), w.Path, w.Added, w.Removed)
+	}
+	for _, c := range append(append([]PlanCommand{}, plan.Installs...), plan.Commands...) {
+		mark := ""
+		if !run {
+			mark = " (пропуск: --no-run)"
+		}
+		fmt.Printf("   ▶️  %s: %s%s\n", planKindName(c.Kind), c.Command, mark)
+	}
+	for _, w := range plan.Warnings {
+		fmt.Printf("   ⚠️  %s\n", w)
+	}
+
+	if ch.terminalReader != nil {
+		response, err := ch.terminalReader.ReadLineWithPrompt("Применить план? (y/n): ")
+		if err != nil || strings.ToLower(strings.TrimSpace(response)) != "y" {
+			fmt.Println("❌ Отменено")
+			return
+		}
+	}
+	if err := a.ApplyPlan(plan, run, force); err != nil {
+		fmt.Printf("❌ %v\n", err)
+	}
+}
@@ -0,0 +1,481 @@
+// embeddings.go
+// Векторный индекс RAG: эмбеддинги фрагментов через API провайдера (Ollama, OpenRouter,
+// OpenAI-совместимый URL) хранятся в ~/.cogitor/rag/<коллекция>/embeddings.json
+// и переиспользуются между запусками — неизменные фрагменты повторно не отправляются
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultRAGCollection  = "default"
+	DefaultEmbeddingModel = "nomic-embed-text"
+	embeddingBatchSize    = 16
+	embeddingTimeout      = 120 * time.Second
+	embeddingMaxAge       = 30 * 24 * time.Hour // неиспользуемые векторы удаляются из индекса
+	ragHybridWeight       = 0.5                 // вес BM25 в гибридной оценке (остальное — косинус)
+)
+
+// vectorEntry — вектор фрагмента и время последнего использования
+type vectorEntry struct {
+	Vector []float32 `json:"v"`
+	Used   string    `json:"used"`
+}
+
+// VectorStore — файловый индекс эмбеддингов коллекции, ключ — хеш текста фрагмента
+type VectorStore struct {
+	Collection string                  `json:"collection"`
+	Provider   string                  `json:"provider"`
+	Model      string                  `json:"model"`
+	Dim        int                     `json:"dim"`
+	Entries    map[string]*vectorEntry `json:"entries"`
+	path       string
+	mu         sync.Mutex
+}
+
+// getRAGDir возвращает директорию коллекции RAG
+func getRAGDir(collection string) string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".cogitor", "rag", collection)
+}
+
+// LoadVectorStore читает индекс коллекции. Если индекс построен другой моделью,
+// он начинается заново: векторы разных моделей несравнимы
+func LoadVectorStore(collection, provider, model string) *VectorStore {
+	vs := &VectorStore{
+		Collection: collection,
+		Provider:   provider,
+		Model:      model,
+		Entries:    make(map[string]*vectorEntry),
+		path:       filepath.Join(getRAGDir(collection), "embeddings.json"),
+	}
+
+	var stored VectorStore
+	if err := readSecureJSON(vs.path, &stored, false); err != nil {
+		return vs
+	}
+	if stored.Provider == provider && stored.Model == model && stored.Entries != nil {
+		vs.Dim = stored.Dim
+		vs.Entries = stored.Entries
+	}
+	return vs
+}
+
+// Save записывает индекс, удаляя давно не использованные векторы
+func (vs *VectorStore) Save() error {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	cutoff := time.Now().Add(-embeddingMaxAge)
+	for key, entry := range vs.Entries {
+		if used, err := time.Parse(time.RFC3339, entry.Used); err == nil && used.Before(cutoff) {
+			delete(vs.Entries, key)
+		}
+	}
+
+	// Без отступов: в индексе тысячи векторов
+	data, err := json.Marshal(vs)
+	if err != nil {
+		return err
+	}
+	return writeSecureData(vs.path, data, encryptRAGCaches())
+}
+
+// Size возвращает число векторов и размер файла индекса
+func (vs *VectorStore) Size() (int, int64) {
+	vs.mu.Lock()
+	count := len(vs.Entries)
+	vs.mu.Unlock()
+
+	var bytes int64
+	if info, err := os.Stat(vs.path); err == nil {
+		bytes = info.Size()
+	}
+	return count, bytes
+}
+
+// Path возвращает путь к файлу индекса
+func (vs *VectorStore) Path() string {
+	return vs.path
+}
+
+func chunkHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:16])
+}
+
+// EmbedChunks находит векторы фрагментов: из кеша или через API.
+// Возвращает векторы (nil, если получены не для всех фрагментов) и число
+// фрагментов, для которых эмбеддинги запрашивались заново
+func (vs *VectorStore) EmbedChunks(c context.Context, chunks []*RAGChunk, apiKey string, progress func(done, total int)) ([][]float32, int, error) {
+	if len(chunks) == 0 {
+		return nil, 0, nil
+	}
+	now := time.Now().Format(time.RFC3339)
+
+	var missing []int
+	vs.mu.Lock()
+	for i, chunk := range chunks {
+		if entry, ok := vs.Entries[chunkHash(chunk.Text)]; ok {
+			entry.Used = now
+		} else {
+			missing = append(missing, i)
+		}
+	}
+	vs.mu.Unlock()
+
+	var embedErr error
+	for start := 0; start < len(missing); start += embeddingBatchSize {
+		end := start + embeddingBatchSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+		texts := make([]string, 0, end-start)
+		for _, i := range missing[start:end] {
+			texts = append(texts, chunks[i].Text)
+		}
+
+		vectors, err := Embed(c, texts, vs.Provider, vs.Model, apiKey)
+		if err != nil {
+			embedErr = err
+			break
+		}
+
+		vs.mu.Lock()
+		for j, i := range missing[start:end] {
+			vs.Entries[chunkHash(chunks[i].Text)] = &vectorEntry{Vector: vectors[j], Used: now}
+			if vs.Dim == 0 {
+				vs.Dim = len(vectors[j])
+			}
+		}
+		vs.mu.Unlock()
+
+		if progress != nil {
+			progress(end, len(missing))
+		}
+	}
+
+	// Сохраняем даже частичный результат: при следующей загрузке продолжим с того же места
+	if len(missing) > 0 || embedErr == nil {
+		if err := vs.Save(); err != nil && embedErr == nil {
+			embedErr = err
+		}
+	}
+
+	vs.mu.Lock()
+	vectors := make([][]float32, len(chunks))
+	complete := true
+	for i, chunk := range chunks {
+		if entry, ok := vs.Entries[chunkHash(chunk.Text)]; ok {
+			vectors[i] = entry.Vector
+		} else {
+			complete = false
+		}
+	}
+	vs.mu.Unlock()
+	if !complete {
+		vectors = nil
+	}
+
+	return vectors, len(missing), embedErr
+}
+
+// embeddingEndpoint возвращает URL API эмбеддингов провайдера и формат ответа
+func embeddingEndpoint(provider string) (string, bool, error) {
+	switch {
+	case provider == "ollama":
+		return "http://localhost:11434/api/embed", true, nil
+	case provider == "openrouter":
+		return "https://openrouter.ai/api/v1/embeddings", false, nil
+	case isURLLLM(provider):
+		// OpenAI-совместимый сервер: .../chat/completions -> .../embeddings
+		base := strings.TrimSuffix(provider, "/")
+		if i := strings.Index(base, "/chat/completions"); i >= 0 {
+			base = base[:i]
+		}
+		return base + "/embeddings", false, nil
+	}
+	return "", false, fmt.Errorf("провайдер %s не поддерживает эмбеддинги (используйте ollama, openrouter или URL)", provider)
+}
+
+// EmbeddingProvider выбирает провайдера эмбеддингов: из настройки embedding_provider,
+// иначе текущий, если он их поддерживает, иначе локальную Ollama
+func EmbeddingProvider(config *Config, current string) string {
+	if v, ok := config.Get("embedding_provider"); ok {
+		if p, ok := v.(string); ok && p != "" {
+			return p
+		}
+	}
+	if _, _, err := embeddingEndpoint(current); err == nil {
+		return current
+	}
+	return "ollama"
+}
+
+// Embed получает эмбеддинги текстов
+func Embed(c context.Context, texts []string, provider, model, apiKey string) ([][]float32, error) {
+	endpoint, ollama, err := embeddingEndpoint(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"model": model, "input": texts})
+	if err != nil {
+		return nil, err
+	}
+
+	reqCtx, cancel := context.WithTimeout(c, embeddingTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" && !ollama {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("эмбеддинги: ошибка сети: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := readWithContext(reqCtx, resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if len(respBody) > 200 {
+			respBody = respBody[:200]
+		}
+		return nil, fmt.Errorf("эмбеддинги: статус %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var parsed struct {
+		Embeddings [][]float32 `json:"embeddings"` // Ollama /api/embed
+		Data       []struct {
+			Embedding []float32 `json:"embedding"`
+			Index     int       `json:"index"`
+		} `json:"data"` // OpenAI-совместимый формат
+	}
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return nil, fmt.Errorf("эмбеддинги: неверный JSON: %w", err)
+	}
+
+	vectors := parsed.Embeddings
+	if len(vectors) == 0 && len(parsed.Data) > 0 {
+		vectors = make([][]float32, len(parsed.Data))
+		for i, d := range parsed.Data {
+			pos := d.Index
+			if pos < 0 || pos >= len(vectors) {
+				pos = i
+			}
+			vectors[pos] = d.Embedding
+		}
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("эмбеддинги: ожидалось %d векторов, получено %d", len(texts), len(vectors))
+	}
+	for _, v := range vectors {
+		if len(v) == 0 {
+			return nil, fmt.Errorf("эмбеддинги: пустой вектор в ответе")
+		}
+	}
+	return vectors, nil
+}
+
+// embeddingSettings возвращает провайдера и модель эмбеддингов из конфигурации
+func (a *Assistant) embeddingSettings() (string, string, string) {
+	config := a.GetConfig()
+	provider := EmbeddingProvider(config, a.provider)
+	model := DefaultEmbeddingModel
+	if v, ok := config.Get("embedding_model"); ok {
+		if m, ok := v.(string); ok && m != "" {
+			model = m
+		}
+	}
+	// Ключ текущего провайдера подходит, только если эмбеддинги идут через него же
+	apiKey := ""
+	if provider == a.provider {
+		apiKey = a.apiKey
+	}
+	return provider, model, apiKey
+}
+
+// startEmbedding запускает построение векторного индекса в фоне и отменяет построение для
+// прежних данных: загрузка и запросы не ждут API эмбеддингов, до готовности поиск идет по BM25
+func (a *Assistant) startEmbedding() {
+	c, cancel := context.WithCancel(context.Background())
+	a.ragMutex.Lock()
+	if a.embedCancel != nil {
+		a.embedCancel()
+	}
+	a.embedCancel = cancel
+	a.ragMutex.Unlock()
+	go a.embedRAGData(c)
+}
+
+// embedRAGData строит векторный индекс для загруженных RAG-данных, если включен rag_embeddings.
+// Кеш эмбеддингов у каждой коллекции свой. Векторы попадают в индекс, только если получены
+// для всех фрагментов; при ошибке RAG продолжает работать только на BM25
+func (a *Assistant) embedRAGData(c context.Context) {
+	a.ragMutex.RLock()
+	idx := a.ragIndex
+	docs := a.ragData
+	enabled := a.ragEnabled
+	a.ragMutex.RUnlock()
+
+	// Прежние векторы могли быть построены другой моделью: до готовности нового индекса — только BM25
+	a.ragMutex.Lock()
+	if a.ragIndex == idx && idx != nil {
+		idx.vectors = nil
+	}
+	a.ragVectors = nil
+	a.ragMutex.Unlock()
+
+	if !enabled || idx.ChunkCount() == 0 || !a.GetConfig().GetBool("rag_embeddings") {
+		return
+	}
+
+	// Группируем фрагменты по коллекциям, сохраняя порядок индекса
+	var collections []string
+	groups := make(map[string][]int)
+	for i, chunk := range idx.chunks {
+		name := docs[chunk.DocID-1].Collection
+		if name == "" {
+			name = DefaultRAGCollection
+		}
+		if _, ok := groups[name]; !ok {
+			collections = append(collections, name)
+		}
+		groups[name] = append(groups[name], i)
+	}
+
+	provider, model, apiKey := a.embeddingSettings()
+	vectors := make([][]float32, len(idx.chunks))
+	var stores []*VectorStore
+	fresh := 0
+	var embedErr error
+	for _, name := range collections {
+		positions := groups[name]
+		chunks := make([]*RAGChunk, len(positions))
+		for j, i := range positions {
+			chunks[j] = idx.chunks[i]
+		}
+
+		store := LoadVectorStore(name, provider, model)
+		got, n, err := store.EmbedChunks(c, chunks, apiKey, nil)
+		fresh += n
+		if err != nil || got == nil {
+			embedErr = err
+			break
+		}
+		for j, i := range positions {
+			vectors[i] = got[j]
+		}
+		stores = append(stores, store)
+	}
+
+	if c.Err() != nil {
+		return // данные сменились, построение запущено заново
+	}
+	if embedErr == nil && len(stores) == len(collections) {
+		embedErr = checkVectors(vectors)
+	}
+	if embedErr != nil {
+		fmt.Printf("⚠️  Векторный индекс не построен, используется только BM25: %v\n", embedErr)
+		vectors, stores = nil, nil
+	} else if len(stores) < len(collections) {
+		vectors, stores = nil, nil
+	} else if fresh > 0 {
+		fmt.Printf("🧮 Векторный индекс обновлен: %d новых фрагментов, %d из кеша\n",
+			fresh, idx.ChunkCount()-fresh)
+	}
+
+	a.ragMutex.Lock()
+	defer a.ragMutex.Unlock()
+	if a.ragIndex != idx {
+		return // данные успели смениться
+	}
+	idx.vectors = vectors
+	a.ragVectors = stores
+}
+
+// checkVectors проверяет, что вектор есть у каждого фрагмента и размерность одна: иначе
+// гибридный поиск смешал бы косинус с нулями
+func checkVectors(vectors [][]float32) error {
+	for i, v := range vectors {
+		if len(v) == 0 {
+			return fmt.Errorf("нет вектора для фрагмента %d из %d", i+1, len(vectors))
+		}
+		if len(v) != len(vectors[0]) {
+			return fmt.Errorf("векторы разной размерности (%d и %d): смените embedding_model или очистите кеш", len(vectors[0]), len(v))
+		}
+	}
+	return nil
+}
+
+// embedQuery возвращает вектор запроса для гибридного поиска или nil
+func (a *Assistant) embedQuery(query string) []float32 {
+	a.ragMutex.RLock()
+	stores := a.ragVectors
+	hasVectors := a.ragIndex.HasVectors()
+	a.ragMutex.RUnlock()
+	if len(stores) == 0 || !hasVectors {
+		return nil
+	}
+
+	// Все коллекции индексируются одной моделью, так что вектор запроса общий
+	store := stores[0]
+	_, _, apiKey := a.embeddingSettings()
+	c, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	vectors, err := Embed(c, []string{query}, store.Provider, store.Model, apiKey)
+	if err != nil {
+		if a.isDebugMode() {
+			fmt.Printf("🔧 Эмбеддинг запроса не получен, только BM25: %v\n", err)
+		}
+		return nil
+	}
+	return vectors[0]
+}
+
+// GetRAGVectorStores возвращает векторные индексы активных коллекций (пусто — только BM25)
+func (a *Assistant) GetRAGVectorStores() []*VectorStore {
+	a.ragMutex.RLock()
+	defer a.ragMutex.RUnlock()
+	return a.ragVectors
+}
+
+// cosineSimilarity возвращает косинусную близость векторов (0 при разной размерности)
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
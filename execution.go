@@ -0,0 +1,491 @@
+// execution.go
+// Выполнение сгенерированных программ: таймаут по времени и отмена по Ctrl+C через
+// exec.CommandContext, остановка всей группы процессов, ограниченный буфер вывода.
+// Программы, похожие на серверы, запускаются в фоне с проверкой готовности порта
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultRunTimeout  = 60  // секунд на компиляцию, запуск или старт сервера
+	DefaultRunOutputKB = 256 // КБ вывода программы в памяти
+
+	installTimeoutFactor = 10 // установка зависимостей скачивает и собирает пакеты — дольше run_timeout
+
+	processWaitDelay   = 2 * time.Second        // сколько ждать закрытия вывода после остановки
+	serverStopGrace    = 2 * time.Second        // между SIGTERM и SIGKILL
+	serverPollInterval = 200 * time.Millisecond // проверка порта при старте сервера
+	serverNoPortWait   = 3 * time.Second        // сервер без известного порта считается запущенным
+)
+
+// serverPattern — вызовы, по которым программа распознается как сервер. listen в Node
+// засчитывается только с портом: .listen( бывает и у событий, очередей и сокетов-клиентов
+var serverPattern = regexp.MustCompile(`(?:http\.)?ListenAndServe(?:TLS)?\(|net\.Listen\(|\.Run\(\s*"[^"]*:\d+"|` +
+	`app\.run\(|uvicorn\.run\(|\.serve_forever\(|web\.run_app\(|asyncio\.start_server\(|` +
+	`WEBrick::HTTPServer|TCPServer\.new|require\s+['"]sinatra['"]|\b(?:https?|net)\.createServer\(|` +
+	`\.listen\(\s*(?:\d{2,5}\b|[\w.]*(?:port|Port|PORT)\b)|(?:^|[^.\w])listen\s*\(\s*\w+\s*,`)
+
+// serverPortPatterns — где искать номер порта, по убыванию надежности
+var serverPortPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\bport\s*(?:=>|:=|[=:,])\s*["']?(\d{2,5})\b`),
+	regexp.MustCompile(`["'][\w.\-]*:(\d{2,5})["']`),
+	regexp.MustCompile(`\(\s*["'][\w.\-]*["']\s*,\s*(\d{2,5})\s*\)`),
+	regexp.MustCompile(`listen\(\s*(\d{2,5})\b`),
+	regexp.MustCompile(`htons\(\s*(\d{2,5})\s*\)`),
+}
+
+// serverDefaultPorts — порт фреймворка, если в коде он не указан
+var serverDefaultPorts = []struct {
+	marker string
+	port   int
+}{
+	{"app.run(", 5000},
+	{"uvicorn.run(", 8000},
+	{"sinatra", 4567},
+}
+
+// serverSpec — признаки сервера в исходном коде
+type serverSpec struct {
+	Port int // 0 — порт определить не удалось
+}
+
+// detectServer распознает долгоживущий сервер по исходному коду
+func detectServer(source string) *serverSpec {
+	if !serverPattern.MatchString(source) {
+		return nil
+	}
+	for _, re := range serverPortPatterns {
+		if m := re.FindStringSubmatch(source); m != nil {
+			if port, err := strconv.Atoi(m[1]); err == nil && port > 0 && port < 65536 {
+				return &serverSpec{Port: port}
+			}
+		}
+	}
+	for _, d := range serverDefaultPorts {
+		if strings.Contains(source, d.marker) {
+			return &serverSpec{Port: d.port}
+		}
+	}
+	return &serverSpec{}
+}
+
+// cappedBuffer хранит начало и конец вывода в пределах limit байт; середина
+// отбрасывается и заменяется пометкой
+type cappedBuffer struct {
+	mu      sync.Mutex
+	limit   int
+	head    []byte
+	tail    []byte
+	dropped int64
+}
+
+func newCappedBuffer(limit int) *cappedBuffer {
+	return &cappedBuffer{limit: limit}
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := len(p)
+	half := b.limit / 2
+	if room := half - len(b.head); room > 0 {
+		k := min(room, len(p))
+		b.head = append(b.head, p[:k]...)
+		p = p[k:]
+	}
+	if len(p) > 0 {
+		b.tail = append(b.tail, p...)
+		if over := len(b.tail) - (b.limit - half); over > 0 {
+			b.dropped += int64(over)
+			b.tail = b.tail[over:]
+		}
+	}
+	return n, nil
+}
+
+// String возвращает сохраненный вывод с пометкой об обрезке
+func (b *cappedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.dropped == 0 {
+		return string(b.head) + string(b.tail)
+	}
+	return strings.ToValidUTF8(string(b.head), "") +
+		fmt.Sprintf("\n... [вывод обрезан: пропущено %d байт, лимит run_output_kb = %d] ...\n", b.dropped, b.limit>>10) +
+		strings.ToValidUTF8(string(b.tail), "")
+}
+
+// runTimeout — таймаут одного запуска из run_timeout
+func (cr *CodeRunner) runTimeout() time.Duration {
+	seconds := DefaultRunTimeout
+	if cr.config != nil {
+		seconds = cr.config.GetInt("run_timeout", DefaultRunTimeout)
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// outputLimit — размер буфера вывода из run_output_kb
+func (cr *CodeRunner) outputLimit() int {
+	kb := DefaultRunOutputKB
+	if cr.config != nil {
+		kb = cr.config.GetInt("run_output_kb", DefaultRunOutputKB)
+	}
+	return kb << 10
+}
+
+// commandWithContext переносит команду в exec.CommandContext: отмена контекста
+// останавливает всю группу процессов
+func commandWithContext(ctx context.Context, cmd *exec.Cmd) *exec.Cmd {
+	c := exec.CommandContext(ctx, cmd.Path)
+	c.Args = cmd.Args
+	c.Dir = cmd.Dir
+	c.Env = cmd.Env
+	c.Stdin = cmd.Stdin
+	c.SysProcAttr = cmd.SysProcAttr
+	setProcessGroup(c)
+	c.Cancel = func() error { return killProcessGroup(c) }
+	c.WaitDelay = processWaitDelay
+	return c
+}
+
+// execute запускает команду (в песочнице, если она есть) с таймаутом run_timeout и
+// ограниченным выводом. Ctrl+C отменяет ctx и останавливает программу
+func (cr *CodeRunner) execute(ctx context.Context, cmd *exec.Cmd, box *Sandbox) (string, error) {
+	if cmd.Err != nil {
+		return "", cmd.Err
+	}
+	if box != nil {
+		wrapped, err := box.Command(cmd)
+		if err != nil {
+			return "", err
+		}
+		cmd = wrapped
+	}
+	return cr.runCommand(ctx, cmd, cr.runTimeout(), nil)
+}
+
+// runCommand запускает команду с таймаутом, остановкой группы процессов и ограниченным
+// выводом; echo, если задан, получает вывод по мере появления (установка в терминале)
+func (cr *CodeRunner) runCommand(ctx context.Context, cmd *exec.Cmd, timeout time.Duration, echo io.Writer) (string, error) {
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	c := commandWithContext(runCtx, cmd)
+	output := newCappedBuffer(cr.outputLimit())
+	c.Stdout = output
+	if echo != nil {
+		c.Stdout = io.MultiWriter(output, echo)
+	}
+	c.Stderr = c.Stdout
+
+	err := c.Run()
+	switch {
+	case ctx.Err() != nil:
+		err = fmt.Errorf("выполнение прервано пользователем")
+	case runCtx.Err() == context.DeadlineExceeded:
+		err = fmt.Errorf("превышено время выполнения (%d с), процесс остановлен; лимит — :set run_timeout <секунды>", int(timeout.Seconds()))
+	}
+	return output.String(), err
+}
+
+// BackgroundServer — сервер, запущенный в фоне после проверки готовности
+type BackgroundServer struct {
+	ID      int
+	File    string
+	Port    int
+	Started time.Time
+	Status  string // результат проверки готовности
+
+	cmd    *exec.Cmd
+	box    *Sandbox
+	save   func(*Sandbox) // переносит в проект файлы, записанные сервером
+	output *cappedBuffer
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// Running сообщает, работает ли процесс сервера
+func (s *BackgroundServer) Running() bool {
+	select {
+	case <-s.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Stop останавливает группу процессов сервера, сохраняет записанные им файлы и удаляет
+// каталог песочницы
+func (s *BackgroundServer) Stop() {
+	if s.Running() {
+		terminateProcessGroup(s.cmd)
+		select {
+		case <-s.done:
+		case <-time.After(serverStopGrace):
+			killProcessGroup(s.cmd)
+			<-s.done
+		}
+	}
+	s.cancel()
+	if s.save != nil && s.box != nil && !s.Started.IsZero() {
+		s.save(s.box)
+	}
+	s.box.Close()
+}
+
+// Address — адрес для браузера или curl
+func (s *BackgroundServer) Address() string {
+	if s.Port == 0 {
+		return "порт не определен"
+	}
+	return fmt.Sprintf("http://127.0.0.1:%d", s.Port)
+}
+
+// startBackgroundServer запускает сервер в фоне и ждет, пока порт начнет принимать соединения.
+// Берет на себя каталог песочницы: при ошибке он удаляется сразу, иначе — при остановке
+func (cr *CodeRunner) startBackgroundServer(ctx context.Context, file string, cmd *exec.Cmd, box *Sandbox, spec *serverSpec) (string, error) {
+	if cmd.Err != nil {
+		box.Close()
+		return "", cmd.Err
+	}
+	cr.stopServersFor(file, spec.Port)
+	if spec.Port > 0 && portOpen(spec.Port) {
+		box.Close()
+		return "", fmt.Errorf("порт %d уже занят другим процессом", spec.Port)
+	}
+	if box != nil {
+		wrapped, err := box.Command(cmd)
+		if err != nil {
+			box.Close()
+			return "", err
+		}
+		cmd = wrapped
+	}
+
+	srvCtx, cancel := context.WithCancel(context.Background())
+	c := commandWithContext(srvCtx, cmd)
+	srv := &BackgroundServer{
+		File:   file,
+		Port:   spec.Port,
+		cmd:    c,
+		box:    box,
+		save:   cr.saveOutputs,
+		output: newCappedBuffer(cr.outputLimit()),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	c.Stdout = srv.output
+	c.Stderr = srv.output
+	if err := c.Start(); err != nil {
+		cancel()
+		box.Close()
+		return "", fmt.Errorf("не удалось запустить сервер: %v", err)
+	}
+	go func() {
+		srv.err = c.Wait()
+		close(srv.done)
+	}()
+
+	timeout := cr.runTimeout()
+	fmt.Printf("🌐 Похоже на сервер — запускаю в фоне (PID %d), жду готовности до %d с...\n", c.Process.Pid, int(timeout.Seconds()))
+	status, err := srv.waitReady(ctx, timeout)
+	if err != nil {
+		srv.Stop()
+		return srv.output.String(), err
+	}
+
+	srv.Status = status
+	srv.Started = time.Now()
+	cr.addServer(srv)
+	result := fmt.Sprintf("🌐 Сервер #%d работает в фоне: %s (%s). Остановить: :servers stop %d", srv.ID, srv.Address(), status, srv.ID)
+	if out := srv.output.String(); out != "" {
+		result += "\n" + out
+	}
+	return result, nil
+}
+
+// waitReady ждет, пока порт сервера начнет принимать соединения. Без известного порта
+// сервер считается запущенным, если не завершился за serverNoPortWait
+func (s *BackgroundServer) waitReady(ctx context.Context, timeout time.Duration) (string, error) {
+	start := time.Now()
+	for {
+		select {
+		case <-s.done:
+			if s.err != nil {
+				return "", fmt.Errorf("сервер завершился при запуске: %v%s", s.err, sandboxNote(s.box, s.err))
+			}
+			return "", fmt.Errorf("сервер завершился при запуске с кодом 0")
+		case <-ctx.Done():
+			return "", fmt.Errorf("запуск сервера прерван пользователем")
+		case <-time.After(serverPollInterval):
+		}
+
+		if s.Port == 0 {
+			if time.Since(start) >= serverNoPortWait {
+				return "порт не найден в коде, процесс работает", nil
+			}
+			continue
+		}
+		if portOpen(s.Port) {
+			return httpStatus(s.Port), nil
+		}
+		if time.Since(start) >= timeout {
+			return "", fmt.Errorf("сервер не начал принимать соединения на порту %d за %d с", s.Port, int(timeout.Seconds()))
+		}
+	}
+}
+
+// portOpen проверяет, принимает ли локальный порт TCP-соединения
+func portOpen(port int) bool {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), 500*time.Millisecond)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// httpStatus делает GET / и описывает ответ; не-HTTP серверу достаточно открытого порта
+func httpStatus(port int) string {
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d/", port))
+	if err != nil {
+		return "TCP-порт отвечает"
+	}
+	resp.Body.Close()
+	return "GET / → " + resp.Status
+}
+
+// addServer регистрирует запущенный сервер
+func (cr *CodeRunner) addServer(srv *BackgroundServer) {
+	cr.serversMu.Lock()
+	defer cr.serversMu.Unlock()
+	cr.nextServerID++
+	srv.ID = cr.nextServerID
+	cr.servers = append(cr.servers, srv)
+}
+
+// removeServers убирает из списка и возвращает серверы, подходящие под match
+func (cr *CodeRunner) removeServers(match func(*BackgroundServer) bool) []*BackgroundServer {
+	cr.serversMu.Lock()
+	defer cr.serversMu.Unlock()
+	var keep, removed []*BackgroundServer
+	for _, srv := range cr.servers {
+		if match(srv) {
+			removed = append(removed, srv)
+		} else {
+			keep = append(keep, srv)
+		}
+	}
+	cr.servers = keep
+	return removed
+}
+
+// stopServersFor останавливает предыдущие серверы того же файла или порта — например,
+// перед повторным запуском исправленного кода
+func (cr *CodeRunner) stopServersFor(file string, port int) {
+	for _, srv := range cr.removeServers(func(srv *BackgroundServer) bool {
+		return srv.File == file || (port > 0 && srv.Port == port)
+	}) {
+		fmt.Printf("♻️  Останавливаю предыдущий сервер #%d (%s)\n", srv.ID, srv.File)
+		srv.Stop()
+	}
+}
+
+// StopServers останавливает все фоновые серверы (при выходе) и возвращает их число
+func (cr *CodeRunner) StopServers() int {
+	servers := cr.removeServers(func(*BackgroundServer) bool { return true })
+	for _, srv := range servers {
+		srv.Stop()
+	}
+	return len(servers)
+}
+
+// handleServers — команда :servers
+func (ch *CommandHandler) handleServers(args []string) {
+	a, ok := ch.assistant.(*Assistant)
+	if !ok {
+		return
+	}
+	cr := a.codeRunner
+
+	cr.serversMu.Lock()
+	servers := append([]*BackgroundServer(nil), cr.servers...)
+	cr.serversMu.Unlock()
+
+	find := func(id string) *BackgroundServer {
+		n, err := strconv.Atoi(strings.TrimPrefix(id, "#"))
+		if err != nil {
+			return nil
+		}
+		for _, srv := range servers {
+			if srv.ID == n {
+				return srv
+			}
+		}
+		return nil
+	}
+
+	if len(args) == 0 {
+		if len(servers) == 0 {
+			fmt.Println("🌐 Фоновых серверов нет")
+			return
+		}
+		fmt.Println("🌐 Фоновые серверы:")
+		for _, srv := range servers {
+			state := "работает"
+			if !srv.Running() {
+				state = "завершился"
+				if srv.err != nil {
+					state += ": " + srv.err.Error()
+				}
+			}
+			fmt.Printf("  #%d %s — %s, %s, %s (%s)\n", srv.ID, srv.File, srv.Address(), state,
+				time.Since(srv.Started).Round(time.Second), srv.Status)
+		}
+		return
+	}
+
+	switch args[0] {
+	case "stop":
+		if len(args) < 2 || args[1] == "all" {
+			fmt.Printf("🛑 Остановлено серверов: %d\n", cr.StopServers())
+			return
+		}
+		srv := find(args[1])
+		if srv == nil {
+			fmt.Printf("❌ Сервер %s не найден\n", args[1])
+			return
+		}
+		for _, s := range cr.removeServers(func(s *BackgroundServer) bool { return s == srv }) {
+			s.Stop()
+		}
+		fmt.Printf("🛑 Сервер #%d остановлен\n", srv.ID)
+	case "log":
+		if len(args) < 2 {
+			fmt.Println("❌ Использование: :servers log <номер>")
+			return
+		}
+		srv := find(args[1])
+		if srv == nil {
+			fmt.Printf("❌ Сервер %s не найден\n", args[1])
+			return
+		}
+		fmt.Printf("📜 Вывод сервера #%d (%s):\n%s\n", srv.ID, srv.File, srv.output.String())
+	default:
+		fmt.Printf("❌ Неизвестная подкоманда: %s\n%s\n", args[0], commandHelp[":servers"])
+	}
+}
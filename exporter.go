@@ -0,0 +1,383 @@
+// exporter.go
+// Экспорт сессий: Markdown с fenced-блоками, автономный HTML с подсветкой синтаксиса,
+// JSON с полными метаданными и извлечение блоков "--- File:" в дерево директорий
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/chroma"
+	chromahtml "github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/lexers"
+	"github.com/alecthomas/chroma/styles"
+	"github.com/yuin/goldmark"
+)
+
+// ExportFormats — поддерживаемые форматы экспорта
+var ExportFormats = []string{"md", "txt", "json", "html", "code"}
+
+// exportSegment — часть ответа: обычный текст или блок кода
+type exportSegment struct {
+	Code     bool
+	Path     string // имя файла из "--- File:" (пусто для ``` блоков)
+	Language string
+	Content  string
+}
+
+// exportMessage — обмен, разобранный на вопрос и ответ
+type exportMessage struct {
+	Index    int      `json:"index"`
+	Question string   `json:"question"`
+	Answer   string   `json:"answer"`
+	Files    []string `json:"files,omitempty"`
+}
+
+// exportDocument — структура JSON-экспорта
+type exportDocument struct {
+	SessionData
+	ExportedAt string          `json:"exported_at"`
+	Messages   []exportMessage `json:"messages"`
+}
+
+var (
+	exportFilePattern  = regexp.MustCompile(`(?m)^---\s*[Ff]ile:\s*([^\n]+?)\s*---\s*$`)
+	exportMarkerLine   = regexp.MustCompile(`(?m)^---\s*(?:[Cc]ompile|[Ii]nstall|[Dd]iff|[Ee]nd\s*\w+):?[^\n]*$`)
+	exportFencePattern = regexp.MustCompile("(?s)```([\\w+#.-]*)[^\\n]*\\n(.*?)```")
+)
+
+// splitExchange разделяет строку обмена контекста на вопрос и ответ
+func splitExchange(exchange string) (string, string) {
+	question := strings.TrimPrefix(exchange, "Вопрос: ")
+	if i := strings.Index(question, "\nОтвет: "); i >= 0 {
+		return question[:i], question[i+len("\nОтвет: "):]
+	}
+	return question, ""
+}
+
+// splitAnswerSegments разбивает ответ на текст и блоки "--- File: path ---"
+func splitAnswerSegments(answer string) []exportSegment {
+	var segments []exportSegment
+	locs := exportFilePattern.FindAllStringSubmatchIndex(answer, -1)
+	if len(locs) == 0 {
+		return []exportSegment{{Content: answer}}
+	}
+
+	if head := strings.TrimSpace(answer[:locs[0][0]]); head != "" {
+		segments = append(segments, exportSegment{Content: head})
+	}
+	for i, loc := range locs {
+		path := strings.TrimSpace(answer[loc[2]:loc[3]])
+		end := len(answer)
+		if i+1 < len(locs) {
+			end = locs[i+1][0]
+		}
+		body := answer[loc[1]:end]
+
+		// Маркеры Compile/Install и текст после них не относятся к содержимому файла
+		tail := ""
+		if m := exportMarkerLine.FindStringIndex(body); m != nil {
+			body, tail = body[:m[0]], body[m[0]:]
+		}
+
+		segments = append(segments, exportSegment{
+			Code:     true,
+			Path:     path,
+			Language: detectLanguage(path, body),
+			Content:  strings.Trim(body, "\n"),
+		})
+		if tail = strings.TrimSpace(tail); tail != "" {
+			segments = append(segments, exportSegment{Content: tail})
+		}
+	}
+	return segments
+}
+
+// detectLanguage определяет язык подсветки по имени файла или содержимому
+func detectLanguage(path, content string) string {
+	var lexer chroma.Lexer
+	if path != "" {
+		lexer = lexers.Match(filepath.Base(path))
+	}
+	if lexer == nil && content != "" {
+		lexer = lexers.Analyse(content)
+	}
+	if lexer == nil {
+		return ""
+	}
+	aliases := lexer.Config().Aliases
+	if len(aliases) > 0 {
+		return aliases[0]
+	}
+	return strings.ToLower(lexer.Config().Name)
+}
+
+// sessionTitle возвращает заголовок сессии или заглушку
+func sessionTitle(data *SessionData) string {
+	if data.Title != "" {
+		return data.Title
+	}
+	if title := autoTitle(data.Exchanges); title != "" {
+		return title
+	}
+	return "Экспорт сессии"
+}
+
+// RenderExport формирует документ экспорта в формате md, txt, json или html
+func RenderExport(format string, data *SessionData) ([]byte, error) {
+	switch format {
+	case "md":
+		return renderMarkdownExport(data), nil
+	case "txt":
+		var b strings.Builder
+		for _, ex := range data.Exchanges {
+			b.WriteString(ex + "\n\n")
+		}
+		return []byte(b.String()), nil
+	case "json":
+		return renderJSONExport(data)
+	case "html":
+		return renderHTMLExport(data)
+	default:
+		return nil, fmt.Errorf("неизвестный формат экспорта: %s (доступно: %s)", format, strings.Join(ExportFormats, ", "))
+	}
+}
+
+func renderMarkdownExport(data *SessionData) []byte {
+	var b strings.Builder
+	b.WriteString("# " + sessionTitle(data) + "\n\n")
+	writeMarkdownMeta(&b, data)
+
+	if data.Summary != "" {
+		b.WriteString("## Сводка предыдущего диалога\n\n" + data.Summary + "\n\n")
+	}
+
+	for i, ex := range data.Exchanges {
+		question, answer := splitExchange(ex)
+		fmt.Fprintf(&b, "## %d. Вопрос\n\n%s\n\n### Ответ\n\n", i+1, strings.TrimSpace(question))
+		for _, seg := range splitAnswerSegments(answer) {
+			if !seg.Code {
+				b.WriteString(strings.TrimSpace(seg.Content) + "\n\n")
+				continue
+			}
+			fence := "```"
+			for strings.Contains(seg.Content, fence) {
+				fence += "`"
+			}
+			fmt.Fprintf(&b, "**%s**\n\n%s%s\n%s\n%s\n\n", seg.Path, fence, seg.Language, seg.Content, fence)
+		}
+	}
+	return []byte(b.String())
+}
+
+func writeMarkdownMeta(b *strings.Builder, data *SessionData) {
+	if data.Provider != "" {
+		fmt.Fprintf(b, "- **Модель:** %s / %s\n", data.Provider, data.Model)
+	}
+	if data.Timestamp != "" {
+		fmt.Fprintf(b, "- **Сохранено:** %s\n", data.Timestamp)
+	}
+	if len(data.Tags) > 0 {
+		fmt.Fprintf(b, "- **Теги:** #%s\n", strings.Join(data.Tags, " #"))
+	}
+	if data.Cwd != "" {
+		fmt.Fprintf(b, "- **Директория:** `%s`\n", data.Cwd)
+	}
+	for _, pin := range data.Pins {
+		fmt.Fprintf(b, "- 📌 %s\n", pin)
+	}
+	b.WriteString("\n")
+}
+
+func renderJSONExport(data *SessionData) ([]byte, error) {
+	doc := exportDocument{
+		SessionData: *data,
+		ExportedAt:  time.Now().Format(time.RFC3339),
+		Messages:    make([]exportMessage, 0, len(data.Exchanges)),
+	}
+	for i, ex := range data.Exchanges {
+		question, answer := splitExchange(ex)
+		msg := exportMessage{Index: i + 1, Question: question, Answer: answer}
+		for _, seg := range splitAnswerSegments(answer) {
+			if seg.Code {
+				msg.Files = append(msg.Files, seg.Path)
+			}
+		}
+		doc.Messages = append(doc.Messages, msg)
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+const exportHTMLStyle = `body{font-family:-apple-system,Segoe UI,Roboto,sans-serif;max-width:960px;margin:2em auto;padding:0 1em;color:#24292f;line-height:1.5}
+h1{border-bottom:1px solid #d0d7de;padding-bottom:.3em}
+.meta{color:#57606a;font-size:.9em}
+.exchange{border:1px solid #d0d7de;border-radius:6px;margin:1.5em 0;overflow:hidden}
+.question{background:#f6f8fa;padding:.8em 1em;border-bottom:1px solid #d0d7de;white-space:pre-wrap}
+.answer{padding:.2em 1em}
+.file{font-family:monospace;font-weight:bold;margin-top:1em}
+pre{padding:.8em;border-radius:6px;overflow-x:auto}
+code{font-family:SFMono-Regular,Consolas,monospace;font-size:.9em}
+.summary{background:#fff8c5;padding:.8em 1em;border-radius:6px}`
+
+func renderHTMLExport(data *SessionData) ([]byte, error) {
+	var b bytes.Buffer
+	title := html.EscapeString(sessionTitle(data))
+
+	b.WriteString("<!DOCTYPE html>\n<html lang=\"ru\">\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(&b, "<title>%s</title>\n<style>\n%s\n</style>\n</head>\n<body>\n", title, exportHTMLStyle)
+	fmt.Fprintf(&b, "<h1>%s</h1>\n<div class=\"meta\">", title)
+	if data.Provider != "" {
+		fmt.Fprintf(&b, "%s / %s", html.EscapeString(data.Provider), html.EscapeString(data.Model))
+	}
+	if data.Timestamp != "" {
+		fmt.Fprintf(&b, " · %s", html.EscapeString(data.Timestamp))
+	}
+	if len(data.Tags) > 0 {
+		fmt.Fprintf(&b, " · #%s", html.EscapeString(strings.Join(data.Tags, " #")))
+	}
+	b.WriteString("</div>\n")
+
+	if data.Summary != "" {
+		fmt.Fprintf(&b, "<h2>Сводка</h2>\n<div class=\"summary\">%s</div>\n", html.EscapeString(data.Summary))
+	}
+
+	for i, ex := range data.Exchanges {
+		question, answer := splitExchange(ex)
+		fmt.Fprintf(&b, "<div class=\"exchange\" id=\"exchange-%d\">\n<div class=\"question\"><b>%d.</b> %s</div>\n<div class=\"answer\">\n",
+			i+1, i+1, html.EscapeString(strings.TrimSpace(question)))
+
+		for _, seg := range splitAnswerSegments(answer) {
+			if seg.Code {
+				fmt.Fprintf(&b, "<div class=\"file\">%s</div>\n", html.EscapeString(seg.Path))
+				if err := highlightHTML(&b, seg.Content, seg.Language); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if err := renderTextHTML(&b, seg.Content); err != nil {
+				return nil, err
+			}
+		}
+		b.WriteString("</div>\n</div>\n")
+	}
+
+	fmt.Fprintf(&b, "<p class=\"meta\">Экспортировано AI Cogitor v%s · %s</p>\n</body>\n</html>\n",
+		Version, time.Now().Format("2006-01-02 15:04"))
+	return b.Bytes(), nil
+}
+
+// renderTextHTML преобразует Markdown-текст в HTML; ``` блоки подсвечиваются отдельно.
+// goldmark по умолчанию экранирует сырой HTML, поэтому содержимое ответа не исполняется в браузере
+func renderTextHTML(b *bytes.Buffer, text string) error {
+	last := 0
+	for _, loc := range exportFencePattern.FindAllStringSubmatchIndex(text, -1) {
+		if err := goldmark.Convert([]byte(text[last:loc[0]]), b); err != nil {
+			return err
+		}
+		lang := text[loc[2]:loc[3]]
+		code := text[loc[4]:loc[5]]
+		if lang == "" {
+			lang = detectLanguage("", code)
+		}
+		if err := highlightHTML(b, strings.TrimRight(code, "\n"), lang); err != nil {
+			return err
+		}
+		last = loc[1]
+	}
+	return goldmark.Convert([]byte(text[last:]), b)
+}
+
+// highlightHTML выводит код с подсветкой синтаксиса (стили встраиваются inline)
+func highlightHTML(b *bytes.Buffer, code, language string) error {
+	lexer := lexers.Get(language)
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code)
+	if err != nil {
+		return err
+	}
+	formatter := chromahtml.New(chromahtml.TabWidth(4))
+	return formatter.Format(b, styles.Get("github"), iterator)
+}
+
+// ExtractCodeFiles записывает все блоки "--- File:" сессии в директорию dir внутри рабочего
+// пространства ws. Если файл встречается несколько раз, сохраняется последняя версия
+func ExtractCodeFiles(data *SessionData, dir string, ws *Workspace) ([]string, error) {
+	latest := make(map[string]string)
+	var order []string
+
+	for _, ex := range data.Exchanges {
+		_, answer := splitExchange(ex)
+		for _, seg := range splitAnswerSegments(answer) {
+			if !seg.Code || seg.Content == "" {
+				continue
+			}
+			rel := filepath.Clean(filepath.FromSlash(seg.Path))
+			if !filepath.IsLocal(rel) {
+				return nil, fmt.Errorf("небезопасный путь в блоке кода: %s", seg.Path)
+			}
+			if _, ok := latest[rel]; !ok {
+				order = append(order, rel)
+			}
+			latest[rel] = seg.Content + "\n"
+		}
+	}
+
+	if len(order) == 0 {
+		return nil, fmt.Errorf("в сессии нет блоков '--- File:'")
+	}
+
+	// Директорию проверяем заранее, чтобы не оставить экспорт записанным наполовину
+	if _, err := ws.Resolve(dir); err != nil {
+		return nil, err
+	}
+	for _, rel := range order {
+		if err := ws.WriteFile(filepath.Join(dir, rel), []byte(latest[rel])); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// WriteExport экспортирует сессию в файл или директорию (для формата code).
+// Если path пуст, имя формируется из текущего времени. Файлы кода пишутся только внутрь ws.
+// Возвращает путь результата
+func WriteExport(format string, data *SessionData, path string, ws *Workspace) (string, []string, error) {
+	if path == "" {
+		path = fmt.Sprintf("export_%s", time.Now().Format("20060102_150405"))
+		if format != "code" {
+			path += "." + format
+		}
+	}
+
+	if format == "code" {
+		files, err := ExtractCodeFiles(data, path, ws)
+		return path, files, err
+	}
+
+	content, err := RenderExport(format, data)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Пишем во временный файл, чтобы не оставлять поврежденный экспорт
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		os.Remove(tmp)
+		return "", nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", nil, err
+	}
+	return path, nil, nil
+}
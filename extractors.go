@@ -0,0 +1,782 @@
+// extractors.go
+// Извлечение текста для RAG: у каждого формата свой экстрактор (текст, исходный код,
+// HTML, DOCX, PDF). Экстрактор возвращает текст и предупреждения о том, что извлечь не удалось
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// ragUnpackFactor — во сколько раз распакованное содержимое DOCX и PDF может быть больше
+// rag_max_file_kb: сжатие текста дает выигрыш в несколько раз, zip-бомба — в тысячи
+const ragUnpackFactor = 20
+
+// ragExtractor извлекает текст из содержимого файла; unpackLimit ограничивает объем
+// распакованных данных в байтах (0 — без ограничения)
+type ragExtractor func(data []byte, path string, unpackLimit int64) (text string, warnings []string, err error)
+
+// ragUnpackLimit — предел распаковки для файлов не больше maxFileSize (0 — без ограничения)
+func ragUnpackLimit(maxFileSize int64) int64 {
+	return maxFileSize * ragUnpackFactor
+}
+
+// ragExtractors — экстракторы по расширению файла
+var ragExtractors = map[string]ragExtractor{
+	".txt":  extractPlainText,
+	".json": extractPlainText,
+	".csv":  extractPlainText,
+	".tsv":  extractPlainText,
+	".md":   extractPlainText,
+	".xml":  extractPlainText,
+	".yaml": extractPlainText,
+	".yml":  extractPlainText,
+	".html": extractHTMLText,
+	".htm":  extractHTMLText,
+	".docx": extractDOCXText,
+	".pdf":  extractPDFText,
+}
+
+// ragSourceExtensions — исходный код: текст берется как есть, документ помечается языком
+var ragSourceExtensions = []string{
+	".go", ".py", ".js", ".jsx", ".ts", ".tsx", ".java", ".kt", ".swift", ".c", ".h",
+	".cpp", ".cc", ".cxx", ".hpp", ".cs", ".rs", ".rb", ".php", ".sh", ".bash", ".sql",
+	".lua", ".pl", ".r", ".scala", ".dart", ".f90", ".f95", ".lisp", ".asm", ".proto",
+	".toml", ".ini", ".css", ".scss", ".vue", ".svelte",
+}
+
+// RAGFormats возвращает поддерживаемые расширения в отсортированном виде
+func RAGFormats() []string {
+	var exts []string
+	for ext := range ragExtractors {
+		exts = append(exts, ext)
+	}
+	exts = append(exts, ragSourceExtensions...)
+	sort.Strings(exts)
+	return exts
+}
+
+func isSupportedRAGFile(filePath string) bool {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	if _, ok := ragExtractors[ext]; ok {
+		return true
+	}
+	return containsString(ragSourceExtensions, ext)
+}
+
+// ExtractRAGDocument создает RAG-документ из содержимого файла; maxFileSize — лимит
+// rag_max_file_kb в байтах, от него считается предел распаковки
+func ExtractRAGDocument(path string, data []byte, maxFileSize int64) (RAGDocument, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	doc := RAGDocument{
+		FilePath: path,
+		LoadedAt: time.Now(),
+		Format:   strings.TrimPrefix(ext, "."),
+		Hash:     fileHash(data),
+	}
+
+	var text string
+	var warnings []string
+	var err error
+	if extractor, ok := ragExtractors[ext]; ok {
+		text, warnings, err = extractor(data, path, ragUnpackLimit(maxFileSize))
+	} else if containsString(ragSourceExtensions, ext) {
+		text, warnings, err = extractPlainText(data, path, 0)
+		doc.Language = detectLanguage(path, "")
+		if doc.Language == "" {
+			doc.Language = doc.Format
+		}
+	} else {
+		return doc, fmt.Errorf("неподдерживаемый формат файла")
+	}
+	if err != nil {
+		return doc, err
+	}
+	if strings.TrimSpace(text) == "" {
+		warnings = append(warnings, "текст не извлечен: документ пуст")
+	}
+
+	doc.Content = text
+	doc.Size = len(text)
+	doc.Warnings = warnings
+	return doc, nil
+}
+
+// extractPlainText читает текст в UTF-8, заменяя некорректные байты
+func extractPlainText(data []byte, path string, unpackLimit int64) (string, []string, error) {
+	if bytes.IndexByte(data, 0) >= 0 {
+		return "", nil, fmt.Errorf("файл похож на бинарный")
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		return strings.ToValidUTF8(string(data), "�"),
+			[]string{"файл не в UTF-8: некорректные символы заменены"}, nil
+	}
+	return string(data), nil, nil
+}
+
+// extractHTMLText извлекает текст страницы тем же способом, что и веб-поиск
+func extractHTMLText(data []byte, path string, unpackLimit int64) (string, []string, error) {
+	reader, err := charset.NewReader(bytes.NewReader(data), "text/html")
+	if err != nil {
+		reader = bytes.NewReader(data)
+	}
+	doc, err := html.Parse(reader)
+	if err != nil {
+		return "", nil, fmt.Errorf("ошибка разбора HTML: %v", err)
+	}
+
+	var warnings []string
+	var title string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "title" && n.FirstChild != nil && title == "" {
+			title = strings.TrimSpace(n.FirstChild.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	text := strings.TrimSpace(extractText(doc))
+	if text == "" && bytes.Contains(bytes.ToLower(data), []byte("<script")) {
+		warnings = append(warnings, "на странице нет текста: вероятно, содержимое формируется JavaScript")
+	}
+	if title != "" && !strings.HasPrefix(text, title) {
+		text = title + "\n\n" + text
+	}
+	return text, warnings, nil
+}
+
+// extractDOCXText извлекает текст из word/document.xml архива DOCX
+func extractDOCXText(data []byte, path string, unpackLimit int64) (string, []string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", nil, fmt.Errorf("DOCX не является zip-архивом: %v", err)
+	}
+
+	var document *zip.File
+	media := 0
+	for _, f := range archive.File {
+		switch {
+		case f.Name == "word/document.xml":
+			document = f
+		case strings.HasPrefix(f.Name, "word/media/"):
+			media++
+		}
+	}
+	if document == nil {
+		return "", nil, fmt.Errorf("в архиве нет word/document.xml")
+	}
+
+	rc, err := document.Open()
+	if err != nil {
+		return "", nil, err
+	}
+	defer rc.Close()
+
+	var b strings.Builder
+	var warnings []string
+	var xmlReader io.Reader = rc
+	var limited *io.LimitedReader
+	if unpackLimit > 0 {
+		limited = &io.LimitedReader{R: rc, N: unpackLimit}
+		xmlReader = limited
+	}
+	decoder := xml.NewDecoder(xmlReader)
+	inText := false
+	cellDepth := 0 // абзацы внутри ячеек таблицы не разрывают строку
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if limited != nil && limited.N <= 0 {
+				warnings = append(warnings, fmt.Sprintf("документ больше %d КБ после распаковки, текст неполный", unpackLimit>>10))
+			} else {
+				warnings = append(warnings, fmt.Sprintf("документ поврежден, текст неполный: %v", err))
+			}
+			break
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tc":
+				cellDepth++
+			case "tab":
+				b.WriteByte('\t')
+			case "br", "cr":
+				b.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if cellDepth > 0 {
+					b.WriteByte(' ')
+				} else {
+					b.WriteByte('\n')
+				}
+			case "tc":
+				cellDepth--
+				b.WriteString("| ")
+			case "tr":
+				row := strings.TrimSuffix(b.String(), "| ")
+				b.Reset()
+				b.WriteString(row)
+				b.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				b.Write(t)
+			}
+		}
+	}
+
+	if media > 0 {
+		warnings = append(warnings, fmt.Sprintf("изображения не извлекаются: %d", media))
+	}
+	return b.String(), warnings, nil
+}
+
+// ========== PDF ==========
+
+var (
+	pdfStreamRe = regexp.MustCompile(`>>\s*stream\r?\n`)
+	pdfLengthRe = regexp.MustCompile(`/Length\s+(\d+)(\s+\d+\s+R)?`)
+	pdfFilterRe = regexp.MustCompile(`/(FlateDecode|Fl|ASCII85Decode|A85|ASCIIHexDecode|AHx|DCTDecode|JPXDecode|CCITTFaxDecode|JBIG2Decode|LZWDecode|LZW|RunLengthDecode)\b`)
+)
+
+// pdfStream — поток PDF с его словарем
+type pdfStream struct {
+	dict string
+	data []byte
+}
+
+// extractPDFText извлекает текст из PDF без внешних зависимостей: разжимает потоки,
+// читает ToUnicode-таблицы шрифтов и текстовые операторы Tj/TJ/'/" в блоках BT...ET.
+// Сканы и нестандартные кодировки дают предупреждения
+func extractPDFText(data []byte, path string, unpackLimit int64) (string, []string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\r\n "), []byte("%PDF")) {
+		return "", nil, fmt.Errorf("файл не является PDF")
+	}
+	if bytes.Contains(data, []byte("/Encrypt")) {
+		return "", nil, fmt.Errorf("PDF зашифрован, извлечение текста не поддерживается")
+	}
+
+	var warnings []string
+	warned := make(map[string]bool)
+	warn := func(msg string) {
+		if !warned[msg] {
+			warned[msg] = true
+			warnings = append(warnings, msg)
+		}
+	}
+
+	streams := pdfStreams(data, unpackLimit, warn)
+
+	// Таблицы ToUnicode всех шрифтов объединяются: привязку шрифтов к страницам не разбираем
+	cmap := make(map[string]string)
+	for _, s := range streams {
+		if bytes.Contains(s.data, []byte("begincmap")) {
+			if parsePDFCMap(s.data, cmap) {
+				warn("шрифты используют разные кодировки: часть символов может быть неверной")
+			}
+		}
+	}
+
+	var b strings.Builder
+	images := 0
+	for _, s := range streams {
+		switch {
+		case strings.Contains(s.dict, "/Image"):
+			images++
+			continue
+		case strings.Contains(s.dict, "/ObjStm"), strings.Contains(s.dict, "/XRef"),
+			strings.Contains(s.dict, "/Length1"), strings.Contains(s.dict, "/FontFile"),
+			bytes.Contains(s.data, []byte("begincmap")):
+			continue
+		}
+		if !bytes.Contains(s.data, []byte("BT")) {
+			continue
+		}
+		text := pdfContentText(s.data, cmap, warn)
+		if strings.TrimSpace(text) != "" {
+			b.WriteString(text)
+			b.WriteString("\n\n")
+		}
+	}
+
+	text := b.String()
+	if strings.TrimSpace(text) == "" {
+		if images > 0 {
+			warn("текст не найден: вероятно, это скан (нужно распознавание текста)")
+		} else {
+			warn("текст не найден")
+		}
+	} else if images > 0 {
+		warn(fmt.Sprintf("изображения не извлекаются: %d", images))
+	}
+	if bytes.Contains(data, []byte("/ObjStm")) && !pdfHasContent(streams) {
+		warn("PDF использует сжатые потоки объектов: текст может быть неполным")
+	}
+	return text, warnings, nil
+}
+
+func pdfHasContent(streams []pdfStream) bool {
+	for _, s := range streams {
+		if bytes.Contains(s.data, []byte("BT")) {
+			return true
+		}
+	}
+	return false
+}
+
+// pdfStreams находит и распаковывает все потоки файла. Вместе они распаковываются не
+// больше чем в unpackLimit байт (0 — без ограничения), остальные потоки пропускаются
+func pdfStreams(data []byte, unpackLimit int64, warn func(string)) []pdfStream {
+	var streams []pdfStream
+	budget := unpackLimit
+	prevEnd := 0
+	for _, loc := range pdfStreamRe.FindAllIndex(data, -1) {
+		if loc[0] < prevEnd {
+			continue // совпадение внутри данных предыдущего потока
+		}
+		// Словарь потока — от ключевого слова obj до stream
+		dictStart := prevEnd
+		if i := bytes.LastIndex(data[prevEnd:loc[0]], []byte("obj")); i >= 0 {
+			dictStart = prevEnd + i + 3
+		}
+		dict := string(data[dictStart:loc[0]])
+		start := loc[1]
+
+		end := -1
+		if m := pdfLengthRe.FindStringSubmatch(dict); m != nil && m[2] == "" {
+			if n, err := strconv.Atoi(m[1]); err == nil && start+n <= len(data) {
+				rest := bytes.TrimLeft(data[start+n:], "\r\n ")
+				if bytes.HasPrefix(rest, []byte("endstream")) {
+					end = start + n
+				}
+			}
+		}
+		if end < 0 {
+			i := bytes.Index(data[start:], []byte("endstream"))
+			if i < 0 {
+				continue
+			}
+			end = start + i
+		}
+
+		prevEnd = end
+		raw := data[start:end]
+		var decoded []byte
+		err := errPDFUnpackLimit
+		if unpackLimit <= 0 || budget > 0 {
+			decoded, err = pdfDecodeStream(dict, raw, budget)
+		}
+		if err == errPDFUnpackLimit {
+			warn(fmt.Sprintf("PDF больше %d КБ после распаковки: текст неполный", unpackLimit>>10))
+			break
+		}
+		if err != nil {
+			if !strings.Contains(dict, "/Image") {
+				warn(fmt.Sprintf("поток не распакован: %v", err))
+			}
+			continue
+		}
+		if unpackLimit > 0 {
+			budget -= int64(len(decoded))
+		}
+		streams = append(streams, pdfStream{dict: dict, data: decoded})
+	}
+	return streams
+}
+
+// errPDFUnpackLimit — поток распаковывается в больший объем, чем осталось в пределе
+var errPDFUnpackLimit = errors.New("превышен предел распаковки")
+
+// pdfDecodeStream применяет фильтры потока (FlateDecode, ASCII85Decode, ASCIIHexDecode).
+// limit > 0 — предел размера распакованного потока
+func pdfDecodeStream(dict string, raw []byte, limit int64) ([]byte, error) {
+	filters := pdfFilterRe.FindAllStringSubmatch(dict, -1)
+	data := raw
+	for _, f := range filters {
+		switch f[1] {
+		case "FlateDecode", "Fl":
+			r, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, fmt.Errorf("FlateDecode: %v", err)
+			}
+			var src io.Reader = r
+			if limit > 0 {
+				src = io.LimitReader(r, limit+1)
+			}
+			out, err := io.ReadAll(src)
+			r.Close()
+			if limit > 0 && int64(len(out)) > limit {
+				return nil, errPDFUnpackLimit
+			}
+			if err != nil && len(out) == 0 {
+				return nil, fmt.Errorf("FlateDecode: %v", err)
+			}
+			data = out
+		case "ASCII85Decode", "A85":
+			trimmed := bytes.TrimSpace(data)
+			trimmed = bytes.TrimPrefix(trimmed, []byte("<~"))
+			trimmed = bytes.TrimSuffix(trimmed, []byte("~>"))
+			out := make([]byte, len(trimmed))
+			n, _, err := ascii85.Decode(out, trimmed, true)
+			if err != nil {
+				return nil, fmt.Errorf("ASCII85Decode: %v", err)
+			}
+			data = out[:n]
+		case "ASCIIHexDecode", "AHx":
+			cleaned := strings.Map(func(r rune) rune {
+				if unicode.IsSpace(r) || r == '>' {
+					return -1
+				}
+				return r
+			}, string(data))
+			if len(cleaned)%2 == 1 {
+				cleaned += "0"
+			}
+			out, err := hex.DecodeString(cleaned)
+			if err != nil {
+				return nil, fmt.Errorf("ASCIIHexDecode: %v", err)
+			}
+			data = out
+		default:
+			return nil, fmt.Errorf("фильтр %s не поддерживается", f[1])
+		}
+	}
+	return data, nil
+}
+
+var (
+	pdfBfCharRe  = regexp.MustCompile(`(?s)beginbfchar(.*?)endbfchar`)
+	pdfBfRangeRe = regexp.MustCompile(`(?s)beginbfrange(.*?)endbfrange`)
+	pdfHexRe     = regexp.MustCompile(`<([0-9A-Fa-f\s]*)>`)
+	pdfRangeRe   = regexp.MustCompile(`<([0-9A-Fa-f]+)>\s*<([0-9A-Fa-f]+)>\s*(<[0-9A-Fa-f\s]*>|\[[^\]]*\])`)
+)
+
+// parsePDFCMap добавляет соответствия кодов символам из ToUnicode CMap.
+// Возвращает true, если встретились конфликтующие соответствия
+func parsePDFCMap(data []byte, cmap map[string]string) bool {
+	conflict := false
+	set := func(code, text string) {
+		code = strings.ToUpper(code)
+		if old, ok := cmap[code]; ok && old != text {
+			conflict = true
+			return
+		}
+		cmap[code] = text
+	}
+
+	for _, block := range pdfBfCharRe.FindAllSubmatch(data, -1) {
+		pairs := pdfHexRe.FindAllSubmatch(block[1], -1)
+		for i := 0; i+1 < len(pairs); i += 2 {
+			set(pdfCleanHex(string(pairs[i][1])), utf16HexToString(string(pairs[i+1][1])))
+		}
+	}
+
+	for _, block := range pdfBfRangeRe.FindAllSubmatch(data, -1) {
+		for _, m := range pdfRangeRe.FindAllSubmatch(block[1], -1) {
+			lo, err1 := strconv.ParseUint(string(m[1]), 16, 32)
+			hi, err2 := strconv.ParseUint(string(m[2]), 16, 32)
+			if err1 != nil || err2 != nil || hi < lo || hi-lo > 0xFFFF {
+				continue
+			}
+			width := len(m[1])
+			dst := string(m[3])
+			if strings.HasPrefix(dst, "[") {
+				// Массив: отдельная строка для каждого кода
+				items := pdfHexRe.FindAllStringSubmatch(dst, -1)
+				for i, item := range items {
+					if lo+uint64(i) > hi {
+						break
+					}
+					set(fmt.Sprintf("%0*X", width, lo+uint64(i)), utf16HexToString(item[1]))
+				}
+				continue
+			}
+			base := []rune(utf16HexToString(strings.Trim(dst, "<>")))
+			if len(base) == 0 {
+				continue
+			}
+			for code := lo; code <= hi; code++ {
+				r := append([]rune(nil), base...)
+				r[len(r)-1] += rune(code - lo)
+				set(fmt.Sprintf("%0*X", width, code), string(r))
+			}
+		}
+	}
+	return conflict
+}
+
+func pdfCleanHex(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
+
+// utf16HexToString декодирует строку UTF-16BE в hex-записи
+func utf16HexToString(h string) string {
+	raw, err := hex.DecodeString(pdfCleanHex(h))
+	if err != nil {
+		return ""
+	}
+	var units []uint16
+	for i := 0; i+1 < len(raw); i += 2 {
+		units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+	}
+	var runes []rune
+	for i := 0; i < len(units); i++ {
+		u := units[i]
+		if u >= 0xD800 && u < 0xDC00 && i+1 < len(units) {
+			runes = append(runes, (rune(u)-0xD800)<<10+(rune(units[i+1])-0xDC00)+0x10000)
+			i++
+			continue
+		}
+		runes = append(runes, rune(u))
+	}
+	return string(runes)
+}
+
+// pdfContentText разбирает поток содержимого страницы и собирает текст
+func pdfContentText(content []byte, cmap map[string]string, warn func(string)) string {
+	var b strings.Builder
+	var operands []string // строки текущих операндов
+	inText := false
+
+	newline := func() {
+		s := b.String()
+		if len(s) > 0 && !strings.HasSuffix(s, "\n") {
+			b.WriteByte('\n')
+		}
+	}
+
+	i := 0
+	for i < len(content) {
+		c := content[i]
+		switch {
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case c == '(':
+			s, next := pdfLiteralString(content, i)
+			operands = append(operands, pdfDecodeBytes(s, cmap, warn))
+			i = next
+			continue
+		case (c == '<' || c == '>') && i+1 < len(content) && content[i+1] == c:
+			i += 2 // словарь << >>
+			continue
+		case c == '<':
+			end := bytes.IndexByte(content[i:], '>')
+			if end < 0 {
+				return b.String()
+			}
+			raw, _ := hex.DecodeString(pdfCleanHex(string(content[i+1 : i+end])))
+			operands = append(operands, pdfDecodeBytes(raw, cmap, warn))
+			i += end + 1
+			continue
+		case c == '[':
+			operands = append(operands, "\x00[") // начало массива TJ
+		case c == ']':
+			operands = append(operands, "\x00]")
+		case isPDFNumberStart(c):
+			start := i
+			for i < len(content) && (isPDFNumberStart(content[i])) {
+				i++
+			}
+			num := string(content[start:i])
+			// Большой отрицательный кернинг в TJ обычно означает пробел между словами
+			if v, err := strconv.ParseFloat(num, 64); err == nil && v < -200 {
+				operands = append(operands, "\x00 ")
+			} else {
+				operands = append(operands, "\x00#")
+			}
+			continue
+		case isPDFRegular(c):
+			start := i
+			for i < len(content) && isPDFRegular(content[i]) {
+				i++
+			}
+			op := string(content[start:i])
+			switch op {
+			case "ID":
+				// Данные встроенного изображения до EI
+				end := bytes.Index(content[i:], []byte("EI"))
+				if end < 0 {
+					return b.String()
+				}
+				i += end + 2
+			case "BT":
+				inText = true
+			case "ET":
+				inText = false
+				newline()
+			case "Tj", "'", "\"", "TJ":
+				if inText {
+					if op == "'" || op == "\"" {
+						newline()
+					}
+					for _, operand := range operands {
+						switch {
+						case operand == "\x00 ":
+							if op == "TJ" {
+								b.WriteByte(' ')
+							}
+						case strings.HasPrefix(operand, "\x00"):
+						default:
+							b.WriteString(operand)
+						}
+					}
+				}
+			case "Td", "TD", "T*", "Tm":
+				if inText {
+					newline()
+				}
+			}
+			operands = operands[:0]
+			continue
+		}
+		i++
+	}
+	return b.String()
+}
+
+// pdfLiteralString читает строку (...) с учетом вложенных скобок и escape-последовательностей
+func pdfLiteralString(content []byte, start int) ([]byte, int) {
+	var out []byte
+	depth := 0
+	i := start
+	for i < len(content) {
+		c := content[i]
+		switch c {
+		case '(':
+			if depth > 0 {
+				out = append(out, c)
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out, i + 1
+			}
+			out = append(out, c)
+		case '\\':
+			i++
+			if i >= len(content) {
+				return out, i
+			}
+			e := content[i]
+			switch e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r', '\n':
+				// перенос строки внутри строки игнорируется
+			default:
+				if e >= '0' && e <= '7' {
+					v := 0
+					j := 0
+					for j < 3 && i < len(content) && content[i] >= '0' && content[i] <= '7' {
+						v = v*8 + int(content[i]-'0')
+						i++
+						j++
+					}
+					out = append(out, byte(v))
+					continue
+				}
+				out = append(out, e)
+			}
+		default:
+			out = append(out, c)
+		}
+		i++
+	}
+	return out, i
+}
+
+// pdfDecodeBytes переводит коды строки в текст: через ToUnicode, если коды там есть,
+// иначе как однобайтовую кодировку
+func pdfDecodeBytes(raw []byte, cmap map[string]string, warn func(string)) string {
+	if len(cmap) > 0 {
+		for _, width := range []int{2, 1} {
+			if len(raw)%width != 0 {
+				continue
+			}
+			var b strings.Builder
+			ok := true
+			for i := 0; i < len(raw); i += width {
+				code := strings.ToUpper(hex.EncodeToString(raw[i : i+width]))
+				text, found := cmap[code]
+				if !found {
+					ok = false
+					break
+				}
+				b.WriteString(text)
+			}
+			if ok && len(raw) > 0 {
+				return b.String()
+			}
+		}
+	}
+
+	var b strings.Builder
+	printable := 0
+	for _, c := range raw {
+		if c >= 0x20 || c == '\t' || c == '\n' {
+			printable++
+		}
+		b.WriteRune(rune(c)) // Latin-1 / WinAnsi для базовых шрифтов
+	}
+	if len(raw) > 0 && printable*2 < len(raw) {
+		warn("часть текста в неизвестной кодировке шрифта (нет ToUnicode)")
+		return ""
+	}
+	return b.String()
+}
+
+func isPDFNumberStart(c byte) bool {
+	return (c >= '0' && c <= '9') || c == '-' || c == '+' || c == '.'
+}
+
+// isPDFRegular — символ оператора или имени (не разделитель и не пробел)
+func isPDFRegular(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0, '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return false
+	}
+	return true
+}
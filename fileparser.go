@@ -22,14 +22,17 @@ type FileReference struct {
 	IsAll     bool
 	IsAbs     bool
 	IsURL     bool
+	Git       string // @git:diff, @git:staged, @git:log — вывод команды git
 }
 
 // FileParser парсит ссылки на файлы
-type FileParser struct{}
+type FileParser struct {
+	workspace *Workspace
+}
 
 // NewFileParser создает новый парсер файлов
-func NewFileParser() *FileParser {
-	return &FileParser{}
+func NewFileParser(workspace *Workspace) *FileParser {
+	return &FileParser{workspace: workspace}
 }
 
 // ExtractFileReferences извлекает все ссылки на файлы из запроса
@@ -64,6 +67,10 @@ func (fp *FileParser) parseFileReference(ref string) *FileReference {
 		return nil
 	}
 
+	if strings.HasPrefix(path, "git:") {
+		return &FileReference{Git: strings.TrimPrefix(path, "git:")}
+	}
+
 	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
     	return &FileReference{
     		Path:  path,
@@ -113,6 +120,8 @@ func (fp *FileParser) ReadReferencedFiles(refs []FileReference) string {
 	for _, ref := range refs {
 		if ref.IsAll {
 			context.WriteString(fp.readAllFiles())
+		} else if ref.Git != "" {
+			context.WriteString(GitReferenceContext(ref.Git))
 		} else {
 			context.WriteString(fp.readSingleFile(ref))
 		}
@@ -188,14 +197,13 @@ func (fp *FileParser) readSingleFile(ref FileReference) string {
     	path = filepath.Join(home, path[2:])
     }
     
-    // Проверяем, что файл не выходит за пределы рабочей директории
-    if !ref.IsAbs {
-    	safePath, err := fp.resolveSafePath(path)
-    	if err != nil {
-    		return fmt.Sprintf("--- File: %s ---\n⚠️ Ошибка валидации пути: %v\n", path, err)
-    	}
-    	path = safePath
+    // Проверяем, что файл не выходит за пределы рабочего пространства — и для абсолютных
+    // путей: чтение вне него разрешают только каталоги из workspace_allow
+    safePath, err := fp.workspace.Resolve(path)
+    if err != nil {
+    	return fmt.Sprintf("--- File: %s ---\n⚠️ Ошибка валидации пути: %v\n", path, err)
     }
+    path = safePath
 	content, err := os.ReadFile(path)
 	if err != nil {
 		return fmt.Sprintf("--- File: %s ---\n⚠️ Ошибка чтения: %v\n", path, err)
@@ -297,46 +305,3 @@ func (fp *FileParser) FetchURLContent(urlStr string) (string, error) {
 	
 	return text, nil
 }
-
-// resolveSafePath проверяет, что относительный путь не содержит попыток выйти за пределы рабочей директории
-func (fp *FileParser) resolveSafePath(relativePath string) (string, error) {
-	// Очищаем путь
-	cleanPath := filepath.Clean(relativePath)
-	
-	// Запрещаем попытки выйти вверх по иерархии
-	if strings.Contains(cleanPath, ".."+string(filepath.Separator)) || cleanPath == ".." {
-		return "", fmt.Errorf("путь содержит недопустимые элементы: %s", relativePath)
-	}
-	
-	// Получаем абсолютный путь рабочей директории
-	workingDir, err := os.Getwd()
-	if err != nil {
-		return "", fmt.Errorf("не удалось получить текущую директорию: %v", err)
-	}
-	
-	// Собираем полный путь
-	fullPath := filepath.Join(workingDir, cleanPath)
-	
-	// Проверяем, что результат не выходит за рабочую директорию
-	absWorkingDir, err := filepath.Abs(workingDir)
-	if err != nil {
-		return "", err
-	}
-	
-	absFullPath, err := filepath.Abs(fullPath)
-	if err != nil {
-		return "", err
-	}
-	
-	// Дополнительная проверка через filepath.Rel
-	relPath, err := filepath.Rel(absWorkingDir, absFullPath)
-	if err != nil {
-		return "", fmt.Errorf("не удалось проверить относительный путь: %v", err)
-	}
-	
-	if strings.HasPrefix(relPath, "..") {
-		return "", fmt.Errorf("путь выходит за пределы рабочей директории: %s", fullPath)
-	}
-	
-	return fullPath, nil
-}
\ No newline at end of file
@@ -0,0 +1,486 @@
+// git.go
+// Интеграция с git: работа в отдельной ветке (git_branch), проверка незакоммиченных
+// изменений перед применением $cod/$diff, автокоммит примененных файлов с сообщением
+// от модели (git_auto_commit), команда :git и ссылки @git:diff, @git:staged, @git:log.
+// Все операции выполняет локальный git, сеть не нужна
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	gitOutputLimit     = 50000 // символов вывода git в контексте запроса
+	gitCommitDiffLimit = 8000  // символов диффа в запросе сообщения коммита
+	gitDirtyShown      = 10    // сколько незакоммиченных файлов показывать
+	gitLogDefault      = 10
+)
+
+// gitReference — ссылка @git:<вид> и команда, вывод которой попадает в контекст
+type gitReference struct {
+	title string
+	args  []string
+}
+
+var gitReferences = map[string]gitReference{
+	"diff":   {"git diff", []string{"diff"}},
+	"staged": {"git diff --cached", []string{"diff", "--cached"}},
+	"log":    {"git log", []string{"log", "-n", "20", "--date=short", "--pretty=format:%h %ad %an%n    %s", "--stat"}},
+}
+
+// runGit выполняет git в текущей директории и возвращает stdout
+func runGit(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.Error); ok {
+			return "", fmt.Errorf("git не найден: %v", err)
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return stdout.String(), fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return stdout.String(), nil
+}
+
+// IsGitRepo сообщает, находится ли текущая директория в рабочем дереве git
+func IsGitRepo() bool {
+	out, err := runGit("rev-parse", "--is-inside-work-tree")
+	return err == nil && strings.TrimSpace(out) == "true"
+}
+
+// GitRoot возвращает корень рабочего дерева
+func GitRoot() (string, error) {
+	out, err := runGit("rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Clean(strings.TrimSpace(out)), nil
+}
+
+// GitCurrentBranch возвращает имя текущей ветки ("HEAD" при отсоединенном указателе)
+func GitCurrentBranch() string {
+	out, err := runGit("rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
+
+// GitDirtyFiles возвращает строки git status --short: измененные и неотслеживаемые файлы.
+// Служебные файлы cogitor (.cogitor: снимки :undo, планы dry-run) не считаются
+func GitDirtyFiles() ([]string, error) {
+	out, err := runGit("status", "--porcelain", "--untracked-files=all")
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == "" || strings.Contains("/"+dirtyPath(line), "/.cogitor/") {
+			continue
+		}
+		files = append(files, line)
+	}
+	return files, nil
+}
+
+// ignoreCogitorDir создает .gitignore в служебной директории .cogitor, чтобы ее файлы
+// не попадали в git status и коммиты
+func ignoreCogitorDir(dir string) {
+	path := filepath.Join(dir, ".gitignore")
+	if _, err := os.Stat(path); err == nil {
+		return
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	os.WriteFile(path, []byte("# служебные файлы cogitor\n*\n"), 0644)
+}
+
+// dirtyPath извлекает путь из строки git status --porcelain (для переименований — новый)
+func dirtyPath(line string) string {
+	if len(line) < 4 {
+		return ""
+	}
+	path := line[3:]
+	if i := strings.Index(path, " -> "); i >= 0 {
+		path = path[i+4:]
+	}
+	return strings.Trim(path, "\"")
+}
+
+// GitEnsureBranch переключается на ветку, создавая её от текущего HEAD при отсутствии.
+// Незакоммиченные изменения git переносит в ветку сам
+func GitEnsureBranch(name string) (created bool, err error) {
+	if GitCurrentBranch() == name {
+		return false, nil
+	}
+	if _, err := runGit("rev-parse", "--verify", "--quiet", "refs/heads/"+name); err == nil {
+		_, err = runGit("checkout", "-q", name)
+		return false, err
+	}
+	_, err = runGit("checkout", "-q", "-b", name)
+	return err == nil, err
+}
+
+// gitRepoPaths оставляет пути внутри репозитория (корни workspace_allow могут быть вне его)
+func gitRepoPaths(root string, paths []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, p := range paths {
+		abs, err := filepath.Abs(expandHome(p))
+		if err != nil {
+			continue
+		}
+		real, err := resolveSymlinks(abs)
+		if err != nil || seen[real] || !pathWithin(root, real) {
+			continue
+		}
+		seen[real] = true
+		result = append(result, real)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// GitReferenceContext возвращает вывод git для ссылки @git:<вид>
+func GitReferenceContext(kind string) string {
+	ref, ok := gitReferences[kind]
+	if !ok {
+		return fmt.Sprintf("\n⚠️ Неизвестная ссылка @git:%s (доступны: @git:diff, @git:staged, @git:log)\n", kind)
+	}
+	title := ref.title
+	if !IsGitRepo() {
+		return fmt.Sprintf("\n--- %s ---\n⚠️ Текущая директория не является git-репозиторием\n", title)
+	}
+	out, err := runGit(ref.args...)
+	if err != nil {
+		return fmt.Sprintf("\n--- %s ---\n⚠️ %v\n", title, err)
+	}
+	if strings.TrimSpace(out) == "" {
+		out = "(нет изменений)\n"
+	}
+	if len(out) > gitOutputLimit {
+		out = out[:gitOutputLimit] + "\n... (обрезано)\n"
+	}
+	return fmt.Sprintf("\n--- %s ---\n%s", title, out)
+}
+
+// gitEnabled сообщает, нужно ли согласовывать запись файлов с git
+func gitEnabled(config *Config) bool {
+	if config == nil {
+		return false
+	}
+	branch, _ := config.Get("git_branch")
+	if s, _ := branch.(string); s == "" && !config.GetBool("git_auto_commit") {
+		return false
+	}
+	return IsGitRepo()
+}
+
+// gitBranchSetting возвращает ветку из git_branch
+func gitBranchSetting(config *Config) string {
+	value, _ := config.Get("git_branch")
+	s, _ := value.(string)
+	return s
+}
+
+// gitSwitchBranch переключается на git_branch, если она задана
+func gitSwitchBranch(config *Config) error {
+	branch := gitBranchSetting(config)
+	if branch == "" {
+		return nil
+	}
+	created, err := GitEnsureBranch(branch)
+	if err != nil {
+		return fmt.Errorf("не удалось переключиться на ветку %s: %v", branch, err)
+	}
+	if created {
+		fmt.Printf("🌿 Git: создана ветка %s\n", branch)
+	}
+	return nil
+}
+
+// gitBeforeApply проверяет рабочее дерево перед записью файлов. При незакоммиченных
+// изменениях спрашивает подтверждение (в автоматическом режиме — только предупреждает).
+// Возвращает false, если применять изменения не нужно. Ветку переключает gitUseWorkBranch —
+// уже после того, как пользователь принял изменения
+func (a *Assistant) gitBeforeApply(paths []string, autoMode bool) bool {
+	config := a.GetConfig()
+	if !gitEnabled(config) {
+		return true
+	}
+
+	dirty, err := GitDirtyFiles()
+	if err != nil {
+		fmt.Printf("⚠️  %v\n", err)
+	}
+	if len(dirty) > 0 {
+		root, _ := GitRoot()
+		targets := make(map[string]bool)
+		for _, p := range gitRepoPaths(root, paths) {
+			targets[p] = true
+		}
+
+		fmt.Printf("⚠️  В рабочем дереве git есть незакоммиченные изменения (%d):\n", len(dirty))
+		for i, line := range dirty {
+			if i == gitDirtyShown {
+				fmt.Printf("   ... и еще %d\n", len(dirty)-gitDirtyShown)
+				break
+			}
+			mark := ""
+			if targets[filepath.Join(root, dirtyPath(line))] {
+				mark = "  ← будет изменен"
+			}
+			fmt.Printf("   %s%s\n", line, mark)
+		}
+
+		if autoMode {
+			fmt.Println("   Продолжаем (автоматический режим)")
+		} else {
+			answer, err := a.terminalReader.ReadLineWithPrompt("Применить изменения поверх незакоммиченных? (y/n): ")
+			answer = strings.ToLower(strings.TrimSpace(answer))
+			if err != nil || (answer != "y" && answer != "у") {
+				fmt.Println("❌ Отменено: закоммитьте или спрячьте изменения (git stash)")
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// gitUseWorkBranch переключается на git_branch перед записью принятых изменений.
+// Возвращает false, если переключиться не удалось и писать файлы нельзя
+func (a *Assistant) gitUseWorkBranch() bool {
+	config := a.GetConfig()
+	if !gitEnabled(config) {
+		return true
+	}
+	if err := gitSwitchBranch(config); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return false
+	}
+	return true
+}
+
+// GitCommitChanges коммитит указанные файлы с сообщением от модели и возвращает
+// "хеш тема"; пустая строка — изменений нет. Коммит включает только эти файлы,
+// остальное содержимое индекса не затрагивается
+func (a *Assistant) GitCommitChanges(c context.Context, paths []string) (string, error) {
+	root, err := GitRoot()
+	if err != nil {
+		return "", err
+	}
+	paths = gitRepoPaths(root, paths)
+	if len(paths) == 0 {
+		return "", nil
+	}
+
+	if _, err := runGit(append([]string{"add", "-A", "--"}, paths...)...); err != nil {
+		return "", err
+	}
+	diff, err := runGit(append([]string{"diff", "--cached", "--"}, paths...)...)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(diff) == "" {
+		return "", nil
+	}
+
+	message := a.gitCommitMessage(c, diff, paths)
+	if _, err := runGit(append([]string{"commit", "-q", "-m", message, "--"}, paths...)...); err != nil {
+		return "", err
+	}
+	out, err := runGit("log", "-1", "--pretty=format:%h %s")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// gitAutoCommit коммитит примененные файлы, если включен git_auto_commit
+func (a *Assistant) gitAutoCommit(c context.Context, paths []string) {
+	config := a.GetConfig()
+	if config == nil || !config.GetBool("git_auto_commit") || len(paths) == 0 || !IsGitRepo() {
+		return
+	}
+	commit, err := a.GitCommitChanges(c, paths)
+	switch {
+	case err != nil:
+		fmt.Printf("⚠️  Git: коммит не создан: %v\n", err)
+	case commit == "":
+		fmt.Println("📦 Git: нет изменений для коммита")
+	default:
+		fmt.Printf("📦 Git: коммит %s (отмена: :git revert)\n", commit)
+	}
+}
+
+// gitCommitMessage просит модель написать сообщение коммита; при ошибке — шаблонное
+func (a *Assistant) gitCommitMessage(c context.Context, diff string, paths []string) string {
+	if len(diff) > gitCommitDiffLimit {
+		diff = diff[:gitCommitDiffLimit] + "\n... (дифф обрезан)"
+	}
+	prompt := fmt.Sprintf(`Напиши сообщение git-коммита для изменений ниже.
+Первая строка — краткое описание до 72 символов в повелительном наклонении, без точки в конце.
+Если нужно, после пустой строки добавь 1-3 строки пояснения.
+Верни только текст сообщения, без кавычек и Markdown.
+
+Запрос пользователя: %s
+
+Изменения:
+%s`, a.lastUserQuery, diff)
+
+	response, err := a.sendWithStats(c, prompt, a.provider, a.model, a.apiKey, "git")
+	if err == nil {
+		if message := cleanCommitMessage(response); message != "" {
+			return message
+		}
+	}
+	if a.isDebugMode() && err != nil {
+		fmt.Printf("⚠️  Сообщение коммита не получено: %v\n", err)
+	}
+	return fallbackCommitMessage(paths)
+}
+
+// cleanCommitMessage убирает из ответа модели ограждения кода и кавычки
+func cleanCommitMessage(response string) string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(response), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			continue
+		}
+		lines = append(lines, strings.TrimRight(line, " \t\r"))
+	}
+	message := strings.TrimSpace(strings.Join(lines, "\n"))
+	return strings.Trim(message, "\"'`")
+}
+
+// fallbackCommitMessage — сообщение коммита без модели
+func fallbackCommitMessage(paths []string) string {
+	names := make([]string, 0, len(paths))
+	for _, p := range paths {
+		names = append(names, filepath.Base(p))
+	}
+	if len(names) > 3 {
+		names = append(names[:3], fmt.Sprintf("еще %d", len(names)-3))
+	}
+	return "cogitor: обновить " + strings.Join(names, ", ")
+}
+
+// ========== Команда :git ==========
+
+func (ch *CommandHandler) handleGit(args []string) {
+	if !IsGitRepo() {
+		fmt.Println("❌ Текущая директория не является git-репозиторием")
+		return
+	}
+	sub := "status"
+	if len(args) > 0 {
+		sub, args = args[0], args[1:]
+	}
+
+	switch sub {
+	case "status", "st":
+		ch.gitStatus()
+	case "log":
+		n := gitLogDefault
+		if len(args) > 0 {
+			v, err := strconv.Atoi(args[0])
+			if err != nil || v <= 0 {
+				fmt.Println("❌ Количество коммитов должно быть положительным числом")
+				return
+			}
+			n = v
+		}
+		out, err := runGit("log", "--oneline", "--decorate", "-n", strconv.Itoa(n))
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+		if strings.TrimSpace(out) == "" {
+			fmt.Println("📋 Коммитов пока нет")
+			return
+		}
+		fmt.Printf("📋 Последние коммиты (%s):\n%s", GitCurrentBranch(), out)
+	case "diff":
+		out, err := runGit(append([]string{"diff"}, args...)...)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+		if strings.TrimSpace(out) == "" {
+			fmt.Println("✅ Незакоммиченных изменений нет")
+			return
+		}
+		fmt.Print(colorizeDiff(out))
+	case "revert":
+		ch.gitRevert(args)
+	default:
+		fmt.Printf("❌ Неизвестная подкоманда: %s\n", sub)
+		fmt.Println("Использование: :git [status|log [n]|diff [--staged] [путь]|revert [коммит]]")
+	}
+}
+
+func (ch *CommandHandler) gitStatus() {
+	fmt.Printf("🌿 Ветка: %s\n", GitCurrentBranch())
+	if branch := gitBranchSetting(ch.config); branch != "" {
+		fmt.Printf("   Рабочая ветка cogitor: %s\n", branch)
+	}
+	fmt.Printf("📦 Автокоммит: %v\n", ch.config.GetBool("git_auto_commit"))
+
+	dirty, err := GitDirtyFiles()
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+	if len(dirty) == 0 {
+		fmt.Println("✅ Рабочее дерево чистое")
+		return
+	}
+	fmt.Printf("📝 Незакоммиченные изменения (%d):\n", len(dirty))
+	for _, line := range dirty {
+		fmt.Printf("   %s\n", line)
+	}
+}
+
+// gitRevert создает коммит, отменяющий указанный (по умолчанию — последний)
+func (ch *CommandHandler) gitRevert(args []string) {
+	commit := "HEAD"
+	if len(args) > 0 {
+		commit = args[0]
+	}
+	info, err := runGit("log", "-1", "--pretty=format:%h %s", commit)
+	if err != nil {
+		fmt.Printf("❌ Коммит не найден: %v\n", err)
+		return
+	}
+	fmt.Printf("↶ Будет отменен коммит: %s\n", strings.TrimSpace(info))
+
+	if ch.terminalReader != nil {
+		response, err := ch.terminalReader.ReadLineWithPrompt("Создать отменяющий коммит? (y/n): ")
+		if err != nil || strings.ToLower(strings.TrimSpace(response)) != "y" {
+			fmt.Println("❌ Отменено")
+			return
+		}
+	}
+
+	if _, err := runGit("revert", "--no-edit", commit); err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+	out, _ := runGit("log", "-1", "--pretty=format:%h %s")
+	fmt.Printf("✅ Создан коммит %s\n", strings.TrimSpace(out))
+}
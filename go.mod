@@ -5,17 +5,20 @@ go 1.24.1
 
 require golang.org/x/net v0.38.0
 
+require golang.org/x/crypto v0.36.0
+
 require golang.org/x/text v0.23.0 // indirect
 
 require github.com/peterh/liner v1.2.2
 
 require (
+	github.com/alecthomas/chroma v0.10.0
 	github.com/charmbracelet/glamour v0.6.0
+	github.com/yuin/goldmark v1.5.2
 	github.com/webview/webview_go v0.0.0-20240831120633-6173450d4dd6
 )
 
 require (
-	github.com/alecthomas/chroma v0.10.0 // indirect
 	github.com/andybalholm/brotli v1.1.1 // indirect
 	github.com/aymanbagabas/go-osc52 v1.0.3 // indirect
 	github.com/aymerick/douceur v0.2.0 // indirect
@@ -38,10 +41,8 @@ require (
 	github.com/quic-go/qpack v0.5.1 // indirect
 	github.com/rivo/uniseg v0.2.0 // indirect
 	github.com/tam7t/hpkp v0.0.0-20160821193359-2b70b4024ed5 // indirect
-	github.com/yuin/goldmark v1.5.2 // indirect
 	github.com/yuin/goldmark-emoji v1.0.1 // indirect
 	go.uber.org/mock v0.5.0 // indirect
-	golang.org/x/crypto v0.36.0 // indirect
 	golang.org/x/mod v0.18.0 // indirect
 	golang.org/x/sync v0.12.0 // indirect
 	golang.org/x/sys v0.31.0 // indirect
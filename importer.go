@@ -0,0 +1,430 @@
+// importer.go
+// Импорт диалогов из других инструментов: conversations.json (OpenAI), массивы [{role, content}]
+// и Markdown-экспорт самого cogitor. Результат сохраняется как обычные сессии
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// importMessage — сообщение в нейтральном формате
+type importMessage struct {
+	Role    string
+	Content string
+}
+
+// ImportedConversation — диалог, приведенный к формату сессии
+type ImportedConversation struct {
+	Title     string
+	Created   time.Time
+	Exchanges []string
+	Skipped   int // сообщения, которые не удалось сопоставить (system, пустые, нетекстовые)
+}
+
+// ImportResult — результат разбора файла
+type ImportResult struct {
+	Format        string
+	Conversations []ImportedConversation
+}
+
+// ImportConversations определяет формат файла и разбирает его
+func ImportConversations(path string) (*ImportResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil, fmt.Errorf("файл пуст")
+	}
+
+	var result *ImportResult
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".md" || ext == ".markdown" {
+		result, err = importCogitorMarkdown(string(data))
+	} else {
+		result, err = importJSON(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Отбрасываем пустые диалоги
+	var conversations []ImportedConversation
+	for _, c := range result.Conversations {
+		if len(c.Exchanges) > 0 {
+			conversations = append(conversations, c)
+		}
+	}
+	if len(conversations) == 0 {
+		return nil, fmt.Errorf("в файле не найдено ни одного обмена (формат: %s)", result.Format)
+	}
+	result.Conversations = conversations
+	return result, nil
+}
+
+// importJSON распознает JSON-форматы по структуре
+func importJSON(data []byte) (*ImportResult, error) {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("некорректный JSON: %v", err)
+	}
+
+	switch v := raw.(type) {
+	case []interface{}:
+		if len(v) == 0 {
+			return nil, fmt.Errorf("пустой массив")
+		}
+		first, _ := v[0].(map[string]interface{})
+		if first == nil {
+			return nil, fmt.Errorf("неизвестный формат: ожидается массив объектов")
+		}
+		if _, ok := first["mapping"]; ok {
+			return importOpenAI(v)
+		}
+		if _, ok := first["role"]; ok {
+			conv := pairMessages(parseRoleMessages(v))
+			return &ImportResult{Format: "messages", Conversations: []ImportedConversation{conv}}, nil
+		}
+	case map[string]interface{}:
+		if _, ok := v["mapping"]; ok {
+			return importOpenAI([]interface{}{v})
+		}
+		if msgs, ok := v["messages"].([]interface{}); ok {
+			conv := pairMessages(parseRoleMessages(msgs))
+			conv.Title, _ = v["title"].(string)
+			return &ImportResult{Format: "messages", Conversations: []ImportedConversation{conv}}, nil
+		}
+		if exchanges, ok := v["exchanges"].([]interface{}); ok {
+			// Собственная сессия или JSON-экспорт cogitor
+			conv := ImportedConversation{}
+			conv.Title, _ = v["title"].(string)
+			for _, ex := range exchanges {
+				if s, ok := ex.(string); ok && strings.TrimSpace(s) != "" {
+					conv.Exchanges = append(conv.Exchanges, s)
+				}
+			}
+			return &ImportResult{Format: "cogitor-json", Conversations: []ImportedConversation{conv}}, nil
+		}
+	}
+	return nil, fmt.Errorf("неизвестный формат JSON: ожидается conversations.json, [{role, content}] или сессия cogitor")
+}
+
+// importOpenAI разбирает conversations.json: каждый диалог — дерево сообщений в поле mapping.
+// Берется ветка от current_node к корню, т.е. последняя выбранная пользователем версия
+func importOpenAI(items []interface{}) (*ImportResult, error) {
+	result := &ImportResult{Format: "openai"}
+
+	for _, item := range items {
+		conv, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		mapping, _ := conv["mapping"].(map[string]interface{})
+		if mapping == nil {
+			continue
+		}
+
+		nodeID, _ := conv["current_node"].(string)
+		if nodeID == "" {
+			nodeID = findLeafNode(mapping)
+		}
+
+		var chain []map[string]interface{}
+		visited := make(map[string]bool)
+		for nodeID != "" && !visited[nodeID] {
+			visited[nodeID] = true
+			node, _ := mapping[nodeID].(map[string]interface{})
+			if node == nil {
+				break
+			}
+			chain = append(chain, node)
+			nodeID, _ = node["parent"].(string)
+		}
+
+		var messages []importMessage
+		skipped := 0
+		for i := len(chain) - 1; i >= 0; i-- {
+			msg, _ := chain[i]["message"].(map[string]interface{})
+			if msg == nil {
+				continue
+			}
+			author, _ := msg["author"].(map[string]interface{})
+			role, _ := author["role"].(string)
+			text := openAIContentText(msg["content"])
+			if strings.TrimSpace(text) == "" {
+				if role == "user" || role == "assistant" {
+					skipped++
+				}
+				continue
+			}
+			messages = append(messages, importMessage{Role: role, Content: text})
+		}
+
+		imported := pairMessages(messages)
+		imported.Skipped += skipped
+		imported.Title, _ = conv["title"].(string)
+		if created, ok := conv["create_time"].(float64); ok {
+			imported.Created = time.Unix(int64(created), 0)
+		}
+		result.Conversations = append(result.Conversations, imported)
+	}
+	return result, nil
+}
+
+// findLeafNode возвращает узел без потомков (если current_node отсутствует)
+func findLeafNode(mapping map[string]interface{}) string {
+	ids := make([]string, 0, len(mapping))
+	for id := range mapping {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		node, _ := mapping[id].(map[string]interface{})
+		children, _ := node["children"].([]interface{})
+		if len(children) == 0 {
+			return id
+		}
+	}
+	return ""
+}
+
+// openAIContentText извлекает текст из content.parts (нетекстовые части пропускаются)
+func openAIContentText(content interface{}) string {
+	c, _ := content.(map[string]interface{})
+	if c == nil {
+		return ""
+	}
+	var parts []string
+	if list, ok := c["parts"].([]interface{}); ok {
+		for _, p := range list {
+			if s, ok := p.(string); ok && s != "" {
+				parts = append(parts, s)
+			}
+		}
+	}
+	if text, ok := c["text"].(string); ok && len(parts) == 0 {
+		parts = append(parts, text)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// parseRoleMessages разбирает массив [{role, content}]; content может быть строкой
+// или массивом частей [{type: "text", text}]
+func parseRoleMessages(items []interface{}) []importMessage {
+	var messages []importMessage
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		role, _ := m["role"].(string)
+		var text string
+		switch c := m["content"].(type) {
+		case string:
+			text = c
+		case []interface{}:
+			var parts []string
+			for _, p := range c {
+				if part, ok := p.(map[string]interface{}); ok {
+					if t, ok := part["text"].(string); ok {
+						parts = append(parts, t)
+					}
+				} else if s, ok := p.(string); ok {
+					parts = append(parts, s)
+				}
+			}
+			text = strings.Join(parts, "\n")
+		}
+		messages = append(messages, importMessage{Role: strings.ToLower(role), Content: text})
+	}
+	return messages
+}
+
+// pairMessages собирает сообщения в обмены "Вопрос/Ответ" в формате ContextManager.
+// Подряд идущие сообщения одной роли объединяются, system и прочие роли пропускаются
+func pairMessages(messages []importMessage) ImportedConversation {
+	var conv ImportedConversation
+	var question, answer []string
+
+	flush := func() {
+		if len(question) == 0 && len(answer) == 0 {
+			return
+		}
+		q := strings.Join(question, "\n\n")
+		if q == "" {
+			q = "(продолжение)"
+		}
+		conv.Exchanges = append(conv.Exchanges, "Вопрос: "+q+"\nОтвет: "+strings.Join(answer, "\n\n"))
+		question, answer = nil, nil
+	}
+
+	for _, m := range messages {
+		content := strings.TrimSpace(m.Content)
+		if content == "" {
+			conv.Skipped++
+			continue
+		}
+		switch m.Role {
+		case "user", "human":
+			if len(answer) > 0 {
+				flush()
+			}
+			question = append(question, content)
+		case "assistant", "model", "ai":
+			answer = append(answer, content)
+		default:
+			conv.Skipped++
+		}
+	}
+	flush()
+	return conv
+}
+
+var (
+	mdExchangeHeader = regexp.MustCompile(`(?m)^## \d+\. Вопрос\s*$`)
+	mdAnswerHeader   = regexp.MustCompile(`(?m)^### Ответ\s*$`)
+	mdFileBlock      = regexp.MustCompile("(?m)^\\*\\*([^*\\n]+)\\*\\*\\n\\n(`{3,})[\\w+#.-]*\\n")
+)
+
+// importCogitorMarkdown разбирает Markdown-экспорт cogitor (:export md).
+// Поддерживается и старый формат, где обмены разделены строками "---"
+func importCogitorMarkdown(text string) (*ImportResult, error) {
+	result := &ImportResult{Format: "cogitor-md"}
+	conv := ImportedConversation{}
+	if strings.HasPrefix(text, "# ") {
+		line := text[2:]
+		if i := strings.Index(line, "\n"); i >= 0 {
+			line = line[:i]
+		}
+		if line != "Экспорт сессии" {
+			conv.Title = strings.TrimSpace(line)
+		}
+	}
+
+	headers := mdExchangeHeader.FindAllStringIndex(text, -1)
+	if len(headers) == 0 {
+		// Старый формат: "# Экспорт сессии" и сырые обмены через "---"
+		for _, part := range regexp.MustCompile(`(?m)^---\s*$`).Split(text, -1) {
+			part = strings.TrimSpace(part)
+			if strings.HasPrefix(part, "Вопрос:") {
+				conv.Exchanges = append(conv.Exchanges, part)
+			}
+		}
+		if len(conv.Exchanges) == 0 {
+			return nil, fmt.Errorf("не найдено обменов: ожидается Markdown-экспорт cogitor (:export md)")
+		}
+		result.Conversations = append(result.Conversations, conv)
+		return result, nil
+	}
+
+	for i, h := range headers {
+		end := len(text)
+		if i+1 < len(headers) {
+			end = headers[i+1][0]
+		}
+		block := text[h[1]:end]
+
+		question, answer := block, ""
+		if loc := mdAnswerHeader.FindStringIndex(block); loc != nil {
+			question, answer = block[:loc[0]], block[loc[1]:]
+		} else {
+			conv.Skipped++
+		}
+		conv.Exchanges = append(conv.Exchanges,
+			"Вопрос: "+strings.TrimSpace(question)+"\nОтвет: "+restoreFileBlocks(strings.TrimSpace(answer)))
+	}
+	result.Conversations = append(result.Conversations, conv)
+	return result, nil
+}
+
+// restoreFileBlocks превращает "**path**" + fenced-блок обратно в "--- File: path ---"
+func restoreFileBlocks(answer string) string {
+	var b strings.Builder
+	for {
+		loc := mdFileBlock.FindStringSubmatchIndex(answer)
+		if loc == nil {
+			b.WriteString(answer)
+			return b.String()
+		}
+		path := answer[loc[2]:loc[3]]
+		fence := answer[loc[4]:loc[5]]
+		rest := answer[loc[1]:]
+		closing := strings.Index(rest, "\n"+fence)
+		if closing < 0 {
+			b.WriteString(answer)
+			return b.String()
+		}
+		b.WriteString(answer[:loc[0]])
+		b.WriteString("--- File: " + path + " ---\n" + rest[:closing] + "\n")
+		answer = strings.TrimPrefix(rest[closing+1+len(fence):], "\n")
+	}
+}
+
+// importSessionName строит имя сессии из заголовка диалога
+func importSessionName(title string, index int) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_':
+			b.WriteRune(r)
+		case unicode.IsSpace(r):
+			b.WriteRune('_')
+		}
+	}
+	name := strings.Trim(b.String(), "_")
+	if runes := []rune(name); len(runes) > 40 {
+		name = string(runes[:40])
+	}
+	if name == "" {
+		name = fmt.Sprintf("%d", index+1)
+	}
+	return "import_" + name
+}
+
+// uniqueSessionName добавляет суффикс, если сессия с таким именем уже есть
+func uniqueSessionName(name string) string {
+	candidate := name
+	for i := 2; ; i++ {
+		if _, err := os.Stat(filepath.Join(getSessionsDir(), candidate+".json")); os.IsNotExist(err) {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s_%d", name, i)
+	}
+}
+
+// SaveImportedConversation сохраняет диалог как сессию и возвращает её имя
+func SaveImportedConversation(conv ImportedConversation, name, provider, model string, encrypt bool) (string, error) {
+	name = uniqueSessionName(name)
+
+	timestamp := time.Now()
+	if !conv.Created.IsZero() {
+		timestamp = conv.Created
+	}
+	title := conv.Title
+	if title == "" {
+		title = autoTitle(conv.Exchanges)
+	}
+
+	data := SessionData{
+		Version:   SessionFormatVersion,
+		Timestamp: timestamp.Format(time.RFC3339),
+		Provider:  provider,
+		Model:     model,
+		Exchanges: conv.Exchanges,
+		Title:     truncateTitle(title),
+		Tags:      []string{"import"},
+	}
+	if err := writeSecureJSON(filepath.Join(getSessionsDir(), name+".json"), data, encrypt); err != nil {
+		return "", err
+	}
+	return name, nil
+}
@@ -17,6 +17,7 @@ import (
 type Installer struct {
 	terminalReader *TerminalReader
 	config         *Config
+	dryRun         *DryRun
 }
 
 // NewInstaller создает новый инсталлятор
@@ -37,6 +38,11 @@ type DependencyInfo struct {
 
 // CheckAndInstallDependencies проверяет и предлагает установить зависимости
 func (i *Installer) CheckAndInstallDependencies(files []CodeFile) error {
+	if i.dryRun.Enabled() {
+		i.planDependencies(files)
+		return nil
+	}
+
 	// Сначала проверяем, есть ли команды установки от LLM
 	var llmCommands []string
 	for _, file := range files {
@@ -140,6 +146,25 @@ func (i *Installer) CheckAndInstallDependencies(files []CodeFile) error {
 	return nil
 }
 
+// planDependencies добавляет в план dry-run команды установки: от LLM или найденные анализом кода
+func (i *Installer) planDependencies(files []CodeFile) {
+	found := false
+	for _, file := range files {
+		if file.Compile != nil && file.Compile.InstallCommand != "" {
+			i.dryRun.AddCommand(PlanCommand{Kind: "install", Command: file.Compile.InstallCommand, Source: "llm"})
+			found = true
+		}
+	}
+	if found {
+		return
+	}
+	for _, dep := range i.analyzeDependencies(files) {
+		if !dep.IsFound {
+			i.dryRun.AddCommand(PlanCommand{Kind: "install", Command: dep.InstallCmd, Source: "analysis", Package: dep.Package})
+		}
+	}
+}
+
 // waitForEnter ожидает нажатия Enter от пользователя
 func (i *Installer) waitForEnter() {
 	_, _ = i.terminalReader.ReadLineWithPrompt("> Нажмите Enter для продолжения...")
@@ -0,0 +1,166 @@
+// interactive.go
+// Интерактивный запуск программ, читающих stdin (меню, игры, вопросы в консоли):
+// терминал подключается к программе через PTY (в Linux) или напрямую, а транскрипт
+// сеанса сохраняется для цикла автоисправления
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// errStoppedByUser — пользователь сам остановил программу: исправлять нечего
+var errStoppedByUser = errors.New("программа остановлена пользователем")
+
+// DefaultRunInteractive — режим по умолчанию: интерактивно, если код читает stdin
+const DefaultRunInteractive = "auto"
+
+// runInteractiveModes — допустимые значения настройки run_interactive
+var runInteractiveModes = []string{"auto", "on", "off"}
+
+// stdinPattern — чтение стандартного ввода в поддерживаемых языках. Методы объектов
+// (file.gets, reader.readLine, getline(file, ...)) читают файлы и каналы и не считаются
+var stdinPattern = regexp.MustCompile(`(?:^|[^.\w])input\s*\(|sys\.stdin|getpass\(|` + // Python
+	`os\.Stdin|fmt\.Scan|` + // Go
+	`\bscanf\s*\(|\bgetchar\s*\(|(?:fgets|getline)\s*\([^;]*\bstdin\b|(?:^|[^.\w])gets\s*\(|STDIN_FILENO|` + // C
+	`std::cin|\bcin\s*>>|getline\s*\(\s*(?:std::)?cin\b|` + // C++
+	`(?:^|[^.\w:])gets\b|\bSTDIN\.|\$stdin|` + // Ruby
+	`(?:^|[^.\w])(?:readLine|readln)\s*\(|System\.in\b|` + // Kotlin, Swift
+	`\(read-line(?:\s*\)|\s+\*standard-input\*)|\(read\)|` + // Lisp
+	`(?i:\bread\s*\(\s*[*5]\s*,|\bread\s*\*\s*,)`) // Fortran
+
+// ansiPattern — управляющие последовательности терминала в транскрипте
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07]*\x07|\x1b[()][0-9A-Za-z]`)
+
+// readsStdin сообщает, читает ли код стандартный ввод
+func readsStdin(source string) bool {
+	return stdinPattern.MatchString(source)
+}
+
+// stdinIsTerminal сообщает, подключен ли stdin к терминалу
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// runInteractiveSetting возвращает режим run_interactive
+func runInteractiveSetting(config *Config) string {
+	if config == nil {
+		return DefaultRunInteractive
+	}
+	value, _ := config.Get("run_interactive")
+	if s, ok := value.(string); ok && s != "" {
+		return s
+	}
+	return DefaultRunInteractive
+}
+
+// interactiveRun решает, запускать ли программу с подключенным терминалом
+func (cr *CodeRunner) interactiveRun(source string) bool {
+	mode := runInteractiveSetting(cr.config)
+	if mode == "off" || cr.noTerminal || !stdinIsTerminal() {
+		return false
+	}
+	return mode == "on" || readsStdin(source)
+}
+
+// interactiveTimeoutFactor — во сколько раз интерактивный запуск может быть дольше run_timeout
+const interactiveTimeoutFactor = 10
+
+// interactiveTimeout — предел для программы, подключенной к терминалу: она ждет человека,
+// но зависшая (или ошибочно признанная интерактивной) не должна держать терминал вечно
+func (cr *CodeRunner) interactiveTimeout() time.Duration {
+	return interactiveTimeoutFactor * cr.runTimeout()
+}
+
+// runInteractive запускает программу с терминалом пользователя. Вместо run_timeout
+// действует interactiveTimeout — программа ждет человека; лимиты песочницы сохраняются.
+// При ошибке возвращается транскрипт (ввод и вывод), при успехе — пустой вывод:
+// пользователь его видел
+func (cr *CodeRunner) runInteractive(ctx context.Context, cmd *exec.Cmd, box *Sandbox) (string, error) {
+	if cmd.Err != nil {
+		return "", cmd.Err
+	}
+	// Песочница оборачивает команду, когда известно, будет ли PTY: сеанс терминала
+	// программе оставляется только на собственном псевдотерминале
+	prepare := func(pty bool) (*exec.Cmd, error) {
+		if box == nil {
+			return cmd, nil
+		}
+		box.Interactive = pty
+		return box.Command(cmd)
+	}
+
+	timeout := cr.interactiveTimeout()
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	transcript := newCappedBuffer(cr.outputLimit())
+	err := runAttached(runCtx, prepare, transcript)
+	fmt.Println("\n" + strings.Repeat("─", 60))
+	switch {
+	case ctx.Err() != nil:
+		err = fmt.Errorf("выполнение прервано пользователем")
+	case runCtx.Err() == context.DeadlineExceeded:
+		err = fmt.Errorf("интерактивный запуск дольше %d с (%d × run_timeout), процесс остановлен", int(timeout.Seconds()), interactiveTimeoutFactor)
+	}
+	if errors.Is(err, errStoppedByUser) {
+		fmt.Println("⏹️  Программа остановлена пользователем")
+		return "", nil
+	}
+	if err == nil {
+		return "", nil
+	}
+
+	text := cleanTranscript(transcript.String())
+	if strings.TrimSpace(text) == "" {
+		return "", err
+	}
+	return "Транскрипт интерактивного запуска (ввод пользователя и вывод программы):\n" + text, err
+}
+
+// printInteractiveHeader сообщает о начале интерактивного сеанса и клавишах управления
+func printInteractiveHeader(keys string) {
+	fmt.Printf("⌨️  Интерактивный запуск: ввод передается программе; %s\n", keys)
+	fmt.Println(strings.Repeat("─", 60))
+}
+
+// runPiped подключает stdin терминала напрямую, а вывод дублирует в транскрипт.
+// Программа работает в своей группе процессов (отмена останавливает ее целиком), которая
+// на время запуска становится активной группой терминала, иначе чтение остановит ее
+// SIGTTIN; введенный текст в транскрипт не попадает
+func runPiped(ctx context.Context, prepare func(pty bool) (*exec.Cmd, error), transcript io.Writer) error {
+	cmd, err := prepare(false)
+	if err != nil {
+		return err
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, "PYTHONUNBUFFERED=1") // stdout не терминал — без этого Python буферизует вывод
+	cmd.Stdin = os.Stdin
+	c := commandWithContext(ctx, cmd)
+	c.Stdout = io.MultiWriter(os.Stdout, transcript)
+	c.Stderr = io.MultiWriter(os.Stderr, transcript)
+	foreground := setForegroundGroup(c)
+	printInteractiveHeader("Ctrl+D — конец ввода, Ctrl+C — остановить программу")
+	err = c.Run()
+	if foreground {
+		reclaimTerminal()
+	}
+	return err
+}
+
+// cleanTranscript убирает управляющие последовательности и возвраты каретки
+func cleanTranscript(s string) string {
+	s = ansiPattern.ReplaceAllString(s, "")
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.ReplaceAll(s, "\r", "\n")
+}
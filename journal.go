@@ -0,0 +1,302 @@
+// journal.go
+// Журнал операций для :undo / :redo: состояние контекста и файлы, записанные ассистентом.
+// Снимки файлов хранятся в .cogitor/snapshots рабочей директории
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const MaxJournalEntries = 50
+
+// fileSnapshot описывает состояние одного файла до и после операции
+type fileSnapshot struct {
+	Path          string // абсолютный путь к файлу
+	ExistedBefore bool
+	ExistedAfter  bool
+	BeforePath    string // снимок содержимого до операции
+	AfterPath     string // снимок содержимого после операции
+}
+
+// JournalEntry — одна обратимая операция
+type JournalEntry struct {
+	ID        string
+	Label     string
+	Time      time.Time
+	dir       string
+	before    contextSnapshot
+	after     contextSnapshot
+	files     []*fileSnapshot
+	fileIndex map[string]*fileSnapshot
+	cm        *ContextManager
+	journal   *Journal
+}
+
+// Journal хранит стеки отмены и повтора
+type Journal struct {
+	undo    []*JournalEntry
+	redo    []*JournalEntry
+	counter int
+	mu      sync.Mutex
+}
+
+// NewJournal создает пустой журнал операций
+func NewJournal() *Journal {
+	return &Journal{}
+}
+
+// getSnapshotsDir возвращает директорию снимков для текущей рабочей директории
+func getSnapshotsDir() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		wd = "."
+	}
+	return filepath.Join(wd, ".cogitor", "snapshots")
+}
+
+// Begin начинает запись операции: запоминает состояние контекста до изменений.
+// Если cm == nil, операция затрагивает только файлы, и контекст при отмене не меняется.
+func (j *Journal) Begin(label string, cm *ContextManager) *JournalEntry {
+	j.mu.Lock()
+	j.counter++
+	id := fmt.Sprintf("%s_%03d", time.Now().Format("20060102_150405"), j.counter)
+	j.mu.Unlock()
+
+	e := &JournalEntry{
+		ID:        id,
+		Label:     label,
+		Time:      time.Now(),
+		dir:       filepath.Join(getSnapshotsDir(), id),
+		fileIndex: make(map[string]*fileSnapshot),
+		cm:        cm,
+		journal:   j,
+	}
+	if cm != nil {
+		e.before = cm.Snapshot()
+	}
+	return e
+}
+
+// TrackFile сохраняет снимок файла перед его изменением.
+// Повторный вызов для того же файла ничего не делает.
+func (e *JournalEntry) TrackFile(path string) {
+	if e == nil {
+		return
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		absPath = path
+	}
+	if _, ok := e.fileIndex[absPath]; ok {
+		return
+	}
+
+	ignoreCogitorDir(filepath.Dir(filepath.Dir(e.dir))) // .cogitor рабочей директории
+	snap := &fileSnapshot{Path: absPath}
+	if content, err := os.ReadFile(absPath); err == nil {
+		snap.ExistedBefore = true
+		snap.BeforePath = filepath.Join(e.dir, fmt.Sprintf("%d.before", len(e.files)))
+		if err := writeSnapshotFile(snap.BeforePath, content); err != nil {
+			fmt.Printf("⚠️  Не удалось сохранить снимок %s: %v\n", path, err)
+		}
+	}
+	e.files = append(e.files, snap)
+	e.fileIndex[absPath] = snap
+}
+
+// Commit завершает запись операции и помещает её в стек отмены
+func (e *JournalEntry) Commit() {
+	if e == nil {
+		return
+	}
+	if e.cm != nil {
+		e.after = e.cm.Snapshot()
+	}
+
+	for i, snap := range e.files {
+		content, err := os.ReadFile(snap.Path)
+		if err != nil {
+			continue
+		}
+		snap.ExistedAfter = true
+		snap.AfterPath = filepath.Join(e.dir, fmt.Sprintf("%d.after", i))
+		if err := writeSnapshotFile(snap.AfterPath, content); err != nil {
+			fmt.Printf("⚠️  Не удалось сохранить снимок %s: %v\n", snap.Path, err)
+		}
+	}
+
+	j := e.journal
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	// Новая операция делает стек повтора недействительным
+	for _, r := range j.redo {
+		r.cleanup()
+	}
+	j.redo = nil
+
+	j.undo = append(j.undo, e)
+	if len(j.undo) > MaxJournalEntries {
+		j.undo[0].cleanup()
+		j.undo = j.undo[1:]
+	}
+	if len(e.files) > 0 {
+		j.pruneSnapshots(filepath.Dir(e.dir))
+	}
+}
+
+// pruneSnapshots удаляет снимки, оставшиеся от прошлых запусков: в директории остается
+// не больше MaxJournalEntries операций, снимки текущего журнала не удаляются
+func (j *Journal) pruneSnapshots(dir string) {
+	live := make(map[string]bool)
+	for _, e := range append(append([]*JournalEntry(nil), j.undo...), j.redo...) {
+		live[e.dir] = true
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	type entry struct {
+		path    string
+		modTime time.Time
+	}
+	var stale []entry
+	for _, f := range files {
+		path := filepath.Join(dir, f.Name())
+		if !f.IsDir() || live[path] {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		stale = append(stale, entry{path, info.ModTime()})
+	}
+	keep := MaxJournalEntries - len(live)
+	if keep < 0 {
+		keep = 0
+	}
+	if len(stale) <= keep {
+		return
+	}
+	sort.Slice(stale, func(i, k int) bool {
+		return stale[i].modTime.After(stale[k].modTime)
+	})
+	for _, e := range stale[keep:] {
+		os.RemoveAll(e.path)
+	}
+}
+
+// Undo отменяет последнюю операцию
+func (j *Journal) Undo() (*JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if len(j.undo) == 0 {
+		return nil, fmt.Errorf("нечего отменять")
+	}
+	e := j.undo[len(j.undo)-1]
+	err := e.restore(false)
+	j.undo = j.undo[:len(j.undo)-1]
+	j.redo = append(j.redo, e)
+	return e, err
+}
+
+// Redo повторяет последнюю отмененную операцию
+func (j *Journal) Redo() (*JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if len(j.redo) == 0 {
+		return nil, fmt.Errorf("нечего повторять")
+	}
+	e := j.redo[len(j.redo)-1]
+	err := e.restore(true)
+	j.redo = j.redo[:len(j.redo)-1]
+	j.undo = append(j.undo, e)
+	return e, err
+}
+
+// Entries возвращает копии стеков отмены и повтора (от старых к новым)
+func (j *Journal) Entries() (undo, redo []*JournalEntry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]*JournalEntry(nil), j.undo...), append([]*JournalEntry(nil), j.redo...)
+}
+
+// Files возвращает пути файлов, затронутых операцией
+func (e *JournalEntry) Files() []string {
+	paths := make([]string, 0, len(e.files))
+	for _, snap := range e.files {
+		paths = append(paths, snap.Path)
+	}
+	return paths
+}
+
+// restore возвращает файлы в состояние до (forward=false) или после (forward=true) операции
+// и отменяет (повторяет) ее изменения контекста; обмены, добавленные позже, сохраняются
+func (e *JournalEntry) restore(forward bool) error {
+	var errs []string
+	for _, snap := range e.files {
+		existed, snapPath := snap.ExistedBefore, snap.BeforePath
+		if forward {
+			existed, snapPath = snap.ExistedAfter, snap.AfterPath
+		}
+
+		if !existed {
+			if err := os.Remove(snap.Path); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, fmt.Sprintf("%s: %v", snap.Path, err))
+			}
+			continue
+		}
+
+		content, err := os.ReadFile(snapPath)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: снимок недоступен: %v", snap.Path, err))
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(snap.Path), 0755); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", snap.Path, err))
+			continue
+		}
+		if err := os.WriteFile(snap.Path, content, 0644); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", snap.Path, err))
+		}
+	}
+
+	if e.cm != nil {
+		if forward {
+			e.cm.ApplyDelta(e.before, e.after)
+		} else {
+			e.cm.ApplyDelta(e.after, e.before)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("не все файлы восстановлены:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// cleanup удаляет снимки файлов операции
+func (e *JournalEntry) cleanup() {
+	if len(e.files) > 0 {
+		os.RemoveAll(e.dir)
+	}
+}
+
+// writeSnapshotFile записывает снимок, создавая директорию при необходимости
+func writeSnapshotFile(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0600)
+}
@@ -4,7 +4,9 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"net"
 	"strconv"
 	"time"
@@ -16,6 +18,11 @@ import (
 const Version = "1.0.1"
 
 func main() {
+	// Перезапуск для песочницы: выставить лимиты и запустить программу (sandbox.go)
+	if len(os.Args) > 1 && os.Args[1] == sandboxHelperArg {
+		os.Exit(runSandboxHelper(os.Args[2:]))
+	}
+
 	// Инициализируем и загружаем конфигурацию
 	config := NewConfig()
 	config.Load() // Загружаем сохраненные настройки
@@ -29,6 +36,7 @@ func main() {
 	serverMode := false
 	serverPort := "8080" // значение по умолчанию
 	guiMode := false
+	dryRun := false
 	args := os.Args[1:]
 	
 	// СНАЧАЛА ПАРСИМ ВСЕ АРГУМЕНТЫ
@@ -70,6 +78,8 @@ func main() {
 			}
 		case "--no-search", "--disable-search":
 			webSearchEnabled = false
+		case "--dry-run":
+			dryRun = true
 		case "--input", "-i":
 			if i+1 < len(args) {
 				inputFile = args[i+1]
@@ -97,6 +107,7 @@ func main() {
 			fmt.Println("  --server [ПОРТ]   Запустить веб-сервер (порт по умолчанию: 8080)")
 			fmt.Println("  -i, --input ФАЙЛ  Файл описания задачи")
 			fmt.Println("  -ds, --no-search  Отключить веб-поиск")
+			fmt.Println("  --dry-run         Только план действий $cod/$diff (JSON), без записи и запуска")
 			fmt.Println("  -v, --version     Показать версию")
 			fmt.Println("  -h, --help        Показать эту справку")
 			fmt.Println()
@@ -131,6 +142,10 @@ func main() {
 		}
 	}
 
+	if dryRun && (guiMode || serverMode) {
+		fmt.Println("⚠️  --dry-run действует только в CLI; в веб-интерфейсе изменения подтверждаются вручную")
+	}
+
 	if guiMode {
         startGUI(provider, model, key, webSearchEnabled)
         return
@@ -144,9 +159,14 @@ func main() {
 		return
 	}
 
+	if dryRun {
+		fmt.Println("📝 Режим dry-run: файлы не записываются, команды не выполняются (план — в .cogitor/plans)")
+	}
+
 	if inputFile != "" {
 		// Автоматический режим
 		assistant := NewAssistant(provider, model, key, webSearchEnabled)
+		assistant.dryRun.SetForced(dryRun)
 		content, err := os.ReadFile(inputFile)
 		if err != nil {
 			fmt.Printf("❌ Ошибка чтения входного файла: %v\n", err)
@@ -156,11 +176,16 @@ func main() {
 		fmt.Printf("🤖 Выполнение задачи из файла: %s\n\n", inputFile)
 		autoExecute := config.GetBool("auto_execute")
 		assistant.ProcessQuery(task, autoExecute)
+		// Фоновые серверы из сгенерированного кода не переживают автоматический режим
+		if n := assistant.codeRunner.StopServers(); n > 0 {
+			fmt.Printf("🛑 Остановлено фоновых серверов: %d\n", n)
+		}
 		return
 	}
 
 	// Интерактивный режим
 	assistant := NewAssistant(provider, model, key, webSearchEnabled)
+	assistant.dryRun.SetForced(dryRun)
 	assistant.RunInteractive()
 }
 
@@ -180,6 +205,7 @@ func startServer(provider, model, apiKey string, webSearchEnabled bool, port str
 	
 	// Создаем ассистента
 	assistant := NewAssistant(provider, model, apiKey, webSearchEnabled)
+	assistant.codeRunner.noTerminal = true // ввод программам идет не из терминала, а из браузера
 	
 	// Создаем веб-сервер
 	server := NewWebServer(assistant, port)
@@ -196,6 +222,10 @@ func startServer(provider, model, apiKey string, webSearchEnabled bool, port str
 		fmt.Println("   Сервер будет работать, но без веб-интерфейса.")
 	}
 	
+	// Автосохранение: при Ctrl+C сессия закрывается штатно и не считается аварийной
+	assistant.startAutosave(false)
+	stopAutosaveOnSignal(assistant)
+	
 	// Запускаем сервер
 	fmt.Printf("🚀 Сервер запущен. Откройте http://localhost:%s в браузере\n", port)
 	fmt.Println("📡 Для остановки нажмите Ctrl+C")
@@ -203,6 +233,7 @@ func startServer(provider, model, apiKey string, webSearchEnabled bool, port str
 	if err := server.Start(); err != nil {
 		fmt.Printf("❌ Ошибка запуска сервера: %v\n", err)
 	}
+	assistant.stopAutosave()
 }
 
 func startGUI(provider, model, apiKey string, webSearchEnabled bool) {
@@ -211,6 +242,7 @@ func startGUI(provider, model, apiKey string, webSearchEnabled bool) {
     
     // 1. Запускаем сервер на случайном порту
     assistant := NewAssistant(provider, model, apiKey, webSearchEnabled)
+    assistant.codeRunner.noTerminal = true
     server := NewWebServer(assistant, "0") // "0" = случайный свободный порт
     
     // Получаем реальный порт сервера
@@ -236,8 +268,22 @@ func startGUI(provider, model, apiKey string, webSearchEnabled bool) {
     // 3. Даем серверу время запуститься
     time.Sleep(100 * time.Millisecond)
     
-    // 4. Запускаем webview
+    // 4. Запускаем webview; автосохранение закрывается вместе с окном
+    assistant.startAutosave(false)
+    stopAutosaveOnSignal(assistant)
     startWebView("127.0.0.1:" + port)
+    assistant.stopAutosave()
+}
+
+// stopAutosaveOnSignal штатно закрывает автосохранение при Ctrl+C в режимах без терминала
+func stopAutosaveOnSignal(assistant *Assistant) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		assistant.stopAutosave()
+		os.Exit(0)
+	}()
 }
 
 // Вспомогательная функция для запуска webview
@@ -0,0 +1,75 @@
+//go:build !windows
+
+// proc_unix.go
+// Группы процессов: запускаемая программа получает свою группу, чтобы Ctrl+C из
+// терминала не доходил до нее напрямую, а таймаут останавливал и все дочерние процессы
+
+package main
+
+import (
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// processAlive проверяет, жив ли процесс: сигнал 0 ничего не посылает, только проверяет PID
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// setProcessGroup запускает команду в новой группе процессов
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// terminateProcessGroup просит группу процессов завершиться (SIGTERM)
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	return signalProcessGroup(cmd, syscall.SIGTERM)
+}
+
+// killProcessGroup немедленно завершает группу процессов (SIGKILL)
+func killProcessGroup(cmd *exec.Cmd) error {
+	return signalProcessGroup(cmd, syscall.SIGKILL)
+}
+
+func signalProcessGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	if err := syscall.Kill(-cmd.Process.Pid, sig); err != nil {
+		return cmd.Process.Signal(sig)
+	}
+	return nil
+}
+
+// setForegroundGroup делает новую группу процессов команды активной группой терминала
+// stdin: программа читает ввод и получает Ctrl+C, а cogitor ждет в фоне. false — stdin
+// не терминал или cogitor сам не активная группа; тогда остается только новая группа
+func setForegroundGroup(cmd *exec.Cmd) bool {
+	setProcessGroup(cmd)
+	var pgrp int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, 0, uintptr(syscall.TIOCGPGRP), uintptr(unsafe.Pointer(&pgrp)))
+	if errno != 0 || int(pgrp) != syscall.Getpgrp() {
+		return false
+	}
+	cmd.SysProcAttr.Foreground = true
+	cmd.SysProcAttr.Ctty = 0 // stdin дочернего процесса
+	return true
+}
+
+// reclaimTerminal возвращает терминал группе процессов cogitor после setForegroundGroup.
+// Фоновая группа получила бы за это SIGTTOU — на время вызова он игнорируется
+func reclaimTerminal() {
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+	pgrp := int32(syscall.Getpgrp())
+	syscall.Syscall(syscall.SYS_IOCTL, 0, uintptr(syscall.TIOCSPGRP), uintptr(unsafe.Pointer(&pgrp)))
+}
@@ -0,0 +1,57 @@
+// proc_windows.go
+// Группы процессов в Windows: отдельная группа для запускаемой программы,
+// остановка — через завершение процесса
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// stillActive — код завершения еще работающего процесса
+const stillActive = 259
+
+// processAlive проверяет, жив ли процесс; процесс без прав на открытие считается живым
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	h, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return err == syscall.ERROR_ACCESS_DENIED
+	}
+	defer syscall.CloseHandle(h)
+	var code uint32
+	if err := syscall.GetExitCodeProcess(h, &code); err != nil {
+		return true
+	}
+	return code == stillActive
+}
+
+// setProcessGroup запускает команду в новой группе процессов
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
+
+// terminateProcessGroup в Windows завершает процесс сразу
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	return killProcessGroup(cmd)
+}
+
+// setForegroundGroup в Windows ничего не делает: групп терминала нет
+func setForegroundGroup(cmd *exec.Cmd) bool { return false }
+
+// reclaimTerminal в Windows ничего не делает
+func reclaimTerminal() {}
+
+// killProcessGroup завершает процесс
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,217 @@
+//go:build linux
+
+// pty_linux.go
+// Псевдотерминал для интерактивного запуска: программа получает настоящий терминал
+// (построчный ввод, Ctrl+C, размер окна), а весь обмен — и ввод, и вывод — попадает
+// в транскрипт, потому что терминал сам повторяет введенные символы
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// ptyStopKey — Ctrl+]: немедленно остановить программу (как в telnet)
+const ptyStopKey = 0x1d
+
+// runAttached запускает программу на псевдотерминале, связанном с терминалом
+// пользователя. Если PTY недоступен, stdin подключается напрямую. prepare собирает
+// команду (в песочнице) и узнает, получит ли программа PTY
+func runAttached(ctx context.Context, prepare func(pty bool) (*exec.Cmd, error), transcript io.Writer) error {
+	master, slave, err := openPTY()
+	if err != nil {
+		fmt.Printf("⚠️  Псевдотерминал недоступен (%v), ввод подключается напрямую\n", err)
+		return runPiped(ctx, prepare, transcript)
+	}
+	defer master.Close()
+
+	restore, err := makeRaw(os.Stdin)
+	if err != nil {
+		slave.Close()
+		fmt.Printf("⚠️  Не удалось перевести терминал в raw-режим (%v), ввод подключается напрямую\n", err)
+		return runPiped(ctx, prepare, transcript)
+	}
+	defer restore()
+
+	cmd, err := prepare(true)
+	if err != nil {
+		slave.Close()
+		return err
+	}
+	copyWindowSize(master)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	// свой сеанс с PTY в роли управляющего терминала: Ctrl+C и Ctrl+Z получает программа
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	cmd.SysProcAttr.Ctty = 0
+	cmd.SysProcAttr.Setpgid = false
+
+	printInteractiveHeader("Ctrl+D — конец ввода, Ctrl+] — остановить программу")
+	if err := cmd.Start(); err != nil {
+		slave.Close()
+		return err
+	}
+	slave.Close()
+
+	var stopped atomic.Bool
+	stopCancel := context.AfterFunc(ctx, func() { killProcessGroup(cmd) })
+	defer stopCancel()
+
+	done := make(chan struct{})
+	defer close(done)
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer signal.Stop(winch)
+	go func() {
+		for {
+			select {
+			case <-winch:
+				copyWindowSize(master)
+			case <-done:
+				return
+			}
+		}
+	}()
+	go pumpInput(master, done, func() {
+		stopped.Store(true)
+		killProcessGroup(cmd)
+	})
+
+	output := make(chan struct{})
+	go func() {
+		io.Copy(io.MultiWriter(os.Stdout, transcript), master)
+		close(output)
+	}()
+
+	err = cmd.Wait()
+	// фоновые потомки могут держать терминал открытым — дочитываем вывод не дольше секунды
+	master.SetReadDeadline(time.Now().Add(time.Second))
+	<-output
+
+	if stopped.Load() {
+		return errStoppedByUser
+	}
+	return err
+}
+
+// pumpInput передает нажатия клавиш в PTY, пока не закрыт done. stdin опрашивается
+// с таймаутом, чтобы после завершения программы не съесть следующий ввод пользователя
+func pumpInput(master *os.File, done <-chan struct{}, stop func()) {
+	buf := make([]byte, 1024)
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		var set syscall.FdSet
+		set.Bits[0] = 1 // fd 0
+		timeout := syscall.Timeval{Usec: 100000}
+		n, err := syscall.Select(1, &set, nil, nil, &timeout)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		if n == 0 {
+			continue
+		}
+		n, err = syscall.Read(0, buf)
+		if err != nil || n == 0 {
+			return
+		}
+		for _, b := range buf[:n] {
+			if b == ptyStopKey {
+				stop()
+				return
+			}
+		}
+		if _, err := master.Write(buf[:n]); err != nil {
+			return
+		}
+	}
+}
+
+// openPTY открывает пару master/slave псевдотерминала
+func openPTY() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	var unlock int32
+	if err := ioctl(master, syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	var n uint32
+	if err := ioctl(master, syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+// makeRaw переводит терминал в raw-режим (как cfmakeraw) и возвращает функцию
+// восстановления: эхо и обработку строк берет на себя PTY программы
+func makeRaw(f *os.File) (func(), error) {
+	var saved syscall.Termios
+	if err := ioctl(f, syscall.TCGETS, uintptr(unsafe.Pointer(&saved))); err != nil {
+		return nil, err
+	}
+	raw := saved
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Oflag &^= syscall.OPOST
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctl(f, syscall.TCSETS, uintptr(unsafe.Pointer(&raw))); err != nil {
+		return nil, err
+	}
+	return func() { ioctl(f, syscall.TCSETS, uintptr(unsafe.Pointer(&saved))) }, nil
+}
+
+// copyWindowSize передает размер окна терминала пользователя в PTY
+func copyWindowSize(master *os.File) {
+	var size [4]uint16 // struct winsize: строки, столбцы, пиксели по x и y
+	if ioctl(os.Stdin, syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&size))) == nil {
+		ioctl(master, syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&size)))
+	}
+}
+
+// ioctl выполняет запрос к файлу, не переводя его в блокирующий режим (в отличие от Fd)
+func ioctl(f *os.File, req, arg uintptr) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	if err := conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg)
+	}); err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
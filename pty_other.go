@@ -0,0 +1,17 @@
+//go:build !linux
+
+// pty_other.go
+// Вне Linux псевдотерминал не используется: stdin подключается к программе напрямую
+
+package main
+
+import (
+	"context"
+	"io"
+	"os/exec"
+)
+
+// runAttached подключает терминал пользователя к программе без PTY
+func runAttached(ctx context.Context, prepare func(pty bool) (*exec.Cmd, error), transcript io.Writer) error {
+	return runPiped(ctx, prepare, transcript)
+}
@@ -0,0 +1,258 @@
+// rag.go
+// Поиск по RAG-документам: документы режутся на перекрывающиеся фрагменты,
+// по фрагментам строится индекс BM25, и в контекст попадают только лучшие для запроса
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	RAGChunkSize    = 1500  // размер фрагмента в символах
+	RAGChunkOverlap = 200   // перекрытие соседних фрагментов
+	RAGTopK         = 8     // максимум фрагментов в контексте
+	RAGContextLimit = 15000 // общий бюджет RAG-контекста в символах
+
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// RAGChunk — фрагмент документа
+type RAGChunk struct {
+	DocID     int    // номер документа (с 1)
+	ChunkID   int    // номер фрагмента в документе (с 1)
+	FilePath  string
+	Text      string
+	StartLine int
+	EndLine   int
+	length    int            // число токенов
+	terms     map[string]int // частоты токенов
+}
+
+// Ref возвращает идентификатор фрагмента в виде [doc:chunk]
+func (c *RAGChunk) Ref() string {
+	return fmt.Sprintf("[%d:%d]", c.DocID, c.ChunkID)
+}
+
+// RAGIndex — индекс BM25 по фрагментам документов
+type RAGIndex struct {
+	chunks    []*RAGChunk
+	docFreq   map[string]int // в скольких фрагментах встречается токен
+	avgLength float64
+	vectors   [][]float32 // эмбеддинги фрагментов (nil — только BM25)
+}
+
+// RAGHit — найденный фрагмент с оценкой
+type RAGHit struct {
+	Chunk *RAGChunk
+	Score float64
+}
+
+// chunkDocument режет текст на фрагменты около size символов с перекрытием overlap.
+// Границы по возможности сдвигаются к концу строки или пробелу
+func chunkDocument(content string, size, overlap int) []RAGChunk {
+	runes := []rune(content)
+	if len(runes) == 0 {
+		return nil
+	}
+	if overlap >= size {
+		overlap = size / 4
+	}
+
+	var chunks []RAGChunk
+	start := 0
+	line := 1
+	for start < len(runes) {
+		end := start + size
+		if end >= len(runes) {
+			end = len(runes)
+		} else {
+			end = chunkBoundary(runes, start+size/2, end)
+		}
+
+		text := string(runes[start:end])
+		lines := strings.Count(text, "\n")
+		endLine := line + lines
+		if strings.HasSuffix(text, "\n") {
+			endLine--
+		}
+		if strings.TrimSpace(text) != "" {
+			chunks = append(chunks, RAGChunk{Text: text, StartLine: line, EndLine: endLine})
+		}
+		if end == len(runes) {
+			break
+		}
+
+		next := end - overlap
+		if next <= start {
+			next = end
+		}
+		// Начинаем следующий фрагмент с начала слова
+		for next < end && next > start && !isChunkSpace(runes[next-1]) {
+			next++
+		}
+		line += strings.Count(string(runes[start:next]), "\n")
+		start = next
+	}
+	return chunks
+}
+
+// chunkBoundary ищет с конца окна [min, end) перевод строки, затем пробел
+func chunkBoundary(runes []rune, min, end int) int {
+	for i := end; i > min; i-- {
+		if runes[i-1] == '\n' {
+			return i
+		}
+	}
+	for i := end; i > min; i-- {
+		if isChunkSpace(runes[i-1]) {
+			return i
+		}
+	}
+	return end
+}
+
+func isChunkSpace(r rune) bool {
+	return r == ' ' || r == '\n' || r == '\t' || r == '\r'
+}
+
+// BuildRAGIndex режет документы на фрагменты и строит индекс. Документы из skip (по DocID)
+// в индекс не входят: таблицы отвечают на запросы сами, а их строки заняли бы все места top-k
+func BuildRAGIndex(docs []RAGDocument, skip map[int]bool) *RAGIndex {
+	idx := &RAGIndex{docFreq: make(map[string]int)}
+	total := 0
+
+	for d, doc := range docs {
+		if skip[d+1] {
+			continue
+		}
+		for c, chunk := range chunkDocument(doc.Content, RAGChunkSize, RAGChunkOverlap) {
+			chunk := chunk
+			chunk.DocID = d + 1
+			chunk.ChunkID = c + 1
+			chunk.FilePath = doc.FilePath
+			// Имя файла тоже участвует в поиске
+			tokens := tokenize(filepath.Base(doc.FilePath) + " " + chunk.Text)
+			chunk.length = len(tokens)
+			chunk.terms = make(map[string]int)
+			for _, t := range tokens {
+				chunk.terms[t]++
+			}
+			for t := range chunk.terms {
+				idx.docFreq[t]++
+			}
+			total += chunk.length
+			idx.chunks = append(idx.chunks, &chunk)
+		}
+	}
+	if len(idx.chunks) > 0 {
+		idx.avgLength = float64(total) / float64(len(idx.chunks))
+	}
+	return idx
+}
+
+// ChunkCount возвращает число фрагментов в индексе
+func (idx *RAGIndex) ChunkCount() int {
+	if idx == nil {
+		return 0
+	}
+	return len(idx.chunks)
+}
+
+// HasVectors сообщает, есть ли у фрагментов эмбеддинги
+func (idx *RAGIndex) HasVectors() bool {
+	return idx != nil && idx.vectors != nil
+}
+
+// Search возвращает до k фрагментов с наибольшей оценкой. Если передан вектор запроса
+// и у фрагментов есть эмбеддинги, оценка гибридная: нормированный BM25 плюс косинус
+func (idx *RAGIndex) Search(query string, queryVector []float32, k int) []RAGHit {
+	if idx == nil || len(idx.chunks) == 0 {
+		return nil
+	}
+	terms := uniqueStrings(tokenize(query))
+	hybrid := queryVector != nil && idx.vectors != nil
+	if len(terms) == 0 && !hybrid {
+		return nil
+	}
+
+	n := float64(len(idx.chunks))
+	scores := make([]float64, len(idx.chunks))
+	maxScore := 0.0
+	for i, chunk := range idx.chunks {
+		score := 0.0
+		for _, t := range terms {
+			tf := float64(chunk.terms[t])
+			if tf == 0 {
+				continue
+			}
+			df := float64(idx.docFreq[t])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			norm := bm25K1 * (1 - bm25B + bm25B*float64(chunk.length)/idx.avgLength)
+			score += idf * tf * (bm25K1 + 1) / (tf + norm)
+		}
+		scores[i] = score
+		if score > maxScore {
+			maxScore = score
+		}
+	}
+
+	var hits []RAGHit
+	for i, chunk := range idx.chunks {
+		score := scores[i]
+		if hybrid {
+			if maxScore > 0 {
+				score /= maxScore
+			}
+			similarity := math.Max(0, cosineSimilarity(queryVector, idx.vectors[i]))
+			score = ragHybridWeight*score + (1-ragHybridWeight)*similarity
+		}
+		if score > 0 {
+			hits = append(hits, RAGHit{Chunk: chunk, Score: score})
+		}
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].Score > hits[j].Score
+	})
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+	return hits
+}
+
+// Retrieve выбирает лучшие фрагменты, помещающиеся в бюджет символов.
+// Если по запросу ничего не нашлось, берутся первые фрагменты документов,
+// чтобы модель все равно видела данные
+func (idx *RAGIndex) Retrieve(query string, queryVector []float32, k, budget int) []RAGHit {
+	hits := idx.Search(query, queryVector, k)
+	if len(hits) == 0 && idx != nil {
+		seen := make(map[int]bool)
+		for _, chunk := range idx.chunks {
+			if !seen[chunk.DocID] {
+				seen[chunk.DocID] = true
+				hits = append(hits, RAGHit{Chunk: chunk})
+			}
+			if len(hits) >= k {
+				break
+			}
+		}
+	}
+
+	var selected []RAGHit
+	used := 0
+	for _, hit := range hits {
+		size := len(hit.Chunk.Text)
+		if used+size > budget {
+			continue // более короткий фрагмент может еще поместиться
+		}
+		used += size
+		selected = append(selected, hit)
+	}
+	return selected
+}
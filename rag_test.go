@@ -0,0 +1,126 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChunkDocument(t *testing.T) {
+	type chunk struct {
+		text       string
+		start, end int
+	}
+	tests := []struct {
+		name          string
+		content       string
+		size, overlap int
+		want          []chunk
+	}{
+		{
+			name:    "пустой документ",
+			content: "",
+			size:    10,
+			want:    nil,
+		},
+		{
+			name:    "только пробелы",
+			content: " \n\n ",
+			size:    10,
+			want:    nil,
+		},
+		{
+			name:    "короче фрагмента",
+			content: "abc",
+			size:    10,
+			want:    []chunk{{"abc", 1, 1}},
+		},
+		{
+			name:    "граница по переводу строки без перекрытия",
+			content: "aaaa\nbbbb\ncccc\ndddd\n",
+			size:    10,
+			want:    []chunk{{"aaaa\nbbbb\n", 1, 2}, {"cccc\ndddd\n", 3, 4}},
+		},
+		{
+			name:    "перекрытие сдвигает начало на строку назад",
+			content: "aaaa\nbbbb\ncccc\ndddd\n",
+			size:    10,
+			overlap: 5,
+			want:    []chunk{{"aaaa\nbbbb\n", 1, 2}, {"bbbb\ncccc\n", 2, 3}, {"cccc\ndddd\n", 3, 4}},
+		},
+		{
+			name:    "граница по пробелу, перекрытие не режет слово",
+			content: "alpha beta gamma delta",
+			size:    12,
+			overlap: 4,
+			want:    []chunk{{"alpha beta ", 1, 1}, {"gamma delta", 1, 1}},
+		},
+		{
+			name:    "без пробелов режется по размеру",
+			content: "абвгдежзий",
+			size:    4,
+			want:    []chunk{{"абвг", 1, 1}, {"дежз", 1, 1}, {"ий", 1, 1}},
+		},
+		{
+			name:    "перекрытие не меньше размера уменьшается до четверти",
+			content: "aaa bbb ccc ddd",
+			size:    8,
+			overlap: 8,
+			want:    []chunk{{"aaa bbb ", 1, 1}, {"ccc ddd", 1, 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []chunk
+			for _, c := range chunkDocument(tt.content, tt.size, tt.overlap) {
+				got = append(got, chunk{c.Text, c.StartLine, c.EndLine})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("получено %q, ожидалось %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChunkDocumentCoversText(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 200; i++ {
+		b.WriteString("строка номер ")
+		b.WriteString(strings.Repeat("х", i%17))
+		b.WriteString("\n")
+	}
+	content := b.String()
+	lines := strings.Split(content, "\n")
+
+	chunks := chunkDocument(content, 300, 60)
+	if len(chunks) < 2 {
+		t.Fatalf("ожидалось несколько фрагментов, получено %d", len(chunks))
+	}
+	covered := 0
+	for i, c := range chunks {
+		if n := len([]rune(c.Text)); n > 300 {
+			t.Errorf("фрагмент %d длиннее размера: %d", i, n)
+		}
+		if !strings.HasSuffix(c.Text, "\n") && i < len(chunks)-1 {
+			t.Errorf("фрагмент %d не закончен на границе строки: %q", i, c.Text)
+		}
+		// Номера строк соответствуют тексту фрагмента (перекрытие может начаться с середины строки)
+		want := strings.Join(lines[c.StartLine-1:c.EndLine], "\n") + "\n"
+		if !strings.HasSuffix(want, c.Text) || len(want)-len(c.Text) >= len(lines[c.StartLine-1]) {
+			t.Errorf("фрагмент %d: строки %d-%d не совпадают с текстом", i, c.StartLine, c.EndLine)
+		}
+		if i > 0 {
+			prev := chunks[i-1]
+			if c.StartLine > prev.EndLine {
+				t.Errorf("между фрагментами %d и %d нет перекрытия: %d > %d", i-1, i, c.StartLine, prev.EndLine)
+			}
+			if c.StartLine <= prev.StartLine {
+				t.Errorf("фрагмент %d не продвинулся: строка %d", i, c.StartLine)
+			}
+		}
+		covered = c.EndLine
+	}
+	if covered != len(lines)-1 {
+		t.Errorf("фрагменты покрывают %d строк из %d", covered, len(lines)-1)
+	}
+}
@@ -0,0 +1,376 @@
+// ragloader.go
+// Загрузка RAG-документов из директорий: рекурсивный обход, фильтры --include/--exclude,
+// правила .gitignore и .cogitorignore, ограничение размера файла, zip-архивы
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	DefaultRAGMaxFileKB = 1024      // ограничение размера файла по умолчанию
+	ragZipMaxTotal      = 200 << 20 // предел распакованного объема zip-архива
+	ragTableSizeFactor  = 32        // во сколько раз лимит для CSV/TSV выше rag_max_file_kb
+)
+
+// RAGLoadOptions — параметры загрузки директории
+type RAGLoadOptions struct {
+	Recursive   bool
+	Include     []string // glob-шаблоны: загружаются только совпавшие файлы
+	Exclude     []string // glob-шаблоны исключений
+	MaxFileSize int64    // байт, 0 — без ограничения
+	Replace     bool     // заменить документы коллекции вместо добавления
+}
+
+// RAGSkipped — пропущенный файл и причина
+type RAGSkipped struct {
+	Path   string
+	Reason string
+}
+
+// ignoreRule — правило из .gitignore / .cogitorignore
+type ignoreRule struct {
+	base    string // директория файла правил относительно корня ("" — корень)
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// parseRAGDataArgs разбирает аргументы :data: путь и флаги
+func parseRAGDataArgs(args []string) (string, RAGLoadOptions, error) {
+	var opts RAGLoadOptions
+	var target string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch arg {
+		case "--recursive", "-r":
+			opts.Recursive = true
+		case "--replace":
+			opts.Replace = true
+		case "--include", "--exclude":
+			if i+1 >= len(args) {
+				return "", opts, fmt.Errorf("%s требует шаблон", arg)
+			}
+			i++
+			pattern := strings.Trim(args[i], "'\"")
+			if arg == "--include" {
+				opts.Include = append(opts.Include, pattern)
+			} else {
+				opts.Exclude = append(opts.Exclude, pattern)
+			}
+		default:
+			if strings.HasPrefix(arg, "--") {
+				return "", opts, fmt.Errorf("неизвестный флаг: %s", arg)
+			}
+			if target != "" {
+				return "", opts, fmt.Errorf("указано несколько путей: %s и %s", target, arg)
+			}
+			target = arg
+		}
+	}
+	if target == "" {
+		return "", opts, fmt.Errorf("не указан путь")
+	}
+	return target, opts, nil
+}
+
+// globToRegexp переводит glob в регулярное выражение: * и ? не пересекают '/', ** — любые директории
+func globToRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?") // **/ — ноль или больше директорий
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// matchGlob проверяет относительный путь (через '/') по шаблону.
+// Шаблон без '/' сравнивается с именем файла на любом уровне
+func matchGlob(pattern, rel string) bool {
+	pattern = strings.TrimPrefix(pattern, "./")
+	target := rel
+	if !strings.Contains(pattern, "/") {
+		target = path.Base(rel)
+	}
+	re, err := globToRegexp(pattern)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(target)
+}
+
+// matchAnyGlob проверяет путь по шаблонам; шаблон директории ("drafts/**", "drafts/")
+// исключает и саму директорию
+func matchAnyGlob(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		if matchGlob(p, rel) || matchGlob(strings.TrimSuffix(p, "/"), rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadIgnoreRules читает .gitignore и .cogitorignore директории dir (base — её путь от корня)
+func loadIgnoreRules(dir, base string) []ignoreRule {
+	var rules []ignoreRule
+	for _, name := range []string{".gitignore", ".cogitorignore"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimRight(line, "\r")
+			if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			line = strings.TrimRight(line, " ")
+			rule := ignoreRule{base: base}
+			if strings.HasPrefix(line, "!") {
+				rule.negate = true
+				line = line[1:]
+			}
+			if strings.HasSuffix(line, "/") {
+				rule.dirOnly = true
+				line = strings.TrimSuffix(line, "/")
+			}
+			// Шаблон со '/' в начале или середине привязан к директории файла правил
+			anchored := strings.Contains(line, "/")
+			line = strings.TrimPrefix(line, "/")
+			if !anchored {
+				line = "**/" + line
+			}
+			re, err := globToRegexp(line)
+			if err != nil {
+				continue
+			}
+			rule.re = re
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// ignored применяет правила по порядку: последнее совпавшее решает
+func ignored(rules []ignoreRule, rel string, isDir bool) bool {
+	result := false
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		target := rel
+		if rule.base != "" {
+			if !strings.HasPrefix(rel, rule.base+"/") {
+				continue
+			}
+			target = strings.TrimPrefix(rel, rule.base+"/")
+		}
+		if rule.re.MatchString(target) {
+			result = !rule.negate
+		}
+	}
+	return result
+}
+
+// CollectRAGFiles собирает файлы директории для загрузки с учетом параметров и правил игнорирования
+func CollectRAGFiles(root string, opts RAGLoadOptions) ([]string, []RAGSkipped, error) {
+	var files []string
+	var skipped []RAGSkipped
+	rulesByDir := map[string][]ignoreRule{"": loadIgnoreRules(root, "")}
+
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			skipped = append(skipped, RAGSkipped{p, err.Error()})
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if p == root {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, p)
+		rel = filepath.ToSlash(rel)
+		parent := path.Dir(rel)
+		if parent == "." {
+			parent = ""
+		}
+		rules := rulesByDir[parent]
+
+		if d.IsDir() {
+			if d.Name() == ".git" || !opts.Recursive {
+				return fs.SkipDir
+			}
+			if ignored(rules, rel, true) || matchAnyGlob(opts.Exclude, rel) {
+				return fs.SkipDir
+			}
+			rulesByDir[rel] = append(append([]ignoreRule(nil), rules...), loadIgnoreRules(p, rel)...)
+			return nil
+		}
+
+		if !d.Type().IsRegular() || !isSupportedRAGFile(p) {
+			return nil
+		}
+		if ignored(rules, rel, false) {
+			return nil
+		}
+		if matchAnyGlob(opts.Exclude, rel) {
+			return nil
+		}
+		if len(opts.Include) > 0 && !matchAnyGlob(opts.Include, rel) {
+			return nil
+		}
+		if limit := ragFileSizeLimit(p, opts.MaxFileSize); limit > 0 {
+			if info, err := d.Info(); err == nil && info.Size() > limit {
+				skipped = append(skipped, RAGSkipped{p, fmt.Sprintf("размер %d КБ больше лимита %d КБ",
+					(info.Size()+1023)/1024, limit/1024)})
+				return nil
+			}
+		}
+		files = append(files, p)
+		return nil
+	})
+	return files, skipped, err
+}
+
+// LoadRAGFiles извлекает текст из файлов, показывая прогресс
+func LoadRAGFiles(paths []string, maxFileSize int64, showProgress bool) ([]RAGDocument, []RAGSkipped) {
+	var docs []RAGDocument
+	var skipped []RAGSkipped
+	for i, p := range paths {
+		if showProgress {
+			name := filepath.Base(p)
+			if len([]rune(name)) > 40 {
+				name = string([]rune(name)[:37]) + "..."
+			}
+			fmt.Printf("\r\033[K📥 Загрузка %d/%d: %s", i+1, len(paths), name)
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			skipped = append(skipped, RAGSkipped{p, err.Error()})
+			continue
+		}
+		doc, err := ExtractRAGDocument(p, data, maxFileSize)
+		if err != nil {
+			skipped = append(skipped, RAGSkipped{p, err.Error()})
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	if showProgress && len(paths) > 0 {
+		fmt.Print("\r\033[K")
+	}
+	return docs, skipped
+}
+
+// ExtractRAGZip извлекает поддерживаемые файлы из zip-архива
+func ExtractRAGZip(name string, data []byte, maxFileSize int64) ([]RAGDocument, []RAGSkipped, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("неверный zip-архив: %v", err)
+	}
+
+	var docs []RAGDocument
+	var skipped []RAGSkipped
+	var total int64
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() || !isSupportedRAGFile(f.Name) {
+			continue
+		}
+		entry := name + "/" + f.Name
+		if !filepath.IsLocal(f.Name) || strings.Contains(f.Name, "__MACOSX/") {
+			skipped = append(skipped, RAGSkipped{entry, "недопустимый путь в архиве"})
+			continue
+		}
+		size := int64(f.UncompressedSize64)
+		if limit := ragFileSizeLimit(f.Name, maxFileSize); limit > 0 && size > limit {
+			skipped = append(skipped, RAGSkipped{entry, fmt.Sprintf("размер %d КБ больше лимита", size/1024)})
+			continue
+		}
+		if total+size > ragZipMaxTotal {
+			return docs, skipped, fmt.Errorf("распакованный объем архива больше %d МБ", ragZipMaxTotal>>20)
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			skipped = append(skipped, RAGSkipped{entry, err.Error()})
+			continue
+		}
+		// Читаем не больше заявленного размера: заголовок архива может лгать
+		content, err := io.ReadAll(io.LimitReader(rc, size+1))
+		rc.Close()
+		if err != nil || int64(len(content)) > size {
+			skipped = append(skipped, RAGSkipped{entry, "поврежденная запись архива"})
+			continue
+		}
+		total += int64(len(content))
+
+		doc, err := ExtractRAGDocument(entry, content, maxFileSize)
+		if err != nil {
+			skipped = append(skipped, RAGSkipped{entry, err.Error()})
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	return docs, skipped, nil
+}
+
+// ragFileSizeLimit возвращает лимит размера для конкретного файла. CSV и TSV разбираются в таблицы
+// для :query, где десятки тысяч строк — обычный объем, поэтому лимит для них выше
+func ragFileSizeLimit(path string, maxFileSize int64) int64 {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv", ".tsv":
+		return maxFileSize * ragTableSizeFactor
+	}
+	return maxFileSize
+}
+
+// ragMaxFileSize возвращает ограничение размера файла из конфигурации, в байтах
+func ragMaxFileSize(config *Config) int64 {
+	return int64(config.GetInt("rag_max_file_kb", DefaultRAGMaxFileKB)) * 1024
+}
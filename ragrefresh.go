@@ -0,0 +1,339 @@
+// ragrefresh.go
+// Инкрементальное обновление RAG-коллекций: по хешам содержимого заново извлекаются
+// только измененные и новые файлы, удаленные — убираются. Слежение за файлами — опрос
+// по размеру и времени изменения, без внешних зависимостей
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const DefaultRAGWatchInterval = 5 // секунд между проверками при :data watch
+
+// RAGRefreshReport — результат обновления коллекции
+type RAGRefreshReport struct {
+	Collection string       `json:"collection"`
+	Added      []string     `json:"added"`
+	Changed    []string     `json:"changed"`
+	Removed    []string     `json:"removed"`
+	Unchanged  int          `json:"unchanged"`
+	Skipped    []RAGSkipped `json:"skipped"`
+}
+
+// HasChanges сообщает, изменился ли состав документов
+func (r RAGRefreshReport) HasChanges() bool {
+	return len(r.Added)+len(r.Changed)+len(r.Removed) > 0
+}
+
+// String кратко описывает изменения
+func (r RAGRefreshReport) String() string {
+	return fmt.Sprintf("'%s': новых %d, изменено %d, удалено %d, без изменений %d",
+		r.Collection, len(r.Added), len(r.Changed), len(r.Removed), r.Unchanged)
+}
+
+// fileHash возвращает sha256 содержимого файла
+func fileHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// options возвращает параметры обхода источника
+func (src RAGLoadSource) options(maxFileSize int64) RAGLoadOptions {
+	return RAGLoadOptions{
+		Recursive:   src.Recursive,
+		Include:     src.Include,
+		Exclude:     src.Exclude,
+		MaxFileSize: maxFileSize,
+	}
+}
+
+// covers сообщает, относится ли файл к источнику
+func (src RAGLoadSource) covers(path string) bool {
+	return path == src.Path || strings.HasPrefix(path, src.Path+string(filepath.Separator))
+}
+
+// sourceFiles перечисляет файлы, которые сейчас дают источники коллекции
+func (c *RAGCollection) sourceFiles(maxFileSize int64) ([]string, []RAGSkipped) {
+	var files []string
+	var skipped []RAGSkipped
+	seen := make(map[string]bool)
+	for _, src := range c.Sources {
+		info, err := os.Stat(src.Path)
+		if err != nil {
+			continue // источник удален: его документы уйдут из коллекции
+		}
+		var found []string
+		if info.IsDir() {
+			var sk []RAGSkipped
+			found, sk, err = CollectRAGFiles(src.Path, src.options(maxFileSize))
+			if err != nil {
+				skipped = append(skipped, RAGSkipped{src.Path, err.Error()})
+			}
+			skipped = append(skipped, sk...)
+		} else {
+			found = []string{src.Path}
+		}
+		for _, f := range found {
+			if !seen[f] {
+				seen[f] = true
+				files = append(files, f)
+			}
+		}
+	}
+	return files, skipped
+}
+
+// Refresh сверяет документы коллекции с файлами на диске. Документы, загруженные через
+// веб-интерфейс (без локального пути), не трогаются
+func (c *RAGCollection) Refresh(maxFileSize int64) RAGRefreshReport {
+	report := RAGRefreshReport{Collection: c.Name}
+	files, skipped := c.sourceFiles(maxFileSize)
+	report.Skipped = skipped
+
+	current := make(map[string]bool, len(files))
+	for _, f := range files {
+		current[f] = true
+	}
+	covered := func(path string) bool {
+		for _, src := range c.Sources {
+			if src.covers(path) {
+				return true
+			}
+		}
+		return false
+	}
+
+	known := make(map[string]bool, len(c.Documents))
+	var docs []RAGDocument
+	for _, doc := range c.Documents {
+		known[doc.FilePath] = true
+		if !filepath.IsAbs(doc.FilePath) {
+			docs = append(docs, doc)
+			continue
+		}
+		// Файл пропал или больше не проходит фильтры источника
+		if covered(doc.FilePath) && !current[doc.FilePath] {
+			report.Removed = append(report.Removed, doc.FilePath)
+			continue
+		}
+		data, err := os.ReadFile(doc.FilePath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				report.Removed = append(report.Removed, doc.FilePath)
+			} else {
+				report.Skipped = append(report.Skipped, RAGSkipped{doc.FilePath, err.Error()})
+				docs = append(docs, doc)
+			}
+			continue
+		}
+		if fileHash(data) == doc.Hash {
+			report.Unchanged++
+			docs = append(docs, doc)
+			continue
+		}
+		updated, err := ExtractRAGDocument(doc.FilePath, data, maxFileSize)
+		if err != nil {
+			report.Skipped = append(report.Skipped, RAGSkipped{doc.FilePath, err.Error()})
+			docs = append(docs, doc)
+			continue
+		}
+		updated.Collection = c.Name
+		report.Changed = append(report.Changed, doc.FilePath)
+		docs = append(docs, updated)
+	}
+
+	var added []string
+	for _, f := range files {
+		if !known[f] {
+			added = append(added, f)
+		}
+	}
+	newDocs, failed := LoadRAGFiles(added, maxFileSize, false)
+	report.Skipped = append(report.Skipped, failed...)
+	for _, doc := range newDocs {
+		doc.Collection = c.Name
+		report.Added = append(report.Added, doc.FilePath)
+		docs = append(docs, doc)
+	}
+
+	c.Documents = docs
+	return report
+}
+
+// sourceFingerprint — дешевый отпечаток файлов коллекции (размеры и время изменения)
+// для обнаружения изменений без чтения содержимого
+func (c *RAGCollection) sourceFingerprint(maxFileSize int64) string {
+	files, _ := c.sourceFiles(maxFileSize)
+	listed := make(map[string]bool, len(files))
+	for _, f := range files {
+		listed[f] = true
+	}
+	for _, doc := range c.Documents {
+		if filepath.IsAbs(doc.FilePath) && !listed[doc.FilePath] {
+			files = append(files, doc.FilePath)
+		}
+	}
+	sort.Strings(files)
+
+	h := sha256.New()
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil {
+			fmt.Fprintf(h, "%s\x00%d\x00%d\n", f, info.Size(), info.ModTime().UnixNano())
+		} else {
+			fmt.Fprintf(h, "%s\x00-\n", f)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// RefreshRAGCollections обновляет коллекции (по умолчанию — активные) и перестраивает индекс,
+// если что-то изменилось. Эмбеддинги неизменных фрагментов берутся из кеша
+func (a *Assistant) RefreshRAGCollections(names []string) ([]RAGRefreshReport, error) {
+	a.ragRefreshMu.Lock()
+	defer a.ragRefreshMu.Unlock()
+
+	active := a.ActiveRAGCollections()
+	if len(names) == 0 {
+		names = active
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("нет активных коллекций (:data use <имя>)")
+	}
+
+	maxSize := ragMaxFileSize(a.GetConfig())
+	var reports []RAGRefreshReport
+	reload := false
+	for _, name := range names {
+		c, err := LoadRAGCollection(name)
+		if err != nil {
+			return reports, err
+		}
+		report := c.Refresh(maxSize)
+		if report.HasChanges() {
+			if err := c.Save(); err != nil {
+				return reports, fmt.Errorf("не удалось сохранить коллекцию '%s': %v", name, err)
+			}
+			if containsString(active, name) {
+				reload = true
+			}
+		}
+		reports = append(reports, report)
+	}
+
+	if reload {
+		if err := a.UseRAGCollections(active); err != nil {
+			return reports, err
+		}
+	}
+	return reports, nil
+}
+
+// ragWatchInterval возвращает интервал опроса из конфигурации
+func ragWatchInterval(config *Config) time.Duration {
+	return time.Duration(config.GetInt("rag_watch_interval", DefaultRAGWatchInterval)) * time.Second
+}
+
+// RAGWatcher периодически проверяет файлы активных коллекций и обновляет их при изменениях
+type RAGWatcher struct {
+	assistant *Assistant
+	interval  time.Duration
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// StartRAGWatch запускает слежение за файлами активных коллекций
+func (a *Assistant) StartRAGWatch(interval time.Duration) {
+	a.StopRAGWatch()
+	w := &RAGWatcher{
+		assistant: a,
+		interval:  interval,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	a.ragMutex.Lock()
+	a.ragWatcher = w
+	a.ragMutex.Unlock()
+	go w.run()
+}
+
+// StopRAGWatch останавливает слежение
+func (a *Assistant) StopRAGWatch() {
+	a.ragMutex.Lock()
+	w := a.ragWatcher
+	a.ragWatcher = nil
+	a.ragMutex.Unlock()
+	if w != nil {
+		close(w.stop)
+		<-w.done
+	}
+}
+
+// IsRAGWatching сообщает, включено ли слежение
+func (a *Assistant) IsRAGWatching() bool {
+	a.ragMutex.RLock()
+	defer a.ragMutex.RUnlock()
+	return a.ragWatcher != nil
+}
+
+func (w *RAGWatcher) run() {
+	defer close(w.done)
+	fingerprints := w.fingerprints()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+
+		current := w.fingerprints()
+		var changed []string
+		for name, fp := range current {
+			if old, ok := fingerprints[name]; ok && old != fp {
+				changed = append(changed, name)
+			}
+		}
+		fingerprints = current
+		if len(changed) == 0 {
+			continue
+		}
+
+		sort.Strings(changed)
+		reports, err := w.assistant.RefreshRAGCollections(changed)
+		if err != nil {
+			fmt.Printf("\n⚠️  RAG: ошибка обновления: %v\n", err)
+			continue
+		}
+		for _, r := range reports {
+			if r.HasChanges() {
+				fmt.Printf("\n🔄 RAG: коллекция %s\n", r)
+			}
+		}
+		// Обновление само меняет коллекции: отпечатки берем заново
+		fingerprints = w.fingerprints()
+	}
+}
+
+// fingerprints вычисляет отпечатки файлов активных коллекций
+func (w *RAGWatcher) fingerprints() map[string]string {
+	maxSize := ragMaxFileSize(w.assistant.GetConfig())
+	result := make(map[string]string)
+	for _, name := range w.assistant.ActiveRAGCollections() {
+		c, err := LoadRAGCollection(name)
+		if err != nil {
+			continue
+		}
+		result[name] = c.sourceFingerprint(maxSize)
+	}
+	return result
+}
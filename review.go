@@ -0,0 +1,405 @@
+// review.go
+// Просмотр изменений перед записью сгенерированного кода: unified diff с текущим
+// содержимым файла и решение по каждому файлу — принять, отклонить, отредактировать
+// в $EDITOR или принять все оставшиеся
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	diffContextLines = 3
+	diffMaxCells     = 4000000 // предел таблицы LCS; больше — файл показывается как полная замена
+	reviewMaxLines   = 300     // строк диффа в терминале
+)
+
+// FileChange — предлагаемое изменение файла
+type FileChange struct {
+	Path       string  `json:"path"`
+	OldContent string  `json:"old_content,omitempty"`
+	Content    string  `json:"content"`
+	IsNew      bool    `json:"new_file"`
+	Diff       string  `json:"diff"`
+	Added      int     `json:"added"`
+	Removed    int     `json:"removed"`
+	Format     string  `json:"format,omitempty"`
+	Confidence float64 `json:"confidence,omitempty"`
+
+	file CodeFile
+}
+
+// NewFileChange сравнивает сгенерированный файл с содержимым на диске
+func NewFileChange(f CodeFile) FileChange {
+	change := FileChange{
+		Path:       f.Path,
+		Content:    f.Content,
+		Format:     f.Format,
+		Confidence: f.Confidence,
+		file:       f,
+	}
+	old, err := os.ReadFile(f.Path)
+	if err != nil {
+		change.IsNew = true
+	} else {
+		change.OldContent = string(old)
+	}
+
+	oldName, newName := "a/"+f.Path, "b/"+f.Path
+	if filepath.IsAbs(f.Path) {
+		oldName, newName = f.Path, f.Path
+	}
+	if change.IsNew {
+		oldName = "/dev/null"
+	}
+	change.Diff, change.Added, change.Removed = UnifiedDiff(oldName, newName, change.OldContent, f.Content)
+	return change
+}
+
+// Unchanged сообщает, что файл уже содержит этот код (без учета конечных переводов строк)
+func (c FileChange) Unchanged() bool {
+	return !c.IsNew && strings.TrimRight(c.OldContent, "\n") == strings.TrimRight(c.Content, "\n")
+}
+
+// CodeFile возвращает файл для записи с текущим (возможно, отредактированным) содержимым
+func (c FileChange) CodeFile() CodeFile {
+	f := c.file
+	f.Path = c.Path
+	f.Content = c.Content
+	return f
+}
+
+// Summary — краткое описание изменения
+func (c FileChange) Summary() string {
+	if c.IsNew {
+		return fmt.Sprintf("новый файл, %d строк", c.Added)
+	}
+	return fmt.Sprintf("+%d -%d", c.Added, c.Removed)
+}
+
+type diffOp struct {
+	kind byte // ' ', '-', '+'
+	line string
+}
+
+func splitDiffLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(strings.ReplaceAll(s, "\r\n", "\n"), "\n"), "\n")
+}
+
+// diffLines строит построчный дифф через наибольшую общую подпоследовательность
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	n, m := len(ma), len(mb)
+
+	if n*m > diffMaxCells {
+		for _, line := range ma {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range mb {
+			ops = append(ops, diffOp{'+', line})
+		}
+	} else {
+		// lcs[i*(m+1)+j] — длина НОП для ma[i:] и mb[j:]
+		lcs := make([]int, (n+1)*(m+1))
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if ma[i] == mb[j] {
+					lcs[i*(m+1)+j] = lcs[(i+1)*(m+1)+j+1] + 1
+				} else if lcs[(i+1)*(m+1)+j] >= lcs[i*(m+1)+j+1] {
+					lcs[i*(m+1)+j] = lcs[(i+1)*(m+1)+j]
+				} else {
+					lcs[i*(m+1)+j] = lcs[i*(m+1)+j+1]
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < n && j < m {
+			switch {
+			case ma[i] == mb[j]:
+				ops = append(ops, diffOp{' ', ma[i]})
+				i++
+				j++
+			case lcs[(i+1)*(m+1)+j] >= lcs[i*(m+1)+j+1]:
+				ops = append(ops, diffOp{'-', ma[i]})
+				i++
+			default:
+				ops = append(ops, diffOp{'+', mb[j]})
+				j++
+			}
+		}
+		for ; i < n; i++ {
+			ops = append(ops, diffOp{'-', ma[i]})
+		}
+		for ; j < m; j++ {
+			ops = append(ops, diffOp{'+', mb[j]})
+		}
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// UnifiedDiff формирует дифф в формате diff -u и считает добавленные и удаленные строки
+func UnifiedDiff(oldName, newName, oldText, newText string) (string, int, int) {
+	ops := diffLines(splitDiffLines(oldText), splitDiffLines(newText))
+
+	var changes []int
+	added, removed := 0, 0
+	for i, op := range ops {
+		switch op.kind {
+		case '+':
+			added++
+			changes = append(changes, i)
+		case '-':
+			removed++
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return "", 0, 0
+	}
+
+	// Номера строк перед каждой операцией
+	oldLine := make([]int, len(ops)+1)
+	newLine := make([]int, len(ops)+1)
+	for i, op := range ops {
+		oldLine[i+1], newLine[i+1] = oldLine[i], newLine[i]
+		if op.kind != '+' {
+			oldLine[i+1]++
+		}
+		if op.kind != '-' {
+			newLine[i+1]++
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("--- " + oldName + "\n")
+	b.WriteString("+++ " + newName + "\n")
+	for k := 0; k < len(changes); {
+		start := changes[k] - diffContextLines
+		if start < 0 {
+			start = 0
+		}
+		end := changes[k]
+		for k < len(changes) && changes[k] <= end+2*diffContextLines {
+			end = changes[k]
+			k++
+		}
+		end += diffContextLines + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		oldLen := oldLine[end] - oldLine[start]
+		newLen := newLine[end] - newLine[start]
+		oldStart, newStart := oldLine[start], newLine[start]
+		if oldLen > 0 {
+			oldStart++
+		}
+		if newLen > 0 {
+			newStart++
+		}
+		b.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", oldStart, oldLen, newStart, newLen))
+		for _, op := range ops[start:end] {
+			b.WriteByte(op.kind)
+			b.WriteString(op.line)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String(), added, removed
+}
+
+// colorizeDiff раскрашивает дифф для терминала
+func colorizeDiff(diff string) string {
+	if runtime.GOOS == "windows" {
+		return diff
+	}
+	var b strings.Builder
+	inHunk := false // "---"/"+++" внутри блока — удаленные/добавленные строки, а не заголовок
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		color := ""
+		switch {
+		case !inHunk && (strings.HasPrefix(line, "+++") || strings.HasPrefix(line, "---")):
+			color = "1"
+		case strings.HasPrefix(line, "@@"):
+			inHunk = true
+			color = "36"
+		case strings.HasPrefix(line, "+"):
+			color = "32"
+		case strings.HasPrefix(line, "-"):
+			color = "31"
+		}
+		if color == "" {
+			b.WriteString(line)
+			continue
+		}
+		b.WriteString("\033[" + color + "m" + strings.TrimSuffix(line, "\n") + "\033[0m")
+		if strings.HasSuffix(line, "\n") {
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// printFileChange выводит заголовок и дифф файла
+func printFileChange(n, total int, c FileChange) {
+	fmt.Printf("\n📄 [%d/%d] %s (%s)\n", n, total, c.Path, c.Summary())
+	lines := strings.SplitAfter(c.Diff, "\n")
+	if len(lines) > reviewMaxLines {
+		fmt.Print(colorizeDiff(strings.Join(lines[:reviewMaxLines], "")))
+		fmt.Printf("... ещё %d строк диффа (e — открыть файл в редакторе)\n", len(lines)-reviewMaxLines)
+		return
+	}
+	fmt.Print(colorizeDiff(c.Diff))
+}
+
+// ReviewCodeFiles показывает дифф каждого файла и спрашивает, записывать ли его.
+// Возвращает принятые файлы (с правками из редактора) и файлы без изменений с пометкой
+// SkipWrite: они не записываются, но нужны для анализа и запуска проекта
+func ReviewCodeFiles(files []CodeFile, tr *TerminalReader) []CodeFile {
+	if tr == nil {
+		return files
+	}
+	fmt.Println("🔍 Просмотр изменений: y — принять, n — отклонить, e — редактировать, a — принять все, q — отклонить остальные")
+
+	var accepted []CodeFile
+	unchanged := func(f CodeFile) bool {
+		if NewFileChange(f).Unchanged() {
+			f.SkipWrite = true
+			accepted = append(accepted, f)
+			return true
+		}
+		return false
+	}
+	acceptAll := false
+	for i, f := range files {
+		change := NewFileChange(f)
+		if unchanged(f) {
+			fmt.Printf("⏭️  %s: без изменений\n", f.Path)
+			continue
+		}
+		if acceptAll {
+			fmt.Printf("✅ %s (%s)\n", change.Path, change.Summary())
+			accepted = append(accepted, change.CodeFile())
+			continue
+		}
+
+	ask:
+		for {
+			printFileChange(i+1, len(files), change)
+			answer, err := tr.ReadLineWithPrompt("Записать файл? [y/n/e/a/q]: ")
+			if err != nil {
+				answer = "q" // Ctrl+C / EOF — отклоняем оставшиеся
+			}
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "y", "д", "yes":
+				accepted = append(accepted, change.CodeFile())
+				break ask
+			case "n", "н", "no":
+				fmt.Printf("🚫 %s отклонен\n", change.Path)
+				break ask
+			case "a", "all":
+				acceptAll = true
+				accepted = append(accepted, change.CodeFile())
+				break ask
+			case "q":
+				fmt.Printf("🚫 Остальные файлы отклонены\n")
+				for _, rest := range files[i+1:] {
+					unchanged(rest)
+				}
+				return accepted
+			case "e":
+				edited, err := editInEditor(change.Path, change.Content)
+				if err != nil {
+					fmt.Printf("❌ Ошибка редактора: %v\n", err)
+					continue
+				}
+				updated := change.CodeFile()
+				updated.Content = edited
+				change = NewFileChange(updated)
+			default:
+				fmt.Println("⚠️  Введите y, n, e, a или q")
+			}
+		}
+	}
+
+	fmt.Printf("📋 Принято файлов: %d из %d\n", countWrites(accepted), len(files))
+	return accepted
+}
+
+// countWrites — число файлов, которые нужно записать (без пометки SkipWrite)
+func countWrites(files []CodeFile) int {
+	n := 0
+	for _, f := range files {
+		if !f.SkipWrite {
+			n++
+		}
+	}
+	return n
+}
+
+// editorCommand возвращает редактор из $VISUAL/$EDITOR
+func editorCommand() []string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if parts := strings.Fields(os.Getenv(env)); len(parts) > 0 {
+			return parts
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"notepad.exe"}
+	}
+	return []string{"vi"}
+}
+
+// editInEditor открывает содержимое во временном файле с тем же расширением и возвращает правку
+func editInEditor(path, content string) (string, error) {
+	tmp, err := os.CreateTemp("", "cogitor-review-*"+filepath.Ext(path))
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	tmp.Close()
+
+	editor := editorCommand()
+	cmd := exec.Command(editor[0], append(editor[1:], tmp.Name())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %v", strings.Join(editor, " "), err)
+	}
+
+	data, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,541 @@
+// sandbox.go
+// Песочница для запуска сгенерированного кода: приватный временный каталог с копией
+// исходников, лимиты ресурсов (CPU, память, размер файла, число процессов) и изоляция
+// через bubblewrap или пространства имен Linux. Сеть по умолчанию отключена.
+// Параметры берутся из настроек sandbox*, на один запуск их меняет :sandbox once
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultSandboxBackend  = "auto"
+	DefaultSandboxCPUSec   = 30
+	DefaultSandboxMemoryMB = 2048 // Go и JVM резервируют много виртуальной памяти
+	DefaultSandboxFileMB   = 64
+	DefaultSandboxProcs    = 256 // потоки тоже считаются: go build и JVM создают десятки
+
+	// sandboxHelperArg — скрытый первый аргумент: cogitor перезапускает сам себя,
+	// выставляет лимиты и заменяет себя запускаемой программой
+	sandboxHelperArg = "__cogitor-sandbox"
+
+	sandboxCopyLimit = 100 << 20 // байт исходников, копируемых в каталог песочницы
+)
+
+// sandboxBackends — допустимые значения настройки sandbox
+var sandboxBackends = []string{"auto", "bwrap", "namespaces", "limits", "off"}
+
+// sandboxSkipDirs не копируются в каталог песочницы
+var sandboxSkipDirs = map[string]bool{"node_modules": true, "__pycache__": true}
+
+// sandboxArtifactExts — результаты сборки, которые не возвращаются из песочницы в проект
+var sandboxArtifactExts = map[string]bool{".o": true, ".obj": true, ".class": true, ".pyc": true, ".jar": true, ".exe": true}
+
+// SandboxOptions — параметры песочницы для одного запуска
+type SandboxOptions struct {
+	Backend  string // auto, bwrap, namespaces, limits, off
+	Network  bool
+	CPUSec   int
+	MemoryMB int
+	FileMB   int
+	Procs    int
+}
+
+// sandboxOptionsFromConfig читает параметры песочницы из настроек
+func sandboxOptionsFromConfig(config *Config) SandboxOptions {
+	opts := SandboxOptions{
+		Backend:  DefaultSandboxBackend,
+		CPUSec:   DefaultSandboxCPUSec,
+		MemoryMB: DefaultSandboxMemoryMB,
+		FileMB:   DefaultSandboxFileMB,
+		Procs:    DefaultSandboxProcs,
+	}
+	if config == nil {
+		return opts
+	}
+	if value, ok := config.Get("sandbox"); ok {
+		if s, ok := value.(string); ok && s != "" {
+			opts.Backend = s
+		}
+	}
+	opts.Network = config.GetBool("sandbox_network")
+	opts.CPUSec = config.GetInt("sandbox_cpu_sec", DefaultSandboxCPUSec)
+	opts.MemoryMB = config.GetInt("sandbox_memory_mb", DefaultSandboxMemoryMB)
+	opts.FileMB = config.GetInt("sandbox_file_mb", DefaultSandboxFileMB)
+	opts.Procs = config.GetInt("sandbox_procs", DefaultSandboxProcs)
+	return opts
+}
+
+// Override применяет параметры вида off, net, nonet, cpu=N, mem=N, file=N, procs=N, backend=...
+func (o *SandboxOptions) Override(args []string) error {
+	for _, arg := range args {
+		key, value, hasValue := strings.Cut(strings.ToLower(arg), "=")
+		if !hasValue {
+			switch key {
+			case "off":
+				o.Backend = "off"
+			case "net":
+				o.Network = true
+			case "nonet":
+				o.Network = false
+			default:
+				if !containsString(sandboxBackends, key) {
+					return fmt.Errorf("неизвестный параметр песочницы: %s", arg)
+				}
+				o.Backend = key
+			}
+			continue
+		}
+		if key == "backend" {
+			if !containsString(sandboxBackends, value) {
+				return fmt.Errorf("неизвестная песочница '%s' (допустимо: %s)", value, strings.Join(sandboxBackends, ", "))
+			}
+			o.Backend = value
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("значение %s должно быть положительным числом", arg)
+		}
+		switch key {
+		case "cpu":
+			o.CPUSec = n
+		case "mem", "memory":
+			o.MemoryMB = n
+		case "file":
+			o.FileMB = n
+		case "procs":
+			o.Procs = n
+		default:
+			return fmt.Errorf("неизвестный параметр песочницы: %s", arg)
+		}
+	}
+	return nil
+}
+
+// describeLimits кратко описывает сеть и лимиты
+func (o SandboxOptions) describeLimits() string {
+	network := "сеть выключена"
+	if o.Network {
+		network = "сеть включена"
+	}
+	cpu := "CPU без лимита"
+	if o.CPUSec > 0 {
+		cpu = fmt.Sprintf("CPU %d с", o.CPUSec)
+	}
+	return fmt.Sprintf("%s, %s, память %d МБ, файл до %d МБ, процессов и потоков до %d",
+		network, cpu, o.MemoryMB, o.FileMB, o.Procs)
+}
+
+// helperArgs — аргументы перезапуска cogitor с лимитами перед запуском программы.
+// Нулевые лимиты пропускаются; число процессов ограничивается только в собственном
+// пространстве имен пользователя — иначе в счет идут все процессы пользователя
+func (o SandboxOptions) helperArgs(withProcs bool) []string {
+	args := []string{sandboxHelperArg}
+	if o.CPUSec > 0 {
+		args = append(args, fmt.Sprintf("cpu=%d", o.CPUSec))
+	}
+	if o.MemoryMB > 0 {
+		args = append(args, fmt.Sprintf("as=%d", uint64(o.MemoryMB)<<20))
+	}
+	if o.FileMB > 0 {
+		args = append(args, fmt.Sprintf("fsize=%d", uint64(o.FileMB)<<20))
+	}
+	if withProcs && o.Procs > 0 {
+		args = append(args, fmt.Sprintf("nproc=%d", o.Procs))
+	}
+	return args
+}
+
+// Sandbox — подготовленный каталог запуска и выбранный способ изоляции
+type Sandbox struct {
+	Options  SandboxOptions
+	Backend  string // bwrap, namespaces или limits — что используется на самом деле
+	Dir      string // приватный рабочий каталог с копией исходников
+	cacheDir string // кэш сборки для bwrap и namespaces (GOCACHE и т.п.), переживает запуски
+	notes    []string
+	srcDir   string               // директория, из которой скопированы исходники
+	copied   map[string]fileStamp // скопированные файлы: по ним видно, что создала программа
+
+	Interactive bool // программа работает на собственном PTY (см. runInteractive)
+}
+
+// NewSandbox выбирает бэкенд и копирует директорию srcDir во временный каталог.
+// Файл mainFile копируется первым, чтобы не попасть под ограничение размера
+func NewSandbox(opts SandboxOptions, srcDir, mainFile string) (*Sandbox, error) {
+	backend, note, err := selectSandboxBackend(opts)
+	if err != nil {
+		return nil, err
+	}
+	s := &Sandbox{Options: opts, Backend: backend, srcDir: srcDir, copied: make(map[string]fileStamp)}
+	if note != "" {
+		s.notes = append(s.notes, note)
+	}
+
+	if home, err := os.UserHomeDir(); err == nil && (backend == "bwrap" || backend == "namespaces") {
+		s.cacheDir = filepath.Join(home, ".cogitor", "sandbox", "cache")
+		if err := os.MkdirAll(s.cacheDir, 0700); err != nil {
+			s.cacheDir = ""
+		}
+	}
+
+	s.Dir, err = os.MkdirTemp("", "cogitor-run-*")
+	if err != nil {
+		return nil, fmt.Errorf("не удалось создать каталог песочницы: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(s.Dir, ".tmp"), 0700); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("не удалось создать каталог песочницы: %v", err)
+	}
+	if err := s.copySources(srcDir, mainFile); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close удаляет каталог песочницы
+func (s *Sandbox) Close() {
+	if s != nil && s.Dir != "" {
+		os.RemoveAll(s.Dir)
+	}
+}
+
+// Describe — строка для вывода: бэкенд, лимиты и каталог
+func (s *Sandbox) Describe() string {
+	var desc string
+	switch s.Backend {
+	case "limits":
+		desc = fmt.Sprintf("🔒 Песочница: limits — %s; каталог %s (без изоляции сети и файловой системы, число процессов не ограничено)",
+			s.Options.describeLimits(), s.Dir)
+	default:
+		desc = fmt.Sprintf("🔒 Песочница: %s — %s; каталог %s", s.Backend, s.Options.describeLimits(), s.Dir)
+	}
+	for _, note := range s.notes {
+		desc += "\n⚠️  " + note
+	}
+	return desc
+}
+
+// Command оборачивает команду для запуска в песочнице: рабочий каталог, окружение,
+// лимиты и изоляция выбранного бэкенда
+func (s *Sandbox) Command(cmd *exec.Cmd) (*exec.Cmd, error) {
+	if cmd.Err != nil {
+		return nil, cmd.Err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось найти исполняемый файл cogitor: %v", err)
+	}
+
+	program := append([]string{"--", cmd.Path}, cmd.Args...)
+	wrapped, err := sandboxCommand(s, exe, program)
+	if err != nil {
+		return nil, err
+	}
+	wrapped.Dir = s.Dir
+	wrapped.Env = s.env(cmd.Env)
+	wrapped.Stdin = cmd.Stdin
+	wrapped.Stdout = cmd.Stdout
+	wrapped.Stderr = cmd.Stderr
+	return wrapped, nil
+}
+
+// ExplainExit поясняет завершение программы из-за лимита песочницы
+func (s *Sandbox) ExplainExit(err error) string {
+	if s == nil || err == nil {
+		return ""
+	}
+	return sandboxExitNote(err, s.Options)
+}
+
+// sandboxNote — пояснение о лимите для сообщения об ошибке, если оно есть
+func sandboxNote(box *Sandbox, err error) string {
+	if note := box.ExplainExit(err); note != "" {
+		return ": " + note
+	}
+	return ""
+}
+
+// env — окружение программы: временные файлы и кэши внутри песочницы
+func (s *Sandbox) env(base []string) []string {
+	if base == nil {
+		base = os.Environ()
+	}
+	env := append([]string{}, base...)
+	env = append(env, "TMPDIR="+filepath.Join(s.Dir, ".tmp"))
+	// В bwrap и namespaces домашний каталог только для чтения — кэши сборки ведем отдельно
+	if s.cacheDir != "" {
+		env = append(env,
+			"GOCACHE="+filepath.Join(s.cacheDir, "go-build"),
+			"XDG_CACHE_HOME="+s.cacheDir,
+		)
+	}
+	return env
+}
+
+// copySources копирует исходники без скрытых директорий и ограничивает общий объем
+func (s *Sandbox) copySources(srcDir, mainFile string) error {
+	var total int64
+	if mainFile != "" {
+		n, err := copySandboxFile(filepath.Join(srcDir, mainFile), filepath.Join(s.Dir, mainFile))
+		if err != nil {
+			return fmt.Errorf("не удалось скопировать %s в песочницу: %v", mainFile, err)
+		}
+		total += n
+		s.stamp(mainFile)
+	}
+
+	skipped := 0
+	err := filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, relErr := filepath.Rel(srcDir, path)
+		if relErr != nil || rel == "." {
+			return nil
+		}
+		if info.IsDir() {
+			if strings.HasPrefix(info.Name(), ".") || sandboxSkipDirs[info.Name()] {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(filepath.Join(s.Dir, rel), 0755)
+		}
+		if !info.Mode().IsRegular() || rel == mainFile {
+			return nil
+		}
+		if total+info.Size() > sandboxCopyLimit {
+			skipped++
+			return nil
+		}
+		n, err := copySandboxFile(path, filepath.Join(s.Dir, rel))
+		if err == nil {
+			total += n
+			s.stamp(rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("не удалось скопировать исходники в песочницу: %v", err)
+	}
+	if skipped > 0 {
+		s.notes = append(s.notes, fmt.Sprintf("В песочницу не скопировано файлов: %d (предел %d МБ)", skipped, sandboxCopyLimit>>20))
+	}
+	return nil
+}
+
+// fileStamp — размер и время изменения копии файла в каталоге песочницы
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// stamp запоминает состояние скопированного файла
+func (s *Sandbox) stamp(rel string) {
+	if info, err := os.Stat(filepath.Join(s.Dir, rel)); err == nil {
+		s.copied[rel] = fileStamp{info.Size(), info.ModTime()}
+	}
+}
+
+// Outputs возвращает файлы (пути относительно каталога песочницы), которые программа
+// создала или изменила. Результаты сборки — новые исполняемые файлы, объектные файлы,
+// .class и т.п. — не считаются
+func (s *Sandbox) Outputs() (created, changed []string) {
+	if s == nil || s.Dir == "" || s.srcDir == "" {
+		return nil, nil
+	}
+	filepath.Walk(s.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, relErr := filepath.Rel(s.Dir, path)
+		if relErr != nil || rel == "." {
+			return nil
+		}
+		if info.IsDir() {
+			if strings.HasPrefix(info.Name(), ".") || sandboxSkipDirs[info.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || sandboxArtifactExts[strings.ToLower(filepath.Ext(rel))] {
+			return nil
+		}
+		stamp, ok := s.copied[rel]
+		switch {
+		case !ok && info.Mode().Perm()&0111 == 0:
+			created = append(created, rel)
+		case ok && (stamp.size != info.Size() || !stamp.modTime.Equal(info.ModTime())):
+			changed = append(changed, rel)
+		}
+		return nil
+	})
+	return created, changed
+}
+
+// copySandboxFile копирует файл с сохранением прав
+func copySandboxFile(src, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return 0, err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// saveOutputs переносит в проект файлы, которые программа создала в песочнице (отчеты,
+// CSV, картинки), и измененные ею файлы данных. Изменения исходного кода отбрасываются:
+// песочница защищает проект от программы. Запись идет через рабочее пространство
+func (cr *CodeRunner) saveOutputs(box *Sandbox) {
+	created, changed := box.Outputs()
+	var saved, discarded []string
+	for _, rel := range append(created, changed...) {
+		if containsString(changed, rel) && cr.getLanguageInfo(rel) != nil {
+			discarded = append(discarded, rel)
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(box.Dir, rel))
+		if err == nil {
+			err = cr.workspace.WriteFile(filepath.Join(box.srcDir, rel), data)
+		}
+		if err != nil {
+			fmt.Printf("⚠️  Файл %s из песочницы не сохранен: %v\n", rel, err)
+			continue
+		}
+		saved = append(saved, rel)
+	}
+	if len(saved) > 0 {
+		fmt.Printf("📦 Файлы, записанные программой, сохранены в %s: %s\n", box.srcDir, strings.Join(saved, ", "))
+	}
+	if len(discarded) > 0 {
+		fmt.Printf("⚠️  Изменения исходников в песочнице отброшены: %s\n", strings.Join(discarded, ", "))
+	}
+}
+
+// installCommand оборачивает команду установки зависимостей лимитами песочницы. Установка
+// скачивает пакеты и пишет в окружение пользователя (site-packages, node_modules), поэтому
+// сеть и файлы не изолируются, а из лимитов действуют процессорное время и память.
+// Вне Linux с включенной песочницей команда не запускается, как и сгенерированный код
+func (cr *CodeRunner) installCommand(cmd *exec.Cmd) (*exec.Cmd, *Sandbox, error) {
+	if cmd.Err != nil {
+		return nil, nil, cmd.Err
+	}
+	opts := cr.sandboxOptions()
+	if opts.Backend == "off" {
+		return cmd, nil, nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, nil, fmt.Errorf("не удалось найти исполняемый файл cogitor: %v", err)
+	}
+	limits := SandboxOptions{Network: true, CPUSec: opts.CPUSec * installTimeoutFactor, MemoryMB: opts.MemoryMB}
+	box := &Sandbox{Options: limits, Backend: "limits"}
+	wrapped, err := sandboxCommand(box, exe, append([]string{"--", cmd.Path}, cmd.Args...))
+	if err != nil {
+		return nil, nil, err
+	}
+	wrapped.Dir = cmd.Dir
+	wrapped.Env = cmd.Env
+	return wrapped, box, nil
+}
+
+// sandboxOptions — параметры следующего запуска: разовые из :sandbox once или из настроек
+func (cr *CodeRunner) sandboxOptions() SandboxOptions {
+	if cr.sandboxOnce != nil {
+		return *cr.sandboxOnce
+	}
+	return sandboxOptionsFromConfig(cr.config)
+}
+
+// SetSandboxOnce задает параметры песочницы только для следующего запуска
+func (cr *CodeRunner) SetSandboxOnce(opts *SandboxOptions) {
+	cr.sandboxOnce = opts
+}
+
+// clearSandboxOnce сбрасывает разовые параметры после запуска
+func (cr *CodeRunner) clearSandboxOnce() {
+	if cr.sandboxOnce != nil {
+		cr.sandboxOnce = nil
+		fmt.Println("🔒 Разовые параметры песочницы сброшены")
+	}
+}
+
+// handleSandbox — команда :sandbox
+func (ch *CommandHandler) handleSandbox(args []string) {
+	a, ok := ch.assistant.(*Assistant)
+	if !ok {
+		return
+	}
+	cr := a.codeRunner
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "once":
+			if len(args) < 2 {
+				fmt.Println("❌ Использование: :sandbox once <параметры>, например :sandbox once net cpu=120")
+				return
+			}
+			opts := cr.sandboxOptions()
+			if err := opts.Override(args[1:]); err != nil {
+				fmt.Printf("❌ %v\n", err)
+				return
+			}
+			cr.SetSandboxOnce(&opts)
+			if opts.Backend == "off" {
+				fmt.Println("🔓 Следующий запуск пройдет без песочницы")
+			} else {
+				fmt.Printf("🔒 Следующий запуск: %s — %s\n", opts.Backend, opts.describeLimits())
+			}
+			return
+		case "reset":
+			cr.SetSandboxOnce(nil)
+			fmt.Println("🔒 Разовые параметры песочницы сброшены")
+			return
+		default:
+			fmt.Printf("❌ Неизвестная подкоманда: %s\n%s\n", args[0], commandHelp[":sandbox"])
+			return
+		}
+	}
+
+	opts := sandboxOptionsFromConfig(ch.config)
+	fmt.Printf("🔒 Песочница: %s — %s\n", opts.Backend, opts.describeLimits())
+	if opts.Backend != "off" {
+		if backend, note, err := selectSandboxBackend(opts); err != nil {
+			fmt.Printf("❌ %v\n", err)
+		} else {
+			fmt.Printf("   Используется: %s\n", backend)
+			if note != "" {
+				fmt.Printf("⚠️  %s\n", note)
+			}
+		}
+	}
+	if cr.sandboxOnce != nil {
+		once := *cr.sandboxOnce
+		fmt.Printf("   Следующий запуск: %s — %s\n", once.Backend, once.describeLimits())
+	}
+	fmt.Println("   Настройки: sandbox, sandbox_network, sandbox_cpu_sec, sandbox_memory_mb, sandbox_file_mb, sandbox_procs")
+}
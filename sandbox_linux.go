@@ -0,0 +1,403 @@
+// sandbox_linux.go
+// Бэкенды песочницы для Linux: bubblewrap, пространства имен через SysProcAttr и
+// только лимиты. Лимиты и, для namespaces, корень только для чтения выставляет
+// перезапущенный cogitor (runSandboxHelper) перед exec
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const rlimitNproc = 6 // RLIMIT_NPROC, нет в пакете syscall
+
+// sandboxRlimits — ресурсы, которые принимает runSandboxHelper
+var sandboxRlimits = map[string]int{
+	"cpu":   syscall.RLIMIT_CPU,
+	"as":    syscall.RLIMIT_AS,
+	"fsize": syscall.RLIMIT_FSIZE,
+	"nproc": rlimitNproc,
+}
+
+var (
+	sandboxProbeMu    sync.Mutex
+	sandboxProbeCache = map[string]error{}
+)
+
+// selectSandboxBackend выбирает бэкенд. В режиме auto bwrap заменяется пространствами
+// имен; только лимиты — лишь если сеть разрешена, иначе запуск без изоляции сети
+// и файлов был бы незаметным. Явно выбранный недоступный бэкенд — ошибка
+func selectSandboxBackend(opts SandboxOptions) (string, string, error) {
+	switch opts.Backend {
+	case "bwrap", "namespaces":
+		if err := probeSandbox(opts.Backend); err != nil {
+			return "", "", fmt.Errorf("песочница %s недоступна: %v (:set sandbox auto — выбрать доступную)", opts.Backend, err)
+		}
+		return opts.Backend, "", nil
+	case "limits":
+		return "limits", "", nil
+	case "auto", "":
+		bwrapErr := probeSandbox("bwrap")
+		if bwrapErr == nil {
+			return "bwrap", "", nil
+		}
+		nsErr := probeSandbox("namespaces")
+		if nsErr == nil {
+			return "namespaces", "", nil
+		}
+		if !opts.Network {
+			return "", "", fmt.Errorf("изоляция недоступна (bwrap: %v; namespaces: %v), а сеть в песочнице выключена — код не запущен. "+
+				":sandbox once limits — запустить один раз только с лимитами ресурсов (сеть и файлы открыты), :set sandbox limits или off — всегда", bwrapErr, nsErr)
+		}
+		return "limits", fmt.Sprintf("Изоляция недоступна (bwrap: %v; namespaces: %v), действуют только лимиты ресурсов", bwrapErr, nsErr), nil
+	}
+	return "", "", fmt.Errorf("неизвестная песочница '%s' (допустимо: %s)", opts.Backend, strings.Join(sandboxBackends, ", "))
+}
+
+// probeSandbox один раз проверяет, что бэкенд запускает процессы
+func probeSandbox(backend string) error {
+	sandboxProbeMu.Lock()
+	defer sandboxProbeMu.Unlock()
+	if err, ok := sandboxProbeCache[backend]; ok {
+		return err
+	}
+
+	err := func() error {
+		if backend == "bwrap" {
+			if _, err := exec.LookPath("bwrap"); err != nil {
+				return fmt.Errorf("не установлен")
+			}
+		}
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		// Пустая программа после "--": помощник просто завершается
+		cmd, err := sandboxCommand(&Sandbox{Options: SandboxOptions{}, Backend: backend}, exe, []string{"--"})
+		if err != nil {
+			return err
+		}
+		if output, err := cmd.CombinedOutput(); err != nil {
+			if msg := strings.TrimSpace(string(output)); msg != "" {
+				return fmt.Errorf("%s", msg)
+			}
+			return err
+		}
+		return nil
+	}()
+	sandboxProbeCache[backend] = err
+	return err
+}
+
+// sandboxCommand строит команду запуска помощника с лимитами внутри бэкенда s.Backend.
+// program — "--", путь к программе и ее argv
+func sandboxCommand(s *Sandbox, exe string, program []string) (*exec.Cmd, error) {
+	helper := append(s.Options.helperArgs(s.Backend != "limits"), program...)
+
+	switch s.Backend {
+	case "bwrap":
+		bwrap, err := exec.LookPath("bwrap")
+		if err != nil {
+			return nil, fmt.Errorf("bwrap не найден: %v", err)
+		}
+		args := append(bwrapArgs(s, exe), "--", exe)
+		return exec.Command(bwrap, append(args, helper...)...), nil
+	case "namespaces":
+		// Параметры файловой системы идут перед "--" вместе с лимитами
+		args := append(s.Options.helperArgs(true), "fs=ro")
+		for _, dir := range []string{s.Dir, s.cacheDir} {
+			if dir != "" {
+				args = append(args, "rw="+dir)
+			}
+		}
+		cmd := exec.Command(exe, append(args, program...)...)
+		cmd.SysProcAttr = namespaceAttr(s.Options.Network)
+		return cmd, nil
+	case "limits":
+		return exec.Command(exe, helper...), nil
+	}
+	return nil, fmt.Errorf("неизвестная песочница '%s'", s.Backend)
+}
+
+// bwrapArgs — корень только для чтения, свои /dev, /proc и /tmp; запись разрешена
+// в каталог песочницы и кэш сборки
+func bwrapArgs(s *Sandbox, exe string) []string {
+	args := []string{
+		"--ro-bind", "/", "/",
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--tmpfs", "/tmp",
+		"--ro-bind", exe, exe, // cogitor, собранный go run, лежит в /tmp
+	}
+	if s.Dir != "" {
+		args = append(args, "--bind", s.Dir, s.Dir, "--chdir", s.Dir)
+	}
+	if s.cacheDir != "" {
+		args = append(args, "--bind", s.cacheDir, s.cacheDir)
+	}
+	args = append(args, "--unshare-user", "--unshare-pid", "--unshare-ipc", "--unshare-uts", "--unshare-cgroup-try")
+	if !s.Options.Network {
+		args = append(args, "--unshare-net")
+	}
+	args = append(args, "--die-with-parent")
+	if s.Interactive {
+		// терминал сеанса (PTY программы) нужен для Ctrl+C и размера окна. С настоящим
+		// терминалом пользователя сеанс остается новым: иначе через TIOCSTI программа
+		// могла бы подставить ввод в оболочку пользователя
+		return args
+	}
+	return append(args, "--new-session")
+}
+
+// namespaceAttr — новые пространства имен пользователя, монтирования, PID, IPC, UTS
+// и сети; пользователь отображается сам в себя без дополнительных прав
+func namespaceAttr(network bool) *syscall.SysProcAttr {
+	flags := syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS
+	if !network {
+		flags |= syscall.CLONE_NEWNET
+	}
+	uid, gid := os.Getuid(), os.Getgid()
+	return &syscall.SysProcAttr{
+		Cloneflags:                 uintptr(flags),
+		UidMappings:                []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}},
+		GidMappings:                []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}},
+		GidMappingsEnableSetgroups: false,
+		Pdeathsig:                  syscall.SIGKILL,
+	}
+}
+
+// runSandboxHelper выставляет лимиты из аргументов вида cpu=N, с fs=ro делает файловую
+// систему только для чтения (кроме каталогов rw=путь) и заменяет себя программой после "--".
+// Коды возврата 126/127 — как у shell: ошибка запуска / программа не найдена
+func runSandboxHelper(args []string) int {
+	end := len(args)
+	for j, arg := range args {
+		if arg == "--" {
+			end = j
+			break
+		}
+	}
+
+	// Файловую систему готовим до лимитов: лимит памяти мог бы не дать это сделать.
+	// Без изоляции файлов программа не запускается: иначе namespaces молча стал бы limits
+	readOnly := false
+	var writable []string
+	for _, arg := range args[:end] {
+		key, value, _ := strings.Cut(arg, "=")
+		switch key {
+		case "fs":
+			readOnly = value == "ro"
+		case "rw":
+			writable = append(writable, value)
+		}
+	}
+	if readOnly {
+		if err := isolateFilesystem(writable); err != nil {
+			fmt.Fprintf(os.Stderr, "cogitor-sandbox: файловая система не изолирована: %v\n", err)
+			return 126
+		}
+	}
+
+	i := 0
+	for ; i < end; i++ {
+		key, value, _ := strings.Cut(args[i], "=")
+		if key == "fs" || key == "rw" {
+			continue
+		}
+		resource, ok := sandboxRlimits[key]
+		n, err := strconv.ParseUint(value, 10, 64)
+		if !ok || err != nil {
+			fmt.Fprintf(os.Stderr, "cogitor-sandbox: неверный лимит %s\n", args[i])
+			return 126
+		}
+		limit := syscall.Rlimit{Cur: n, Max: n}
+		if resource == syscall.RLIMIT_CPU {
+			limit.Max = n + 1 // сначала SIGXCPU, через секунду SIGKILL
+		}
+		if err := syscall.Setrlimit(resource, &limit); err != nil {
+			fmt.Fprintf(os.Stderr, "cogitor-sandbox: не удалось выставить %s: %v\n", args[i], err)
+			return 126
+		}
+	}
+	if i+2 >= len(args) {
+		return 0 // нечего запускать: проверка бэкенда
+	}
+
+	path, argv := args[i+1], args[i+2:]
+	err := syscall.Exec(path, argv, os.Environ())
+	fmt.Fprintf(os.Stderr, "cogitor-sandbox: не удалось запустить %s: %v\n", path, err)
+	if errors.Is(err, syscall.ENOENT) {
+		return 127
+	}
+	return 126
+}
+
+// isolateFilesystem в собственном пространстве имен монтирования перемонтирует все точки
+// только для чтения, монтирует пустой /tmp и открывает на запись каталоги writable
+func isolateFilesystem(writable []string) error {
+	// Изменения не должны распространяться в исходное пространство имен
+	if err := syscall.Mount("none", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("приватные монтирования: %v", err)
+	}
+	cwd, _ := os.Getwd()
+
+	// Каталоги открываем заранее: после монтирования /tmp лежащие в нем пути пропадут
+	dirs := make([]*os.File, len(writable))
+	for i, dir := range writable {
+		f, err := os.Open(dir)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		dirs[i] = f
+	}
+
+	points, err := mountPoints()
+	if err != nil {
+		return err
+	}
+	for _, point := range points {
+		if err := remount(point, true); err != nil && !pseudoMount(point) {
+			return fmt.Errorf("%s только для чтения: %v", point, err)
+		}
+	}
+
+	if err := syscall.Mount("tmpfs", "/tmp", "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=1777"); err != nil {
+		return fmt.Errorf("/tmp: %v", err)
+	}
+	for i, dir := range writable {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		source := fmt.Sprintf("/proc/self/fd/%d", dirs[i].Fd())
+		if err := syscall.Mount(source, dir, "", syscall.MS_BIND, ""); err != nil {
+			return fmt.Errorf("%s: %v", dir, err)
+		}
+		// Копия монтирования наследует "только для чтения" — снимаем его
+		if err := remount(dir, false); err != nil {
+			return fmt.Errorf("%s на запись: %v", dir, err)
+		}
+	}
+
+	// Рабочий каталог указывает на прежнее монтирование: переходим в новое.
+	// Каталог из /tmp, не открытый на запись, остался снаружи — тогда в корень
+	if cwd == "" || os.Chdir(cwd) != nil {
+		return os.Chdir("/")
+	}
+	return nil
+}
+
+// statfsMountFlags — флаги statfs, которые при перемонтировании нужно сохранить: в чужом
+// пространстве имен пользователя их нельзя снять
+var statfsMountFlags = map[int64]uintptr{
+	0x2:    syscall.MS_NOSUID,
+	0x4:    syscall.MS_NODEV,
+	0x8:    syscall.MS_NOEXEC,
+	0x400:  syscall.MS_NOATIME,
+	0x800:  syscall.MS_NODIRATIME,
+	0x1000: syscall.MS_RELATIME,
+}
+
+// remount меняет режим точки монтирования на только чтение или чтение и запись
+func remount(point string, readOnly bool) error {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(point, &st); err != nil {
+		return err
+	}
+	flags := uintptr(syscall.MS_REMOUNT | syscall.MS_BIND)
+	for bit, flag := range statfsMountFlags {
+		if int64(st.Flags)&bit != 0 {
+			flags |= flag
+		}
+	}
+	if readOnly {
+		flags |= syscall.MS_RDONLY
+	}
+	return syscall.Mount("none", point, "", flags, "")
+}
+
+// mountPoints читает точки монтирования из /proc/self/mountinfo
+func mountPoints() ([]string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var points []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 4 {
+			points = append(points, unescapeMountPath(fields[4]))
+		}
+	}
+	return points, scanner.Err()
+}
+
+// unescapeMountPath раскрывает восьмеричные последовательности mountinfo (\040 — пробел)
+func unescapeMountPath(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// pseudoMount — служебные файловые системы: часть их точек в пространстве имен
+// пользователя перемонтировать нельзя, а данных пользователя в них нет
+func pseudoMount(point string) bool {
+	for _, prefix := range []string{"/proc", "/sys", "/dev"} {
+		if point == prefix || strings.HasPrefix(point, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// sandboxExitNote поясняет сигналы лимитов: SIGXCPU, SIGXFSZ и SIGKILL после жесткого
+// лимита CPU. bwrap передает сигнал как код 128+N
+func sandboxExitNote(err error, opts SandboxOptions) string {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return ""
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok {
+		return ""
+	}
+	sig := syscall.Signal(-1)
+	if status.Signaled() {
+		sig = status.Signal()
+	} else if code := status.ExitStatus(); code > 128 {
+		sig = syscall.Signal(code - 128)
+	}
+
+	switch sig {
+	case syscall.SIGXCPU:
+		return fmt.Sprintf("превышен лимит процессорного времени песочницы (%d с)", opts.CPUSec)
+	case syscall.SIGXFSZ:
+		return fmt.Sprintf("превышен лимит размера файла песочницы (%d МБ)", opts.FileMB)
+	case syscall.SIGKILL:
+		// Процесс с PID 1 в своем пространстве имен не получает SIGXCPU — только SIGKILL
+		// по жесткому лимиту
+		return fmt.Sprintf("процесс принудительно завершен — вероятно, исчерпан лимит процессорного времени песочницы (%d с)", opts.CPUSec)
+	}
+	return ""
+}
@@ -0,0 +1,40 @@
+//go:build !linux
+
+// sandbox_other.go
+// Вне Linux изоляция и лимиты недоступны: код не запускается, пока песочница не
+// отключена явно (:set sandbox off)
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// selectSandboxBackend всегда возвращает ошибку: запуск без изоляции и с сетью должен
+// быть явным решением пользователя
+func selectSandboxBackend(opts SandboxOptions) (string, string, error) {
+	backend := opts.Backend
+	if backend == "" {
+		backend = "auto"
+	}
+	return "", "", fmt.Errorf("песочница (%s) поддерживается только в Linux, а здесь %s — код не запущен. "+
+		":sandbox once off — запустить один раз без песочницы (сеть и файлы открыты), :set sandbox off — всегда", backend, runtime.GOOS)
+}
+
+// sandboxCommand недоступна вне Linux
+func sandboxCommand(s *Sandbox, exe string, program []string) (*exec.Cmd, error) {
+	return nil, fmt.Errorf("песочница поддерживается только в Linux")
+}
+
+// runSandboxHelper не используется вне Linux
+func runSandboxHelper(args []string) int {
+	fmt.Fprintln(os.Stderr, "cogitor-sandbox: поддерживается только в Linux")
+	return 126
+}
+
+func sandboxExitNote(err error, opts SandboxOptions) string {
+	return ""
+}
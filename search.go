@@ -0,0 +1,329 @@
+// search.go
+// Полнотекстовый поиск по сохраненным сессиям и текущему контексту.
+// Инвертированный индекс строится лениво и обновляется только для измененных файлов сессий
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	CurrentSessionName  = "(текущий)" // имя live-контекста в результатах поиска
+	MaxSearchResults    = 20
+	SearchSnippetRadius = 80 // символов вокруг совпадения в сниппете
+)
+
+// SessionSearchResult — одно найденное совпадение
+type SessionSearchResult struct {
+	Session    string   `json:"session"`
+	Exchange   int      `json:"exchange"` // номер обмена, начиная с 1
+	Snippet    string   `json:"snippet"`
+	Highlights [][2]int `json:"highlights"` // байтовые смещения совпадений внутри сниппета
+	Score      int      `json:"score"`
+	Modified   string   `json:"modified,omitempty"`
+}
+
+// posting — вхождение терма в обмен
+type posting struct {
+	session  string
+	exchange int
+	count    int
+}
+
+// indexedSession — проиндексированный файл сессии
+type indexedSession struct {
+	modTime   time.Time
+	exchanges []string
+}
+
+// SessionIndex — инвертированный индекс по сохраненным сессиям
+type SessionIndex struct {
+	sessions map[string]*indexedSession
+	terms    map[string][]posting
+	mu       sync.Mutex
+}
+
+var sessionIndex = &SessionIndex{
+	sessions: make(map[string]*indexedSession),
+	terms:    make(map[string][]posting),
+}
+
+// tokenize разбивает текст на термы в нижнем регистре (буквы и цифры, от 2 символов)
+func tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	tokens := fields[:0]
+	for _, f := range fields {
+		if len([]rune(f)) >= 2 {
+			tokens = append(tokens, f)
+		}
+	}
+	return tokens
+}
+
+// refresh синхронизирует индекс с директорией сессий
+func (idx *SessionIndex) refresh() error {
+	files, err := os.ReadDir(getSessionsDir())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	changed := false
+
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		name := strings.TrimSuffix(f.Name(), ".json")
+		seen[name] = true
+
+		if s, ok := idx.sessions[name]; ok && s.modTime.Equal(info.ModTime()) {
+			continue
+		}
+
+		exchanges, err := readSessionExchanges(filepath.Join(getSessionsDir(), f.Name()))
+		if err != nil {
+			continue // поврежденные сессии пропускаем
+		}
+		idx.sessions[name] = &indexedSession{modTime: info.ModTime(), exchanges: exchanges}
+		changed = true
+	}
+
+	for name := range idx.sessions {
+		if !seen[name] {
+			delete(idx.sessions, name)
+			changed = true
+		}
+	}
+
+	if changed {
+		idx.rebuild()
+	}
+	return nil
+}
+
+// rebuild пересобирает словарь термов по всем сессиям
+func (idx *SessionIndex) rebuild() {
+	idx.terms = make(map[string][]posting)
+	for name, s := range idx.sessions {
+		for i, exchange := range s.exchanges {
+			for term, count := range countTerms(exchange) {
+				idx.terms[term] = append(idx.terms[term], posting{session: name, exchange: i, count: count})
+			}
+		}
+	}
+}
+
+// readSessionExchanges читает обмены из файла сессии
+func readSessionExchanges(path string) ([]string, error) {
+	session, err := readSessionFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return session.Exchanges, nil
+}
+
+func countTerms(text string) map[string]int {
+	counts := make(map[string]int)
+	for _, t := range tokenize(text) {
+		counts[t]++
+	}
+	return counts
+}
+
+// SearchSessions ищет обмены, содержащие все слова запроса, в сохраненных сессиях
+// и в текущем контексте (current может быть nil)
+func SearchSessions(query string, current []string) ([]SessionSearchResult, error) {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	idx := sessionIndex
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if err := idx.refresh(); err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		session  string
+		exchange int
+	}
+	scores := make(map[key]int)
+	matched := make(map[key]int)
+
+	for _, term := range uniqueStrings(terms) {
+		for _, p := range idx.terms[term] {
+			k := key{p.session, p.exchange}
+			scores[k] += p.count
+			matched[k]++
+		}
+	}
+
+	var results []SessionSearchResult
+	required := len(uniqueStrings(terms))
+
+	for k, score := range scores {
+		if matched[k] < required {
+			continue
+		}
+		s := idx.sessions[k.session]
+		snippet, highlights := buildSnippet(s.exchanges[k.exchange], terms)
+		results = append(results, SessionSearchResult{
+			Session:    k.session,
+			Exchange:   k.exchange + 1,
+			Snippet:    snippet,
+			Highlights: highlights,
+			Score:      score,
+			Modified:   s.modTime.Format(time.RFC3339),
+		})
+	}
+
+	// Текущий контекст не индексируется — он небольшой и постоянно меняется
+	for i, exchange := range current {
+		counts := countTerms(exchange)
+		score, ok := 0, true
+		for _, term := range uniqueStrings(terms) {
+			if counts[term] == 0 {
+				ok = false
+				break
+			}
+			score += counts[term]
+		}
+		if !ok {
+			continue
+		}
+		snippet, highlights := buildSnippet(exchange, terms)
+		results = append(results, SessionSearchResult{
+			Session:    CurrentSessionName,
+			Exchange:   i + 1,
+			Snippet:    snippet,
+			Highlights: highlights,
+			Score:      score,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if results[i].Modified != results[j].Modified {
+			return results[i].Modified > results[j].Modified
+		}
+		return results[i].Exchange < results[j].Exchange
+	})
+
+	if len(results) > MaxSearchResults {
+		results = results[:MaxSearchResults]
+	}
+	return results, nil
+}
+
+// buildSnippet вырезает фрагмент вокруг первого совпадения и возвращает смещения всех совпадений в нем
+func buildSnippet(text string, terms []string) (string, [][2]int) {
+	lower := strings.ToLower(text)
+	first := -1
+	for _, term := range terms {
+		if pos := strings.Index(lower, term); pos >= 0 && (first < 0 || pos < first) {
+			first = pos
+		}
+	}
+	if first < 0 || first > len(text) {
+		first = 0
+	}
+
+	start := first - SearchSnippetRadius
+	if start < 0 {
+		start = 0
+	}
+	end := first + SearchSnippetRadius*2
+	if end > len(text) {
+		end = len(text)
+	}
+	// Не режем UTF-8 посередине символа
+	for start > 0 && !isRuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !isRuneStart(text[end]) {
+		end++
+	}
+
+	prefix, suffix := "", ""
+	if start > 0 {
+		prefix = "..."
+	}
+	if end < len(text) {
+		suffix = "..."
+	}
+
+	// strings.ToLower может изменить длину строки, поэтому ищем совпадения уже в сниппете
+	fragment := strings.ReplaceAll(text[start:end], "\n", " ")
+	snippet := prefix + fragment + suffix
+	lowerSnippet := strings.ToLower(snippet)
+	if len(lowerSnippet) != len(snippet) {
+		return snippet, nil
+	}
+
+	var highlights [][2]int
+	for _, term := range uniqueStrings(terms) {
+		for offset := 0; ; {
+			pos := strings.Index(lowerSnippet[offset:], term)
+			if pos < 0 {
+				break
+			}
+			highlights = append(highlights, [2]int{offset + pos, offset + pos + len(term)})
+			offset += pos + len(term)
+		}
+	}
+	sort.Slice(highlights, func(i, j int) bool { return highlights[i][0] < highlights[j][0] })
+	return snippet, highlights
+}
+
+// HighlightSnippet оборачивает совпадения в ANSI-выделение для вывода в терминал
+func HighlightSnippet(r SessionSearchResult) string {
+	var b strings.Builder
+	last := 0
+	for _, h := range r.Highlights {
+		if h[0] < last {
+			continue
+		}
+		b.WriteString(r.Snippet[last:h[0]])
+		b.WriteString("\033[1;33m")
+		b.WriteString(r.Snippet[h[0]:h[1]])
+		b.WriteString("\033[0m")
+		last = h[1]
+	}
+	b.WriteString(r.Snippet[last:])
+	return b.String()
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+func uniqueStrings(items []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, item := range items {
+		if !seen[item] {
+			seen[item] = true
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -4,6 +4,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -31,6 +32,19 @@ type WebServer struct {
 	port        string
 	config      *Config
 	fsManager   *FileSystemManager
+	pending     map[string]pendingChanges // сгенерированные файлы, ожидающие решения пользователя
+	pendingMu   sync.Mutex
+}
+
+// pendingTTL — сколько изменения ждут решения пользователя; следующий запрос того же
+// соединения заменяет их раньше
+const pendingTTL = 30 * time.Minute
+
+// pendingChanges — изменения одного ответа модели, ожидающие решения в браузере
+type pendingChanges struct {
+	changes []FileChange
+	conn    *websocket.Conn
+	created time.Time
 }
 
 // NewWebServer создает новый веб-сервер
@@ -51,6 +65,7 @@ func NewWebServer(assistant *Assistant, port string) *WebServer {
 		port:        port,
 		config:      config,
 	 	fsManager:   NewFileSystemManager(), 
+		pending:     make(map[string]pendingChanges),
 	}
 }
 
@@ -81,9 +96,15 @@ func (ws *WebServer) StartWithListener(addr string) error {
     http.HandleFunc("/api/rag/enable", ws.handleRAGEnable)
     http.HandleFunc("/api/rag/disable", ws.handleRAGDisable)
     http.HandleFunc("/api/rag/status", ws.handleRAGStatus)
+    http.HandleFunc("/api/rag/collections", ws.handleRAGCollections)
+    http.HandleFunc("/api/rag/use", ws.handleRAGUse)
+    http.HandleFunc("/api/rag/remove", ws.handleRAGRemove)
+    http.HandleFunc("/api/rag/refresh", ws.handleRAGRefresh)
     http.HandleFunc("/api/sessions/save", ws.handleSessionsSave)
     http.HandleFunc("/api/sessions/load", ws.handleSessionsLoad)
     http.HandleFunc("/api/sessions/list", ws.handleSessionsList)
+    http.HandleFunc("/api/sessions/search", ws.handleSessionsSearch)
+    http.HandleFunc("/api/sessions/export", ws.handleSessionsExport)
 	http.HandleFunc("/api/system/info", ws.handleSystemInfo)
     http.HandleFunc("/api/provider/change", ws.handleProviderChange)
 	http.HandleFunc("/api/sessions/delete", ws.handleSessionsDelete)
@@ -122,9 +143,15 @@ func (ws *WebServer) Start() error {
     http.HandleFunc("/api/rag/enable", ws.handleRAGEnable)
     http.HandleFunc("/api/rag/disable", ws.handleRAGDisable)
     http.HandleFunc("/api/rag/status", ws.handleRAGStatus)
+    http.HandleFunc("/api/rag/collections", ws.handleRAGCollections)
+    http.HandleFunc("/api/rag/use", ws.handleRAGUse)
+    http.HandleFunc("/api/rag/remove", ws.handleRAGRemove)
+    http.HandleFunc("/api/rag/refresh", ws.handleRAGRefresh)
     http.HandleFunc("/api/sessions/save", ws.handleSessionsSave)
     http.HandleFunc("/api/sessions/load", ws.handleSessionsLoad)
     http.HandleFunc("/api/sessions/list", ws.handleSessionsList)
+    http.HandleFunc("/api/sessions/search", ws.handleSessionsSearch)
+    http.HandleFunc("/api/sessions/export", ws.handleSessionsExport)
 	http.HandleFunc("/api/system/info", ws.handleSystemInfo)
     http.HandleFunc("/api/provider/change", ws.handleProviderChange)
 	http.HandleFunc("/api/sessions/delete", ws.handleSessionsDelete)
@@ -138,66 +165,120 @@ func (ws *WebServer) Start() error {
 	return http.ListenAndServe(addr, nil)
 }
 
-// handleRAGUpload обрабатывает загрузку файлов для RAG
+// handleRAGUpload обрабатывает загрузку файлов для RAG: несколько файлов в поле "file"
+// (или "files") и zip-архивы, из которых берутся поддерживаемые файлы
 func (ws *WebServer) handleRAGUpload(w http.ResponseWriter, r *http.Request) {
     if r.Method != "POST" {
         http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
         return
     }
     
-    // Максимальный размер файла - 10MB
-    if err := r.ParseMultipartForm(10 << 20); err != nil {
-        http.Error(w, fmt.Sprintf("Файл слишком большой: %v", err), http.StatusBadRequest)
-        return
-    }
-    
-    file, handler, err := r.FormFile("file")
-    if err != nil {
-        http.Error(w, fmt.Sprintf("Ошибка получения файла: %v", err), http.StatusBadRequest)
+    // До 32MB в памяти, остальное — во временных файлах
+    if err := r.ParseMultipartForm(32 << 20); err != nil {
+        http.Error(w, fmt.Sprintf("Ошибка разбора формы: %v", err), http.StatusBadRequest)
         return
     }
-    defer file.Close()
     
-    // Читаем содержимое файла
-    data, err := io.ReadAll(file)
-    if err != nil {
-        http.Error(w, fmt.Sprintf("Ошибка чтения файла: %v", err), http.StatusBadRequest)
+    headers := append(r.MultipartForm.File["file"], r.MultipartForm.File["files"]...)
+    if len(headers) == 0 {
+        http.Error(w, "Ошибка получения файла: файлы не переданы", http.StatusBadRequest)
         return
     }
     
-    // Проверяем поддерживаемый формат
-    ext := strings.ToLower(filepath.Ext(handler.Filename))
-    supported := false
-    for _, supportedExt := range []string{".txt", ".json", ".csv", ".md", ".xml", ".yaml", ".yml"} {
-        if ext == supportedExt {
-            supported = true
-            break
+    maxSize := ragMaxFileSize(ws.assistant.GetConfig())
+    var docs []RAGDocument
+    var skipped []RAGSkipped
+    for _, handler := range headers {
+        name := handler.Filename
+        isZip := strings.EqualFold(filepath.Ext(name), ".zip")
+        if !isZip && !isSupportedRAGFile(name) {
+            skipped = append(skipped, RAGSkipped{name, "неподдерживаемый формат"})
+            continue
         }
+        if limit := ragFileSizeLimit(name, maxSize); !isZip && limit > 0 && handler.Size > limit {
+            skipped = append(skipped, RAGSkipped{name, fmt.Sprintf("размер больше лимита %d КБ", limit/1024)})
+            continue
+        }
+        
+        file, err := handler.Open()
+        if err != nil {
+            skipped = append(skipped, RAGSkipped{name, err.Error()})
+            continue
+        }
+        data, err := io.ReadAll(file)
+        file.Close()
+        if err != nil {
+            skipped = append(skipped, RAGSkipped{name, err.Error()})
+            continue
+        }
+        
+        if isZip {
+            zipDocs, zipSkipped, err := ExtractRAGZip(name, data, maxSize)
+            docs = append(docs, zipDocs...)
+            skipped = append(skipped, zipSkipped...)
+            if err != nil {
+                skipped = append(skipped, RAGSkipped{name, err.Error()})
+            }
+            continue
+        }
+        
+        doc, err := ExtractRAGDocument(name, data, maxSize)
+        if err != nil {
+            skipped = append(skipped, RAGSkipped{name, err.Error()})
+            continue
+        }
+        docs = append(docs, doc)
     }
     
-    if !supported {
-        http.Error(w, fmt.Sprintf("Неподдерживаемый формат файла: %s", ext), http.StatusBadRequest)
+    if len(docs) == 0 {
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(http.StatusBadRequest)
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": false,
+            "message": "Не загружено ни одного файла",
+            "skipped": skipped,
+        })
         return
     }
     
-    // Создаем RAG документ
-    ragDoc := RAGDocument{
-        FilePath: handler.Filename,
-        Content:  string(data),
-        Size:     len(data),
-        LoadedAt: time.Now(),
+    // Добавляем документы в коллекцию из формы (по умолчанию — текущую) и сохраняем на диск
+    collection := r.FormValue("collection")
+    if collection == "" {
+        collection = ws.assistant.CurrentRAGCollection()
     }
+    added, replaced, err := ws.assistant.AddRAGDocuments(collection, docs, nil, false)
+    if err != nil {
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(http.StatusBadRequest)
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": false,
+            "message": err.Error(),
+            "skipped": skipped,
+        })
+        return
+    }
+    ws.broadcastRAGStatus()
     
-    // Добавляем документ к существующим данным
-    currentData := ws.assistant.GetRAGData()
-    currentData = append(currentData, ragDoc)
-    ws.assistant.SetRAGData(currentData)
+    totalSize := 0
+    warnings := make(map[string][]string)
+    for _, doc := range docs {
+        totalSize += doc.Size
+        if len(doc.Warnings) > 0 {
+            warnings[doc.FilePath] = doc.Warnings
+        }
+    }
     
     response := map[string]interface{}{
-        "success": true,
-        "message": fmt.Sprintf("Файл загружен: %s (%d символов)", handler.Filename, len(data)),
-        "size":    len(data),
-        "time":    time.Now().Format(time.RFC3339),
+        "success":  true,
+        "message":  fmt.Sprintf("Загружено файлов: %d (%d символов)", len(docs), totalSize),
+        "files":    len(docs),
+        "added":    added,
+        "replaced": replaced,
+        "collection": collection,
+        "size":     totalSize,
+        "skipped":  skipped,
+        "warnings": warnings,
+        "time":     time.Now().Format(time.RFC3339),
     }
     
     w.Header().Set("Content-Type", "application/json")
@@ -259,8 +340,11 @@ func (ws *WebServer) handleRAGDisable(w http.ResponseWriter, r *http.Request) {
         return
     }
     
-    // Очищаем RAG данные
-    ws.assistant.ClearRAGData()
+    // Деактивируем коллекции; на диске они сохраняются
+    if err := ws.assistant.UseRAGCollections(nil); err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
     
     // Рассылаем обновление статуса всем клиентам
     ws.broadcastRAGStatus()
@@ -268,7 +352,7 @@ func (ws *WebServer) handleRAGDisable(w http.ResponseWriter, r *http.Request) {
     response := map[string]interface{}{
         "success": true,
         "enabled": false,
-        "message": "RAG режим отключен, данные очищены",
+        "message": "RAG режим отключен, коллекции сохранены",
         "time":    time.Now().Format(time.RFC3339),
     }
     
@@ -291,13 +375,217 @@ func (ws *WebServer) handleRAGStatus(w http.ResponseWriter, r *http.Request) {
         "enabled":   enabled,
         "documents": ragData,
         "totalSize": ws.calculateRAGTotalSize(ragData),
+        "chunks":    ws.assistant.GetRAGChunkCount(),
+        "collections": ws.assistant.ActiveRAGCollections(),
+        "current":   ws.assistant.CurrentRAGCollection(),
         "time":      time.Now().Format(time.RFC3339),
     }
+    if stores := ws.assistant.GetRAGVectorStores(); len(stores) > 0 {
+        var vectors []map[string]interface{}
+        for _, store := range stores {
+            count, size := store.Size()
+            vectors = append(vectors, map[string]interface{}{
+                "collection": store.Collection,
+                "count":    count,
+                "dim":      store.Dim,
+                "bytes":    size,
+                "provider": store.Provider,
+                "model":    store.Model,
+            })
+        }
+        response["vectors"] = vectors
+    }
     
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(response)
 }
 
+// handleRAGCollections: GET — список коллекций, POST {name, activate} — создать,
+// DELETE ?name= — удалить коллекцию с диска
+func (ws *WebServer) handleRAGCollections(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "application/json")
+    
+    switch r.Method {
+    case "GET":
+        list, err := ListRAGCollections(ws.assistant.ActiveRAGCollections())
+        if err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        if list == nil {
+            list = []RAGCollectionInfo{}
+        }
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success":     true,
+            "collections": list,
+            "current":     ws.assistant.CurrentRAGCollection(),
+        })
+        
+    case "POST":
+        var data struct {
+            Name     string `json:"name"`
+            Activate bool   `json:"activate"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+            http.Error(w, "Некорректный JSON", http.StatusBadRequest)
+            return
+        }
+        if err := ValidateCollectionName(data.Name); err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        if RAGCollectionExists(data.Name) {
+            http.Error(w, fmt.Sprintf("Коллекция '%s' уже существует", data.Name), http.StatusConflict)
+            return
+        }
+        c := NewRAGCollection(data.Name)
+        if err := c.Save(); err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        if data.Activate {
+            active := append([]string{data.Name}, ws.assistant.ActiveRAGCollections()...)
+            if err := ws.assistant.UseRAGCollections(active); err != nil {
+                http.Error(w, err.Error(), http.StatusInternalServerError)
+                return
+            }
+            ws.broadcastRAGStatus()
+        }
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success":    true,
+            "collection": c.Info(),
+        })
+        
+    case "DELETE":
+        name := r.URL.Query().Get("name")
+        if err := DeleteRAGCollection(name); err != nil {
+            http.Error(w, err.Error(), http.StatusNotFound)
+            return
+        }
+        var active []string
+        for _, n := range ws.assistant.ActiveRAGCollections() {
+            if n != name {
+                active = append(active, n)
+            }
+        }
+        if err := ws.assistant.UseRAGCollections(active); err != nil {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+            return
+        }
+        ws.broadcastRAGStatus()
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "success": true,
+            "message": fmt.Sprintf("Коллекция '%s' удалена", name),
+        })
+        
+    default:
+        http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+    }
+}
+
+// handleRAGUse активирует коллекции {names: [...]}; пустой список выключает RAG
+func (ws *WebServer) handleRAGUse(w http.ResponseWriter, r *http.Request) {
+    if r.Method != "POST" {
+        http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+        return
+    }
+    
+    var data struct {
+        Names []string `json:"names"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+        http.Error(w, "Некорректный JSON", http.StatusBadRequest)
+        return
+    }
+    if err := ws.assistant.UseRAGCollections(data.Names); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    ws.broadcastRAGStatus()
+    
+    ragData := ws.assistant.GetRAGData()
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "success":     true,
+        "enabled":     ws.assistant.IsRAGEnabled(),
+        "collections": ws.assistant.ActiveRAGCollections(),
+        "documents":   ragData,
+        "totalSize":   ws.calculateRAGTotalSize(ragData),
+        "chunks":      ws.assistant.GetRAGChunkCount(),
+    })
+}
+
+// handleRAGRemove удаляет документ {doc, collection} из коллекции (по умолчанию — текущей)
+func (ws *WebServer) handleRAGRemove(w http.ResponseWriter, r *http.Request) {
+    if r.Method != "POST" {
+        http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+        return
+    }
+    
+    var data struct {
+        Doc        string `json:"doc"`
+        Collection string `json:"collection"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&data); err != nil || data.Doc == "" {
+        http.Error(w, "Некорректный JSON: нужен doc", http.StatusBadRequest)
+        return
+    }
+    ref := data.Doc
+    if data.Collection != "" {
+        ref = data.Collection + ":" + data.Doc
+    }
+    doc, collection, err := ws.assistant.RemoveRAGDocument(ref)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    ws.broadcastRAGStatus()
+    
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "success":    true,
+        "message":    fmt.Sprintf("Документ %s удален из коллекции '%s'", doc.FilePath, collection),
+        "collection": collection,
+    })
+}
+
+// handleRAGRefresh обновляет измененные файлы коллекций {names} (по умолчанию — активных)
+func (ws *WebServer) handleRAGRefresh(w http.ResponseWriter, r *http.Request) {
+    if r.Method != "POST" {
+        http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+        return
+    }
+    
+    var data struct {
+        Names []string `json:"names"`
+    }
+    if r.ContentLength != 0 {
+        if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+            http.Error(w, "Некорректный JSON", http.StatusBadRequest)
+            return
+        }
+    }
+    
+    reports, err := ws.assistant.RefreshRAGCollections(data.Names)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    for _, report := range reports {
+        if report.HasChanges() {
+            ws.broadcastRAGStatus()
+            break
+        }
+    }
+    
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "success": true,
+        "reports": reports,
+        "chunks":  ws.assistant.GetRAGChunkCount(),
+    })
+}
+
 // calculateRAGTotalSize вычисляет общий размер RAG документов
 func (ws *WebServer) calculateRAGTotalSize(docs []RAGDocument) int {
     total := 0
@@ -318,6 +606,7 @@ func (ws *WebServer) broadcastRAGStatus() {
             "enabled":   enabled,
             "documents": ragData,
             "totalSize": ws.calculateRAGTotalSize(ragData),
+            "collections": ws.assistant.ActiveRAGCollections(),
             "timestamp": time.Now().Format(time.RFC3339),
         },
     }
@@ -368,6 +657,84 @@ func (ws *WebServer) handleSessionsDelete(w http.ResponseWriter, r *http.Request
     json.NewEncoder(w).Encode(response)
 }
 
+// handleSessionsExport экспортирует текущую или сохраненную сессию.
+// Для md/txt/json/html возвращает документ как вложение, для code — извлекает файлы в директорию
+func (ws *WebServer) handleSessionsExport(w http.ResponseWriter, r *http.Request) {
+    if r.Method != "POST" {
+        http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+        return
+    }
+
+    var data struct {
+        Format string `json:"format"`
+        Name   string `json:"name,omitempty"` // пусто — текущая сессия
+        Dir    string `json:"dir,omitempty"`  // для format=code, относительно рабочей директории
+    }
+
+    if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+        http.Error(w, "Некорректный JSON", http.StatusBadRequest)
+        return
+    }
+    if data.Format == "" {
+        data.Format = "md"
+    }
+
+    var session SessionData
+    if data.Name == "" {
+        session = ws.assistant.commandHandler.currentSessionData()
+    } else {
+        if strings.ContainsAny(data.Name, "/\\") || strings.Contains(data.Name, "..") {
+            http.Error(w, "Недопустимое имя сессии", http.StatusBadRequest)
+            return
+        }
+        loaded, err := readSessionFile(filepath.Join(getSessionsDir(), data.Name+".json"))
+        if err != nil {
+            http.Error(w, fmt.Sprintf("Сессия не найдена: %s", data.Name), http.StatusNotFound)
+            return
+        }
+        session = *loaded
+    }
+
+    if data.Format == "code" {
+        if data.Dir == "" || !filepath.IsLocal(data.Dir) {
+            http.Error(w, "Укажите относительную директорию dir внутри рабочей директории", http.StatusBadRequest)
+            return
+        }
+        files, err := ExtractCodeFiles(&session, data.Dir, ws.assistant.workspace)
+        if err != nil {
+            http.Error(w, fmt.Sprintf("Ошибка экспорта: %v", err), http.StatusBadRequest)
+            return
+        }
+        response := map[string]interface{}{
+            "success": true,
+            "dir":     data.Dir,
+            "files":   files,
+            "count":   len(files),
+            "time":    time.Now().Format(time.RFC3339),
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(response)
+        return
+    }
+
+    content, err := RenderExport(data.Format, &session)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    contentTypes := map[string]string{
+        "md":   "text/markdown; charset=utf-8",
+        "txt":  "text/plain; charset=utf-8",
+        "json": "application/json",
+        "html": "text/html; charset=utf-8",
+    }
+    filename := fmt.Sprintf("export_%s.%s", time.Now().Format("20060102_150405"), data.Format)
+    w.Header().Set("Content-Type", contentTypes[data.Format])
+    w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+    w.Write(content)
+}
+
 // handleProviderChange обрабатывает смену провайдера через веб-интерфейс
 func (ws *WebServer) handleProviderChange(w http.ResponseWriter, r *http.Request) {
     if r.Method != "POST" {
@@ -538,6 +905,9 @@ func (ws *WebServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		ws.mu.Lock()
 		delete(ws.connections, conn)
 		ws.mu.Unlock()
+		ws.pendingMu.Lock()
+		ws.evictPending(conn)
+		ws.pendingMu.Unlock()
 		conn.Close()
 	}()
 	
@@ -589,6 +959,8 @@ func (ws *WebServer) handleWSMessage(conn *websocket.Conn, msg WSMessage) {
         ws.handleFSLsWS(conn, msg)
     case "fs_open":
         ws.handleFSOpenWS(conn, msg)
+	case "apply_changes":
+		ws.handleApplyChanges(conn, msg)
 	default:
 		ws.sendError(conn, fmt.Sprintf("Неизвестный тип сообщения: %s", msg.Type))
 	}
@@ -605,6 +977,7 @@ func (ws *WebServer) sendRAGStatus(conn *websocket.Conn) {
             "enabled":   enabled,
             "documents": ragData,
             "totalSize": ws.calculateRAGTotalSize(ragData),
+            "collections": ws.assistant.ActiveRAGCollections(),
             "timestamp": time.Now().Format(time.RFC3339),
         },
     })
@@ -765,6 +1138,11 @@ func (ws *WebServer) handleQuery(conn *websocket.Conn, msg WSMessage) {
 		ws.sendError(conn, "Некорректный запрос")
 		return
 	}
+
+	// Непринятые изменения прошлого ответа больше не применить: новый ответ их заменяет
+	ws.pendingMu.Lock()
+	ws.evictPending(conn)
+	ws.pendingMu.Unlock()
 	
 	// Отправляем статус "думаю"
 	ws.sendMessage(conn, WSMessage{
@@ -805,23 +1183,36 @@ func (ws *WebServer) handleQuery(conn *websocket.Conn, msg WSMessage) {
 		}
 		
 		// Обычный запрос
-		response, err := ws.processQuery(ctx, query)
+		response, ragSources, err := ws.processQuery(ctx, query)
 		if err != nil {
 			ws.sendError(conn, err.Error())
 			return
 		}
 		
+		payload := map[string]interface{}{
+			"query":    query,
+			"response": response,
+			"time":     time.Now().Format(time.RFC3339),
+			"markdown": IsMarkdownContent(response),
+		}
+		if len(ragSources) > 0 {
+			report := CheckCitations(response, ragSources)
+			payload["sources"] = report.Sources
+			payload["cited"] = report.Cited
+			payload["invalid_citations"] = report.Invalid
+		}
+		
 		// Отправляем ответ
 		ws.sendMessage(conn, WSMessage{
-			Type: "response",
-			Payload: map[string]interface{}{
-				"query":    query,
-				"response": response,
-				"time":     time.Now().Format(time.RFC3339),
-				"markdown": IsMarkdownContent(response),
-			},
+			Type:    "response",
+			Payload: payload,
 		})
 		
+		// Файлы из ответа не записываются сразу: клиент получает дифф и решает по каждому
+		if files := ws.assistant.codeParser.ParseCodeBlocks(response); len(files) > 0 {
+			ws.sendPendingChanges(conn, files)
+		}
+		
 		// Обновляем контекст для всех клиентов
 		ws.broadcastContext()
 	}()
@@ -873,13 +1264,14 @@ func (ws *WebServer) handleSetContextLimit(w http.ResponseWriter, r *http.Reques
     json.NewEncoder(w).Encode(response)
 }
 
-// processQuery обрабатывает запрос через существующего ассистента
-func (ws *WebServer) processQuery(ctx context.Context, query string) (string, error) {
+// processQuery обрабатывает запрос через существующего ассистента.
+// Возвращает также RAG-фрагменты, переданные модели
+func (ws *WebServer) processQuery(ctx context.Context, query string) (string, []RAGSource, error) {
 	// Используем существующую логику ассистента
 	refs, hasRefs := ws.assistant.fileParser.ExtractFileReferences(query)
 	contextStr := ws.assistant.buildContext(refs, hasRefs)
 
-    ragContext := ws.assistant.GetRAGContext()
+    ragContext, ragSources := ws.assistant.GetRAGContext(query)
     if ragContext != "" {
         contextStr += ragContext
     }	
@@ -892,13 +1284,162 @@ func (ws *WebServer) processQuery(ctx context.Context, query string) (string, er
 	response, err := SendMessageToLLM(ctx, prompt, 
 		ws.assistant.provider, ws.assistant.model, ws.assistant.apiKey)
 	if err != nil {
-		return "", err
+		return "", nil, err
+	}
+	response, err = ws.assistant.answerTableQueries(ctx, prompt, response, func(c context.Context, p string) (string, error) {
+		return SendMessageToLLM(c, p, ws.assistant.provider, ws.assistant.model, ws.assistant.apiKey)
+	}, false)
+	if err != nil {
+		return "", nil, err
 	}
 	
 	// Обновляем контекст беседы
 	ws.assistant.context.AddExchange(query, response)
+	ws.assistant.maybeAutoSummarize(ctx)
+	ws.assistant.autosave()
 	
-	return response, nil
+	return response, ragSources, nil
+}
+
+// sendPendingChanges отправляет клиенту диффы сгенерированных файлов для просмотра
+func (ws *WebServer) sendPendingChanges(conn *websocket.Conn, files []CodeFile) {
+	var changes []FileChange
+	var blocked []string
+	unchanged := 0
+	for _, f := range files {
+		// Содержимое файлов вне рабочего пространства не читаем и не показываем
+		if _, err := ws.assistant.workspace.Resolve(f.Path); err != nil {
+			blocked = append(blocked, err.Error())
+			continue
+		}
+		change := NewFileChange(f)
+		if change.Unchanged() {
+			unchanged++
+			continue
+		}
+		changes = append(changes, change)
+	}
+	if len(changes) == 0 && len(blocked) == 0 {
+		return
+	}
+
+	// Незакоммиченные изменения показываем до применения (git_auto_commit, git_branch)
+	var dirty []string
+	if gitEnabled(ws.assistant.GetConfig()) {
+		dirty, _ = GitDirtyFiles()
+	}
+
+	id := strconv.FormatInt(time.Now().UnixNano(), 36)
+	ws.pendingMu.Lock()
+	ws.evictPending(conn)
+	ws.pending[id] = pendingChanges{changes: changes, conn: conn, created: time.Now()}
+	ws.pendingMu.Unlock()
+
+	ws.sendMessage(conn, WSMessage{
+		Type: "pending_changes",
+		Payload: map[string]interface{}{
+			"id":        id,
+			"files":     changes,
+			"unchanged": unchanged,
+			"blocked":   blocked,
+			"git_dirty": dirty,
+		},
+	})
+}
+
+// evictPending удаляет устаревшие изменения и изменения соединения conn (если не nil):
+// новый запрос или закрытие вкладки заменяет прежнее предложение. Вызывается под pendingMu
+func (ws *WebServer) evictPending(conn *websocket.Conn) {
+	for id, p := range ws.pending {
+		if (conn != nil && p.conn == conn) || time.Since(p.created) > pendingTTL {
+			delete(ws.pending, id)
+		}
+	}
+}
+
+// handleApplyChanges записывает принятые файлы. Payload: {"id", "accept": [пути], "edits": {путь: содержимое}};
+// пустой accept отклоняет все изменения
+func (ws *WebServer) handleApplyChanges(conn *websocket.Conn, msg WSMessage) {
+	var req struct {
+		ID     string            `json:"id"`
+		Accept []string          `json:"accept"`
+		Edits  map[string]string `json:"edits"`
+	}
+	data, _ := json.Marshal(msg.Payload)
+	if err := json.Unmarshal(data, &req); err != nil {
+		ws.sendError(conn, "Некорректный запрос на применение изменений")
+		return
+	}
+
+	ws.pendingMu.Lock()
+	ws.evictPending(nil)
+	entry, ok := ws.pending[req.ID]
+	delete(ws.pending, req.ID)
+	ws.pendingMu.Unlock()
+	if !ok {
+		ws.sendError(conn, "Изменения не найдены, устарели или уже обработаны")
+		return
+	}
+	changes := entry.changes
+
+	var written, rejected, failed []string
+	var commit string
+	var accepted []CodeFile
+	for _, change := range changes {
+		if !containsString(req.Accept, change.Path) {
+			rejected = append(rejected, change.Path)
+			continue
+		}
+		f := change.CodeFile()
+		if edited, ok := req.Edits[change.Path]; ok {
+			f.Content = edited
+		}
+		accepted = append(accepted, f)
+	}
+
+	if len(accepted) > 0 && gitEnabled(ws.assistant.GetConfig()) {
+		if err := gitSwitchBranch(ws.assistant.GetConfig()); err != nil {
+			failed = append(failed, err.Error())
+			accepted = nil // не пишем в другую ветку
+		}
+	}
+
+	if len(accepted) > 0 {
+		paths := make([]string, 0, len(accepted))
+		for _, f := range accepted {
+			paths = append(paths, f.Path)
+		}
+		op := ws.assistant.journal.Begin("Код: "+strings.Join(paths, ", "), nil)
+		for _, f := range accepted {
+			op.TrackFile(f.Path)
+			if err := ws.assistant.workspace.WriteFile(f.Path, []byte(f.Content)); err != nil {
+				failed = append(failed, err.Error())
+				continue
+			}
+			written = append(written, f.Path)
+		}
+		op.Commit()
+
+		if len(written) > 0 && ws.assistant.GetConfig().GetBool("git_auto_commit") && IsGitRepo() {
+			c, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+			var err error
+			if commit, err = ws.assistant.GitCommitChanges(c, written); err != nil {
+				failed = append(failed, "git: "+err.Error())
+			}
+			cancel()
+		}
+	}
+
+	ws.sendMessage(conn, WSMessage{
+		Type: "changes_applied",
+		Payload: map[string]interface{}{
+			"id":       req.ID,
+			"written":  written,
+			"rejected": rejected,
+			"errors":   failed,
+			"commit":   commit,
+		},
+	})
 }
 
 // handleCommandWS обрабатывает команды через WebSocket
@@ -1236,21 +1777,48 @@ func (ws *WebServer) handleSessionsSave(w http.ResponseWriter, r *http.Request)
     }
     
     var data struct {
-        Name string `json:"name"`
+        Name       string `json:"name"`
+        Encrypt    *bool  `json:"encrypt,omitempty"`    // не задано — по настройке encrypt_sessions
+        Passphrase string `json:"passphrase,omitempty"` // пароль шифрования, если он еще не введен
     }
     
     if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
         http.Error(w, "Некорректный JSON", http.StatusBadRequest)
         return
     }
+    if data.Name == "" {
+        data.Name = "session"
+    }
+    encrypt := ws.assistant.commandHandler.config.GetBool("encrypt_sessions")
+    if data.Encrypt != nil {
+        encrypt = *data.Encrypt
+    }
     
-    // Используем существующий CommandHandler для сохранения
-    ws.assistant.commandHandler.handleSave([]string{data.Name})
+    path, err := sessionPath(data.Name)
+    if err != nil {
+        writeSessionError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+    // Пароль в терминале здесь спрашивать некому: без ключа просим прислать его в запросе
+    if encrypt {
+        if data.Passphrase != "" {
+            sessionCrypto.SetPassphrase(data.Passphrase)
+        }
+        if !sessionCrypto.Ready() {
+            writeSessionError(w, http.StatusLocked, "Нужен пароль шифрования: передайте его в поле passphrase")
+            return
+        }
+    }
+    if _, err := ws.assistant.commandHandler.saveSession(path, encrypt); err != nil {
+        writeSessionError(w, http.StatusInternalServerError, fmt.Sprintf("Ошибка сохранения: %v", err))
+        return
+    }
     
     response := map[string]interface{}{
-        "success": true,
-        "message": fmt.Sprintf("Сессия сохранена: %s", data.Name),
-        "time":    time.Now().Format(time.RFC3339),
+        "success":   true,
+        "message":   fmt.Sprintf("Сессия сохранена: %s", data.Name),
+        "encrypted": encrypt,
+        "time":      time.Now().Format(time.RFC3339),
     }
     
     w.Header().Set("Content-Type", "application/json")
@@ -1264,7 +1832,9 @@ func (ws *WebServer) handleSessionsLoad(w http.ResponseWriter, r *http.Request)
     }
     
     var data struct {
-        Name string `json:"name"`
+        Name       string `json:"name"`
+        Exchange   int    `json:"exchange,omitempty"`   // загрузить историю до этого обмена
+        Passphrase string `json:"passphrase,omitempty"` // пароль для зашифрованной сессии
     }
     
     if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
@@ -1272,18 +1842,89 @@ func (ws *WebServer) handleSessionsLoad(w http.ResponseWriter, r *http.Request)
         return
     }
     
-    // Используем существующий CommandHandler для загрузки
-    ws.assistant.commandHandler.handleLoad([]string{data.Name})
+    path, err := sessionPath(data.Name)
+    if err != nil || data.Name == "" {
+        writeSessionError(w, http.StatusBadRequest, "Некорректное имя сессии")
+        return
+    }
+    if _, err := os.Stat(path); err != nil {
+        writeSessionError(w, http.StatusNotFound, fmt.Sprintf("Сессия '%s' не найдена", data.Name))
+        return
+    }
+    if data.Passphrase != "" {
+        sessionCrypto.SetPassphrase(data.Passphrase)
+    }
+    session, err := readSessionFile(path) // без запроса пароля: ErrNoKey, если он неизвестен
+    switch {
+    case errors.Is(err, ErrNoKey):
+        writeSessionError(w, http.StatusLocked, "Сессия зашифрована: передайте пароль в поле passphrase")
+        return
+    case errors.Is(err, ErrBadKey):
+        writeSessionError(w, http.StatusUnauthorized, err.Error())
+        return
+    case err != nil:
+        writeSessionError(w, http.StatusInternalServerError, fmt.Sprintf("Ошибка загрузки: %v", err))
+        return
+    }
+    if err := ws.assistant.commandHandler.applySession(data.Name, session, data.Exchange, ":load "+data.Name); err != nil {
+        writeSessionError(w, http.StatusBadRequest, err.Error())
+        return
+    }
     
     // Обновляем контекст для всех клиентов после загрузки
     ws.broadcastContext()
     
+    response := map[string]interface{}{
+        "success":   true,
+        "message":   fmt.Sprintf("Сессия загружена: %s", data.Name),
+        "exchanges": len(session.Exchanges),
+        "time":      time.Now().Format(time.RFC3339),
+    }
+    
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(response)
+}
+
+// writeSessionError отвечает на запрос к сессиям ошибкой в JSON
+func writeSessionError(w http.ResponseWriter, status int, message string) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "success": false,
+        "message": message,
+    })
+}
+
+// handleSessionsSearch выполняет полнотекстовый поиск: GET /api/sessions/search?q=<текст>
+func (ws *WebServer) handleSessionsSearch(w http.ResponseWriter, r *http.Request) {
+    if r.Method != "GET" {
+        http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+        return
+    }
+
+    query := strings.TrimSpace(r.URL.Query().Get("q"))
+    if query == "" {
+        http.Error(w, "Параметр q обязателен", http.StatusBadRequest)
+        return
+    }
+
+    results, err := SearchSessions(query, ws.assistant.GetContext().GetAllExchanges())
+    if err != nil {
+        http.Error(w, fmt.Sprintf("Ошибка поиска: %v", err), http.StatusInternalServerError)
+        return
+    }
+    if results == nil {
+        results = []SessionSearchResult{}
+    }
+
     response := map[string]interface{}{
         "success": true,
-        "message": fmt.Sprintf("Сессия загружена: %s", data.Name),
+        "query":   query,
+        "results": results,
+        "count":   len(results),
         "time":    time.Now().Format(time.RFC3339),
     }
-    
+
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(response)
 }
@@ -1308,11 +1949,20 @@ func (ws *WebServer) handleSessionsList(w http.ResponseWriter, r *http.Request)
                     continue
                 }
                 
-                sessions = append(sessions, map[string]interface{}{
+                session := map[string]interface{}{
                     "name":     strings.TrimSuffix(f.Name(), ".json"),
                     "modified": info.ModTime().Format(time.RFC3339),
                     "size":     info.Size(),
-                })
+                }
+                if data, err := readSessionFile(filepath.Join(dir, f.Name())); err == nil {
+                    title := data.Title
+                    if title == "" {
+                        title = autoTitle(data.Exchanges)
+                    }
+                    session["title"] = title
+                    session["tags"] = data.Tags
+                }
+                sessions = append(sessions, session)
             }
         }
     }
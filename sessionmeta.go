@@ -0,0 +1,181 @@
+// sessionmeta.go
+// Метаданные сессии: заголовок, теги, рабочая директория, набор RAG-документов, закрепленные заметки
+
+package main
+
+import (
+	ctx "context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const MaxSessionTitleLength = 60
+
+// SessionMeta — метаданные текущей сессии, которые сохраняются вместе с обменами
+type SessionMeta struct {
+	Title string
+	Tags  []string
+	mu    sync.Mutex
+}
+
+// NewSessionMeta создает пустые метаданные сессии
+func NewSessionMeta() *SessionMeta {
+	return &SessionMeta{}
+}
+
+// GetTitle возвращает заголовок сессии
+func (sm *SessionMeta) GetTitle() string {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.Title
+}
+
+// SetTitle устанавливает заголовок сессии
+func (sm *SessionMeta) SetTitle(title string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.Title = truncateTitle(title)
+}
+
+// GetTags возвращает копию тегов сессии
+func (sm *SessionMeta) GetTags() []string {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return append([]string(nil), sm.Tags...)
+}
+
+// SetTags заменяет теги сессии (для :load)
+func (sm *SessionMeta) SetTags(tags []string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.Tags = nil
+	for _, tag := range tags {
+		if t := normalizeTag(tag); t != "" && !containsString(sm.Tags, t) {
+			sm.Tags = append(sm.Tags, t)
+		}
+	}
+	sort.Strings(sm.Tags)
+}
+
+// Reset сбрасывает заголовок и теги (для :clean): новая беседа не наследует описание старой
+func (sm *SessionMeta) Reset() {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.Title = ""
+	sm.Tags = nil
+}
+
+// AddTag добавляет тег; возвращает false, если тег пустой или уже есть
+func (sm *SessionMeta) AddTag(tag string) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	t := normalizeTag(tag)
+	if t == "" || containsString(sm.Tags, t) {
+		return false
+	}
+	sm.Tags = append(sm.Tags, t)
+	sort.Strings(sm.Tags)
+	return true
+}
+
+// RemoveTag удаляет тег; возвращает false, если тега не было
+func (sm *SessionMeta) RemoveTag(tag string) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	t := normalizeTag(tag)
+	for i, existing := range sm.Tags {
+		if existing == t {
+			sm.Tags = append(sm.Tags[:i], sm.Tags[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeTag приводит тег к нижнему регистру и убирает ведущий '#'
+func normalizeTag(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	tag = strings.TrimPrefix(tag, "#")
+	return strings.Join(strings.Fields(tag), "-")
+}
+
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func truncateTitle(title string) string {
+	title = strings.Join(strings.Fields(title), " ")
+	runes := []rune(title)
+	if len(runes) > MaxSessionTitleLength {
+		return string(runes[:MaxSessionTitleLength-3]) + "..."
+	}
+	return title
+}
+
+// autoTitle строит заголовок из вопроса первого обмена
+func autoTitle(exchanges []string) string {
+	if len(exchanges) == 0 {
+		return ""
+	}
+	first := exchanges[0]
+	if i := strings.Index(first, "\nОтвет:"); i >= 0 {
+		first = first[:i]
+	}
+	first = strings.TrimPrefix(first, "Вопрос: ")
+	if i := strings.Index(first, "\n"); i >= 0 {
+		first = first[:i]
+	}
+	return truncateTitle(first)
+}
+
+// GenerateSessionTitle просит LLM придумать короткий заголовок по первым обменам
+func GenerateSessionTitle(c ctx.Context, exchanges []string, provider, model, apiKey string) (string, error) {
+	if len(exchanges) == 0 {
+		return "", fmt.Errorf("контекст пуст")
+	}
+	sample := exchanges
+	if len(sample) > 3 {
+		sample = sample[:3]
+	}
+	text := strings.Join(sample, "\n\n")
+	if len(text) > 4000 {
+		text = text[:4000]
+	}
+
+	prompt := "Придумай короткий заголовок (до 8 слов) для этого диалога. " +
+		"ВЕРНИ ТОЛЬКО заголовок без кавычек и пояснений.\n\n" + text
+	response, err := SendMessageToLLM(c, prompt, provider, model, apiKey)
+	if err != nil {
+		return "", err
+	}
+	title := strings.Trim(strings.TrimSpace(response), "\"'«»`")
+	if i := strings.Index(title, "\n"); i >= 0 {
+		title = title[:i]
+	}
+	if title == "" {
+		return "", fmt.Errorf("LLM вернула пустой заголовок")
+	}
+	return truncateTitle(title), nil
+}
+
+// readSessionFile читает файл сохраненной сессии без запроса пароля:
+// зашифрованные сессии доступны, только если ключ уже известен
+func readSessionFile(path string) (*SessionData, error) {
+	var data SessionData
+	if err := readSecureJSON(path, &data, false); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// sessionHasTag проверяет, есть ли у сессии тег
+func sessionHasTag(data *SessionData, tag string) bool {
+	return containsString(data.Tags, normalizeTag(tag))
+}
@@ -0,0 +1,107 @@
+// summarizer.go
+// Накопительная (иерархическая) суммаризация контекста: старые обмены сжимаются в сводку,
+// последние N обменов остаются дословно
+
+package main
+
+import (
+	ctx "context"
+	"fmt"
+	"strings"
+)
+
+const (
+	DefaultContextTokenBudget = 8000 // порог оценки токенов для автосуммаризации
+	DefaultSummaryKeepRecent  = 4    // сколько последних обменов не сжимать
+	MaxSummarySize            = 4000 // ограничение размера сводки в символах
+	EvictedBatchShare         = 4    // вытесненные обмены сжимаются пачкой, набрав 1/4 бюджета токенов
+)
+
+// SummarizeContext сжимает все обмены, кроме keepRecent последних, и вытесненные лимитами
+// в накопительную сводку.
+// Предыдущая сводка учитывается, поэтому каждое сжатие строится поверх предыдущего.
+// Возвращает новую сводку и количество сжатых обменов.
+func SummarizeContext(c ctx.Context, cm *ContextManager, keepRecent int, provider, model, apiKey string) (string, int, error) {
+	old, previous := cm.SplitForSummary(keepRecent)
+	if len(old) == 0 {
+		return previous, 0, nil
+	}
+
+	response, err := SendMessageToLLM(c, buildSummaryPrompt(previous, old), provider, model, apiKey)
+	if err != nil {
+		return "", 0, err
+	}
+
+	summary := strings.TrimSpace(response)
+	if summary == "" {
+		return "", 0, fmt.Errorf("LLM вернула пустую сводку")
+	}
+	if runes := []rune(summary); len(runes) > MaxSummarySize {
+		summary = string(runes[:MaxSummarySize]) + "...(обрезано)"
+	}
+
+	if err := cm.ApplySummary(summary, previous, old); err != nil {
+		return "", 0, err
+	}
+	return summary, len(old), nil
+}
+
+// buildSummaryPrompt формирует промпт для обновления накопительной сводки
+func buildSummaryPrompt(previous string, exchanges []string) string {
+	var b strings.Builder
+	b.WriteString("Обнови сводку диалога. Сохрани ключевые факты, решения, имена файлов и договоренности, ")
+	b.WriteString("отбрось несущественные детали. Сводка должна быть не длиннее 10 предложений.\n\n")
+	if previous != "" {
+		b.WriteString("ТЕКУЩАЯ СВОДКА:\n")
+		b.WriteString(previous)
+		b.WriteString("\n\n")
+	}
+	b.WriteString("НОВЫЕ ОБМЕНЫ ДЛЯ ВКЛЮЧЕНИЯ В СВОДКУ:\n")
+	b.WriteString(strings.Join(exchanges, "\n\n"))
+	b.WriteString("\n\nВЕРНИ ТОЛЬКО обновленную сводку.")
+	return b.String()
+}
+
+// maybeAutoSummarize сжимает старые обмены, если контекст приблизился к бюджету токенов
+// или вытесненные лимитами окна обмены набрали долю бюджета. Вытесненные копятся пачкой,
+// чтобы не делать лишний запрос к модели после каждого вопроса
+func (a *Assistant) maybeAutoSummarize(c ctx.Context) {
+	config := a.GetConfig()
+	if !config.GetBool("auto_summarize") {
+		return
+	}
+
+	budget := config.GetInt("context_token_budget", DefaultContextTokenBudget)
+	tokens := a.context.GetEstimatedTokens()
+	evicted := a.context.EvictedTokens()
+	if tokens < budget && (evicted == 0 || evicted < budget/EvictedBatchShare) {
+		return
+	}
+
+	keep := config.GetInt("summary_keep_recent", DefaultSummaryKeepRecent)
+	if tokens >= budget {
+		fmt.Printf("🗜️  Контекст приблизился к бюджету (~%d / %d токенов), сжимаю старые обмены...\n", tokens, budget)
+	} else {
+		keep = a.context.GetExchangeCount() // окно не трогаем, сжимаем только вытесненные
+		fmt.Printf("🗜️  Лимит окна вытеснил обменов: %d (~%d токенов), добавляю их в сводку...\n",
+			a.context.EvictedCount(), evicted)
+	}
+
+	op := a.journal.Begin("Автосуммаризация", a.context)
+	_, count, err := SummarizeContext(c, a.context, keep, a.provider, a.model, a.apiKey)
+	if err == nil && count > 0 {
+		op.Commit()
+	}
+	if err != nil {
+		fmt.Printf("⚠️  Автосуммаризация не удалась: %v\n", err)
+		return
+	}
+	if count == 0 {
+		if a.isDebugMode() {
+			fmt.Println("🔧 Нечего сжимать: в контексте только последние обмены")
+		}
+		return
+	}
+	fmt.Printf("✅ Сжато обменов: %d (токенов теперь ~%d). Отмена: :summarize undo\n",
+		count, a.context.GetEstimatedTokens())
+}
@@ -0,0 +1,1257 @@
+// tables.go
+// Вопросы к табличным RAG-данным: CSV и JSON-массивы объектов распознаются при загрузке,
+// модель получает схему и примеры строк и отвечает запросом на ограниченном SQL-подобном
+// языке, который выполняется локально по всем строкам; результат возвращается модели
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	tableSampleRows   = 5   // примеров строк в контексте
+	tableResultRows   = 100 // максимум строк результата, передаваемых модели
+	tableQueryRounds  = 2   // сколько раз модель может уточнить запрос
+	tableMinRows      = 2   // меньше строк — обычный текст, а не таблица
+	tableMaxCellWidth = 80
+)
+
+// tableQueryRe находит блоки ```query с запросом к таблице
+var tableQueryRe = regexp.MustCompile("(?s)```(?:query|sql)\\s*\\n(.*?)```")
+
+// RAGTable — табличный документ RAG
+type RAGTable struct {
+	Name     string // имя для запросов: имя файла без расширения
+	DocID    int
+	FilePath string
+	Columns  []string
+	Types    []string // "число" или "текст"
+	Rows     [][]string
+}
+
+// parseTable распознает CSV/TSV или JSON-массив объектов; nil — документ не таблица
+func parseTable(doc RAGDocument) *RAGTable {
+	var columns []string
+	var rows [][]string
+	switch doc.Format {
+	case "csv", "tsv":
+		columns, rows = parseCSVTable(doc.Content)
+	case "json":
+		columns, rows = parseJSONTable(doc.Content)
+	default:
+		return nil
+	}
+	if len(columns) == 0 || len(rows) < tableMinRows {
+		return nil
+	}
+
+	t := &RAGTable{FilePath: doc.FilePath, Columns: columns, Rows: rows}
+	t.Types = make([]string, len(columns))
+	for i := range columns {
+		t.Types[i] = "число"
+		filled := 0
+		for _, row := range rows {
+			if row[i] == "" {
+				continue
+			}
+			filled++
+			if _, ok := parseNumber(row[i]); !ok {
+				t.Types[i] = "текст"
+				break
+			}
+		}
+		if filled == 0 {
+			t.Types[i] = "текст"
+		}
+	}
+	return t
+}
+
+// parseCSVTable читает CSV с заголовком; разделитель определяется по первой строке
+func parseCSVTable(content string) ([]string, [][]string) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	firstLine := content
+	if i := strings.IndexByte(content, '\n'); i >= 0 {
+		firstLine = content[:i]
+	}
+	delimiter, best := ',', 0
+	for _, d := range []rune{',', ';', '\t', '|'} {
+		if n := strings.Count(firstLine, string(d)); n > best {
+			delimiter, best = d, n
+		}
+	}
+
+	r := csv.NewReader(strings.NewReader(content))
+	r.Comma = delimiter
+	r.LazyQuotes = true
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil || len(records) < 2 {
+		return nil, nil
+	}
+
+	columns := uniqueColumnNames(records[0])
+	rows := make([][]string, 0, len(records)-1)
+	for _, rec := range records[1:] {
+		if len(rec) == 1 && strings.TrimSpace(rec[0]) == "" {
+			continue
+		}
+		row := make([]string, len(columns))
+		for i := range row {
+			if i < len(rec) {
+				row[i] = strings.TrimSpace(rec[i])
+			}
+		}
+		rows = append(rows, row)
+	}
+	return columns, rows
+}
+
+// parseJSONTable читает массив объектов (или первый такой массив в объекте верхнего уровня)
+func parseJSONTable(content string) ([]string, [][]string) {
+	var root interface{}
+	dec := json.NewDecoder(strings.NewReader(content))
+	dec.UseNumber()
+	if err := dec.Decode(&root); err != nil {
+		return nil, nil
+	}
+
+	items, ok := root.([]interface{})
+	if !ok {
+		obj, isObj := root.(map[string]interface{})
+		if !isObj {
+			return nil, nil
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if arr, isArr := obj[k].([]interface{}); isArr && len(arr) > 0 {
+				if _, isObjArr := arr[0].(map[string]interface{}); isObjArr {
+					items = arr
+					break
+				}
+			}
+		}
+	}
+
+	// Порядок колонок — как в первом объекте, где они встретились
+	var columns []string
+	index := make(map[string]int)
+	var objects []map[string]interface{}
+	for _, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		objects = append(objects, obj)
+	}
+	for _, obj := range objects {
+		var keys []string
+		for k := range obj {
+			if _, seen := index[k]; !seen {
+				keys = append(keys, k)
+			}
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return strings.Index(content, `"`+keys[i]+`"`) < strings.Index(content, `"`+keys[j]+`"`)
+		})
+		for _, k := range keys {
+			index[k] = len(columns)
+			columns = append(columns, k)
+		}
+	}
+
+	rows := make([][]string, 0, len(objects))
+	for _, obj := range objects {
+		row := make([]string, len(columns))
+		for k, v := range obj {
+			row[index[k]] = jsonCell(v)
+		}
+		rows = append(rows, row)
+	}
+	return columns, rows
+}
+
+func jsonCell(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case json.Number:
+		return val.String()
+	case bool:
+		return strconv.FormatBool(val)
+	default:
+		data, _ := json.Marshal(val)
+		return string(data)
+	}
+}
+
+// uniqueColumnNames заменяет пустые и повторяющиеся имена колонок
+func uniqueColumnNames(header []string) []string {
+	columns := make([]string, len(header))
+	seen := make(map[string]int)
+	for i, h := range header {
+		name := strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))
+		if name == "" {
+			name = fmt.Sprintf("col%d", i+1)
+		}
+		if n := seen[strings.ToLower(name)]; n > 0 {
+			seen[strings.ToLower(name)]++
+			name = fmt.Sprintf("%s_%d", name, n+1)
+		} else {
+			seen[strings.ToLower(name)] = 1
+		}
+		columns[i] = name
+	}
+	return columns
+}
+
+// tableName делает из имени файла идентификатор для запросов
+func tableName(path string, used map[string]bool) string {
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	var b strings.Builder
+	for _, r := range strings.ToLower(base) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	name := strings.Trim(b.String(), "_")
+	if name == "" || unicode.IsDigit([]rune(name)[0]) {
+		name = "t_" + name
+	}
+	unique := name
+	for i := 2; used[unique]; i++ {
+		unique = fmt.Sprintf("%s_%d", name, i)
+	}
+	used[unique] = true
+	return unique
+}
+
+// buildRAGTables находит табличные документы
+func buildRAGTables(docs []RAGDocument) []*RAGTable {
+	var tables []*RAGTable
+	used := make(map[string]bool)
+	for i, doc := range docs {
+		t := parseTable(doc)
+		if t == nil {
+			continue
+		}
+		t.DocID = i + 1
+		t.Name = tableName(doc.FilePath, used)
+		tables = append(tables, t)
+	}
+	return tables
+}
+
+// tableDocIDs — документы, разобранные в таблицы (DocID)
+func tableDocIDs(tables []*RAGTable) map[int]bool {
+	ids := make(map[int]bool, len(tables))
+	for _, t := range tables {
+		ids[t.DocID] = true
+	}
+	return ids
+}
+
+func parseNumber(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		// Десятичная запятая: 12,5
+		if strings.Count(s, ",") == 1 && !strings.Contains(s, ".") {
+			f, err = strconv.ParseFloat(strings.Replace(s, ",", ".", 1), 64)
+		}
+		if err != nil {
+			return 0, false
+		}
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+func formatNumber(f float64) string {
+	if f == math.Trunc(f) && math.Abs(f) < 1e15 {
+		return strconv.FormatFloat(f, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(f, 'f', 4, 64)
+}
+
+// describeTables формирует описание таблиц и правила запросов для промпта
+func describeTables(tables []*RAGTable) string {
+	var b strings.Builder
+	b.WriteString("\n=== ТАБЛИЦЫ ===\n")
+	b.WriteString("Табличные файлы загружены целиком; ниже схема и первые строки.\n\n")
+	for _, t := range tables {
+		b.WriteString(fmt.Sprintf("Таблица %s (файл %s, %d строк):\n", t.Name, filepath.Base(t.FilePath), len(t.Rows)))
+		for i, col := range t.Columns {
+			b.WriteString(fmt.Sprintf("  - %s: %s\n", quoteIdent(col), t.Types[i]))
+		}
+		n := tableSampleRows
+		if n > len(t.Rows) {
+			n = len(t.Rows)
+		}
+		b.WriteString(formatTableRows(t.Columns, t.Rows[:n]))
+		b.WriteString("\n")
+	}
+	b.WriteString("ЗАПРОСЫ К ТАБЛИЦАМ:\n")
+	b.WriteString("Для вычислений по таблицам (суммы, средние, подсчет, группировки, поиск строк) НЕ считай по примерам.\n")
+	b.WriteString("Ответь ТОЛЬКО блоком ```query с одним запросом — он будет выполнен по всем строкам, и ты получишь результат:\n")
+	b.WriteString("```query\nSELECT region, avg(latency) AS avg_latency, count(*) FROM metrics WHERE status = 'ok' GROUP BY region ORDER BY avg_latency DESC LIMIT 10\n```\n")
+	b.WriteString("Поддерживается: SELECT колонки и count/sum/avg/min/max, FROM одна таблица, WHERE с = != < <= > >= LIKE IN, AND/OR/NOT, ")
+	b.WriteString("GROUP BY, ORDER BY [ASC|DESC], LIMIT. Имена колонок с пробелами — в `обратных кавычках`, строки — в 'кавычках'.\n")
+	return b.String()
+}
+
+func quoteIdent(name string) string {
+	for _, r := range name {
+		if !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_') {
+			return "`" + name + "`"
+		}
+	}
+	return name
+}
+
+// formatTableRows выводит строки в виде таблицы Markdown
+func formatTableRows(columns []string, rows [][]string) string {
+	var b strings.Builder
+	b.WriteString("| " + strings.Join(columns, " | ") + " |\n")
+	b.WriteString("|" + strings.Repeat(" --- |", len(columns)) + "\n")
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cell = strings.ReplaceAll(cell, "|", "\\|")
+			cell = strings.ReplaceAll(cell, "\n", " ")
+			if r := []rune(cell); len(r) > tableMaxCellWidth {
+				cell = string(r[:tableMaxCellWidth-3]) + "..."
+			}
+			cells[i] = cell
+		}
+		b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+	return b.String()
+}
+
+// ========== Язык запросов ==========
+
+type queryToken struct {
+	kind  string // ident, number, string, op, punct, keyword
+	value string
+}
+
+var queryKeywords = map[string]bool{
+	"select": true, "from": true, "where": true, "group": true, "by": true, "order": true,
+	"limit": true, "and": true, "or": true, "not": true, "like": true, "in": true,
+	"asc": true, "desc": true, "as": true,
+}
+
+// tokenizeQuery разбивает запрос на лексемы
+func tokenizeQuery(q string) ([]queryToken, error) {
+	var tokens []queryToken
+	runes := []rune(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(q), ";")))
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'' || r == '"' || r == '`':
+			end := i + 1
+			var b strings.Builder
+			for ; end < len(runes); end++ {
+				if runes[end] == r {
+					if end+1 < len(runes) && runes[end+1] == r {
+						b.WriteRune(r) // удвоенная кавычка
+						end++
+						continue
+					}
+					break
+				}
+				b.WriteRune(runes[end])
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("незакрытая кавычка")
+			}
+			kind := "string"
+			if r == '`' {
+				kind = "ident"
+			}
+			tokens = append(tokens, queryToken{kind, b.String()})
+			i = end + 1
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1]) && lastIsOperator(tokens)):
+			end := i + 1
+			for end < len(runes) && (unicode.IsDigit(runes[end]) || runes[end] == '.' || runes[end] == 'e' || runes[end] == 'E') {
+				end++
+			}
+			tokens = append(tokens, queryToken{"number", string(runes[i:end])})
+			i = end
+		case unicode.IsLetter(r) || r == '_':
+			end := i + 1
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_' || runes[end] == '.') {
+				end++
+			}
+			word := string(runes[i:end])
+			if queryKeywords[strings.ToLower(word)] {
+				tokens = append(tokens, queryToken{"keyword", strings.ToLower(word)})
+			} else {
+				tokens = append(tokens, queryToken{"ident", word})
+			}
+			i = end
+		case strings.ContainsRune("<>!=", r):
+			op := string(r)
+			if i+1 < len(runes) && (runes[i+1] == '=' || (r == '<' && runes[i+1] == '>')) {
+				op += string(runes[i+1])
+			}
+			if op == "!" {
+				return nil, fmt.Errorf("неизвестный оператор '!'")
+			}
+			tokens = append(tokens, queryToken{"op", op})
+			i += len(op)
+		case strings.ContainsRune("(),*", r):
+			tokens = append(tokens, queryToken{"punct", string(r)})
+			i++
+		default:
+			return nil, fmt.Errorf("недопустимый символ '%c'", r)
+		}
+	}
+	return tokens, nil
+}
+
+// lastIsOperator — минус после оператора или в начале относится к числу
+func lastIsOperator(tokens []queryToken) bool {
+	if len(tokens) == 0 {
+		return true
+	}
+	last := tokens[len(tokens)-1]
+	return last.kind == "op" || last.kind == "keyword" || (last.kind == "punct" && last.value != ")")
+}
+
+type selectItem struct {
+	agg    string // "", count, sum, avg, min, max
+	column string // "*" для count(*)
+	alias  string
+}
+
+func (s selectItem) name() string {
+	if s.alias != "" {
+		return s.alias
+	}
+	if s.agg != "" {
+		return s.agg + "(" + s.column + ")"
+	}
+	return s.column
+}
+
+type orderItem struct {
+	key  string
+	desc bool
+}
+
+// TableQuery — разобранный запрос
+type TableQuery struct {
+	Table   string
+	items   []selectItem
+	where   queryExpr
+	groupBy []string
+	orderBy []orderItem
+	limit   int
+}
+
+type queryExpr interface {
+	eval(t *RAGTable, row []string) (bool, error)
+}
+
+type andExpr struct{ left, right queryExpr }
+type orExpr struct{ left, right queryExpr }
+type notExpr struct{ inner queryExpr }
+type compareExpr struct {
+	column string
+	op     string
+	values []string
+	like   *regexp.Regexp // шаблон LIKE, компилируется один раз при разборе
+}
+
+func (e andExpr) eval(t *RAGTable, row []string) (bool, error) {
+	l, err := e.left.eval(t, row)
+	if err != nil || !l {
+		return false, err
+	}
+	return e.right.eval(t, row)
+}
+
+func (e orExpr) eval(t *RAGTable, row []string) (bool, error) {
+	l, err := e.left.eval(t, row)
+	if err != nil || l {
+		return l, err
+	}
+	return e.right.eval(t, row)
+}
+
+func (e notExpr) eval(t *RAGTable, row []string) (bool, error) {
+	v, err := e.inner.eval(t, row)
+	return !v, err
+}
+
+func (e compareExpr) eval(t *RAGTable, row []string) (bool, error) {
+	i := t.columnIndex(e.column)
+	if i < 0 {
+		return false, fmt.Errorf("в таблице %s нет колонки '%s' (есть: %s)", t.Name, e.column, strings.Join(t.Columns, ", "))
+	}
+	cell := row[i]
+	switch e.op {
+	case "in":
+		for _, v := range e.values {
+			if compareValues(cell, v) == 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "like":
+		return e.like.MatchString(cell), nil
+	}
+
+	// Пустая ячейка не сравнивается с числом
+	if cell == "" && e.op != "=" && e.op != "!=" && e.op != "<>" {
+		return false, nil
+	}
+	c := compareValues(cell, e.values[0])
+	switch e.op {
+	case "=":
+		return c == 0, nil
+	case "!=", "<>":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	}
+	return false, fmt.Errorf("неизвестный оператор %s", e.op)
+}
+
+// compareValues сравнивает как числа, если оба значения числовые, иначе как строки без учета регистра
+func compareValues(a, b string) int {
+	fa, okA := parseNumber(a)
+	fb, okB := parseNumber(b)
+	if okA && okB {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+// likeRegexp переводит шаблон LIKE с % и _ в регулярное выражение без учета регистра
+func likeRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+func (t *RAGTable) columnIndex(name string) int {
+	for i, c := range t.Columns {
+		if c == name {
+			return i
+		}
+	}
+	for i, c := range t.Columns {
+		if strings.EqualFold(c, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() queryToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return queryToken{}
+}
+
+func (p *queryParser) next() queryToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *queryParser) isKeyword(kw string) bool {
+	t := p.peek()
+	return t.kind == "keyword" && t.value == kw
+}
+
+func (p *queryParser) expectKeyword(kw string) error {
+	if !p.isKeyword(kw) {
+		return fmt.Errorf("ожидалось %s, получено '%s'", strings.ToUpper(kw), p.peek().value)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *queryParser) expectPunct(v string) error {
+	t := p.next()
+	if t.kind != "punct" || t.value != v {
+		return fmt.Errorf("ожидалось '%s', получено '%s'", v, t.value)
+	}
+	return nil
+}
+
+func (p *queryParser) ident() (string, error) {
+	t := p.next()
+	if t.kind != "ident" {
+		return "", fmt.Errorf("ожидалось имя колонки, получено '%s'", t.value)
+	}
+	return t.value, nil
+}
+
+// ParseTableQuery разбирает запрос SELECT ... FROM ... [WHERE] [GROUP BY] [ORDER BY] [LIMIT]
+func ParseTableQuery(q string) (*TableQuery, error) {
+	tokens, err := tokenizeQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	query := &TableQuery{limit: tableResultRows}
+
+	if err := p.expectKeyword("select"); err != nil {
+		return nil, err
+	}
+	for {
+		item, err := p.selectItem()
+		if err != nil {
+			return nil, err
+		}
+		query.items = append(query.items, item)
+		if t := p.peek(); t.kind == "punct" && t.value == "," {
+			p.pos++
+			continue
+		}
+		break
+	}
+
+	if err := p.expectKeyword("from"); err != nil {
+		return nil, err
+	}
+	if query.Table, err = p.ident(); err != nil {
+		return nil, err
+	}
+
+	if p.isKeyword("where") {
+		p.pos++
+		if query.where, err = p.orExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.isKeyword("group") {
+		p.pos++
+		if err := p.expectKeyword("by"); err != nil {
+			return nil, err
+		}
+		for {
+			col, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			query.groupBy = append(query.groupBy, col)
+			if t := p.peek(); t.kind == "punct" && t.value == "," {
+				p.pos++
+				continue
+			}
+			break
+		}
+	}
+	if p.isKeyword("order") {
+		p.pos++
+		if err := p.expectKeyword("by"); err != nil {
+			return nil, err
+		}
+		for {
+			key, err := p.orderKey()
+			if err != nil {
+				return nil, err
+			}
+			item := orderItem{key: key}
+			if p.isKeyword("desc") {
+				item.desc = true
+				p.pos++
+			} else if p.isKeyword("asc") {
+				p.pos++
+			}
+			query.orderBy = append(query.orderBy, item)
+			if t := p.peek(); t.kind == "punct" && t.value == "," {
+				p.pos++
+				continue
+			}
+			break
+		}
+	}
+	if p.isKeyword("limit") {
+		p.pos++
+		t := p.next()
+		n, err := strconv.Atoi(t.value)
+		if t.kind != "number" || err != nil || n <= 0 {
+			return nil, fmt.Errorf("LIMIT требует положительное число")
+		}
+		if n < query.limit {
+			query.limit = n
+		}
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("лишний текст в запросе: '%s'", p.peek().value)
+	}
+	return query, nil
+}
+
+// orderKey — колонка, псевдоним, агрегат или номер колонки результата
+func (p *queryParser) orderKey() (string, error) {
+	t := p.peek()
+	if t.kind == "number" {
+		p.pos++
+		return "#" + t.value, nil
+	}
+	if t.kind == "ident" && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].value == "(" {
+		item, err := p.selectItem()
+		if err != nil {
+			return "", err
+		}
+		return item.name(), nil
+	}
+	return p.ident()
+}
+
+func (p *queryParser) selectItem() (selectItem, error) {
+	var item selectItem
+	t := p.next()
+	switch {
+	case t.kind == "punct" && t.value == "*":
+		item.column = "*"
+	case t.kind == "ident":
+		if next := p.peek(); next.kind == "punct" && next.value == "(" {
+			agg := strings.ToLower(t.value)
+			if !containsString([]string{"count", "sum", "avg", "min", "max"}, agg) {
+				return item, fmt.Errorf("неизвестная функция %s (доступны count, sum, avg, min, max)", t.value)
+			}
+			p.pos++
+			arg := p.next()
+			switch {
+			case arg.kind == "punct" && arg.value == "*" && agg == "count":
+				item.column = "*"
+			case arg.kind == "ident":
+				item.column = arg.value
+			default:
+				return item, fmt.Errorf("%s() требует имя колонки", agg)
+			}
+			if err := p.expectPunct(")"); err != nil {
+				return item, err
+			}
+			item.agg = agg
+		} else {
+			item.column = t.value
+		}
+	default:
+		return item, fmt.Errorf("ожидалась колонка или функция, получено '%s'", t.value)
+	}
+	if p.isKeyword("as") {
+		p.pos++
+		alias, err := p.ident()
+		if err != nil {
+			return item, err
+		}
+		item.alias = alias
+	}
+	return item, nil
+}
+
+func (p *queryParser) orExpr() (queryExpr, error) {
+	left, err := p.andExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("or") {
+		p.pos++
+		right, err := p.andExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) andExpr() (queryExpr, error) {
+	left, err := p.unaryExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("and") {
+		p.pos++
+		right, err := p.unaryExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) unaryExpr() (queryExpr, error) {
+	if p.isKeyword("not") {
+		p.pos++
+		inner, err := p.unaryExpr()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{inner}, nil
+	}
+	if t := p.peek(); t.kind == "punct" && t.value == "(" {
+		p.pos++
+		e, err := p.orExpr()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expectPunct(")")
+	}
+	return p.comparison()
+}
+
+func (p *queryParser) literal() (string, error) {
+	t := p.next()
+	if t.kind != "string" && t.kind != "number" {
+		return "", fmt.Errorf("ожидалось значение, получено '%s'", t.value)
+	}
+	return t.value, nil
+}
+
+func (p *queryParser) comparison() (queryExpr, error) {
+	column, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	negate := false
+	if p.isKeyword("not") {
+		negate = true
+		p.pos++
+	}
+
+	var e compareExpr
+	switch t := p.next(); {
+	case t.kind == "op" && !negate:
+		value, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		e = compareExpr{column: column, op: t.value, values: []string{value}}
+	case t.kind == "keyword" && t.value == "like":
+		value, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		re, err := likeRegexp(value)
+		if err != nil {
+			return nil, fmt.Errorf("неверный шаблон LIKE '%s': %v", value, err)
+		}
+		e = compareExpr{column: column, op: "like", values: []string{value}, like: re}
+	case t.kind == "keyword" && t.value == "in":
+		if err := p.expectPunct("("); err != nil {
+			return nil, err
+		}
+		e = compareExpr{column: column, op: "in"}
+		for {
+			value, err := p.literal()
+			if err != nil {
+				return nil, err
+			}
+			e.values = append(e.values, value)
+			if next := p.next(); next.value == ")" {
+				break
+			} else if next.value != "," {
+				return nil, fmt.Errorf("ожидалось ',' или ')' в IN")
+			}
+		}
+	default:
+		return nil, fmt.Errorf("ожидался оператор сравнения после %s, получено '%s'", column, t.value)
+	}
+	if negate {
+		return notExpr{e}, nil
+	}
+	return e, nil
+}
+
+// TableResult — результат запроса
+type TableResult struct {
+	Columns []string
+	Rows    [][]string
+	Total   int // строк до LIMIT
+}
+
+// Execute выполняет запрос по таблице
+func (q *TableQuery) Execute(t *RAGTable) (*TableResult, error) {
+	// Проверяем колонки заранее, чтобы модель получила понятную ошибку
+	check := func(col string) error {
+		if col != "*" && t.columnIndex(col) < 0 {
+			return fmt.Errorf("в таблице %s нет колонки '%s' (есть: %s)", t.Name, col, strings.Join(t.Columns, ", "))
+		}
+		return nil
+	}
+	grouped := len(q.groupBy) > 0
+	for _, item := range q.items {
+		if err := check(item.column); err != nil {
+			return nil, err
+		}
+		if item.agg != "" {
+			grouped = true
+		}
+	}
+	for _, col := range q.groupBy {
+		if err := check(col); err != nil {
+			return nil, err
+		}
+	}
+
+	var rows [][]string
+	for _, row := range t.Rows {
+		if q.where != nil {
+			ok, err := q.where.eval(t, row)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	result := &TableResult{}
+	if grouped {
+		for _, item := range q.items {
+			if item.agg == "" && item.column != "*" && !containsFold(q.groupBy, item.column) {
+				return nil, fmt.Errorf("колонка %s должна быть в GROUP BY или внутри агрегатной функции", item.column)
+			}
+			if item.agg == "" && item.column == "*" {
+				return nil, fmt.Errorf("SELECT * нельзя использовать с GROUP BY и агрегатами")
+			}
+		}
+		result.Rows = q.aggregate(t, rows)
+	} else {
+		for _, row := range rows {
+			var out []string
+			for _, item := range q.items {
+				if item.column == "*" {
+					out = append(out, row...)
+				} else {
+					out = append(out, row[t.columnIndex(item.column)])
+				}
+			}
+			result.Rows = append(result.Rows, out)
+		}
+	}
+	for _, item := range q.items {
+		if item.column == "*" && item.agg == "" {
+			result.Columns = append(result.Columns, t.Columns...)
+		} else {
+			result.Columns = append(result.Columns, item.name())
+		}
+	}
+
+	if err := q.sort(result); err != nil {
+		return nil, err
+	}
+	result.Total = len(result.Rows)
+	if len(result.Rows) > q.limit {
+		result.Rows = result.Rows[:q.limit]
+	}
+	return result, nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// aggregate группирует строки и считает агрегаты; группы идут в порядке появления
+func (q *TableQuery) aggregate(t *RAGTable, rows [][]string) [][]string {
+	type group struct {
+		key  []string
+		rows [][]string
+	}
+	var order []string
+	groups := make(map[string]*group)
+	for _, row := range rows {
+		key := make([]string, len(q.groupBy))
+		for i, col := range q.groupBy {
+			key[i] = row[t.columnIndex(col)]
+		}
+		k := strings.Join(key, "\x00")
+		g, ok := groups[k]
+		if !ok {
+			g = &group{key: key}
+			groups[k] = g
+			order = append(order, k)
+		}
+		g.rows = append(g.rows, row)
+	}
+	// Агрегаты без GROUP BY по пустой выборке дают одну строку
+	if len(q.groupBy) == 0 && len(order) == 0 {
+		groups[""] = &group{}
+		order = append(order, "")
+	}
+
+	var out [][]string
+	for _, k := range order {
+		g := groups[k]
+		var row []string
+		for _, item := range q.items {
+			if item.agg == "" {
+				for i, col := range q.groupBy {
+					if strings.EqualFold(col, item.column) {
+						row = append(row, g.key[i])
+						break
+					}
+				}
+				continue
+			}
+			row = append(row, aggregateValues(item, t, g.rows))
+		}
+		out = append(out, row)
+	}
+	return out
+}
+
+// aggregateValues считает агрегат по колонке; sum/avg учитывают только числа
+func aggregateValues(item selectItem, t *RAGTable, rows [][]string) string {
+	if item.agg == "count" && item.column == "*" {
+		return strconv.Itoa(len(rows))
+	}
+	i := t.columnIndex(item.column)
+	count := 0
+	var sum float64
+	var minNum, maxNum float64
+	numeric := 0
+	var minStr, maxStr string
+	for _, row := range rows {
+		cell := row[i]
+		if cell == "" {
+			continue
+		}
+		count++
+		if f, ok := parseNumber(cell); ok {
+			if numeric == 0 || f < minNum {
+				minNum = f
+			}
+			if numeric == 0 || f > maxNum {
+				maxNum = f
+			}
+			sum += f
+			numeric++
+		}
+		if count == 1 || strings.ToLower(cell) < strings.ToLower(minStr) {
+			minStr = cell
+		}
+		if count == 1 || strings.ToLower(cell) > strings.ToLower(maxStr) {
+			maxStr = cell
+		}
+	}
+
+	switch item.agg {
+	case "count":
+		return strconv.Itoa(count)
+	case "sum":
+		return formatNumber(sum)
+	case "avg":
+		if numeric == 0 {
+			return ""
+		}
+		return formatNumber(sum / float64(numeric))
+	case "min":
+		if numeric > 0 && numeric == count {
+			return formatNumber(minNum)
+		}
+		return minStr
+	case "max":
+		if numeric > 0 && numeric == count {
+			return formatNumber(maxNum)
+		}
+		return maxStr
+	}
+	return ""
+}
+
+// sort упорядочивает результат по ORDER BY
+func (q *TableQuery) sort(result *TableResult) error {
+	if len(q.orderBy) == 0 {
+		return nil
+	}
+	indexes := make([]int, len(q.orderBy))
+	for i, o := range q.orderBy {
+		indexes[i] = -1
+		if strings.HasPrefix(o.key, "#") {
+			n, _ := strconv.Atoi(o.key[1:])
+			if n < 1 || n > len(result.Columns) {
+				return fmt.Errorf("ORDER BY %d: в результате %d колонок", n, len(result.Columns))
+			}
+			indexes[i] = n - 1
+			continue
+		}
+		for j, col := range result.Columns {
+			if strings.EqualFold(col, o.key) {
+				indexes[i] = j
+				break
+			}
+		}
+		if indexes[i] < 0 {
+			return fmt.Errorf("ORDER BY %s: такой колонки нет в SELECT", o.key)
+		}
+	}
+	sort.SliceStable(result.Rows, func(a, b int) bool {
+		for i, o := range q.orderBy {
+			c := compareValues(result.Rows[a][indexes[i]], result.Rows[b][indexes[i]])
+			if c == 0 {
+				continue
+			}
+			if o.desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+	return nil
+}
+
+// Format выводит результат для модели и пользователя
+func (r *TableResult) Format() string {
+	var b strings.Builder
+	b.WriteString(formatTableRows(r.Columns, r.Rows))
+	if r.Total > len(r.Rows) {
+		b.WriteString(fmt.Sprintf("(показано %d из %d строк)\n", len(r.Rows), r.Total))
+	} else {
+		b.WriteString(fmt.Sprintf("(строк: %d)\n", r.Total))
+	}
+	return b.String()
+}
+
+// RunTableQuery выполняет запрос по загруженным таблицам
+func (a *Assistant) RunTableQuery(q string) (*TableResult, error) {
+	query, err := ParseTableQuery(q)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка разбора запроса: %v", err)
+	}
+	a.ragMutex.RLock()
+	tables := a.ragTables
+	a.ragMutex.RUnlock()
+
+	var names []string
+	for _, t := range tables {
+		if strings.EqualFold(t.Name, query.Table) {
+			return query.Execute(t)
+		}
+		names = append(names, t.Name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("табличные данные не загружены")
+	}
+	return nil, fmt.Errorf("нет таблицы '%s' (есть: %s)", query.Table, strings.Join(names, ", "))
+}
+
+// GetRAGTables возвращает распознанные таблицы
+func (a *Assistant) GetRAGTables() []*RAGTable {
+	a.ragMutex.RLock()
+	defer a.ragMutex.RUnlock()
+	return a.ragTables
+}
+
+// answerTableQueries выполняет запросы ```query из ответа модели и отправляет ей результат,
+// пока она не даст окончательный ответ (не больше tableQueryRounds раз)
+func (a *Assistant) answerTableQueries(c context.Context, prompt, response string,
+	send func(context.Context, string) (string, error), verbose bool) (string, error) {
+
+	if len(a.GetRAGTables()) == 0 {
+		return response, nil
+	}
+	for round := 0; round < tableQueryRounds; round++ {
+		matches := tableQueryRe.FindAllStringSubmatch(response, -1)
+		if len(matches) == 0 {
+			return response, nil
+		}
+
+		var results bytes.Buffer
+		for _, m := range matches {
+			q := strings.TrimSpace(m[1])
+			if verbose {
+				fmt.Printf("🧮 Запрос к таблице: %s\n", strings.Join(strings.Fields(q), " "))
+			}
+			results.WriteString("Запрос:\n```query\n" + q + "\n```\n")
+			result, err := a.RunTableQuery(q)
+			if err != nil {
+				if verbose {
+					fmt.Printf("⚠️  %v\n", err)
+				}
+				results.WriteString("Ошибка: " + err.Error() + "\n\n")
+				continue
+			}
+			if verbose {
+				fmt.Printf("📊 Результат: %d строк\n", result.Total)
+			}
+			results.WriteString("Результат, вычисленный по всем строкам:\n" + result.Format() + "\n")
+		}
+
+		followUp := prompt + "\n\n=== РЕЗУЛЬТАТЫ ЗАПРОСОВ К ТАБЛИЦАМ ===\n" + results.String() +
+			"Теперь дай окончательный ответ на вопрос пользователя, опираясь на эти результаты. " +
+			"Новый блок ```query пиши, только если запрос завершился ошибкой или данных не хватает.\n"
+		var err error
+		response, err = send(c, followUp)
+		if err != nil {
+			return "", err
+		}
+	}
+	return response, nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSalesCSV = `city,product,qty,price
+Moscow,apple,10,1.5
+Kazan,pear,5,2
+Moscow,pear,3,2
+Omsk,Apple Green,,1
+Kazan,apple,7,1.5
+`
+
+func testSalesTable(t *testing.T) *RAGTable {
+	t.Helper()
+	tables := buildRAGTables([]RAGDocument{{FilePath: "data/sales.csv", Format: "csv", Content: testSalesCSV}})
+	if len(tables) != 1 {
+		t.Fatalf("ожидалась одна таблица, получено %d", len(tables))
+	}
+	return tables[0]
+}
+
+func TestParseTable(t *testing.T) {
+	table := testSalesTable(t)
+	if table.Name != "sales" || table.DocID != 1 {
+		t.Errorf("Name=%q DocID=%d", table.Name, table.DocID)
+	}
+	if want := []string{"city", "product", "qty", "price"}; !reflect.DeepEqual(table.Columns, want) {
+		t.Errorf("Columns=%v, ожидалось %v", table.Columns, want)
+	}
+	if len(table.Rows) != 5 {
+		t.Errorf("строк %d, ожидалось 5", len(table.Rows))
+	}
+
+	semicolon := parseTable(RAGDocument{FilePath: "x.csv", Format: "csv", Content: "a;b\n1;2\n3;4\n"})
+	if semicolon == nil || !reflect.DeepEqual(semicolon.Columns, []string{"a", "b"}) {
+		t.Errorf("разделитель ';' не распознан: %+v", semicolon)
+	}
+}
+
+func TestTableQueryExecute(t *testing.T) {
+	table := testSalesTable(t)
+	tests := []struct {
+		name    string
+		query   string
+		columns []string
+		rows    [][]string
+		total   int
+	}{
+		{
+			name:    "равенство без учёта регистра",
+			query:   "SELECT city, qty FROM sales WHERE product = 'APPLE'",
+			columns: []string{"city", "qty"},
+			rows:    [][]string{{"Moscow", "10"}, {"Kazan", "7"}},
+			total:   2,
+		},
+		{
+			name:    "числовое сравнение, пустая ячейка не участвует",
+			query:   "SELECT city FROM sales WHERE qty < 6",
+			columns: []string{"city"},
+			rows:    [][]string{{"Kazan"}, {"Moscow"}},
+			total:   2,
+		},
+		{
+			name:    "LIKE, IN и NOT",
+			query:   "SELECT product FROM sales WHERE product LIKE 'apple%' AND city NOT IN ('Kazan')",
+			columns: []string{"product"},
+			rows:    [][]string{{"apple"}, {"Apple Green"}},
+			total:   2,
+		},
+		{
+			name:    "OR и скобки",
+			query:   "SELECT city FROM sales WHERE (city = 'Omsk' OR qty >= 10) AND NOT product = 'pear'",
+			columns: []string{"city"},
+			rows:    [][]string{{"Moscow"}, {"Omsk"}},
+			total:   2,
+		},
+		{
+			name:    "GROUP BY в порядке первого появления",
+			query:   "SELECT city, count(*), sum(qty) AS total FROM sales GROUP BY city",
+			columns: []string{"city", "count(*)", "total"},
+			rows:    [][]string{{"Moscow", "2", "13"}, {"Kazan", "2", "12"}, {"Omsk", "1", "0"}},
+			total:   3,
+		},
+		{
+			name:    "avg считает только числа",
+			query:   "SELECT avg(qty), min(price), max(price) FROM sales",
+			columns: []string{"avg(qty)", "min(price)", "max(price)"},
+			rows:    [][]string{{"6.2500", "1", "2"}},
+			total:   1,
+		},
+		{
+			name:    "ORDER BY псевдонима DESC",
+			query:   "SELECT city, sum(qty) AS total FROM sales GROUP BY city ORDER BY total DESC",
+			columns: []string{"city", "total"},
+			rows:    [][]string{{"Moscow", "13"}, {"Kazan", "12"}, {"Omsk", "0"}},
+			total:   3,
+		},
+		{
+			name:    "ORDER BY номера колонки и LIMIT",
+			query:   "SELECT city, qty FROM sales WHERE qty > 0 ORDER BY 2 LIMIT 2;",
+			columns: []string{"city", "qty"},
+			rows:    [][]string{{"Moscow", "3"}, {"Kazan", "5"}},
+			total:   4,
+		},
+		{
+			name:    "ORDER BY нескольких колонок",
+			query:   "SELECT city, product FROM sales ORDER BY city, product DESC",
+			columns: []string{"city", "product"},
+			rows:    [][]string{{"Kazan", "pear"}, {"Kazan", "apple"}, {"Moscow", "pear"}, {"Moscow", "apple"}, {"Omsk", "Apple Green"}},
+			total:   5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := ParseTableQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseTableQuery: %v", err)
+			}
+			res, err := q.Execute(table)
+			if err != nil {
+				t.Fatalf("Execute: %v", err)
+			}
+			if !reflect.DeepEqual(res.Columns, tt.columns) {
+				t.Errorf("Columns=%v, ожидалось %v", res.Columns, tt.columns)
+			}
+			if !reflect.DeepEqual(res.Rows, tt.rows) {
+				t.Errorf("Rows=%v, ожидалось %v", res.Rows, tt.rows)
+			}
+			if res.Total != tt.total {
+				t.Errorf("Total=%d, ожидалось %d", res.Total, tt.total)
+			}
+		})
+	}
+}
+
+func TestTableQueryErrors(t *testing.T) {
+	table := testSalesTable(t)
+	tests := []struct {
+		query string
+		err   string
+	}{
+		{"SELECT city FROM sales LIMIT 0", "LIMIT требует положительное число"},
+		{"SELECT city FROM sales LIMIT x", "LIMIT требует положительное число"},
+		{"SELECT city FROM sales city", "лишний текст в запросе: 'city'"},
+		{"SELECT median(qty) FROM sales", "неизвестная функция median (доступны count, sum, avg, min, max)"},
+		{"SELECT city FROM sales WHERE qty BETWEEN 1", "ожидался оператор сравнения после qty, получено 'BETWEEN'"},
+		{"SELECT city FROM sales WHERE city = 'Omsk", "незакрытая кавычка"},
+		{"SELECT city FROM sales WHERE qty ! 1", "неизвестный оператор '!'"},
+		{"SELECT city FROM sales WHERE qty = 1 ?", "недопустимый символ '?'"},
+		{"SELECT region FROM sales", "в таблице sales нет колонки 'region' (есть: city, product, qty, price)"},
+		{"SELECT city FROM sales WHERE region = 'x'", "в таблице sales нет колонки 'region'"},
+		{"SELECT city, product, count(*) FROM sales GROUP BY city", "колонка product должна быть в GROUP BY или внутри агрегатной функции"},
+		{"SELECT * FROM sales GROUP BY city", "SELECT * нельзя использовать с GROUP BY и агрегатами"},
+		{"SELECT city FROM sales ORDER BY qty", "ORDER BY qty: такой колонки нет в SELECT"},
+		{"SELECT city FROM sales ORDER BY 3", "ORDER BY 3: в результате 1 колонок"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseTableQuery(tt.query)
+			if err == nil {
+				_, err = q.Execute(table)
+			}
+			if err == nil {
+				t.Fatalf("ожидалась ошибка %q", tt.err)
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ошибка %q, ожидалось %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCompareValues(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"10", "9", 1},
+		{"1.5", "1.50", 0},
+		{"apple", "Apple", 0},
+		{"b", "a", 1},
+		{"9", "a", -1},
+	}
+	for _, tt := range tests {
+		if got := compareValues(tt.a, tt.b); sign(got) != tt.want {
+			t.Errorf("compareValues(%q, %q) = %d, ожидалось %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+func TestBuildRAGIndexSkipsTables(t *testing.T) {
+	docs := []RAGDocument{
+		{FilePath: "notes.md", Format: "md", Content: "Выручка по городам описана в таблице sales."},
+		{FilePath: "sales.csv", Format: "csv", Content: testSalesCSV},
+	}
+	tables := buildRAGTables(docs)
+	idx := BuildRAGIndex(docs, tableDocIDs(tables))
+	for _, chunk := range idx.chunks {
+		if chunk.DocID == 2 {
+			t.Fatalf("фрагмент таблицы попал в индекс: %q", chunk.Text)
+		}
+	}
+	if idx.ChunkCount() == 0 {
+		t.Fatal("текстовый документ не проиндексирован")
+	}
+}
@@ -148,6 +148,15 @@ func (t *TerminalReader) ReadLineWithPrompt(prompt string) (string, error) {
     return input, nil
 }
 
+// ReadPassword читает строку без отображения вводимых символов
+func (t *TerminalReader) ReadPassword(prompt string) (string, error) {
+    input, err := t.line.PasswordPrompt(prompt)
+    if err != nil {
+        return "", fmt.Errorf("ошибка ввода: %w", err)
+    }
+    return input, nil
+}
+
 // Close освобождает ресурсы терминала
 func (t *TerminalReader) Close() {
 	// Опционально: сохранение истории в файл при выходе
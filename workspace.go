@@ -0,0 +1,173 @@
+// workspace.go
+// Границы рабочего пространства: все чтения и записи файлов по путям из запросов и
+// ответов модели проходят через одну проверку. Разрешены текущая директория и корни
+// из workspace_allow; символические ссылки раскрываются до проверки
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const maxSymlinkDepth = 40
+
+// Workspace — политика путей рабочего пространства
+type Workspace struct {
+	config *Config
+}
+
+// NewWorkspace создает политику; config может быть nil (только текущая директория)
+func NewWorkspace(config *Config) *Workspace {
+	return &Workspace{config: config}
+}
+
+// WorkspaceError — путь вне разрешенных корней
+type WorkspaceError struct {
+	Path     string // путь, как его указала модель или пользователь
+	Resolved string // куда ведет путь, если его увела символическая ссылка
+	Roots    []string
+}
+
+func (e *WorkspaceError) Error() string {
+	msg := fmt.Sprintf("путь '%s' вне рабочего пространства %s", e.Path, strings.Join(e.Roots, ", "))
+	if e.Resolved != "" {
+		msg += fmt.Sprintf(" (указывает на %s)", e.Resolved)
+	}
+	return msg + "; разрешить другие корни: :set workspace_allow <путь,путь>"
+}
+
+// AllowedRoots возвращает дополнительные корни из workspace_allow
+func (w *Workspace) AllowedRoots() []string {
+	if w == nil || w.config == nil {
+		return nil
+	}
+	value, _ := w.config.Get("workspace_allow")
+	s, _ := value.(string)
+	var roots []string
+	for _, r := range strings.Split(s, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			roots = append(roots, expandHome(r))
+		}
+	}
+	return roots
+}
+
+// Roots возвращает все разрешенные корни: текущую директорию и workspace_allow
+func (w *Workspace) Roots() ([]string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("не удалось получить текущую директорию: %v", err)
+	}
+	return append([]string{cwd}, w.AllowedRoots()...), nil
+}
+
+// Resolve проверяет путь и возвращает его абсолютную форму. Относительные пути берутся от
+// текущей директории, "~/" раскрывается; путь (и ссылки в нем) должен вести внутрь одного из корней
+func (w *Workspace) Resolve(path string) (string, error) {
+	if strings.TrimSpace(path) == "" {
+		return "", fmt.Errorf("пустой путь")
+	}
+	roots, err := w.Roots()
+	if err != nil {
+		return "", err
+	}
+
+	full := expandHome(path)
+	if !filepath.IsAbs(full) {
+		full = filepath.Join(roots[0], full)
+	}
+	full = filepath.Clean(full)
+
+	resolved, err := resolveSymlinks(full)
+	if err != nil {
+		return "", fmt.Errorf("не удалось проверить путь '%s': %v", path, err)
+	}
+	for _, root := range roots {
+		if realRoot, err := resolveSymlinks(filepath.Clean(root)); err == nil && pathWithin(realRoot, resolved) {
+			return full, nil
+		}
+	}
+	e := &WorkspaceError{Path: path, Roots: roots}
+	if resolved != full {
+		e.Resolved = resolved // путь уводит наружу через символическую ссылку
+	}
+	return "", e
+}
+
+// pathWithin сообщает, лежит ли path внутри root (или совпадает с ним)
+func pathWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || filepath.IsLocal(rel)
+}
+
+// resolveSymlinks раскрывает ссылки в существующей части пути; несуществующий хвост
+// присоединяется как есть. Висячая ссылка раскрывается по её цели, чтобы запись через
+// нее не вышла за пределы корня
+func resolveSymlinks(path string) (string, error) {
+	rest := ""
+	for depth := 0; ; {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		if info, lerr := os.Lstat(path); lerr == nil && info.Mode()&os.ModeSymlink != 0 {
+			if depth++; depth > maxSymlinkDepth {
+				return "", fmt.Errorf("слишком много символических ссылок")
+			}
+			target, err := os.Readlink(path)
+			if err != nil {
+				return "", err
+			}
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(path), target)
+			}
+			path = filepath.Clean(target)
+			continue
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(path, rest), nil
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
+
+// FilterCodeFiles убирает файлы с путями вне рабочего пространства и сообщает о каждом
+func (w *Workspace) FilterCodeFiles(files []CodeFile) []CodeFile {
+	var allowed []CodeFile
+	for _, f := range files {
+		if _, err := w.Resolve(f.Path); err != nil {
+			fmt.Printf("⛔ Файл %s не будет записан: %v\n", f.Path, err)
+			continue
+		}
+		allowed = append(allowed, f)
+	}
+	return allowed
+}
+
+// WriteFile записывает файл внутри рабочего пространства, создавая директории
+func (w *Workspace) WriteFile(path string, data []byte) error {
+	full, err := w.Resolve(path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		return fmt.Errorf("ошибка создания директории %s: %v", filepath.Dir(full), err)
+	}
+	if err := os.WriteFile(full, data, 0644); err != nil {
+		return fmt.Errorf("ошибка записи файла %s: %v", path, err)
+	}
+	return nil
+}